@@ -467,7 +467,7 @@ type SourceMaterial struct {
 	FileType   FileType `json:"fileType,omitempty"`
 	Name       string   `json:"name,omitempty"`
 	Status     int      `json:"status,omitempty"`
-	CreateTime string   `json:"createTime,omitempty"`
+	CreateTime DateTime `json:"createTime,omitzero"`
 }
 
 type ImgRel struct {
@@ -490,8 +490,8 @@ type Ad struct {
 	BusinessType int      `json:"businessType"`
 	Duration     int      `json:"duration"`
 	Status       int      `json:"status"`
-	CreateTime   string   `json:"createTime"`
-	UpdateTime   string   `json:"updateTime"`
+	CreateTime   DateTime `json:"createTime"`
+	UpdateTime   DateTime `json:"updateTime"`
 	ImgRelList   []ImgRel `json:"imgRelList"`
 	VmList       []Vm     `json:"vmList"`
 }
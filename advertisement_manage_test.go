@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"resty.dev/v3"
@@ -33,6 +34,10 @@ func (m *MockClient) GetRestyClient() *resty.Client {
 	return m.RestyClient
 }
 
+func (m *MockClient) Location() *time.Location {
+	return PlatformLocation
+}
+
 // RoundTripFunc .
 type RoundTripFunc func(req *http.Request) (*http.Response, error)
 
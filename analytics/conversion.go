@@ -0,0 +1,296 @@
+package analytics
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// ConversionQuery selects the period, machines and bucket size of a conversion report
+type ConversionQuery struct {
+	Query
+	// Field is the bucket size; defaults to hours. Day and month buckets are cut in the query's time
+	// zone, so keep it at the platform timezone for those to line up with the platform's counts.
+	Field aifinitsdk.PeopleFlowField
+}
+
+func (q ConversionQuery) field() aifinitsdk.PeopleFlowField {
+	if q.Field == "" {
+		return aifinitsdk.PeopleFlowByHour
+	}
+	return q.Field
+}
+
+func (q ConversionQuery) validate() error {
+	if q.Range.From.IsZero() || q.Range.To.IsZero() {
+		return errors.New("conversion needs a range with both bounds")
+	}
+	if len(q.Machines) == 0 {
+		return errors.New("conversion needs at least one machine")
+	}
+	if err := q.Range.Validate(); err != nil {
+		return err
+	}
+	return q.Field.Validate()
+}
+
+// ConversionStats relate visitors to sales
+type ConversionStats struct {
+	Visitors int              `json:"visitors"`
+	Orders   int              `json:"orders"`
+	Units    int64            `json:"units"`
+	Revenue  aifinitsdk.Money `json:"revenue"`
+	// ConversionRate is orders per visitor, 0 without visitors
+	ConversionRate float64 `json:"conversionRate"`
+	// RevenuePerVisitor is 0 without visitors
+	RevenuePerVisitor aifinitsdk.Money `json:"revenuePerVisitor"`
+}
+
+func (s *ConversionStats) add(other ConversionStats) {
+	s.Visitors += other.Visitors
+	s.Orders += other.Orders
+	s.Units += other.Units
+	s.Revenue.Minor += other.Revenue.Minor
+}
+
+// finish sets the currency and derives the rates
+func (s *ConversionStats) finish(currency string) {
+	s.Revenue.Currency = currency
+	s.RevenuePerVisitor = average(s.Revenue, s.Visitors)
+	s.ConversionRate = 0
+	if s.Visitors > 0 {
+		s.ConversionRate = float64(s.Orders) / float64(s.Visitors)
+	}
+}
+
+// ConversionBucket is the conversion of one machine in one bucket
+type ConversionBucket struct {
+	Start  time.Time `json:"start"`
+	VmCode string    `json:"vmCode"`
+	ConversionStats
+}
+
+// ConversionReport is conversion per machine and bucket, by bucket then machine
+type ConversionReport struct {
+	Field   aifinitsdk.PeopleFlowField `json:"field"`
+	Buckets []ConversionBucket         `json:"buckets"`
+	Total   ConversionStats            `json:"total"`
+}
+
+// ConversionTrend compares a period with the one of the same length right before it
+type ConversionTrend struct {
+	Current  ConversionStats `json:"current"`
+	Previous ConversionStats `json:"previous"`
+	// Changes are relative, 0.1 is a 10% rise; they are 0 when the previous value is 0
+	VisitorsChange float64 `json:"visitorsChange"`
+	OrdersChange   float64 `json:"ordersChange"`
+	RevenueChange  float64 `json:"revenueChange"`
+	// Deltas are absolute differences
+	ConversionRateDelta    float64          `json:"conversionRateDelta"`
+	RevenuePerVisitorDelta aifinitsdk.Money `json:"revenuePerVisitorDelta"`
+}
+
+// CampaignConversion is the conversion while a promotion played; PromotionId 0 covers the time no
+// recorded promotion played
+type CampaignConversion struct {
+	PromotionId int    `json:"promotionId"`
+	Name        string `json:"name,omitempty"`
+	Machines    int    `json:"machines"`
+	Buckets     int    `json:"buckets"`
+	ConversionStats
+}
+
+// CampaignComparison are campaigns by conversion rate, highest first
+type CampaignComparison []CampaignConversion
+
+// ConversionAnalyzer joins the platform's people flow with the orders in an engine
+type ConversionAnalyzer struct {
+	Engine  *Engine
+	Devices aifinitsdk.VendingMachineManageClient
+}
+
+// NewConversionAnalyzer creates a conversion analyzer over the engine's orders
+func NewConversionAnalyzer(engine *Engine, devices aifinitsdk.VendingMachineManageClient) *ConversionAnalyzer {
+	return &ConversionAnalyzer{Engine: engine, Devices: devices}
+}
+
+type bucketKey struct {
+	start  int64 // unix milliseconds
+	vmCode string
+}
+
+// Report fetches people flow for the query's machines and aligns it with their orders per bucket.
+// The orders must have been ingested into the engine beforehand.
+func (a *ConversionAnalyzer) Report(q ConversionQuery) (*ConversionReport, error) {
+	if err := q.validate(); err != nil {
+		return nil, aifinitsdk.NewAinfinitError(err)
+	}
+	field, location := q.field(), q.location()
+
+	buckets := make(map[bucketKey]*ConversionStats)
+	bucket := func(k bucketKey) *ConversionStats {
+		stats, ok := buckets[k]
+		if !ok {
+			stats = &ConversionStats{}
+			buckets[k] = stats
+		}
+		return stats
+	}
+
+	for _, machine := range q.Machines {
+		request := (&aifinitsdk.DevicePeopleFlowRequest{Field: field, Codes: []string{machine}}).SetRange(q.Range)
+		response, err := a.Devices.PeopleFlow(request, machine)
+		if err != nil {
+			return nil, err
+		}
+		for _, flow := range response.Result {
+			at, err := flow.Time()
+			if err != nil {
+				return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("people flow of %s: %w", machine, err))
+			}
+			vmCode := cmp.Or(flow.Code, machine)
+			bucket(bucketKey{field.Truncate(at.In(location)).UnixMilli(), vmCode}).Visitors += flow.VisitorCount
+		}
+	}
+
+	orders := make(map[bucketKey]map[string]bool)
+	a.Engine.scan(q.Query, func(i int, at time.Time) {
+		k := bucketKey{field.Truncate(at).UnixMilli(), a.Engine.columns.VmCode[i]}
+		stats := bucket(k)
+		if orders[k] == nil {
+			orders[k] = make(map[string]bool)
+		}
+		if code := a.Engine.columns.OrderCode[i]; !orders[k][code] {
+			orders[k][code] = true
+			stats.Orders++
+		}
+		stats.Units += a.Engine.columns.Count[i]
+		stats.Revenue.Minor += a.Engine.columns.Amount[i]
+	})
+
+	currency := a.Engine.currency()
+	report := &ConversionReport{Field: field, Buckets: make([]ConversionBucket, 0, len(buckets))}
+	for k, stats := range buckets {
+		stats.finish(currency)
+		report.Total.add(*stats)
+		report.Buckets = append(report.Buckets, ConversionBucket{Start: time.UnixMilli(k.start).In(location), VmCode: k.vmCode, ConversionStats: *stats})
+	}
+	report.Total.finish(currency)
+	slices.SortFunc(report.Buckets, func(a, b ConversionBucket) int {
+		return cmp.Or(a.Start.Compare(b.Start), cmp.Compare(a.VmCode, b.VmCode))
+	})
+	return report, nil
+}
+
+// Trend compares the query's period with the period of the same length before it
+func (a *ConversionAnalyzer) Trend(q ConversionQuery) (*ConversionTrend, error) {
+	current, err := a.Report(q)
+	if err != nil {
+		return nil, err
+	}
+	previousQuery := q
+	length := q.Range.To.Sub(q.Range.From) + time.Millisecond
+	previousQuery.Range = aifinitsdk.TimeRange{From: q.Range.From.Add(-length), To: q.Range.From.Add(-time.Millisecond)}
+	previous, err := a.Report(previousQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	trend := &ConversionTrend{
+		Current:             current.Total,
+		Previous:            previous.Total,
+		VisitorsChange:      change(float64(current.Total.Visitors), float64(previous.Total.Visitors)),
+		OrdersChange:        change(float64(current.Total.Orders), float64(previous.Total.Orders)),
+		RevenueChange:       change(float64(current.Total.Revenue.Minor), float64(previous.Total.Revenue.Minor)),
+		ConversionRateDelta: current.Total.ConversionRate - previous.Total.ConversionRate,
+	}
+	trend.RevenuePerVisitorDelta, err = current.Total.RevenuePerVisitor.Sub(previous.Total.RevenuePerVisitor)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(err)
+	}
+	return trend, nil
+}
+
+// Campaigns compares conversion while each recorded promotion played. Buckets are attributed to
+// the promotion playing at their start, so hourly buckets give the sharpest split.
+func (a *ConversionAnalyzer) Campaigns(q ConversionQuery, history *PromotionHistory) (CampaignComparison, error) {
+	report, err := a.Report(q)
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := make(map[int]*CampaignConversion)
+	machines := make(map[int]map[string]bool)
+	for _, bucket := range report.Buckets {
+		period, _ := history.Active(bucket.VmCode, bucket.Start)
+		campaign, ok := campaigns[period.PromotionId]
+		if !ok {
+			campaign = &CampaignConversion{PromotionId: period.PromotionId, Name: period.Name}
+			campaigns[period.PromotionId] = campaign
+			machines[period.PromotionId] = make(map[string]bool)
+		}
+		machines[period.PromotionId][bucket.VmCode] = true
+		campaign.Buckets++
+		campaign.add(bucket.ConversionStats)
+	}
+
+	currency := a.Engine.currency()
+	result := make(CampaignComparison, 0, len(campaigns))
+	for id, campaign := range campaigns {
+		campaign.Machines = len(machines[id])
+		campaign.finish(currency)
+		result = append(result, *campaign)
+	}
+	slices.SortFunc(result, func(a, b CampaignConversion) int {
+		return cmp.Or(cmp.Compare(b.ConversionRate, a.ConversionRate), cmp.Compare(a.PromotionId, b.PromotionId))
+	})
+	return result, nil
+}
+
+// change is the relative change from previous to current, 0 when previous is 0
+func change(current, previous float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return (current - previous) / previous
+}
+
+func (r *ConversionReport) Header() []string {
+	return []string{"start", "vm_code", "visitors", "orders", "units", "revenue", "conversion_rate", "revenue_per_visitor"}
+}
+
+func (r *ConversionReport) Records() [][]string {
+	records := make([][]string, 0, len(r.Buckets))
+	for _, bucket := range r.Buckets {
+		records = append(records, append([]string{bucket.Start.Format(time.RFC3339), bucket.VmCode}, bucket.ConversionStats.record()...))
+	}
+	return records
+}
+
+func (c CampaignComparison) Header() []string {
+	return []string{"promotion_id", "name", "machines", "buckets", "visitors", "orders", "units", "revenue", "conversion_rate", "revenue_per_visitor"}
+}
+
+func (c CampaignComparison) Records() [][]string {
+	records := make([][]string, 0, len(c))
+	for _, campaign := range c {
+		records = append(records, append([]string{strconv.Itoa(campaign.PromotionId), campaign.Name, strconv.Itoa(campaign.Machines), strconv.Itoa(campaign.Buckets)}, campaign.ConversionStats.record()...))
+	}
+	return records
+}
+
+func (s ConversionStats) record() []string {
+	return []string{
+		strconv.Itoa(s.Visitors),
+		strconv.Itoa(s.Orders),
+		strconv.FormatInt(s.Units, 10),
+		s.Revenue.Decimal(),
+		strconv.FormatFloat(s.ConversionRate, 'f', 4, 64),
+		s.RevenuePerVisitor.Decimal(),
+	}
+}
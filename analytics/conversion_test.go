@@ -0,0 +1,144 @@
+package analytics
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+type fakePeopleFlowClient struct {
+	aifinitsdk.VendingMachineManageClient
+	flows    []aifinitsdk.PeopleFlow
+	requests []aifinitsdk.DevicePeopleFlowRequest
+}
+
+func (f *fakePeopleFlowClient) PeopleFlow(request *aifinitsdk.DevicePeopleFlowRequest, machineCode string) (*aifinitsdk.DevicePeopleFlowResponse, error) {
+	f.requests = append(f.requests, *request)
+	response := &aifinitsdk.DevicePeopleFlowResponse{Status: 200}
+	for _, flow := range f.flows {
+		at, err := flow.Time()
+		if err != nil {
+			return nil, err
+		}
+		if flow.Code == machineCode && !at.Before(request.StartTimeStamp.Time) && !at.After(request.EndTimeStamp.Time) {
+			response.Result = append(response.Result, flow)
+		}
+	}
+	return response, nil
+}
+
+func hourFlow(vmCode string, day, hour, visitors int) aifinitsdk.PeopleFlow {
+	return aifinitsdk.PeopleFlow{Code: vmCode, VisitorCount: visitors, AggregateTime: fmt.Sprintf("2024-05-%02d %02d", day, hour)}
+}
+
+func dayRange(first, last int) aifinitsdk.TimeRange {
+	return aifinitsdk.TimeRange{From: at(first, 0).Add(-30 * time.Minute), To: at(last, 23).Add(29*time.Minute + 59*time.Second)}
+}
+
+func TestConversionAnalyzer_Report(t *testing.T) {
+	devices := &fakePeopleFlowClient{flows: []aifinitsdk.PeopleFlow{
+		hourFlow("VM1", 1, 9, 10),
+		hourFlow("VM1", 1, 18, 4),
+		hourFlow("VM1", 1, 20, 6),
+		hourFlow("VM2", 2, 9, 2),
+	}}
+	analyzer := NewConversionAnalyzer(testEngine(t), devices)
+
+	report, err := analyzer.Report(ConversionQuery{Query: Query{Range: dayRange(1, 2), Machines: []string{"VM1", "VM2"}}})
+	require.NoError(t, err)
+	assert.Equal(t, aifinitsdk.PeopleFlowByHour, devices.requests[0].Field)
+	require.Len(t, report.Buckets, 4)
+
+	first := report.Buckets[0]
+	assert.Equal(t, "VM1", first.VmCode)
+	assert.True(t, first.Start.Equal(at(1, 9).Add(-30*time.Minute)))
+	assert.Equal(t, 10, first.Visitors)
+	assert.Equal(t, 1, first.Orders)
+	assert.InDelta(t, 0.1, first.ConversionRate, 1e-9)
+	assert.Equal(t, mnt(0.8), first.RevenuePerVisitor)
+
+	// Hours with visitors but no orders are kept
+	assert.Equal(t, 6, report.Buckets[2].Visitors)
+	assert.Zero(t, report.Buckets[2].Orders)
+
+	assert.Equal(t, ConversionStats{Visitors: 22, Orders: 3, Units: 7, Revenue: mnt(13.5), ConversionRate: 3.0 / 22, RevenuePerVisitor: mnt(0.61)}, report.Total)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, report))
+	assert.Contains(t, buf.String(), "VM1,10,1,3,8,0.1000,0.8\n")
+}
+
+func TestConversionAnalyzer_Report_Days(t *testing.T) {
+	devices := &fakePeopleFlowClient{flows: []aifinitsdk.PeopleFlow{
+		{Code: "VM1", VisitorCount: 20, AggregateTime: "2024-05-01"},
+	}}
+	report, err := NewConversionAnalyzer(testEngine(t), devices).Report(ConversionQuery{
+		Query: Query{Range: dayRange(1, 2), Machines: []string{"VM1"}},
+		Field: aifinitsdk.PeopleFlowByDay,
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Buckets, 1)
+	assert.Equal(t, 20, report.Buckets[0].Visitors)
+	assert.Equal(t, 2, report.Buckets[0].Orders)
+}
+
+func TestConversionAnalyzer_Report_Invalid(t *testing.T) {
+	analyzer := NewConversionAnalyzer(testEngine(t), &fakePeopleFlowClient{})
+	_, err := analyzer.Report(ConversionQuery{Query: Query{Machines: []string{"VM1"}}})
+	assert.ErrorContains(t, err, "both bounds")
+	_, err = analyzer.Report(ConversionQuery{Query: Query{Range: dayRange(1, 1)}})
+	assert.ErrorContains(t, err, "machine")
+	_, err = analyzer.Report(ConversionQuery{Query: Query{Range: dayRange(1, 1), Machines: []string{"VM1"}}, Field: "week"})
+	assert.ErrorContains(t, err, "week")
+}
+
+func TestConversionAnalyzer_Trend(t *testing.T) {
+	devices := &fakePeopleFlowClient{flows: []aifinitsdk.PeopleFlow{
+		hourFlow("VM1", 1, 9, 10),
+		hourFlow("VM1", 1, 18, 10),
+		hourFlow("VM1", 2, 9, 10),
+	}}
+	engine := testEngine(t)
+	require.NoError(t, engine.HandleOrder(callback("O4", "VM1", at(2, 9),
+		aifinitsdk.OrderGoods{ItemCode: "cola", ItemPrice: mnt(2.5), Count: 1},
+	)))
+
+	trend, err := NewConversionAnalyzer(engine, devices).Trend(ConversionQuery{Query: Query{Range: dayRange(2, 2), Machines: []string{"VM1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, 10, trend.Current.Visitors)
+	assert.Equal(t, 20, trend.Previous.Visitors)
+	assert.InDelta(t, -0.5, trend.VisitorsChange, 1e-9)
+	assert.InDelta(t, -0.5, trend.OrdersChange, 1e-9)
+	assert.InDelta(t, 0, trend.ConversionRateDelta, 1e-9)
+	assert.Equal(t, mnt(-0.28), trend.RevenuePerVisitorDelta)
+}
+
+func TestConversionAnalyzer_Campaigns(t *testing.T) {
+	devices := &fakePeopleFlowClient{flows: []aifinitsdk.PeopleFlow{
+		hourFlow("VM1", 1, 9, 10),
+		hourFlow("VM1", 1, 18, 2),
+		hourFlow("VM2", 2, 9, 30),
+	}}
+	history := NewPromotionHistory(nil, nil)
+	require.NoError(t, history.Record("VM1", &aifinitsdk.Ad{Id: 7, Name: "Summer"}, at(1, 12).Time))
+	require.NoError(t, history.Record("VM2", &aifinitsdk.Ad{Id: 7, Name: "Summer"}, at(1, 0).Time))
+
+	campaigns, err := NewConversionAnalyzer(testEngine(t), devices).Campaigns(ConversionQuery{Query: Query{Range: dayRange(1, 2), Machines: []string{"VM1", "VM2"}}}, history)
+	require.NoError(t, err)
+	require.Len(t, campaigns, 2)
+
+	assert.Equal(t, 0, campaigns[0].PromotionId)
+	assert.Equal(t, 1, campaigns[0].Machines)
+	assert.InDelta(t, 0.1, campaigns[0].ConversionRate, 1e-9)
+
+	assert.Equal(t, "Summer", campaigns[1].Name)
+	assert.Equal(t, 2, campaigns[1].Machines)
+	assert.Equal(t, 2, campaigns[1].Buckets)
+	assert.Equal(t, 32, campaigns[1].Visitors)
+	assert.Equal(t, 2, campaigns[1].Orders)
+}
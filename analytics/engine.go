@@ -0,0 +1,232 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Engine ingests settled orders from webhooks or order listings and answers sales queries.
+// Orders are de-duplicated by order code, so the same order may arrive from both sources.
+type Engine struct {
+	Store Store
+	// CompactEvery is how many saves to an Appender store only append the new rows before one
+	// rewrites it whole; defaults to 1000
+	CompactEvery int
+
+	mu      sync.RWMutex
+	columns Columns
+	orders  map[string]bool
+	names   map[string]string // latest name per item code
+
+	// saveMu orders saves, so that each appends the rows the one before left out
+	saveMu   sync.Mutex
+	saved    int // rows in the store
+	appended int // appends since the store was last rewritten
+}
+
+// NewEngine creates an engine. A nil store keeps the data in memory only.
+func NewEngine(store Store) *Engine {
+	if store == nil {
+		store = &MemoryStore{}
+	}
+	return &Engine{Store: store, CompactEvery: 1000, orders: make(map[string]bool), names: make(map[string]string)}
+}
+
+// Load restores the data saved in the store
+func (e *Engine) Load() error {
+	columns, err := e.Store.Load()
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("load analytics: %w", err))
+	}
+	if columns == nil {
+		return nil
+	}
+	if !columns.valid() {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("load analytics: columns have different lengths"))
+	}
+
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.columns = *columns
+	e.saved, e.appended = columns.Len(), 0
+	e.orders = make(map[string]bool)
+	e.names = make(map[string]string)
+	for i, code := range columns.OrderCode {
+		e.orders[code] = true
+		if name := columns.ItemName[i]; name != "" {
+			e.names[columns.ItemCode[i]] = name
+		}
+	}
+	return nil
+}
+
+// HandleOrder ingests an order settlement callback. Orders whose recognition failed are skipped
+// until they are settled by other means.
+func (e *Engine) HandleOrder(order *aifinitsdk.OrderCallbackRequest) error {
+	if order == nil || order.HandleStatus.IsFailure() {
+		return nil
+	}
+	added, err := e.add(order.OrderCode, order.VmCode, order.CloseDoorTime, order.OrderGoodsList)
+	if err != nil || !added {
+		return err
+	}
+	return e.save()
+}
+
+// AddOrders ingests listed orders and reports how many were new
+func (e *Engine) AddOrders(orders ...aifinitsdk.Order) (int, error) {
+	added := 0
+	for _, order := range orders {
+		ok, err := e.addListed(order)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	return added, e.save()
+}
+
+// Import ingests the orders of the machines within the range through ListOrders and reports how
+// many were new. Orders ingested before an error are kept.
+func (e *Engine) Import(ctx context.Context, operations aifinitsdk.OperationClient, machines []string, r aifinitsdk.TimeRange) (int, error) {
+	added := 0
+	var importErr error
+	for _, machine := range machines {
+		for order, err := range aifinitsdk.NewOrderIterator(operations, machine, r).All(ctx) {
+			if err != nil {
+				importErr = err
+				break
+			}
+			ok, err := e.addListed(order)
+			if err != nil {
+				importErr = err
+				break
+			}
+			if ok {
+				added++
+			}
+		}
+		if importErr != nil {
+			break
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{"machines": len(machines), "added": added}).Debug("Imported orders into analytics")
+	if added > 0 {
+		if err := e.save(); err != nil {
+			return added, err
+		}
+	}
+	return added, importErr
+}
+
+func (e *Engine) addListed(order aifinitsdk.Order) (bool, error) {
+	if aifinitsdk.HandleStatus(order.HandleStatus).IsFailure() {
+		return false, nil
+	}
+	goods := make([]aifinitsdk.OrderGoods, 0, len(order.OrderGoodsList))
+	for _, item := range order.OrderGoodsList {
+		goods = append(goods, aifinitsdk.OrderGoods{ItemCode: item.ItemCode, ItemPrice: item.ActualPrice, Count: item.Count})
+	}
+	return e.add(order.OrderCode, order.VmCode, order.CloseDoorTime, goods)
+}
+
+func (e *Engine) add(orderCode, vmCode string, closed aifinitsdk.Millis, goods []aifinitsdk.OrderGoods) (bool, error) {
+	if orderCode == "" || len(goods) == 0 {
+		return false, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.orders[orderCode] {
+		return false, nil
+	}
+
+	// Check every line first so that an order is ingested whole or not at all
+	currency := e.columns.Currency
+	amounts := make([]int64, len(goods))
+	for i, item := range goods {
+		if item.Count <= 0 {
+			continue
+		}
+		if currency == "" {
+			currency = item.ItemPrice.CurrencyCode()
+		} else if item.ItemPrice.CurrencyCode() != currency {
+			return false, aifinitsdk.NewAinfinitError(fmt.Errorf("order %s: %w: %s and %s", orderCode, aifinitsdk.ErrCurrencyMismatch, currency, item.ItemPrice.CurrencyCode()))
+		}
+		amount, err := item.ItemPrice.Mul(int64(item.Count))
+		if err != nil {
+			return false, aifinitsdk.NewAinfinitError(fmt.Errorf("order %s line %s: %w", orderCode, item.ItemCode, err))
+		}
+		amounts[i] = amount.Minor
+	}
+
+	at := closed.Milliseconds()
+	rows := 0
+	for i, item := range goods {
+		if item.Count <= 0 {
+			continue
+		}
+		name := item.ItemName
+		if name == "" {
+			// Listed orders carry no names; reuse one seen in a callback
+			name = e.names[item.ItemCode]
+		} else {
+			e.names[item.ItemCode] = name
+		}
+		e.columns.append(orderCode, vmCode, at, item.ItemCode, name, int64(item.Count), amounts[i])
+		rows++
+	}
+	if rows == 0 {
+		return false, nil
+	}
+	e.columns.Currency = currency
+	e.orders[orderCode] = true
+	return true, nil
+}
+
+// Orders is the number of ingested orders
+func (e *Engine) Orders() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return len(e.orders)
+}
+
+// save stores the rows added since the last save. An Appender store gets just those rows, other
+// stores and every CompactEvery-th save get all of them.
+func (e *Engine) save() error {
+	e.saveMu.Lock()
+	defer e.saveMu.Unlock()
+	e.mu.RLock()
+	snapshot := e.columns
+	e.mu.RUnlock()
+	if snapshot.Len() == e.saved {
+		return nil
+	}
+
+	appender, ok := e.Store.(Appender)
+	var err error
+	if ok && e.appended < e.CompactEvery {
+		err = appender.Append(snapshot.from(e.saved))
+		e.appended++
+	} else {
+		err = e.Store.Save(&snapshot)
+		e.appended = 0
+	}
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("save analytics: %w", err))
+	}
+	e.saved = snapshot.Len()
+	return nil
+}
@@ -0,0 +1,226 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+func mnt(amount float64) aifinitsdk.Money {
+	return aifinitsdk.MoneyFromFloat(amount, aifinitsdk.DefaultCurrency)
+}
+
+func at(day, hour int) aifinitsdk.Millis {
+	return aifinitsdk.MillisOf(time.Date(2024, 5, day, hour, 30, 0, 0, aifinitsdk.PlatformLocation))
+}
+
+func callback(orderCode, vmCode string, closed aifinitsdk.Millis, goods ...aifinitsdk.OrderGoods) *aifinitsdk.OrderCallbackRequest {
+	return &aifinitsdk.OrderCallbackRequest{
+		OrderCode:      orderCode,
+		VmCode:         vmCode,
+		HandleStatus:   aifinitsdk.HandleStatusCloudSuccess,
+		CloseDoorTime:  closed,
+		OrderGoodsList: goods,
+	}
+}
+
+type fakeOrderClient struct {
+	aifinitsdk.OperationClient
+	orders map[string][]aifinitsdk.Order
+	err    error
+}
+
+func (f *fakeOrderClient) ListOrders(request *aifinitsdk.ListOrderRequest, machineCode string) (*aifinitsdk.ListOrderResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	rows := f.orders[machineCode]
+	response := &aifinitsdk.ListOrderResponse{Status: 200}
+	response.Data.Total = len(rows)
+	start := min((request.Page-1)*request.Limit, len(rows))
+	end := min(start+request.Limit, len(rows))
+	response.Data.Rows = rows[start:end]
+	return response, nil
+}
+
+func TestEngine_HandleOrder(t *testing.T) {
+	engine := NewEngine(nil)
+
+	require.NoError(t, engine.HandleOrder(callback("O1", "VM1", at(1, 9),
+		aifinitsdk.OrderGoods{ItemCode: "cola", ItemName: "Cola", ItemPrice: mnt(2.5), Count: 2},
+		aifinitsdk.OrderGoods{ItemCode: "chips", ItemName: "Chips", ItemPrice: mnt(3), Count: 0},
+	)))
+	// Duplicate deliveries and failed recognition are not counted
+	require.NoError(t, engine.HandleOrder(callback("O1", "VM1", at(1, 9),
+		aifinitsdk.OrderGoods{ItemCode: "cola", ItemPrice: mnt(2.5), Count: 2},
+	)))
+	failed := callback("O2", "VM1", at(1, 9), aifinitsdk.OrderGoods{ItemCode: "cola", ItemPrice: mnt(2.5), Count: 1})
+	failed.HandleStatus = aifinitsdk.HandleStatusCloudFailure
+	require.NoError(t, engine.HandleOrder(failed))
+
+	assert.Equal(t, 1, engine.Orders())
+	assert.Equal(t, 1, engine.columns.Len())
+	assert.Equal(t, int64(500), engine.columns.Amount[0])
+}
+
+func TestEngine_HandleOrder_CurrencyMismatch(t *testing.T) {
+	engine := NewEngine(nil)
+	require.NoError(t, engine.HandleOrder(callback("O1", "VM1", at(1, 9),
+		aifinitsdk.OrderGoods{ItemCode: "cola", ItemPrice: mnt(2.5), Count: 1},
+	)))
+
+	err := engine.HandleOrder(callback("O2", "VM1", at(1, 9),
+		aifinitsdk.OrderGoods{ItemCode: "cola", ItemPrice: mnt(2.5), Count: 1},
+		aifinitsdk.OrderGoods{ItemCode: "soda", ItemPrice: aifinitsdk.MoneyFromFloat(1, "USD"), Count: 1},
+	))
+	assert.ErrorIs(t, err, aifinitsdk.ErrCurrencyMismatch)
+	assert.Equal(t, 1, engine.Orders())
+	assert.Equal(t, 1, engine.columns.Len())
+}
+
+func TestEngine_FileStore(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "analytics.json")}
+	engine := NewEngine(store)
+	require.NoError(t, engine.Load())
+	require.NoError(t, engine.HandleOrder(callback("O1", "VM1", at(1, 9),
+		aifinitsdk.OrderGoods{ItemCode: "cola", ItemName: "Cola", ItemPrice: mnt(2.5), Count: 2},
+	)))
+
+	restored := NewEngine(store)
+	require.NoError(t, restored.Load())
+	assert.Equal(t, 1, restored.Orders())
+	assert.Equal(t, engine.columns, restored.columns)
+
+	// Names seen in callbacks are reused for listed orders
+	added, err := restored.AddOrders(aifinitsdk.Order{OrderCode: "O2", VmCode: "VM1", CloseDoorTime: at(2, 9),
+		OrderGoodsList: []aifinitsdk.Goods{{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	assert.Equal(t, "Cola", restored.columns.ItemName[1])
+}
+
+func TestEngine_FileStore_Append(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "analytics.json")}
+	engine := NewEngine(store)
+	engine.CompactEvery = 2
+	require.NoError(t, engine.Load())
+	handle := func(code string) {
+		require.NoError(t, engine.HandleOrder(callback(code, "VM1", at(1, 9),
+			aifinitsdk.OrderGoods{ItemCode: "cola", ItemName: "Cola", ItemPrice: mnt(2.5), Count: 1},
+		)))
+	}
+
+	// New orders are appended to the log, the file is not written until compaction
+	handle("O1")
+	handle("O2")
+	assert.NoFileExists(t, store.Path)
+	log, err := os.ReadFile(store.Path + ".log")
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(log), "\n"))
+	restored := NewEngine(store)
+	require.NoError(t, restored.Load())
+	assert.Equal(t, engine.columns, restored.columns)
+
+	// The third save compacts the log into the file
+	handle("O3")
+	assert.FileExists(t, store.Path)
+	assert.NoFileExists(t, store.Path+".log")
+	handle("O4")
+	restored = NewEngine(store)
+	require.NoError(t, restored.Load())
+	assert.Equal(t, 4, restored.Orders())
+	assert.Equal(t, engine.columns, restored.columns)
+}
+
+// logRow is a one-row batch as the engine appends it
+func logRow(code string) *Columns {
+	var columns Columns
+	columns.append(code, "VM1", 1, "cola", "Cola", 1, 250)
+	return &columns
+}
+
+func TestFileStore_Load(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "analytics.json")}
+
+	// A log left behind by a crash after the file was written is not counted twice
+	require.NoError(t, store.Append(logRow("O1")))
+	require.NoError(t, store.Append(logRow("O2")))
+	log, err := os.ReadFile(store.Path + ".log")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(logRow("O1")))
+	// A crash while appending leaves a partial last line
+	require.NoError(t, os.WriteFile(store.Path+".log", append(log, `{"orderCode":["O`...), 0o644))
+
+	columns, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"O1", "O2"}, columns.OrderCode)
+
+	// The next append starts after the last complete line, not after the partial one
+	require.NoError(t, store.Append(logRow("O3")))
+	columns, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"O1", "O2", "O3"}, columns.OrderCode)
+}
+
+func TestFileStore_AppendAfterCrash(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "analytics.json")}
+
+	// The process dies part way through writing each of the first two records
+	full, err := json.Marshal(logRow("LOST"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(store.Path+".log", full[:len(full)/2], 0o644))
+	require.NoError(t, store.Append(logRow("O1")))
+	log, err := os.ReadFile(store.Path + ".log")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(store.Path+".log", append(log, full[:len(full)-3]...), 0o644))
+
+	for _, code := range []string{"O2", "O3"} {
+		require.NoError(t, store.Append(logRow(code)))
+	}
+	columns, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"O1", "O2", "O3"}, columns.OrderCode)
+}
+
+func TestEngine_Import(t *testing.T) {
+	var orders []aifinitsdk.Order
+	for i := range 60 {
+		orders = append(orders, aifinitsdk.Order{
+			OrderCode:      "O" + string(rune('A'+i/26)) + string(rune('a'+i%26)),
+			CloseDoorTime:  at(1, 9),
+			OrderGoodsList: []aifinitsdk.Goods{{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}},
+		})
+	}
+	client := &fakeOrderClient{orders: map[string][]aifinitsdk.Order{"VM1": orders}}
+	engine := NewEngine(nil)
+
+	added, err := engine.Import(context.Background(), client, []string{"VM1", "VM2"}, aifinitsdk.TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, 60, added)
+	assert.Equal(t, []string{"VM1"}, engine.Machines(Query{}).codes())
+
+	added, err = engine.Import(context.Background(), client, []string{"VM1"}, aifinitsdk.TimeRange{})
+	require.NoError(t, err)
+	assert.Zero(t, added)
+
+	client.err = errors.New("platform unavailable")
+	_, err = engine.Import(context.Background(), client, []string{"VM1"}, aifinitsdk.TimeRange{})
+	assert.EqualError(t, err, "platform unavailable")
+}
+
+func (r MachineRanking) codes() []string {
+	codes := make([]string, 0, len(r))
+	for _, machine := range r {
+		codes = append(codes, machine.VmCode)
+	}
+	return codes
+}
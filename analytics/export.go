@@ -0,0 +1,103 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Table is a report that can be written as CSV
+type Table interface {
+	Header() []string
+	Records() [][]string
+}
+
+// WriteCSV writes a report as CSV with a header row. Amounts are in major units.
+func WriteCSV(w io.Writer, table Table) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(table.Header()); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(table.Records()); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// WriteJSON writes a report as indented JSON
+func WriteJSON(w io.Writer, report any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func (s Summary) Header() []string {
+	return []string{"orders", "units", "revenue", "average_ticket", "average_basket", "currency"}
+}
+
+func (s Summary) Records() [][]string {
+	return [][]string{{
+		strconv.Itoa(s.Orders),
+		strconv.FormatInt(s.Units, 10),
+		s.Revenue.Decimal(),
+		s.AverageTicket.Decimal(),
+		strconv.FormatFloat(s.AverageBasket, 'f', 2, 64),
+		s.Revenue.CurrencyCode(),
+	}}
+}
+
+func (d DailySales) Header() []string {
+	return []string{"day", "vm_code", "orders", "units", "revenue"}
+}
+
+func (d DailySales) Records() [][]string {
+	records := make([][]string, 0, len(d))
+	for _, day := range d {
+		records = append(records, []string{day.Day, day.VmCode, strconv.Itoa(day.Orders), strconv.FormatInt(day.Units, 10), day.Revenue.Decimal()})
+	}
+	return records
+}
+
+func (r ItemRanking) Header() []string {
+	return []string{"rank", "item_code", "item_name", "orders", "units", "revenue"}
+}
+
+func (r ItemRanking) Records() [][]string {
+	records := make([][]string, 0, len(r))
+	for _, item := range r {
+		records = append(records, []string{strconv.Itoa(item.Rank), item.ItemCode, item.ItemName, strconv.Itoa(item.Orders), strconv.FormatInt(item.Units, 10), item.Revenue.Decimal()})
+	}
+	return records
+}
+
+func (r MachineRanking) Header() []string {
+	return []string{"rank", "vm_code", "orders", "units", "revenue", "average_ticket"}
+}
+
+func (r MachineRanking) Records() [][]string {
+	records := make([][]string, 0, len(r))
+	for _, machine := range r {
+		records = append(records, []string{strconv.Itoa(machine.Rank), machine.VmCode, strconv.Itoa(machine.Orders), strconv.FormatInt(machine.Units, 10), machine.Revenue.Decimal(), machine.AverageTicket.Decimal()})
+	}
+	return records
+}
+
+func (h *Heatmap) Header() []string {
+	return []string{"weekday", "hour", "orders", "units", "revenue"}
+}
+
+// Records lists the hours with activity only
+func (h *Heatmap) Records() [][]string {
+	var records [][]string
+	for weekday, hours := range h.Cells {
+		for hour, cell := range hours {
+			if cell.Orders == 0 {
+				continue
+			}
+			records = append(records, []string{time.Weekday(weekday).String(), strconv.Itoa(hour), strconv.Itoa(cell.Orders), strconv.FormatInt(cell.Units, 10), cell.Revenue.Decimal()})
+		}
+	}
+	return records
+}
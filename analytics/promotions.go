@@ -0,0 +1,175 @@
+package analytics
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// PromotionPeriod is a span during which a promotion played on a machine
+type PromotionPeriod struct {
+	VmCode      string    `json:"vmCode"`
+	PromotionId int       `json:"promotionId"`
+	Name        string    `json:"name,omitempty"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to,omitzero"` // zero while the promotion is still playing
+}
+
+// Contains reports whether t falls within the period
+func (p PromotionPeriod) Contains(t time.Time) bool {
+	return !t.Before(p.From) && (p.To.IsZero() || t.Before(p.To))
+}
+
+// PromotionStore persists promotion history between runs
+type PromotionStore interface {
+	Load() ([]PromotionPeriod, error)
+	Save(periods []PromotionPeriod) error
+}
+
+// MemoryPromotionStore keeps promotion history in memory only
+type MemoryPromotionStore struct {
+	mu      sync.Mutex
+	periods []PromotionPeriod
+}
+
+func (s *MemoryPromotionStore) Load() ([]PromotionPeriod, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.periods), nil
+}
+
+func (s *MemoryPromotionStore) Save(periods []PromotionPeriod) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.periods = slices.Clone(periods)
+	return nil
+}
+
+// FilePromotionStore keeps promotion history as a JSON file
+type FilePromotionStore struct {
+	Path string
+}
+
+func (s *FilePromotionStore) Load() ([]PromotionPeriod, error) {
+	var periods []PromotionPeriod
+	_, err := readJSONFile(s.Path, &periods)
+	return periods, err
+}
+
+func (s *FilePromotionStore) Save(periods []PromotionPeriod) error {
+	return writeJSONFile(s.Path, periods)
+}
+
+// PromotionHistory records which promotion each machine plays over time. The platform only reports
+// the current promotion, so Poll has to run periodically; a change is dated at the poll noticing it.
+type PromotionHistory struct {
+	Ads   aifinitsdk.AdvertisementManageClient
+	Store PromotionStore
+
+	mu      sync.RWMutex
+	periods []PromotionPeriod
+	now     func() time.Time
+}
+
+// NewPromotionHistory creates a promotion history. A nil store keeps the history in memory only.
+func NewPromotionHistory(ads aifinitsdk.AdvertisementManageClient, store PromotionStore) *PromotionHistory {
+	if store == nil {
+		store = &MemoryPromotionStore{}
+	}
+	return &PromotionHistory{Ads: ads, Store: store, now: time.Now}
+}
+
+// Load restores the history saved in the store
+func (h *PromotionHistory) Load() error {
+	periods, err := h.Store.Load()
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("load promotion history: %w", err))
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.periods = periods
+	return nil
+}
+
+// Poll asks each machine for its current promotion and records changes. Machines that fail are
+// skipped; the first error is returned after the others are polled.
+func (h *PromotionHistory) Poll(machines []string) error {
+	var firstErr error
+	for _, machine := range machines {
+		response, err := h.Ads.GetVmPromotion(machine)
+		if err != nil {
+			logrus.WithError(err).WithField("vmCode", machine).Debug("Failed to poll vm promotion")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if err := h.Record(machine, response.Data, h.now()); err != nil {
+			return err
+		}
+	}
+	return firstErr
+}
+
+// Record notes that the machine plays the promotion, or none when ad is nil, from at onwards
+func (h *PromotionHistory) Record(vmCode string, ad *aifinitsdk.Ad, at time.Time) error {
+	h.mu.Lock()
+	changed := h.record(vmCode, ad, at)
+	snapshot := slices.Clone(h.periods)
+	h.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	if err := h.Store.Save(snapshot); err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("save promotion history: %w", err))
+	}
+	return nil
+}
+
+func (h *PromotionHistory) record(vmCode string, ad *aifinitsdk.Ad, at time.Time) bool {
+	open := -1
+	for i, period := range h.periods {
+		if period.VmCode == vmCode && period.To.IsZero() {
+			open = i
+		}
+	}
+	if open >= 0 {
+		if ad != nil && h.periods[open].PromotionId == ad.Id {
+			return false
+		}
+		h.periods[open].To = at
+	}
+	if ad != nil {
+		h.periods = append(h.periods, PromotionPeriod{VmCode: vmCode, PromotionId: ad.Id, Name: ad.Name, From: at})
+	}
+	return open >= 0 || ad != nil
+}
+
+// Periods returns the recorded periods of the machines, all machines when none are given
+func (h *PromotionHistory) Periods(machines ...string) []PromotionPeriod {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var periods []PromotionPeriod
+	for _, period := range h.periods {
+		if len(machines) == 0 || slices.Contains(machines, period.VmCode) {
+			periods = append(periods, period)
+		}
+	}
+	return periods
+}
+
+// Active returns the promotion the machine played at t
+func (h *PromotionHistory) Active(vmCode string, t time.Time) (PromotionPeriod, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, period := range h.periods {
+		if period.VmCode == vmCode && period.Contains(t) {
+			return period, true
+		}
+	}
+	return PromotionPeriod{}, false
+}
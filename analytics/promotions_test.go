@@ -0,0 +1,59 @@
+package analytics
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+type fakePromotionClient struct {
+	aifinitsdk.AdvertisementManageClient
+	current map[string]*aifinitsdk.Ad
+}
+
+func (f *fakePromotionClient) GetVmPromotion(vmCode string) (*aifinitsdk.GetVmPromotionResponse, error) {
+	if vmCode == "OFFLINE" {
+		return nil, errors.New("machine offline")
+	}
+	return &aifinitsdk.GetVmPromotionResponse{Status: 200, Data: f.current[vmCode]}, nil
+}
+
+func TestPromotionHistory_Poll(t *testing.T) {
+	ads := &fakePromotionClient{current: map[string]*aifinitsdk.Ad{"VM1": {Id: 1, Name: "Spring"}}}
+	store := &FilePromotionStore{Path: filepath.Join(t.TempDir(), "promotions.json")}
+	history := NewPromotionHistory(ads, store)
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	history.now = func() time.Time { return now }
+
+	require.NoError(t, history.Poll([]string{"VM1", "VM2"}))
+	now = now.Add(time.Hour)
+	require.NoError(t, history.Poll([]string{"VM1"}))
+	assert.Len(t, history.Periods(), 1)
+
+	ads.current["VM1"] = &aifinitsdk.Ad{Id: 2, Name: "Summer"}
+	now = now.Add(time.Hour)
+	assert.EqualError(t, history.Poll([]string{"OFFLINE", "VM1"}), "machine offline")
+
+	ads.current["VM1"] = nil
+	now = now.Add(time.Hour)
+	require.NoError(t, history.Poll([]string{"VM1"}))
+
+	restored := NewPromotionHistory(ads, store)
+	require.NoError(t, restored.Load())
+	periods := restored.Periods("VM1")
+	require.Len(t, periods, 2)
+	assert.Equal(t, "Spring", periods[0].Name)
+	assert.True(t, periods[0].To.Equal(periods[1].From))
+	assert.True(t, periods[1].To.Equal(now))
+
+	active, ok := restored.Active("VM1", now.Add(-time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 2, active.PromotionId)
+	_, ok = restored.Active("VM1", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,282 @@
+package analytics
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Query selects the orders a report covers
+type Query struct {
+	// Range is the period, by close door time; zero bounds are open
+	Range aifinitsdk.TimeRange
+	// Machines limits the report to these machines; empty means all
+	Machines []string
+	// Location is the time zone days and hours are counted in; defaults to aifinitsdk.PlatformLocation.
+	// Set it to the Config.Timezone of the client the orders came from.
+	Location *time.Location
+}
+
+func (q Query) location() *time.Location {
+	if q.Location != nil {
+		return q.Location
+	}
+	return aifinitsdk.PlatformLocation
+}
+
+// Summary totals the sales of a period
+type Summary struct {
+	Orders  int              `json:"orders"`
+	Units   int64            `json:"units"`
+	Revenue aifinitsdk.Money `json:"revenue"`
+	// AverageTicket is revenue per order
+	AverageTicket aifinitsdk.Money `json:"averageTicket"`
+	// AverageBasket is units per order
+	AverageBasket float64 `json:"averageBasket"`
+}
+
+// DaySales are the sales of one machine on one day
+type DaySales struct {
+	Day     string           `json:"day"` // YYYY-MM-DD in the query's time zone
+	VmCode  string           `json:"vmCode"`
+	Orders  int              `json:"orders"`
+	Units   int64            `json:"units"`
+	Revenue aifinitsdk.Money `json:"revenue"`
+}
+
+// ItemSales are the sales of one item
+type ItemSales struct {
+	Rank     int              `json:"rank"`
+	ItemCode string           `json:"itemCode"`
+	ItemName string           `json:"itemName,omitempty"`
+	Orders   int              `json:"orders"`
+	Units    int64            `json:"units"`
+	Revenue  aifinitsdk.Money `json:"revenue"`
+}
+
+// MachineSales are the sales of one machine
+type MachineSales struct {
+	Rank          int              `json:"rank"`
+	VmCode        string           `json:"vmCode"`
+	Orders        int              `json:"orders"`
+	Units         int64            `json:"units"`
+	Revenue       aifinitsdk.Money `json:"revenue"`
+	AverageTicket aifinitsdk.Money `json:"averageTicket"`
+}
+
+// HeatCell is the activity of one weekday hour
+type HeatCell struct {
+	Orders  int              `json:"orders"`
+	Units   int64            `json:"units"`
+	Revenue aifinitsdk.Money `json:"revenue"`
+}
+
+// Heatmap is activity by weekday (Sunday first, as time.Weekday) and hour of day
+type Heatmap struct {
+	Cells [7][24]HeatCell `json:"cells"`
+}
+
+type (
+	// DailySales are sales per machine per day, by day then machine
+	DailySales []DaySales
+	// ItemRanking are items by revenue, highest first
+	ItemRanking []ItemSales
+	// MachineRanking are machines by revenue, highest first
+	MachineRanking []MachineSales
+)
+
+// Summary totals the sales of the query
+func (e *Engine) Summary(q Query) Summary {
+	var summary Summary
+	orders := make(map[string]bool)
+	e.scan(q, func(i int, _ time.Time) {
+		orders[e.columns.OrderCode[i]] = true
+		summary.Units += e.columns.Count[i]
+		summary.Revenue.Minor += e.columns.Amount[i]
+	})
+	summary.Orders = len(orders)
+	summary.Revenue.Currency = e.currency()
+	summary.AverageTicket = average(summary.Revenue, summary.Orders)
+	if summary.Orders > 0 {
+		summary.AverageBasket = float64(summary.Units) / float64(summary.Orders)
+	}
+	return summary
+}
+
+// Daily returns revenue per machine per day
+func (e *Engine) Daily(q Query) DailySales {
+	type key struct{ day, vmCode string }
+	days := make(map[key]*DaySales)
+	orders := make(map[key]map[string]bool)
+	e.scan(q, func(i int, at time.Time) {
+		k := key{at.Format(time.DateOnly), e.columns.VmCode[i]}
+		day, ok := days[k]
+		if !ok {
+			day = &DaySales{Day: k.day, VmCode: k.vmCode}
+			days[k] = day
+			orders[k] = make(map[string]bool)
+		}
+		orders[k][e.columns.OrderCode[i]] = true
+		day.Units += e.columns.Count[i]
+		day.Revenue.Minor += e.columns.Amount[i]
+	})
+
+	currency := e.currency()
+	result := make(DailySales, 0, len(days))
+	for k, day := range days {
+		day.Orders = len(orders[k])
+		day.Revenue.Currency = currency
+		result = append(result, *day)
+	}
+	slices.SortFunc(result, func(a, b DaySales) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.VmCode, b.VmCode))
+	})
+	return result
+}
+
+// TopItems ranks items by revenue, then units; a limit of 0 or less returns every item
+func (e *Engine) TopItems(q Query, limit int) ItemRanking {
+	items := make(map[string]*ItemSales)
+	orders := make(map[string]map[string]bool)
+	e.scan(q, func(i int, _ time.Time) {
+		code := e.columns.ItemCode[i]
+		item, ok := items[code]
+		if !ok {
+			item = &ItemSales{ItemCode: code}
+			items[code] = item
+			orders[code] = make(map[string]bool)
+		}
+		if name := e.columns.ItemName[i]; name != "" {
+			item.ItemName = name
+		}
+		orders[code][e.columns.OrderCode[i]] = true
+		item.Units += e.columns.Count[i]
+		item.Revenue.Minor += e.columns.Amount[i]
+	})
+
+	currency := e.currency()
+	result := make(ItemRanking, 0, len(items))
+	for code, item := range items {
+		item.Orders = len(orders[code])
+		item.Revenue.Currency = currency
+		result = append(result, *item)
+	}
+	slices.SortFunc(result, func(a, b ItemSales) int {
+		return cmp.Or(cmp.Compare(b.Revenue.Minor, a.Revenue.Minor), cmp.Compare(b.Units, a.Units), cmp.Compare(a.ItemCode, b.ItemCode))
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	for i := range result {
+		result[i].Rank = i + 1
+	}
+	return result
+}
+
+// Machines ranks machines by revenue, then orders
+func (e *Engine) Machines(q Query) MachineRanking {
+	machines := make(map[string]*MachineSales)
+	orders := make(map[string]map[string]bool)
+	e.scan(q, func(i int, _ time.Time) {
+		code := e.columns.VmCode[i]
+		machine, ok := machines[code]
+		if !ok {
+			machine = &MachineSales{VmCode: code}
+			machines[code] = machine
+			orders[code] = make(map[string]bool)
+		}
+		orders[code][e.columns.OrderCode[i]] = true
+		machine.Units += e.columns.Count[i]
+		machine.Revenue.Minor += e.columns.Amount[i]
+	})
+
+	currency := e.currency()
+	result := make(MachineRanking, 0, len(machines))
+	for code, machine := range machines {
+		machine.Orders = len(orders[code])
+		machine.Revenue.Currency = currency
+		machine.AverageTicket = average(machine.Revenue, machine.Orders)
+		result = append(result, *machine)
+	}
+	slices.SortFunc(result, func(a, b MachineSales) int {
+		return cmp.Or(cmp.Compare(b.Revenue.Minor, a.Revenue.Minor), cmp.Compare(b.Orders, a.Orders), cmp.Compare(a.VmCode, b.VmCode))
+	})
+	for i := range result {
+		result[i].Rank = i + 1
+	}
+	return result
+}
+
+// Heatmap counts activity by weekday and hour in the query's time zone
+func (e *Engine) Heatmap(q Query) *Heatmap {
+	heatmap := &Heatmap{}
+	type key struct {
+		weekday, hour int
+		orderCode     string
+	}
+	counted := make(map[key]bool)
+	e.scan(q, func(i int, at time.Time) {
+		weekday, hour := int(at.Weekday()), at.Hour()
+		cell := &heatmap.Cells[weekday][hour]
+		if k := (key{weekday, hour, e.columns.OrderCode[i]}); !counted[k] {
+			counted[k] = true
+			cell.Orders++
+		}
+		cell.Units += e.columns.Count[i]
+		cell.Revenue.Minor += e.columns.Amount[i]
+	})
+
+	currency := e.currency()
+	for weekday := range heatmap.Cells {
+		for hour := range heatmap.Cells[weekday] {
+			heatmap.Cells[weekday][hour].Revenue.Currency = currency
+		}
+	}
+	return heatmap
+}
+
+// scan calls fn with every row matching the query and its time in the query's zone, under the
+// read lock
+func (e *Engine) scan(q Query, fn func(i int, at time.Time)) {
+	location := q.location()
+	var machines map[string]bool
+	if len(q.Machines) > 0 {
+		machines = make(map[string]bool, len(q.Machines))
+		for _, machine := range q.Machines {
+			machines[machine] = true
+		}
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for i, ms := range e.columns.At {
+		if machines != nil && !machines[e.columns.VmCode[i]] {
+			continue
+		}
+		at := time.UnixMilli(ms).In(location)
+		if !q.Range.Contains(at) {
+			continue
+		}
+		fn(i, at)
+	}
+}
+
+func (e *Engine) currency() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.columns.Currency == "" {
+		return aifinitsdk.DefaultCurrency
+	}
+	return e.columns.Currency
+}
+
+// average divides an amount by a count, rounding half away from zero
+func average(total aifinitsdk.Money, count int) aifinitsdk.Money {
+	if count == 0 {
+		return aifinitsdk.Money{Currency: total.Currency}
+	}
+	average, _ := total.MulRate(1 / float64(count))
+	return average
+}
@@ -0,0 +1,108 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+func testEngine(t *testing.T) *Engine {
+	engine := NewEngine(nil)
+	orders := []*aifinitsdk.OrderCallbackRequest{
+		callback("O1", "VM1", at(1, 9),
+			aifinitsdk.OrderGoods{ItemCode: "cola", ItemName: "Cola", ItemPrice: mnt(2.5), Count: 2},
+			aifinitsdk.OrderGoods{ItemCode: "chips", ItemName: "Chips", ItemPrice: mnt(3), Count: 1},
+		),
+		callback("O2", "VM1", at(1, 18),
+			aifinitsdk.OrderGoods{ItemCode: "cola", ItemName: "Cola", ItemPrice: mnt(2.5), Count: 1},
+		),
+		callback("O3", "VM2", at(2, 9),
+			aifinitsdk.OrderGoods{ItemCode: "water", ItemName: "Water", ItemPrice: mnt(1), Count: 3},
+		),
+	}
+	for _, order := range orders {
+		require.NoError(t, engine.HandleOrder(order))
+	}
+	return engine
+}
+
+func TestEngine_Summary(t *testing.T) {
+	engine := testEngine(t)
+
+	summary := engine.Summary(Query{})
+	assert.Equal(t, 3, summary.Orders)
+	assert.Equal(t, int64(7), summary.Units)
+	assert.Equal(t, mnt(13.5), summary.Revenue)
+	assert.Equal(t, mnt(4.5), summary.AverageTicket)
+	assert.InDelta(t, 7.0/3, summary.AverageBasket, 1e-9)
+
+	day := aifinitsdk.TimeRange{From: at(1, 0).Time, To: at(1, 23).Time}
+	summary = engine.Summary(Query{Range: day, Machines: []string{"VM1"}})
+	assert.Equal(t, 2, summary.Orders)
+	assert.Equal(t, mnt(10.5), summary.Revenue)
+
+	assert.Zero(t, engine.Summary(Query{Machines: []string{"VM3"}}).AverageTicket.Minor)
+}
+
+func TestEngine_Daily(t *testing.T) {
+	daily := testEngine(t).Daily(Query{})
+	require.Len(t, daily, 2)
+	assert.Equal(t, DaySales{Day: "2024-05-01", VmCode: "VM1", Orders: 2, Units: 4, Revenue: mnt(10.5)}, daily[0])
+	assert.Equal(t, DaySales{Day: "2024-05-02", VmCode: "VM2", Orders: 1, Units: 3, Revenue: mnt(3)}, daily[1])
+
+	// Days follow the query's time zone: 09:30 at UTC+8 is still the previous day at UTC-2
+	daily = testEngine(t).Daily(Query{Location: time.FixedZone("UTC-2", -2*60*60)})
+	assert.Equal(t, "2024-04-30", daily[0].Day)
+}
+
+func TestEngine_TopItems(t *testing.T) {
+	top := testEngine(t).TopItems(Query{}, 2)
+	require.Len(t, top, 2)
+	assert.Equal(t, ItemSales{Rank: 1, ItemCode: "cola", ItemName: "Cola", Orders: 2, Units: 3, Revenue: mnt(7.5)}, top[0])
+	assert.Equal(t, "water", top[1].ItemCode)
+}
+
+func TestEngine_Machines(t *testing.T) {
+	machines := testEngine(t).Machines(Query{})
+	require.Len(t, machines, 2)
+	assert.Equal(t, MachineSales{Rank: 1, VmCode: "VM1", Orders: 2, Units: 4, Revenue: mnt(10.5), AverageTicket: mnt(5.25)}, machines[0])
+	assert.Equal(t, 2, machines[1].Rank)
+}
+
+func TestEngine_Heatmap(t *testing.T) {
+	heatmap := testEngine(t).Heatmap(Query{})
+	wednesday := heatmap.Cells[time.Wednesday]
+	assert.Equal(t, HeatCell{Orders: 1, Units: 3, Revenue: mnt(8)}, wednesday[9])
+	assert.Equal(t, 1, wednesday[18].Orders)
+	assert.Equal(t, 1, heatmap.Cells[time.Thursday][9].Orders)
+	assert.Len(t, heatmap.Records(), 3)
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, testEngine(t).TopItems(Query{}, 0)))
+	assert.Equal(t, "rank,item_code,item_name,orders,units,revenue\n"+
+		"1,cola,Cola,2,3,7.5\n"+
+		"2,water,Water,1,3,3\n"+
+		"3,chips,Chips,1,1,3\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteCSV(&buf, testEngine(t).Summary(Query{})))
+	assert.Equal(t, "orders,units,revenue,average_ticket,average_basket,currency\n3,7,13.5,4.5,2.33,MNT\n", buf.String())
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSON(&buf, testEngine(t).Machines(Query{})))
+
+	var decoded []map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(t, decoded, 2)
+	assert.Equal(t, "VM1", decoded[0]["vmCode"])
+	assert.Equal(t, 10.5, decoded[0]["revenue"])
+}
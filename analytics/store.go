@@ -0,0 +1,228 @@
+// Package analytics keeps a local columnar copy of settled orders and answers sales questions
+// over it: revenue, units, basket size, average ticket, top items, hourly heatmaps and machine
+// rankings over arbitrary periods. Joined with the platform's people flow and promotion history it
+// also reports conversion per machine, period and campaign.
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// Columns holds one row per order line, one slice per column. Amounts are in minor units of
+// Currency.
+type Columns struct {
+	Currency  string   `json:"currency,omitempty"`
+	OrderCode []string `json:"orderCode"`
+	VmCode    []string `json:"vmCode"`
+	At        []int64  `json:"at"` // close door time, unix milliseconds
+	ItemCode  []string `json:"itemCode"`
+	ItemName  []string `json:"itemName"`
+	Count     []int64  `json:"count"`
+	Amount    []int64  `json:"amount"` // line amount: unit price times count
+}
+
+// Len is the number of rows
+func (c *Columns) Len() int {
+	return len(c.OrderCode)
+}
+
+func (c *Columns) append(orderCode, vmCode string, at int64, itemCode, itemName string, count, amount int64) {
+	c.OrderCode = append(c.OrderCode, orderCode)
+	c.VmCode = append(c.VmCode, vmCode)
+	c.At = append(c.At, at)
+	c.ItemCode = append(c.ItemCode, itemCode)
+	c.ItemName = append(c.ItemName, itemName)
+	c.Count = append(c.Count, count)
+	c.Amount = append(c.Amount, amount)
+}
+
+// from returns the rows starting at row i
+func (c *Columns) from(i int) *Columns {
+	return &Columns{
+		Currency:  c.Currency,
+		OrderCode: c.OrderCode[i:],
+		VmCode:    c.VmCode[i:],
+		At:        c.At[i:],
+		ItemCode:  c.ItemCode[i:],
+		ItemName:  c.ItemName[i:],
+		Count:     c.Count[i:],
+		Amount:    c.Amount[i:],
+	}
+}
+
+func (c *Columns) valid() bool {
+	n := len(c.OrderCode)
+	return len(c.VmCode) == n && len(c.At) == n && len(c.ItemCode) == n && len(c.ItemName) == n && len(c.Count) == n && len(c.Amount) == n
+}
+
+// Store persists the columns between runs
+type Store interface {
+	Load() (*Columns, error)
+	Save(columns *Columns) error
+}
+
+// Appender is a Store that persists new rows without rewriting the ones stored before
+type Appender interface {
+	Store
+	// Append stores rows that follow the columns last saved, loaded or appended
+	Append(rows *Columns) error
+}
+
+// MemoryStore keeps the columns in memory only
+type MemoryStore struct {
+	mu      sync.Mutex
+	columns *Columns
+}
+
+func (s *MemoryStore) Load() (*Columns, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.columns, nil
+}
+
+func (s *MemoryStore) Save(columns *Columns) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.columns = columns
+	return nil
+}
+
+// FileStore keeps the columns as a JSON file. Appended rows go to a JSON Lines log next to it, the
+// path followed by ".log", which Save folds into the file.
+type FileStore struct {
+	Path string
+}
+
+func (s *FileStore) Load() (*Columns, error) {
+	var columns Columns
+	found, err := readJSONFile(s.Path, &columns)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.logPath())
+	if errors.Is(err, os.ErrNotExist) {
+		if !found {
+			return nil, nil
+		}
+		return &columns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A crash between writing the file and removing the log leaves orders in both
+	saved := make(map[string]bool, len(columns.OrderCode))
+	for _, code := range columns.OrderCode {
+		saved[code] = true
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	// The last line is empty, or cut short by a crash while appending
+	for _, line := range lines[:len(lines)-1] {
+		var rows Columns
+		if err := json.Unmarshal(line, &rows); err != nil {
+			return nil, err
+		}
+		if !rows.valid() {
+			return nil, errors.New("appended rows have different column lengths")
+		}
+		if rows.Currency != "" {
+			columns.Currency = rows.Currency
+		}
+		for i, code := range rows.OrderCode {
+			if !saved[code] {
+				columns.append(code, rows.VmCode[i], rows.At[i], rows.ItemCode[i], rows.ItemName[i], rows.Count[i], rows.Amount[i])
+			}
+		}
+	}
+	return &columns, nil
+}
+
+func (s *FileStore) Save(columns *Columns) error {
+	if err := writeJSONFile(s.Path, columns); err != nil {
+		return err
+	}
+	if err := os.Remove(s.logPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Append(rows *Columns) error {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.logPath(), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	// A crash while appending leaves a partial last line, which Load skips. It was never stored,
+	// so it is cut off rather than merged with these rows.
+	end, err := completeLines(file)
+	if err == nil {
+		err = file.Truncate(end)
+	}
+	if err == nil {
+		_, err = file.WriteAt(append(data, '\n'), end)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// completeLines returns the length of the file up to and including its last newline
+func completeLines(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4096)
+	for end := info.Size(); end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+func (s *FileStore) logPath() string {
+	return s.Path + ".log"
+}
+
+// readJSONFile decodes the file into v and reports whether the file exists
+func readJSONFile(path string, v any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// writeJSONFile replaces the file with v through a temporary file
+func writeJSONFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
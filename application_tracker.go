@@ -0,0 +1,412 @@
+package aifinitsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ApplicationEventType is the kind of change recorded for a tracked product application
+type ApplicationEventType string
+
+const (
+	ApplicationEventSubmitted   ApplicationEventType = "submitted"
+	ApplicationEventApproved    ApplicationEventType = "approved"
+	ApplicationEventRejected    ApplicationEventType = "rejected"
+	ApplicationEventResubmitted ApplicationEventType = "resubmitted"
+)
+
+// ApplicationEventSource tells which channel reported an application event
+type ApplicationEventSource string
+
+const (
+	ApplicationEventSourceClient   ApplicationEventSource = "client"   // Submit or Resubmit
+	ApplicationEventSourceCallback ApplicationEventSource = "callback" // review notification callback
+	ApplicationEventSourcePoll     ApplicationEventSource = "poll"     // DetailProductApplication polling
+)
+
+// ApplicationEvent is one entry in the history of a product application
+type ApplicationEvent struct {
+	ApplicationId int                          `json:"applicationId"`
+	Type          ApplicationEventType         `json:"type"`
+	Source        ApplicationEventSource       `json:"source"`
+	At            time.Time                    `json:"at"`
+	ItemCode      string                       `json:"itemCode,omitempty"`     // set on approval
+	RejectType    ProductApplicationRejectType `json:"rejectType,omitempty"`   // set on rejection
+	RejectReason  string                       `json:"rejectReason,omitempty"` // set on rejection
+}
+
+// TrackedApplication is the tracker's view of a submitted product application
+type TrackedApplication struct {
+	Id           int                          `json:"id"`
+	Name         string                       `json:"name"`
+	QrCodes      string                       `json:"qrCodes"`
+	ApplyStatus  int                          `json:"applyStatus"` // ApplyStatusUnderReview, ApplyStatusApproved or ApplyStatusRejected
+	ItemCode     string                       `json:"itemCode,omitempty"`
+	RejectType   ProductApplicationRejectType `json:"rejectType,omitempty"`
+	RejectReason string                       `json:"rejectReason,omitempty"`
+	Attempts     int                          `json:"attempts"` // 1 for the first submission, incremented by each resubmission
+	SubmittedAt  time.Time                    `json:"submittedAt"`
+	UpdatedAt    time.Time                    `json:"updatedAt"`
+	History      []ApplicationEvent           `json:"history"`
+}
+
+// ApplicationStore persists tracked applications between restarts
+type ApplicationStore interface {
+	Load() ([]TrackedApplication, error)
+	Save(applications []TrackedApplication) error
+}
+
+// MemoryApplicationStore keeps tracked applications in memory only
+type MemoryApplicationStore struct {
+	mu           sync.Mutex
+	applications []TrackedApplication
+}
+
+func (s *MemoryApplicationStore) Load() ([]TrackedApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applications, nil
+}
+
+func (s *MemoryApplicationStore) Save(applications []TrackedApplication) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applications = applications
+	return nil
+}
+
+// FileApplicationStore keeps tracked applications as a JSON file
+type FileApplicationStore struct {
+	Path string
+}
+
+func (s *FileApplicationStore) Load() ([]TrackedApplication, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var applications []TrackedApplication
+	if err := json.Unmarshal(data, &applications); err != nil {
+		return nil, err
+	}
+	return applications, nil
+}
+
+func (s *FileApplicationStore) Save(applications []TrackedApplication) error {
+	data, err := json.Marshal(applications)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// ApplicationTracker follows product applications from submission to approval or rejection.
+// Outcomes arrive through review notification callbacks (HandleReviewNotification) and, as a
+// fallback, by polling DetailProductApplication for applications still under review. Each outcome
+// is reported once through OnEvent, whichever channel sees it first.
+type ApplicationTracker struct {
+	Products ProductManageClient
+	Store    ApplicationStore
+	// PollInterval used by Run; defaults to ten minutes
+	PollInterval time.Duration
+	// OnEvent is called for every recorded event, outside the tracker lock
+	OnEvent func(ApplicationEvent)
+
+	mu           sync.Mutex
+	applications map[int]*TrackedApplication
+	now          func() time.Time
+}
+
+// NewApplicationTracker creates a tracker. A nil store keeps the applications in memory only.
+func NewApplicationTracker(products ProductManageClient, store ApplicationStore) *ApplicationTracker {
+	if store == nil {
+		store = &MemoryApplicationStore{}
+	}
+
+	return &ApplicationTracker{
+		Products:     products,
+		Store:        store,
+		PollInterval: 10 * time.Minute,
+		applications: make(map[int]*TrackedApplication),
+		now:          time.Now,
+	}
+}
+
+// Load restores tracked applications from the store
+func (t *ApplicationTracker) Load() error {
+	applications, err := t.Store.Load()
+	if err != nil {
+		return NewAinfinitError(fmt.Errorf("load applications: %w", err))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range applications {
+		application := applications[i]
+		t.applications[application.Id] = &application
+	}
+	return nil
+}
+
+// Submit files a new product application and starts tracking it
+func (t *ApplicationTracker) Submit(application *NewProductApplication) (*TrackedApplication, error) {
+	resp, err := t.Products.NewProductApplication(&NewProductApplicationRequest{Product: application})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Data == 0 {
+		return nil, NewAinfinitError(fmt.Errorf("product application created without id"))
+	}
+
+	t.mu.Lock()
+	now := t.now()
+	tracked := &TrackedApplication{
+		Id:          resp.Data,
+		Name:        application.Name,
+		QrCodes:     application.QrCodes,
+		ApplyStatus: ApplyStatusUnderReview,
+		Attempts:    1,
+		SubmittedAt: now,
+	}
+	t.applications[tracked.Id] = tracked
+	event := t.record(tracked, ApplicationEvent{Type: ApplicationEventSubmitted, Source: ApplicationEventSourceClient})
+	result := t.copyOf(tracked)
+	err = t.save()
+	t.mu.Unlock()
+
+	t.emit(event)
+	return &result, err
+}
+
+// Resubmit sends corrected data for a rejected application through UpdateProductApplication
+// and puts it back under review
+func (t *ApplicationTracker) Resubmit(update *UpdateProductApplication) (*TrackedApplication, error) {
+	if update == nil {
+		return nil, NewAinfinitError(fmt.Errorf("update cannot be nil"))
+	}
+
+	t.mu.Lock()
+	tracked, ok := t.applications[update.Id]
+	var itemCode string
+	var status int
+	if ok {
+		itemCode = tracked.ItemCode
+		status = tracked.ApplyStatus
+	}
+	t.mu.Unlock()
+
+	if !ok {
+		return nil, NewAinfinitError(fmt.Errorf("application %d is not tracked", update.Id))
+	}
+	if status != ApplyStatusRejected {
+		return nil, NewAinfinitError(fmt.Errorf("application %d is not rejected", update.Id))
+	}
+
+	if _, err := t.Products.UpdateProductApplication(itemCode, &UpdateProductApplicationRequest{Item: update}); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	tracked = t.applications[update.Id]
+	tracked.ApplyStatus = ApplyStatusUnderReview
+	tracked.RejectType = ""
+	tracked.RejectReason = ""
+	tracked.Attempts++
+	if update.QrCodes != "" {
+		tracked.QrCodes = update.QrCodes
+	}
+	event := t.record(tracked, ApplicationEvent{Type: ApplicationEventResubmitted, Source: ApplicationEventSourceClient})
+	result := t.copyOf(tracked)
+	err := t.save()
+	t.mu.Unlock()
+
+	t.emit(event)
+	return &result, err
+}
+
+// HandleReviewNotification applies a review notification callback.
+// Notifications for applications the tracker has not seen are tracked from that point on.
+func (t *ApplicationTracker) HandleReviewNotification(request *ProductApplicationReviewNotificationCallbackRequest) error {
+	if request == nil || request.ID == 0 {
+		return NewAinfinitError(fmt.Errorf("review notification without application id"))
+	}
+
+	status := int(request.Status)
+	if status != ApplyStatusApproved && status != ApplyStatusRejected {
+		return NewAinfinitError(fmt.Errorf("unknown review status: %d", request.Status))
+	}
+
+	return t.apply(int(request.ID), status, request.ItemCode, request.RejectType, request.RejectReason, ApplicationEventSourceCallback)
+}
+
+// Poll checks every application still under review with DetailProductApplication
+func (t *ApplicationTracker) Poll(ctx context.Context) error {
+	t.mu.Lock()
+	var pending []int
+	for id, application := range t.applications {
+		if application.ApplyStatus == ApplyStatusUnderReview {
+			pending = append(pending, id)
+		}
+	}
+	t.mu.Unlock()
+	sort.Ints(pending)
+
+	var errs []error
+	for _, id := range pending {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		detail, err := t.Products.DetailProductApplication(strconv.Itoa(id))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("application %d: %w", id, err))
+			continue
+		}
+
+		application := detail.Data
+		if application.ApplyStatus != ApplyStatusApproved && application.ApplyStatus != ApplyStatusRejected {
+			continue
+		}
+		err = t.apply(id, application.ApplyStatus, application.ItemCode,
+			ProductApplicationRejectType(application.RejectType), application.RejectReason, ApplicationEventSourcePoll)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run loads stored applications and polls pending ones until the context is cancelled
+func (t *ApplicationTracker) Run(ctx context.Context) error {
+	if err := t.Load(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(t.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := t.Poll(ctx); err != nil {
+				logrus.WithError(err).Warn("Product application poll failed")
+			}
+		}
+	}
+}
+
+// Application returns a tracked application with its history
+func (t *ApplicationTracker) Application(id int) (TrackedApplication, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	application, ok := t.applications[id]
+	if !ok {
+		return TrackedApplication{}, false
+	}
+	return t.copyOf(application), true
+}
+
+// Applications returns all tracked applications ordered by id
+func (t *ApplicationTracker) Applications() []TrackedApplication {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.list()
+}
+
+// History returns the recorded events of an application, oldest first
+func (t *ApplicationTracker) History(id int) []ApplicationEvent {
+	application, _ := t.Application(id)
+	return application.History
+}
+
+// apply records an outcome unless the application already has it
+func (t *ApplicationTracker) apply(id, status int, itemCode string, rejectType ProductApplicationRejectType, rejectReason string, source ApplicationEventSource) error {
+	t.mu.Lock()
+	tracked, ok := t.applications[id]
+	if !ok {
+		tracked = &TrackedApplication{Id: id, Attempts: 1}
+		t.applications[id] = tracked
+	}
+	if tracked.ApplyStatus == status {
+		t.mu.Unlock()
+		return nil
+	}
+
+	tracked.ApplyStatus = status
+	event := ApplicationEvent{Source: source}
+	if status == ApplyStatusApproved {
+		tracked.ItemCode = itemCode
+		event.Type = ApplicationEventApproved
+		event.ItemCode = itemCode
+	} else {
+		tracked.RejectType = rejectType
+		tracked.RejectReason = rejectReason
+		event.Type = ApplicationEventRejected
+		event.RejectType = rejectType
+		event.RejectReason = rejectReason
+	}
+	event = t.record(tracked, event)
+	err := t.save()
+	t.mu.Unlock()
+
+	t.emit(event)
+	return err
+}
+
+func (t *ApplicationTracker) record(tracked *TrackedApplication, event ApplicationEvent) ApplicationEvent {
+	event.ApplicationId = tracked.Id
+	event.At = t.now()
+	tracked.UpdatedAt = event.At
+	tracked.History = append(tracked.History, event)
+	return event
+}
+
+func (t *ApplicationTracker) emit(event ApplicationEvent) {
+	if t.OnEvent != nil {
+		t.OnEvent(event)
+	}
+}
+
+func (t *ApplicationTracker) copyOf(tracked *TrackedApplication) TrackedApplication {
+	application := *tracked
+	application.History = append([]ApplicationEvent(nil), tracked.History...)
+	return application
+}
+
+func (t *ApplicationTracker) list() []TrackedApplication {
+	applications := make([]TrackedApplication, 0, len(t.applications))
+	for _, application := range t.applications {
+		applications = append(applications, t.copyOf(application))
+	}
+	sort.Slice(applications, func(i, j int) bool { return applications[i].Id < applications[j].Id })
+	return applications
+}
+
+func (t *ApplicationTracker) save() error {
+	if err := t.Store.Save(t.list()); err != nil {
+		return NewAinfinitError(fmt.Errorf("save applications: %w", err))
+	}
+	return nil
+}
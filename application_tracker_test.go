@@ -0,0 +1,89 @@
+package aifinitsdk
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeApplicationClient accepts applications and serves their review state
+type fakeApplicationClient struct {
+	ProductManageClient
+	nextId  int
+	details map[int]Product
+	updates []*UpdateProductApplication
+}
+
+func (f *fakeApplicationClient) NewProductApplication(request *NewProductApplicationRequest) (*NewProductApplicationResponse, error) {
+	f.nextId++
+	f.details[f.nextId] = Product{Id: f.nextId, Name: request.Product.Name, ApplyStatus: ApplyStatusUnderReview}
+	return &NewProductApplicationResponse{Status: 200, Data: f.nextId}, nil
+}
+
+func (f *fakeApplicationClient) DetailProductApplication(itemCode string) (*DetailProductApplicationResponse, error) {
+	id, _ := strconv.Atoi(itemCode)
+	return &DetailProductApplicationResponse{Status: 200, Data: f.details[id]}, nil
+}
+
+func (f *fakeApplicationClient) UpdateProductApplication(itemCode string, request *UpdateProductApplicationRequest) (*UpdateProductApplicationResponse, error) {
+	f.updates = append(f.updates, request.Item)
+	f.details[request.Item.Id] = Product{Id: request.Item.Id, ApplyStatus: ApplyStatusUnderReview}
+	return &UpdateProductApplicationResponse{Status: 200}, nil
+}
+
+func TestApplicationTracker_Lifecycle(t *testing.T) {
+	products := &fakeApplicationClient{details: map[int]Product{}}
+	tracker := NewApplicationTracker(products, &FileApplicationStore{Path: filepath.Join(t.TempDir(), "applications.json")})
+
+	var events []ApplicationEvent
+	tracker.OnEvent = func(event ApplicationEvent) { events = append(events, event) }
+
+	cola, err := tracker.Submit(&NewProductApplication{Name: "Cola", Price: mnt(2.5), QrCodes: "4006381333931"})
+	assert.NoError(t, err)
+	chips, err := tracker.Submit(&NewProductApplication{Name: "Chips", Price: mnt(3), QrCodes: "96385074"})
+	assert.NoError(t, err)
+
+	// Cola is approved by callback, the poll that follows must not report it again
+	assert.NoError(t, tracker.HandleReviewNotification(&ProductApplicationReviewNotificationCallbackRequest{
+		ID: int64(cola.Id), Status: ProductApplicationReviewStatusApproved, ItemCode: "ITEM-1",
+	}))
+	products.details[cola.Id] = Product{Id: cola.Id, ApplyStatus: ApplyStatusApproved, ItemCode: "ITEM-1"}
+
+	// Chips is rejected and only seen by polling
+	products.details[chips.Id] = Product{Id: chips.Id, ApplyStatus: ApplyStatusRejected, RejectType: "3", RejectReason: "blurry"}
+	assert.NoError(t, tracker.Poll(context.Background()))
+
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, ApplicationEventApproved, events[2].Type)
+		assert.Equal(t, "ITEM-1", events[2].ItemCode)
+		assert.Equal(t, ApplicationEventSourceCallback, events[2].Source)
+		assert.Equal(t, ApplicationEventRejected, events[3].Type)
+		assert.Equal(t, ProductApplicationRejectTypeImageUnclear, events[3].RejectType)
+		assert.Equal(t, "blurry", events[3].RejectReason)
+		assert.Equal(t, ApplicationEventSourcePoll, events[3].Source)
+	}
+
+	// Approved applications cannot be resubmitted, rejected ones can
+	_, err = tracker.Resubmit(&UpdateProductApplication{Id: cola.Id})
+	assert.Error(t, err)
+
+	resubmitted, err := tracker.Resubmit(&UpdateProductApplication{Id: chips.Id, ImgFiles: [][]byte{{1}}, ImgFileNames: []string{"sharp.jpg"}})
+	assert.NoError(t, err)
+	assert.Equal(t, ApplyStatusUnderReview, resubmitted.ApplyStatus)
+	assert.Equal(t, 2, resubmitted.Attempts)
+	assert.Empty(t, resubmitted.RejectReason)
+	assert.Len(t, products.updates, 1)
+
+	// History survives a restart
+	restored := NewApplicationTracker(products, tracker.Store)
+	assert.NoError(t, restored.Load())
+	var types []ApplicationEventType
+	for _, event := range restored.History(chips.Id) {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []ApplicationEventType{ApplicationEventSubmitted, ApplicationEventRejected, ApplicationEventResubmitted}, types)
+	assert.Len(t, restored.Applications(), 2)
+}
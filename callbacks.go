@@ -86,7 +86,7 @@ const (
 // Maintenance Exception Notification
 type MaintenanceExceptionNotificationCallbackRequest struct {
 	ExCode     MaintenanceExceptionCode   `json:"exCode"`             // Exception code
-	NotifyTime int64                      `json:"notifyTime"`         // Time of exception occurrence or recovery
+	NotifyTime Millis                     `json:"notifyTime"`         // Time of exception occurrence or recovery
 	Status     MaintenanceExceptionStatus `json:"status"`             // 0: Triggered, 1: Recovered
 	VmCode     string                     `json:"vmCode"`             // Vending machine code
 	VmName     string                     `json:"vmName"`             // Vending machine name
@@ -101,10 +101,10 @@ type OperationalExceptionNotificationCallbackRequest struct {
 	ExID          string                   `json:"exId"`                    // Exception alarm ID
 	ExType        OperationalExceptionType `json:"exType"`                  // Exception type
 	ExDetail      string                   `json:"exDetail"`                // Detailed info (e.g., lockopen_doorclose)
-	SendTime      int64                    `json:"sendTime"`                // Client-side exception timestamp (in ms)
+	SendTime      Millis                   `json:"sendTime"`                // Client-side exception timestamp (in ms)
 	VideoURL      string                   `json:"videoUrl,omitempty"`      // Video URL (if applicable)
 	VideoStatus   AlarmVideoStatus         `json:"videoStatus,omitempty"`   // Video status
-	VideoSendTime int64                    `json:"videoSendTime,omitempty"` // Video upload timestamp (in ms)
+	VideoSendTime Millis                   `json:"videoSendTime,omitzero"` // Video upload timestamp (in ms)
 	ScanCode      string                   `json:"scanCode,omitempty"`      // QR sticker code
 }
 
@@ -280,7 +280,7 @@ type ProductChangeNotificationCallbackRequest struct {
 	ImageUrl  string                `json:"imageUrl"`  // Product image URL
 	ItemCodes []string              `json:"itemCodes"` // Codes of items in the bundle (empty for single items)
 	Name      string                `json:"name"`      // Product name
-	Price     int                   `json:"price"`     // Price in cents
+	Price     MinorMoney            `json:"price"`     // Price in cents
 	Status    ProductStatus         `json:"status"`    // 1 = listed (available), 2 = unlisted (unavailable)
 	Weight    int                   `json:"weight"`    // Weight in grams
 }
@@ -383,9 +383,9 @@ type OrderCallbackRequest struct {
 	VmCode          string            `json:"vmCode"`                    // Self-dealer equipment code
 	HandleStatus    HandleStatus      `json:"handleStatus"`              // Identification of processing status
 	AbnormalReasons []AbnormalReason  `json:"abnormalReasons,omitempty"` // Artificial handling of abnormal causes
-	OpenDoorTime    int64             `json:"openDoorTime"`              // Opening the door time stamp
+	OpenDoorTime    Millis            `json:"openDoorTime"`              // Opening the door time stamp
 	OpenDoorWeight  float64               `json:"openDoorWeight"`            // Total weight of the door
-	CloseDoorTime   int64             `json:"closeDoorTime"`             // Closed time stamp
+	CloseDoorTime   Millis            `json:"closeDoorTime"`             // Closed time stamp
 	CloseDoorWeight float64               `json:"closeDoorWeight"`           // Total closing weight
 	HardwareEx      HardwareException `json:"hardwareEx,omitempty"`      // Hardware exception
 	ShopMove        ShopMove          `json:"shopMove"`                  // Door movement status
@@ -456,9 +456,9 @@ type DoorOpenCloseShoppingResult struct {
 	UserCode        string       `json:"userCode"`        // User code
 	HandleStatus    int          `json:"handleStatus"`    // Handle status
 	ShopMove        int          `json:"shopMove"`        // Shop movement status
-	TotalFee        float64          `json:"totalFee"`        // Total fee
-	OpenDoorTime    int64        `json:"openDoorTime"`    // Door open time
-	CloseDoorTime   int64        `json:"closeDoorTime"`   // Door close time
+	TotalFee        Money        `json:"totalFee"`        // Total fee
+	OpenDoorTime    Millis       `json:"openDoorTime"`    // Door open time
+	CloseDoorTime   Millis       `json:"closeDoorTime"`   // Door close time
 	OpenDoorWeight  float64          `json:"openDoorWeight"`  // Weight when door opened
 	CloseDoorWeight float64          `json:"closeDoorWeight"` // Weight when door closed
 	OrderGoodsList  []OrderGoods `json:"orderGoodsList"`  // List of ordered goods
@@ -468,8 +468,8 @@ type DoorOpenCloseShoppingResult struct {
 type DoorOpenCloseRestockingResult struct {
 	RequestID       string `json:"requestId"`       // Request ID
 	VmCode          string `json:"vmCode"`          // Vending machine code
-	OpenDoorTime    int64  `json:"openDoorTime"`    // Door open time
-	CloseDoorTime   int64  `json:"closeDoorTime"`   // Door close time
+	OpenDoorTime    Millis `json:"openDoorTime"`    // Door open time
+	CloseDoorTime   Millis `json:"closeDoorTime"`   // Door close time
 	OpenDoorWeight  float64    `json:"openDoorWeight"`  // Weight when door opened
 	CloseDoorWeight float64    `json:"closeDoorWeight"` // Weight when door closed
 }
@@ -0,0 +1,468 @@
+package aifinitsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CatalogSnapshot is the persisted state of a Catalog
+type CatalogSnapshot struct {
+	Products       []Product `json:"products"`
+	Count          int       `json:"count"`          // Product count reported by LastInfo at sync time
+	LastUpdateTime Millis    `json:"lastUpdateTime"` // lastUpdateTime reported by LastInfo at sync time
+	SyncedAt       time.Time `json:"syncedAt"`
+}
+
+// CatalogStore persists catalog snapshots between restarts
+type CatalogStore interface {
+	// Load returns the stored snapshot, or nil when nothing has been stored yet
+	Load() (*CatalogSnapshot, error)
+	Save(snapshot *CatalogSnapshot) error
+}
+
+// MemoryCatalogStore keeps the snapshot in memory only
+type MemoryCatalogStore struct {
+	mu       sync.Mutex
+	snapshot *CatalogSnapshot
+}
+
+func (s *MemoryCatalogStore) Load() (*CatalogSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot, nil
+}
+
+func (s *MemoryCatalogStore) Save(snapshot *CatalogSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+	return nil
+}
+
+// FileCatalogStore keeps the snapshot as a JSON file
+type FileCatalogStore struct {
+	Path string
+}
+
+func (s *FileCatalogStore) Load() (*CatalogSnapshot, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot CatalogSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s *FileCatalogStore) Save(snapshot *CatalogSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// Catalog is a local copy of the platform product catalog.
+// It is filled by a full sync, kept current by product change callbacks (ApplyChange),
+// and falls back to polling LastInfo and re-syncing when lastUpdateTime moves.
+type Catalog struct {
+	Products ProductManageClient
+	Store    CatalogStore
+	// PageSize used for full syncs; defaults to 50
+	PageSize int
+	// PollInterval used by Run; defaults to five minutes
+	PollInterval time.Duration
+
+	mu             sync.RWMutex
+	byCode         map[string]Product
+	byBarcode      map[string][]string
+	count          int
+	lastUpdateTime Millis
+	syncedAt       time.Time
+}
+
+// NewCatalog creates an empty catalog. A nil store keeps the catalog in memory only.
+func NewCatalog(products ProductManageClient, store CatalogStore) *Catalog {
+	if store == nil {
+		store = &MemoryCatalogStore{}
+	}
+
+	return &Catalog{
+		Products:     products,
+		Store:        store,
+		PageSize:     50,
+		PollInterval: 5 * time.Minute,
+		byCode:       make(map[string]Product),
+		byBarcode:    make(map[string][]string),
+	}
+}
+
+// Load restores the catalog from its store. It reports whether a snapshot was found.
+func (c *Catalog) Load() (bool, error) {
+	snapshot, err := c.Store.Load()
+	if err != nil {
+		return false, NewAinfinitError(fmt.Errorf("load catalog: %w", err))
+	}
+	if snapshot == nil {
+		return false, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replace(snapshot.Products)
+	c.count = snapshot.Count
+	c.lastUpdateTime = snapshot.LastUpdateTime
+	c.syncedAt = snapshot.SyncedAt
+	return true, nil
+}
+
+// Sync downloads the whole catalog and replaces the local copy
+func (c *Catalog) Sync(ctx context.Context) error {
+	info, err := c.Products.LastInfo()
+	if err != nil {
+		return err
+	}
+
+	var products []Product
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		list, err := c.Products.ProductList(page, c.PageSize)
+		if err != nil {
+			return err
+		}
+		products = append(products, list.Data.Rows...)
+
+		if len(list.Data.Rows) < c.PageSize || len(products) >= list.Data.Total {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.replace(products)
+	c.count = info.Data.Count
+	c.lastUpdateTime = info.Data.LastUpdateTime
+	c.syncedAt = time.Now()
+	snapshot := c.snapshot()
+	c.mu.Unlock()
+
+	return c.save(snapshot)
+}
+
+// Refresh polls LastInfo and re-syncs when the platform catalog changed since the last sync.
+// When only lastUpdateTime moved, just the products updated since the previous sync are fetched;
+// a changed product count (additions or deletions) triggers a full sync, and so does a delta that
+// does not add up to the platform's count, as when a deletion and an addition cancel out. It
+// reports whether a sync happened.
+func (c *Catalog) Refresh(ctx context.Context) (bool, error) {
+	info, err := c.Products.LastInfo()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := info.Data.LastUpdateTime.Equal(c.lastUpdateTime.Time) && info.Data.Count == c.count
+	delta := info.Data.Count == c.count && !c.lastUpdateTime.IsZero()
+	since := c.lastUpdateTime.Time
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if delta {
+		err := c.syncSince(ctx, info.Data, since)
+		if err == nil {
+			return true, nil
+		}
+		if errors.Is(err, errCatalogDeletions) {
+			logrus.WithError(err).Debug("Catalog delta misses deletions, falling back to full sync")
+		} else {
+			logrus.WithError(err).Warn("Catalog delta sync failed, falling back to full sync")
+		}
+	}
+
+	return true, c.Sync(ctx)
+}
+
+// errCatalogDeletions reports a delta sync that cannot account for the platform's product count
+var errCatalogDeletions = errors.New("catalog delta does not match the product count")
+
+func (c *Catalog) syncSince(ctx context.Context, info LastInfo, since time.Time) error {
+	var products []Product
+	for page := 1; ; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		list, err := c.Products.ProductListWithFilter(&ProductListPage{Page: page, Limit: c.PageSize, UpdatedTime: since})
+		if err != nil {
+			return err
+		}
+		products = append(products, list.Data.Rows...)
+
+		if len(list.Data.Rows) < c.PageSize || len(products) >= list.Data.Total {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	// The delta carries no deletions: products gone upstream would linger unless the count exposes them
+	count := len(c.byCode)
+	for _, product := range products {
+		if _, ok := c.byCode[product.ItemCode]; !ok {
+			count++
+		}
+	}
+	if count != info.Count {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %d products after the delta, %d on the platform", errCatalogDeletions, count, info.Count)
+	}
+	for _, product := range products {
+		c.put(product)
+	}
+	c.count = info.Count
+	c.lastUpdateTime = info.LastUpdateTime
+	snapshot := c.snapshot()
+	c.mu.Unlock()
+
+	return c.save(snapshot)
+}
+
+// Run loads the stored catalog, syncs if it is empty and then polls until the context is cancelled
+func (c *Catalog) Run(ctx context.Context) error {
+	found, err := c.Load()
+	if err != nil {
+		return err
+	}
+	if !found {
+		if err := c.Sync(ctx); err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(c.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := c.Refresh(ctx); err != nil {
+				logrus.WithError(err).Warn("Catalog refresh failed")
+			}
+		}
+	}
+}
+
+// ApplyChange applies a product change callback to the local catalog.
+// Fields the callback does not carry (such as barcodes) are kept from the cached product.
+func (c *Catalog) ApplyChange(action ProductChangeAction, change *ProductChangeNotificationCallbackRequest) error {
+	if change == nil || change.Code == "" {
+		return NewAinfinitError(fmt.Errorf("product change without code"))
+	}
+
+	c.mu.Lock()
+	switch action {
+	case ProductChangeActionAdd, ProductChangeActionUpdate:
+		product := c.byCode[change.Code]
+		product.ItemCode = change.Code
+		product.Name = change.Name
+		product.Price = change.Price
+		product.Weight = change.Weight
+		product.ImgUrl = change.ImageUrl
+		product.CollType = int(change.CollType)
+		product.ItemCodes = change.ItemCodes
+		product.Status = int(change.Status)
+		c.put(product)
+	case ProductChangeActionDelete:
+		c.remove(change.Code)
+	default:
+		c.mu.Unlock()
+		return NewAinfinitError(fmt.Errorf("unknown product change action: %s", action))
+	}
+	snapshot := c.snapshot()
+	c.mu.Unlock()
+
+	return c.save(snapshot)
+}
+
+// Product returns the cached product for an item code
+func (c *Catalog) Product(itemCode string) (Product, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	product, ok := c.byCode[itemCode]
+	return product, ok
+}
+
+// ByBarcode returns every cached product carrying the barcode
+func (c *Catalog) ByBarcode(barcode string) []Product {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var products []Product
+	for _, itemCode := range c.byBarcode[strings.TrimSpace(barcode)] {
+		products = append(products, c.byCode[itemCode])
+	}
+	return products
+}
+
+// Search returns products whose name contains the query, case-insensitively, ordered by name
+func (c *Catalog) Search(query string) []Product {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	c.mu.RLock()
+	var products []Product
+	for _, product := range c.byCode {
+		if strings.Contains(strings.ToLower(product.Name), query) {
+			products = append(products, product)
+		}
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(products, func(i, j int) bool { return products[i].Name < products[j].Name })
+	return products
+}
+
+// ExpandBundle returns the single items a bundle is made of, expanding nested bundles.
+// A single item expands to itself.
+func (c *Catalog) ExpandBundle(itemCode string) ([]Product, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.expand(itemCode, map[string]bool{})
+}
+
+// Len returns the number of cached products
+func (c *Catalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.byCode)
+}
+
+// SyncedAt returns when the last full sync finished
+func (c *Catalog) SyncedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.syncedAt
+}
+
+func (c *Catalog) expand(itemCode string, visiting map[string]bool) ([]Product, error) {
+	product, ok := c.byCode[itemCode]
+	if !ok {
+		return nil, NewAinfinitError(fmt.Errorf("product %s not in catalog", itemCode))
+	}
+	if ProductCollectionType(product.CollType) != ProductCollectionTypeBundle || len(product.ItemCodes) == 0 {
+		return []Product{product}, nil
+	}
+	if visiting[itemCode] {
+		return nil, NewAinfinitError(fmt.Errorf("bundle %s contains itself", itemCode))
+	}
+	visiting[itemCode] = true
+	defer delete(visiting, itemCode)
+
+	var items []Product
+	for _, code := range product.ItemCodes {
+		expanded, err := c.expand(code, visiting)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, expanded...)
+	}
+	return items, nil
+}
+
+func (c *Catalog) replace(products []Product) {
+	c.byCode = make(map[string]Product, len(products))
+	c.byBarcode = make(map[string][]string)
+	for _, product := range products {
+		c.put(product)
+	}
+}
+
+func (c *Catalog) put(product Product) {
+	c.remove(product.ItemCode)
+	c.byCode[product.ItemCode] = product
+	for _, barcode := range splitBarcodes(product.QrCodes) {
+		c.byBarcode[barcode] = append(c.byBarcode[barcode], product.ItemCode)
+	}
+}
+
+func (c *Catalog) remove(itemCode string) {
+	product, ok := c.byCode[itemCode]
+	if !ok {
+		return
+	}
+	delete(c.byCode, itemCode)
+
+	for _, barcode := range splitBarcodes(product.QrCodes) {
+		codes := c.byBarcode[barcode]
+		for i, code := range codes {
+			if code == itemCode {
+				codes = append(codes[:i], codes[i+1:]...)
+				break
+			}
+		}
+		if len(codes) == 0 {
+			delete(c.byBarcode, barcode)
+		} else {
+			c.byBarcode[barcode] = codes
+		}
+	}
+}
+
+func (c *Catalog) snapshot() *CatalogSnapshot {
+	products := make([]Product, 0, len(c.byCode))
+	for _, product := range c.byCode {
+		products = append(products, product)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ItemCode < products[j].ItemCode })
+
+	return &CatalogSnapshot{
+		Products:       products,
+		Count:          c.count,
+		LastUpdateTime: c.lastUpdateTime,
+		SyncedAt:       c.syncedAt,
+	}
+}
+
+func (c *Catalog) save(snapshot *CatalogSnapshot) error {
+	if err := c.Store.Save(snapshot); err != nil {
+		return NewAinfinitError(fmt.Errorf("save catalog: %w", err))
+	}
+	return nil
+}
+
+// splitBarcodes splits the qrCodes field, which may hold several comma separated barcodes
+func splitBarcodes(qrCodes string) []string {
+	var barcodes []string
+	for _, barcode := range strings.Split(qrCodes, ",") {
+		if barcode = strings.TrimSpace(barcode); barcode != "" {
+			barcodes = append(barcodes, barcode)
+		}
+	}
+	return barcodes
+}
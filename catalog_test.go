@@ -0,0 +1,186 @@
+package aifinitsdk
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeProductClient serves a fixed product list and counts calls
+type fakeProductClient struct {
+	ProductManageClient
+	products       []Product
+	applications   []Product
+	lastUpdateTime int64
+	listCalls      int
+	lastFilter     ProductListPage
+}
+
+func (f *fakeProductClient) LastInfo() (*LastInfoResponse, error) {
+	return &LastInfoResponse{Status: 200, Data: LastInfo{Count: len(f.products), LastUpdateTime: FromUnixMilli(f.lastUpdateTime)}}, nil
+}
+
+func (f *fakeProductClient) ProductList(page, limit int) (*ProductListResponse, error) {
+	return f.ProductListWithFilter(&ProductListPage{Page: page, Limit: limit})
+}
+
+func (f *fakeProductClient) ProductListWithFilter(filter *ProductListPage) (*ProductListResponse, error) {
+	f.listCalls++
+	f.lastFilter = *filter
+
+	var matched []Product
+	for _, product := range f.products {
+		if !filter.UpdatedTime.IsZero() && product.UpdateTime.Before(filter.UpdatedTime) {
+			continue
+		}
+		if filter.QrCodes != "" && !strings.Contains(product.QrCodes, filter.QrCodes) {
+			continue
+		}
+		matched = append(matched, product)
+	}
+
+	response := &ProductListResponse{Status: 200}
+	response.Data.Total = len(matched)
+	response.Data.Rows = pageOf(matched, filter.Page, filter.Limit)
+	return response, nil
+}
+
+func (f *fakeProductClient) ListProductApplication(params *ListProductApplicationParams) (*ListProductApplicationResponse, error) {
+	var matched []Product
+	for _, application := range f.applications {
+		if params.ApplyStatus != 0 && application.ApplyStatus != params.ApplyStatus {
+			continue
+		}
+		if params.QrCodes != "" && !strings.Contains(application.QrCodes, params.QrCodes) {
+			continue
+		}
+		matched = append(matched, application)
+	}
+
+	response := &ListProductApplicationResponse{Status: 200}
+	response.Data.Total = len(matched)
+	response.Data.Rows = pageOf(matched, params.Page, params.PageSize)
+	return response, nil
+}
+
+func pageOf(products []Product, page, limit int) []Product {
+	start := (page - 1) * limit
+	if start >= len(products) {
+		return nil
+	}
+	end := start + limit
+	if end > len(products) {
+		end = len(products)
+	}
+	return products[start:end]
+}
+
+func catalogFixture() []Product {
+	return []Product{
+		{ItemCode: "A", Name: "Cola 330ml", Price: Cents(250), QrCodes: "4006381333931", CollType: 1},
+		{ItemCode: "B", Name: "Water 500ml", Price: Cents(150), QrCodes: "96385074,4006381333931", CollType: 1},
+		{ItemCode: "C", Name: "Chips", Price: Cents(300), CollType: 1},
+		{ItemCode: "P", Name: "Party pack", Price: Cents(600), CollType: 2, ItemCodes: []string{"A", "B", "Q"}},
+		{ItemCode: "Q", Name: "Snack duo", Price: Cents(450), CollType: 2, ItemCodes: []string{"C", "C"}},
+	}
+}
+
+func TestCatalog_SyncAndLookup(t *testing.T) {
+	products := &fakeProductClient{products: catalogFixture(), lastUpdateTime: 100}
+	catalog := NewCatalog(products, nil)
+	catalog.PageSize = 2
+
+	assert.NoError(t, catalog.Sync(context.Background()))
+	assert.Equal(t, 5, catalog.Len())
+	assert.Equal(t, 3, products.listCalls)
+
+	product, ok := catalog.Product("A")
+	assert.True(t, ok)
+	assert.Equal(t, "Cola 330ml", product.Name)
+
+	assert.Len(t, catalog.ByBarcode("4006381333931"), 2)
+	assert.Len(t, catalog.ByBarcode("96385074"), 1)
+
+	found := catalog.Search("ML")
+	if assert.Len(t, found, 2) {
+		assert.Equal(t, "Cola 330ml", found[0].Name)
+	}
+
+	items, err := catalog.ExpandBundle("P")
+	assert.NoError(t, err)
+	var codes []string
+	for _, item := range items {
+		codes = append(codes, item.ItemCode)
+	}
+	assert.Equal(t, []string{"A", "B", "C", "C"}, codes)
+}
+
+func TestCatalog_ApplyChangeAndRefresh(t *testing.T) {
+	products := &fakeProductClient{products: catalogFixture(), lastUpdateTime: 100}
+	catalog := NewCatalog(products, &FileCatalogStore{Path: filepath.Join(t.TempDir(), "catalog.json")})
+	assert.NoError(t, catalog.Sync(context.Background()))
+
+	err := catalog.ApplyChange(ProductChangeActionUpdate, &ProductChangeNotificationCallbackRequest{
+		Code: "A", Name: "Cola Zero 330ml", Price: Cents(270), CollType: ProductCollectionTypeSingle, Status: ProductStatusListed,
+	})
+	assert.NoError(t, err)
+	product, _ := catalog.Product("A")
+	assert.Equal(t, "Cola Zero 330ml", product.Name)
+	assert.Equal(t, Cents(270), product.Price)
+	// Barcodes are not part of the callback and must survive the update
+	assert.Len(t, catalog.ByBarcode("4006381333931"), 2)
+
+	assert.NoError(t, catalog.ApplyChange(ProductChangeActionDelete, &ProductChangeNotificationCallbackRequest{Code: "B"}))
+	assert.Len(t, catalog.ByBarcode("96385074"), 0)
+	assert.Error(t, catalog.ApplyChange("rename", &ProductChangeNotificationCallbackRequest{Code: "A"}))
+
+	// A catalog restored from the store sees the applied changes
+	restored := NewCatalog(products, catalog.Store)
+	found, err := restored.Load()
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 4, restored.Len())
+
+	// LastInfo unchanged: no sync
+	synced, err := restored.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, synced)
+
+	// Product count changed upstream: full sync
+	products.lastUpdateTime = 200
+	products.products = products.products[:4]
+	synced, err = restored.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, synced)
+	assert.Equal(t, 4, restored.Len())
+	assert.Equal(t, int64(200), restored.lastUpdateTime.Milliseconds())
+
+	// Only lastUpdateTime moved: delta sync of products updated since the previous sync
+	products.products[2].Name = "Chips XL"
+	products.products[2].UpdateTime = DateTime{Time: time.UnixMilli(250)}
+	products.lastUpdateTime = 300
+	synced, err = restored.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, synced)
+	assert.Equal(t, FromUnixMilli(200).Time, products.lastFilter.UpdatedTime)
+	chips, _ := restored.Product("C")
+	assert.Equal(t, "Chips XL", chips.Name)
+
+	// A deletion and an addition keep the count: the delta does not add up, so a full sync drops the deleted product
+	products.products = append(products.products[1:], Product{ItemCode: "D", Name: "Juice", UpdateTime: DateTime{Time: time.UnixMilli(350)}})
+	products.lastUpdateTime = 400
+	calls := products.listCalls
+	synced, err = restored.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, synced)
+	assert.Equal(t, calls+2, products.listCalls)
+	assert.Equal(t, 4, restored.Len())
+	_, ok := restored.Product("A")
+	assert.False(t, ok)
+	_, ok = restored.Product("D")
+	assert.True(t, ok)
+}
@@ -3,6 +3,9 @@ package aifinitsdk
 import (
 	"encoding/base64"
 	"encoding/json"
+	"io"
+	"reflect"
+	"time"
 
 	"resty.dev/v3"
 )
@@ -10,6 +13,9 @@ import (
 type Config struct {
 	Debug      bool
 	RestyDebug bool
+	// Timezone is the zone this client reads and writes platform date strings in and presents
+	// timestamps in; PlatformLocation when nil
+	Timezone *time.Location
 }
 
 type Client interface {
@@ -18,6 +24,8 @@ type Client interface {
 	RestyDebug() bool
 	SetConfig(config Config)
 	GetRestyClient() *resty.Client
+	// Location is the platform timezone of the client
+	Location() *time.Location
 }
 
 type client struct {
@@ -55,6 +63,32 @@ func (c *client) GetRestyClient() *resty.Client {
 
 func (c *client) SetConfig(config Config) {
 	c.Config = &config
+	if location := config.Timezone; location != nil {
+		// Responses are decoded in PlatformLocation, then moved to the client's zone; request
+		// bodies take the opposite way
+		c.RestyClient.AddContentTypeDecoder("json", func(r io.Reader, v any) error {
+			if err := json.NewDecoder(r).Decode(v); err != nil {
+				return err
+			}
+			if result := reflect.ValueOf(v); result.Kind() == reflect.Pointer && !result.IsNil() {
+				relocateValue(result.Elem(), PlatformLocation, location)
+			}
+			return nil
+		})
+		c.RestyClient.AddContentTypeEncoder("json", func(w io.Writer, v any) error {
+			body := reflect.New(reflect.TypeOf(v)).Elem()
+			body.Set(reflect.ValueOf(v))
+			relocateValue(body, location, PlatformLocation)
+			return json.NewEncoder(w).Encode(body.Interface())
+		})
+	}
+}
+
+func (c *client) Location() *time.Location {
+	if c.Config == nil || c.Config.Timezone == nil {
+		return PlatformLocation
+	}
+	return c.Config.Timezone
 }
 
 func (c *client) RestyDebug() bool {
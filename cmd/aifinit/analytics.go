@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/techpartners-asia/aifinitsdk"
+	"github.com/techpartners-asia/aifinitsdk/analytics"
+)
+
+func runAnalytics(command string, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("analytics "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	storePath := flags.String("store", "analytics.json", "analytics data file")
+	from := flags.String("from", "", "first day, YYYY-MM-DD")
+	to := flags.String("to", "", "last day, YYYY-MM-DD")
+	machines := flags.String("machine", "", "comma separated machine codes")
+	format := flags.String("format", "csv", "report format: csv or json")
+	limit := flags.Int("n", 10, "number of items for top, 0 for all")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := parseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	machineCodes := splitList(*machines)
+
+	engine := analytics.NewEngine(&analytics.FileStore{Path: *storePath})
+	if err := engine.Load(); err != nil {
+		return err
+	}
+
+	location, err := timezone()
+	if err != nil {
+		return err
+	}
+	query := analytics.Query{Range: r, Machines: machineCodes, Location: location}
+	var report analytics.Table
+	switch command {
+	case "ingest":
+		return ingest(engine, machineCodes, r, stdout)
+	case "summary":
+		report = engine.Summary(query)
+	case "daily":
+		report = engine.Daily(query)
+	case "top":
+		report = engine.TopItems(query, *limit)
+	case "heatmap":
+		report = engine.Heatmap(query)
+	case "machines":
+		report = engine.Machines(query)
+	default:
+		return fmt.Errorf("unknown analytics command %q\n%s", command, usage)
+	}
+
+	switch *format {
+	case "csv":
+		return analytics.WriteCSV(stdout, report)
+	case "json":
+		return analytics.WriteJSON(stdout, report)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func ingest(engine *analytics.Engine, machines []string, r aifinitsdk.TimeRange, stdout io.Writer) error {
+	if len(machines) == 0 {
+		return errors.New("ingest needs -machine")
+	}
+	platform, err := client()
+	if err != nil {
+		return err
+	}
+	if r.From.IsZero() {
+		r.From = aifinitsdk.LastDays(7).From
+	}
+
+	operations := aifinitsdk.NewOperationClientImpl(platform)
+	added, err := engine.Import(context.Background(), operations, machines, r)
+	fmt.Fprintf(stdout, "ingested %d new orders, %d in total\n", added, engine.Orders())
+	return err
+}
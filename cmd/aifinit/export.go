@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/techpartners-asia/aifinitsdk"
+	"github.com/techpartners-asia/aifinitsdk/export"
+)
+
+func runExport(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	from := flags.String("from", "", "first day, YYYY-MM-DD")
+	to := flags.String("to", "", "last day, YYYY-MM-DD")
+	machines := flags.String("machine", "", "comma separated machine codes to list orders of")
+	callbacks := flags.String("callbacks", "", "callback log (JSON Lines) to export orders from")
+	catalogPath := flags.String("catalog", "", "catalog snapshot file for product names and barcodes")
+	checkpointPath := flags.String("checkpoint", "", "checkpoint file for incremental exports")
+	format := flags.String("format", "csv", "output format: csv, jsonl or parquet")
+	out := flags.String("out", "", "output file, standard output when empty")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	r, err := parseRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	var checkpoints export.CheckpointStore
+	if *checkpointPath != "" {
+		checkpoints = &export.FileCheckpointStore{Path: *checkpointPath}
+	}
+	exporter := export.NewExporter(checkpoints)
+	// Callbacks go first: unlike listed orders they carry item names
+	if *callbacks != "" {
+		exporter.Sources = append(exporter.Sources, export.NewCallbackLog(*callbacks))
+	}
+	platform, clientErr := client()
+	if machineCodes := splitList(*machines); len(machineCodes) > 0 {
+		if clientErr != nil {
+			return clientErr
+		}
+		exporter.Sources = append(exporter.Sources, &export.ListedOrders{Operations: aifinitsdk.NewOperationClientImpl(platform), Machines: machineCodes})
+	}
+	if len(exporter.Sources) == 0 {
+		return errors.New("export needs -machine or -callbacks")
+	}
+	if clientErr == nil {
+		exporter.Machines = export.NewMachineDirectory(aifinitsdk.NewDeviceClient(platform))
+	}
+	if *catalogPath != "" {
+		catalog := aifinitsdk.NewCatalog(nil, &aifinitsdk.FileCatalogStore{Path: *catalogPath})
+		if _, err := catalog.Load(); err != nil {
+			return err
+		}
+		exporter.Products = catalog
+	}
+
+	if *out == "" {
+		writer, err := export.NewWriter(stdout, export.Format(*format))
+		if err != nil {
+			return err
+		}
+		_, err = exporter.Export(context.Background(), writer, r)
+		return err
+	}
+
+	// Write next to the target and move it into place once complete
+	tmp := *out + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+	writer, err := export.NewWriter(file, export.Format(*format))
+	if err != nil {
+		return err
+	}
+	result, err := exporter.Write(context.Background(), writer, r)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+	// Only an export that is in place may advance the checkpoint
+	if err := exporter.Commit(result); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "exported %d orders, %d rows to %s\n", result.Orders, result.Rows, *out)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+	"github.com/techpartners-asia/aifinitsdk/export"
+)
+
+func TestRun_Export(t *testing.T) {
+	t.Setenv("MERCHANT_CODE", "")
+	dir := t.TempDir()
+	log := export.NewCallbackLog(filepath.Join(dir, "callbacks.jsonl"))
+	require.NoError(t, log.HandleOrder(&aifinitsdk.OrderCallbackRequest{
+		OrderCode: "O1", VmCode: "VM1",
+		CloseDoorTime:  aifinitsdk.MillisOf(time.Date(2024, 5, 1, 9, 0, 0, 0, aifinitsdk.PlatformLocation)),
+		OrderGoodsList: []aifinitsdk.OrderGoods{{ItemCode: "cola", ItemName: "Cola", ItemPrice: aifinitsdk.MoneyFromFloat(2.5, ""), Count: 2}},
+	}))
+
+	out := filepath.Join(dir, "orders.csv")
+	args := []string{"export", "-callbacks", log.Path, "-checkpoint", filepath.Join(dir, "checkpoint.json"), "-from", "2024-05-01", "-out", out}
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, run(args, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stderr.String(), "exported 1 orders, 1 rows")
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "O1,,callback,VM1")
+
+	// The checkpoint makes the next run incremental
+	stderr.Reset()
+	require.Equal(t, 0, run(args, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stderr.String(), "exported 0 orders")
+
+	// An export that cannot be moved into place leaves the checkpoint alone
+	blocked := filepath.Join(dir, "blocked")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "file"), 0o755))
+	checkpoint := filepath.Join(dir, "blocked-checkpoint.json")
+	assert.Equal(t, 1, run([]string{"export", "-callbacks", log.Path, "-checkpoint", checkpoint, "-from", "2024-05-01", "-out", blocked}, &stdout, &stderr))
+	assert.NoFileExists(t, checkpoint)
+
+	assert.Equal(t, 1, run([]string{"export"}, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"export", "-machine", "VM1"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "MERCHANT_CODE")
+}
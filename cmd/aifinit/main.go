@@ -0,0 +1,114 @@
+// Command aifinit is a command line companion to the SDK.
+//
+//	aifinit analytics ingest -machine VM1,VM2 -from 2024-05-01 -to 2024-05-31
+//	aifinit analytics summary|daily|top|heatmap|machines [-from ...] [-to ...] [-machine ...] [-format csv|json]
+//	aifinit export -machine VM1,VM2 [-callbacks callbacks.jsonl] [-format csv|jsonl|parquet] [-out orders.parquet]
+//
+// Commands that call the platform read the merchant credentials from MERCHANT_CODE and SECRET_KEY.
+// Dates are days in the platform timezone, AIFINIT_TIMEZONE (e.g. Asia/Ulaanbaatar) when set and
+// UTC+8 otherwise; -to is inclusive.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+const usage = `usage:
+  aifinit analytics <ingest|summary|daily|top|heatmap|machines> [flags]
+  aifinit export [flags]`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var err error
+	switch {
+	case len(args) >= 2 && args[0] == "analytics":
+		err = runAnalytics(args[1], args[2:], stdout, stderr)
+	case len(args) >= 1 && args[0] == "export":
+		err = runExport(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintln(stderr, usage)
+		return 2
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintln(stderr, "aifinit:", err)
+		return 1
+	}
+	return 0
+}
+
+// client builds a platform client from MERCHANT_CODE and SECRET_KEY
+func client() (aifinitsdk.Client, error) {
+	credentials := aifinitsdk.Crendetials{
+		MerchantCode: os.Getenv("MERCHANT_CODE"),
+		SecretKey:    os.Getenv("SECRET_KEY"),
+	}
+	if credentials.MerchantCode == "" || credentials.SecretKey == "" {
+		return nil, errors.New("MERCHANT_CODE and SECRET_KEY must be set")
+	}
+	location, err := timezone()
+	if err != nil {
+		return nil, err
+	}
+	platform := aifinitsdk.New(credentials, nil, "")
+	platform.SetConfig(aifinitsdk.Config{Timezone: location})
+	return platform, nil
+}
+
+// timezone reads the platform timezone from AIFINIT_TIMEZONE
+func timezone() (*time.Location, error) {
+	name := os.Getenv("AIFINIT_TIMEZONE")
+	if name == "" {
+		return aifinitsdk.PlatformLocation, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AIFINIT_TIMEZONE: %w", err)
+	}
+	return location, nil
+}
+
+// splitList splits a comma separated flag value
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// parseRange reads whole days in the platform timezone; the last day is included
+func parseRange(from, to string) (aifinitsdk.TimeRange, error) {
+	var r aifinitsdk.TimeRange
+	location, err := timezone()
+	if err != nil {
+		return r, err
+	}
+	if from != "" {
+		day, err := time.ParseInLocation(time.DateOnly, from, location)
+		if err != nil {
+			return r, fmt.Errorf("invalid -from: %w", err)
+		}
+		r.From = day
+	}
+	if to != "" {
+		day, err := time.ParseInLocation(time.DateOnly, to, location)
+		if err != nil {
+			return r, fmt.Errorf("invalid -to: %w", err)
+		}
+		r.To = day.AddDate(0, 0, 1).Add(-time.Millisecond)
+	}
+	return r, r.Validate()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+	"github.com/techpartners-asia/aifinitsdk/analytics"
+)
+
+func TestRun_Analytics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "analytics.json")
+	engine := analytics.NewEngine(&analytics.FileStore{Path: path})
+	closed := aifinitsdk.MillisOf(time.Date(2024, 5, 1, 9, 0, 0, 0, aifinitsdk.PlatformLocation))
+	for code, machine := range map[string]string{"O1": "VM1", "O2": "VM2"} {
+		require.NoError(t, engine.HandleOrder(&aifinitsdk.OrderCallbackRequest{
+			OrderCode: code, VmCode: machine, CloseDoorTime: closed,
+			OrderGoodsList: []aifinitsdk.OrderGoods{{ItemCode: "cola", ItemName: "Cola", ItemPrice: aifinitsdk.MoneyFromFloat(2.5, ""), Count: 1}},
+		}))
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"analytics", "summary", "-store", path, "-from", "2024-05-01", "-to", "2024-05-01", "-machine", "VM1"}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "orders,units,revenue,average_ticket,average_basket,currency\n1,1,2.5,2.5,1.00,MNT\n", stdout.String())
+
+	stdout.Reset()
+	code = run([]string{"analytics", "summary", "-store", path, "-from", "2024-05-02"}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "\n0,0,0,0,0.00,MNT\n")
+
+	stdout.Reset()
+	code = run([]string{"analytics", "machines", "-store", path, "-format", "json"}, &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), `"vmCode": "VM1"`)
+}
+
+func TestRun_Errors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(nil, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"analytics", "unknown", "-store", filepath.Join(t.TempDir(), "a.json")}, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"analytics", "summary", "-from", "2024-05-02", "-to", "2024-05-01"}, &stdout, &stderr))
+	t.Setenv("MERCHANT_CODE", "")
+	assert.Equal(t, 1, run([]string{"analytics", "ingest", "-machine", "VM1", "-store", filepath.Join(t.TempDir(), "a.json")}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "MERCHANT_CODE")
+}
+
+func TestParseRange_Timezone(t *testing.T) {
+	t.Setenv("AIFINIT_TIMEZONE", "UTC")
+	r, err := parseRange("2024-05-01", "2024-05-01")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), r.From)
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC).Add(-time.Millisecond), r.To)
+
+	t.Setenv("AIFINIT_TIMEZONE", "Mars/Olympus")
+	_, err = parseRange("2024-05-01", "")
+	assert.ErrorContains(t, err, "AIFINIT_TIMEZONE")
+}
@@ -0,0 +1,351 @@
+package aifinitsdk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OpenDoorGuard decides whether a door-open request may be forwarded to the platform.
+// Returning a non-nil error refuses the request.
+type OpenDoorGuard interface {
+	CheckOpenDoor(ctx context.Context, request *OpenDoorRequest, machineCode string) error
+}
+
+// ColdChainViolation describes why a cold chain check failed
+type ColdChainViolation string
+
+const (
+	ColdChainViolationTemperatureExcursion ColdChainViolation = "temperature_excursion" // Cabinet stayed above the safe temperature too long
+	ColdChainViolationOpenIncident         ColdChainViolation = "open_incident"         // A blocking maintenance exception is still active
+)
+
+// String returns the string representation of ColdChainViolation
+func (v ColdChainViolation) String() string {
+	violations := map[ColdChainViolation]string{
+		ColdChainViolationTemperatureExcursion: "Temperature excursion",
+		ColdChainViolationOpenIncident:         "Open incident",
+	}
+	if violation, ok := violations[v]; ok {
+		return violation
+	}
+	return "Unknown"
+}
+
+// ColdChainError is returned by OpenDoor when the cold chain guard refuses a shopping session
+type ColdChainError struct {
+	VmCode    string
+	Violation ColdChainViolation
+	// Temperature is the peak temperature observed during the excursion
+	Temperature float64
+	// Since is when the excursion started or the incident was triggered
+	Since time.Time
+	// Duration is how long the excursion lasted (zero for incidents)
+	Duration time.Duration
+	// Incident is the blocking maintenance exception (only for open incidents)
+	Incident MaintenanceExceptionCode
+}
+
+func (e *ColdChainError) Error() string {
+	switch e.Violation {
+	case ColdChainViolationTemperatureExcursion:
+		return fmt.Sprintf("cold chain broken on %s: above safe temperature for %s since %s (peak %.1f°C)",
+			e.VmCode, e.Duration.Round(time.Second), e.Since.Format(time.RFC3339), e.Temperature)
+	case ColdChainViolationOpenIncident:
+		return fmt.Sprintf("cold chain broken on %s: %s incident open since %s",
+			e.VmCode, e.Incident, e.Since.Format(time.RFC3339))
+	default:
+		return fmt.Sprintf("cold chain broken on %s: %s", e.VmCode, e.Violation)
+	}
+}
+
+// ColdChainPolicy configures when the cold chain guard blocks sales
+type ColdChainPolicy struct {
+	// MaxTemperature is the highest safe cabinet temperature in °C
+	MaxTemperature float64
+	// MaxExcursion is how long the cabinet may stay above MaxTemperature before sales are blocked
+	MaxExcursion time.Duration
+	// Window is how far back temperature samples are kept and evaluated
+	Window time.Duration
+	// BlockingIncidents are the maintenance exceptions that block sales while they are open.
+	// Defaults to Overheating, PowerOff and UPSPower.
+	BlockingIncidents []MaintenanceExceptionCode
+}
+
+// DefaultColdChainPolicy returns a policy suitable for chilled goods (8°C for 30 minutes within 24 hours)
+func DefaultColdChainPolicy() ColdChainPolicy {
+	return ColdChainPolicy{
+		MaxTemperature: 8,
+		MaxExcursion:   30 * time.Minute,
+		Window:         24 * time.Hour,
+		BlockingIncidents: []MaintenanceExceptionCode{
+			MaintenanceExceptionCodeOverheating,
+			MaintenanceExceptionCodePowerOff,
+			MaintenanceExceptionCodeUPSPower,
+		},
+	}
+}
+
+// ColdChainAuditRecord is written every time an operator overrides a cold chain block
+type ColdChainAuditRecord struct {
+	VmCode    string          `json:"vmCode"`
+	RequestID string          `json:"requestId"`
+	Operator  string          `json:"operator"`
+	Reason    string          `json:"reason"`
+	Violation *ColdChainError `json:"violation"`
+	At        time.Time       `json:"at"`
+}
+
+// ColdChainAuditor persists override audit records
+type ColdChainAuditor interface {
+	RecordOverride(record ColdChainAuditRecord) error
+}
+
+type coldChainOverrideKey struct{}
+
+type coldChainOverride struct {
+	operator string
+	reason   string
+}
+
+// WithColdChainOverride marks an OpenDoor call as an operator override of the cold chain guard.
+// The override is only honoured when an operator is given, and every use is audited.
+func WithColdChainOverride(ctx context.Context, operator, reason string) context.Context {
+	return context.WithValue(ctx, coldChainOverrideKey{}, coldChainOverride{operator: operator, reason: reason})
+}
+
+type temperatureSample struct {
+	temperature float64
+	at          time.Time
+}
+
+// ColdChainGuard blocks shopping door opens on machines whose cold chain is broken.
+// It keeps a temperature history per machine, fed by RecordTemperature and, when Devices is set,
+// by reading MachineDetail before each check. Maintenance exception callbacks keep track of open
+// Overheating/PowerOff/UPS incidents. Replenishment door opens are never blocked.
+type ColdChainGuard struct {
+	Policy ColdChainPolicy
+	// Devices is optional; when set the current cabinet temperature is sampled on every check
+	Devices VendingMachineManageClient
+	// Auditor is optional; overrides are always kept in memory and also forwarded here
+	Auditor ColdChainAuditor
+
+	mu        sync.Mutex
+	samples   map[string][]temperatureSample
+	incidents map[string]map[MaintenanceExceptionCode]time.Time
+	audit     []ColdChainAuditRecord
+	now       func() time.Time
+}
+
+// NewColdChainGuard creates a guard using the given policy
+func NewColdChainGuard(policy ColdChainPolicy, devices VendingMachineManageClient) *ColdChainGuard {
+	if len(policy.BlockingIncidents) == 0 {
+		policy.BlockingIncidents = DefaultColdChainPolicy().BlockingIncidents
+	}
+	if policy.Window == 0 {
+		policy.Window = DefaultColdChainPolicy().Window
+	}
+
+	return &ColdChainGuard{
+		Policy:    policy,
+		Devices:   devices,
+		samples:   make(map[string][]temperatureSample),
+		incidents: make(map[string]map[MaintenanceExceptionCode]time.Time),
+		now:       time.Now,
+	}
+}
+
+// RecordTemperature adds a cabinet temperature sample for a machine
+func (g *ColdChainGuard) RecordTemperature(vmCode string, temperature float64, at time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	samples := append(g.samples[vmCode], temperatureSample{temperature: temperature, at: at})
+	sort.Slice(samples, func(i, j int) bool { return samples[i].at.Before(samples[j].at) })
+
+	cutoff := g.now().Add(-g.Policy.Window)
+	first := 0
+	for first < len(samples) && samples[first].at.Before(cutoff) {
+		first++
+	}
+	g.samples[vmCode] = samples[first:]
+}
+
+// HandleMaintenanceException tracks blocking incidents from the alarm notification callback
+func (g *ColdChainGuard) HandleMaintenanceException(request *MaintenanceExceptionNotificationCallbackRequest) {
+	if request == nil || !g.isBlocking(request.ExCode) {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	open := g.incidents[request.VmCode]
+	if open == nil {
+		open = make(map[MaintenanceExceptionCode]time.Time)
+		g.incidents[request.VmCode] = open
+	}
+
+	switch request.Status {
+	case MaintenanceExceptionStatusTriggered:
+		if _, ok := open[request.ExCode]; !ok {
+			open[request.ExCode] = request.NotifyTime.Time
+		}
+	case MaintenanceExceptionStatusRecovered:
+		delete(open, request.ExCode)
+	}
+}
+
+// Check evaluates the cold chain of a machine without an OpenDoor request
+func (g *ColdChainGuard) Check(vmCode string) *ColdChainError {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if violation := g.openIncident(vmCode); violation != nil {
+		return violation
+	}
+	return g.excursion(vmCode)
+}
+
+// CheckOpenDoor implements OpenDoorGuard
+func (g *ColdChainGuard) CheckOpenDoor(ctx context.Context, request *OpenDoorRequest, machineCode string) error {
+	if request.Type != OpenDoorForShopping {
+		return nil
+	}
+
+	if g.Devices != nil {
+		detail, err := g.Devices.MachineDetail(machineCode)
+		if err != nil {
+			logrus.WithError(err).WithField("device_code", machineCode).Warn("Cold chain guard could not sample temperature")
+		} else {
+			g.RecordTemperature(machineCode, detail.Data.Temperature, g.now())
+		}
+	}
+
+	violation := g.Check(machineCode)
+	if violation == nil {
+		return nil
+	}
+
+	override, ok := ctx.Value(coldChainOverrideKey{}).(coldChainOverride)
+	if !ok || override.operator == "" {
+		return violation
+	}
+
+	record := ColdChainAuditRecord{
+		VmCode:    machineCode,
+		RequestID: request.RequestID,
+		Operator:  override.operator,
+		Reason:    override.reason,
+		Violation: violation,
+		At:        g.now(),
+	}
+
+	if g.Auditor != nil {
+		if err := g.Auditor.RecordOverride(record); err != nil {
+			// An override that cannot be audited is not honoured
+			return fmt.Errorf("cold chain override audit failed: %w", err)
+		}
+	}
+
+	g.mu.Lock()
+	g.audit = append(g.audit, record)
+	g.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"device_code": machineCode,
+		"request_id":  request.RequestID,
+		"operator":    override.operator,
+		"violation":   violation.Error(),
+	}).Warn("Cold chain block overridden by operator")
+
+	return nil
+}
+
+// AuditLog returns all override records kept in memory
+func (g *ColdChainGuard) AuditLog() []ColdChainAuditRecord {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]ColdChainAuditRecord(nil), g.audit...)
+}
+
+func (g *ColdChainGuard) isBlocking(code MaintenanceExceptionCode) bool {
+	for _, blocking := range g.Policy.BlockingIncidents {
+		if blocking == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *ColdChainGuard) openIncident(vmCode string) *ColdChainError {
+	var worst *ColdChainError
+	for code, since := range g.incidents[vmCode] {
+		if worst == nil || since.Before(worst.Since) {
+			worst = &ColdChainError{
+				VmCode:    vmCode,
+				Violation: ColdChainViolationOpenIncident,
+				Since:     since,
+				Incident:  code,
+			}
+		}
+	}
+	return worst
+}
+
+// excursion finds the longest run of samples above the safe temperature within the window.
+// A run that is still ongoing at the latest sample is assumed to last until now.
+func (g *ColdChainGuard) excursion(vmCode string) *ColdChainError {
+	now := g.now()
+	cutoff := now.Add(-g.Policy.Window)
+
+	var (
+		worst   *ColdChainError
+		start   time.Time
+		peak    float64
+		running bool
+	)
+
+	closeRun := func(end time.Time) {
+		duration := end.Sub(start)
+		if duration > g.Policy.MaxExcursion && (worst == nil || duration > worst.Duration) {
+			worst = &ColdChainError{
+				VmCode:      vmCode,
+				Violation:   ColdChainViolationTemperatureExcursion,
+				Temperature: peak,
+				Since:       start,
+				Duration:    duration,
+			}
+		}
+		running = false
+	}
+
+	for _, sample := range g.samples[vmCode] {
+		if sample.at.Before(cutoff) {
+			continue
+		}
+		if sample.temperature > g.Policy.MaxTemperature {
+			if !running {
+				running = true
+				start = sample.at
+				peak = sample.temperature
+			} else if sample.temperature > peak {
+				peak = sample.temperature
+			}
+			continue
+		}
+		if running {
+			closeRun(sample.at)
+		}
+	}
+	if running {
+		closeRun(now)
+	}
+
+	return worst
+}
@@ -0,0 +1,125 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"resty.dev/v3"
+)
+
+func newGuardedOperationClient(t *testing.T, guard OpenDoorGuard, calls *int) OperationClient {
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		respBytes, _ := json.Marshal(OpenDoorResponse{Status: OpenDoorStatusSuccess, Message: "OK"})
+
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json")
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(bytes.NewBuffer(respBytes)),
+			Header:     header,
+		}, nil
+	}))
+
+	return NewOperationClientImpl(&MockClient{RestyClient: restyClient}, WithOpenDoorGuard(guard))
+}
+
+func TestColdChainGuard_BlocksLongExcursion(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewColdChainGuard(DefaultColdChainPolicy(), nil)
+	guard.now = func() time.Time { return now }
+
+	guard.RecordTemperature("vm1", 4, now.Add(-3*time.Hour))
+	guard.RecordTemperature("vm1", 11, now.Add(-2*time.Hour))
+	guard.RecordTemperature("vm1", 12.5, now.Add(-90*time.Minute))
+	guard.RecordTemperature("vm1", 5, now.Add(-time.Hour))
+
+	calls := 0
+	ops := newGuardedOperationClient(t, guard, &calls)
+
+	_, err := ops.OpenDoor(context.Background(), &OpenDoorRequest{Type: OpenDoorForShopping, RequestID: "r1"}, "vm1")
+	var coldChainErr *ColdChainError
+	if assert.True(t, errors.As(err, &coldChainErr)) {
+		assert.Equal(t, ColdChainViolationTemperatureExcursion, coldChainErr.Violation)
+		assert.Equal(t, time.Hour, coldChainErr.Duration)
+		assert.Equal(t, 12.5, coldChainErr.Temperature)
+	}
+	assert.Equal(t, 0, calls)
+
+	// Replenishment is still allowed so staff can remove spoiled stock
+	_, err = ops.OpenDoor(context.Background(), &OpenDoorRequest{Type: OpenDoorForReplenishment, RequestID: "r2"}, "vm1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestColdChainGuard_ShortExcursionAllowed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewColdChainGuard(DefaultColdChainPolicy(), nil)
+	guard.now = func() time.Time { return now }
+
+	guard.RecordTemperature("vm1", 10, now.Add(-20*time.Minute))
+	guard.RecordTemperature("vm1", 6, now.Add(-5*time.Minute))
+
+	assert.Nil(t, guard.Check("vm1"))
+}
+
+func TestColdChainGuard_OpenIncidentAndOverride(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	guard := NewColdChainGuard(DefaultColdChainPolicy(), nil)
+	guard.now = func() time.Time { return now }
+
+	guard.HandleMaintenanceException(&MaintenanceExceptionNotificationCallbackRequest{
+		ExCode:     MaintenanceExceptionCodePowerOff,
+		Status:     MaintenanceExceptionStatusTriggered,
+		VmCode:     "vm1",
+		NotifyTime: MillisOf(now.Add(-10 * time.Minute)),
+	})
+	// Non-blocking incidents are ignored
+	guard.HandleMaintenanceException(&MaintenanceExceptionNotificationCallbackRequest{
+		ExCode: MaintenanceExceptionCodeCameraIssue,
+		Status: MaintenanceExceptionStatusTriggered,
+		VmCode: "vm2",
+	})
+	assert.Nil(t, guard.Check("vm2"))
+
+	calls := 0
+	ops := newGuardedOperationClient(t, guard, &calls)
+	request := &OpenDoorRequest{Type: OpenDoorForShopping, RequestID: "r1"}
+
+	_, err := ops.OpenDoor(context.Background(), request, "vm1")
+	var coldChainErr *ColdChainError
+	if assert.True(t, errors.As(err, &coldChainErr)) {
+		assert.Equal(t, ColdChainViolationOpenIncident, coldChainErr.Violation)
+		assert.Equal(t, MaintenanceExceptionCodePowerOff, coldChainErr.Incident)
+	}
+
+	// An override without an operator is not honoured
+	_, err = ops.OpenDoor(WithColdChainOverride(context.Background(), "", "no one"), request, "vm1")
+	assert.Error(t, err)
+
+	_, err = ops.OpenDoor(WithColdChainOverride(context.Background(), "alice", "probe replaced"), request, "vm1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	audit := guard.AuditLog()
+	if assert.Len(t, audit, 1) {
+		assert.Equal(t, "alice", audit[0].Operator)
+		assert.Equal(t, "r1", audit[0].RequestID)
+		assert.Equal(t, ColdChainViolationOpenIncident, audit[0].Violation.Violation)
+	}
+
+	guard.HandleMaintenanceException(&MaintenanceExceptionNotificationCallbackRequest{
+		ExCode: MaintenanceExceptionCodePowerOff,
+		Status: MaintenanceExceptionStatusRecovered,
+		VmCode: "vm1",
+	})
+	assert.Nil(t, guard.Check("vm1"))
+}
@@ -0,0 +1,282 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DateTimeLayout is the wire format of platform date strings ("YYYY-MM-DD HH:MM:SS")
+const DateTimeLayout = "2006-01-02 15:04:05"
+
+// PlatformLocation is the timezone the platform writes date strings in and timestamps are presented
+// in, unless a client's Config.Timezone says otherwise. Values decoded outside a client, such as
+// callbacks and local files, use it.
+var PlatformLocation = time.FixedZone("UTC+8", 8*60*60)
+
+// DateTime is a platform date string decoded into a time.Time.
+// It marshals back to the exact "YYYY-MM-DD HH:MM:SS" wire format; the zero value is an empty string.
+type DateTime struct {
+	time.Time
+}
+
+// ParseDateTime parses a "YYYY-MM-DD HH:MM:SS" string in the platform timezone
+func ParseDateTime(value string) (DateTime, error) {
+	if value == "" {
+		return DateTime{}, nil
+	}
+
+	t, err := time.ParseInLocation(DateTimeLayout, value, PlatformLocation)
+	if err != nil {
+		return DateTime{}, fmt.Errorf("invalid platform date %q: %w", value, err)
+	}
+	return DateTime{Time: t}, nil
+}
+
+// String returns the wire representation in PlatformLocation
+func (d DateTime) String() string {
+	return d.StringIn(PlatformLocation)
+}
+
+// StringIn returns the wire representation in a platform timezone
+func (d DateTime) StringIn(location *time.Location) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.In(location).Format(DateTimeLayout)
+}
+
+func (d DateTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *DateTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*d = DateTime{}
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := ParseDateTime(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Millis is a platform timestamp in milliseconds since the epoch, decoded into a time.Time in the
+// platform timezone. It accepts integers, floats (as DeviceUpdateTimestamp is sent) and numeric
+// strings, and marshals back to a number of milliseconds; the zero value is 0.
+type Millis struct {
+	time.Time
+}
+
+// MillisOf wraps a time; the zero time stays zero
+func MillisOf(t time.Time) Millis {
+	if t.IsZero() {
+		return Millis{}
+	}
+	return Millis{Time: t.In(PlatformLocation)}
+}
+
+// FromUnixMilli converts a millisecond timestamp; 0 is the zero time
+func FromUnixMilli(ms int64) Millis {
+	if ms == 0 {
+		return Millis{}
+	}
+	return Millis{Time: time.UnixMilli(ms).In(PlatformLocation)}
+}
+
+// Milliseconds returns the wire value, 0 for the zero time
+func (m Millis) Milliseconds() int64 {
+	if m.IsZero() {
+		return 0
+	}
+	return m.UnixMilli()
+}
+
+// String returns the wire value, keeping a fraction of a millisecond when there is one
+func (m Millis) String() string {
+	if m.IsZero() {
+		return "0"
+	}
+	ms := m.UnixMilli()
+	if fraction := m.UnixNano() - ms*int64(time.Millisecond); fraction != 0 {
+		return strconv.FormatFloat(float64(m.UnixNano())/float64(time.Millisecond), 'f', -1, 64)
+	}
+	return strconv.FormatInt(ms, 10)
+}
+
+func (m Millis) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Millis) UnmarshalJSON(data []byte) error {
+	value := string(bytes.Trim(data, `"`))
+	if value == "null" || value == "" {
+		*m = Millis{}
+		return nil
+	}
+
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*m = FromUnixMilli(ms)
+		return nil
+	}
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(ms) || math.IsInf(ms, 0) || math.Abs(ms) > math.MaxInt64/float64(time.Millisecond) {
+		return fmt.Errorf("invalid platform timestamp %s", value)
+	}
+	if ms == 0 {
+		*m = Millis{}
+		return nil
+	}
+	*m = Millis{Time: time.Unix(0, int64(math.Round(ms*float64(time.Millisecond)))).In(PlatformLocation)}
+	return nil
+}
+
+// TimeRange is a period [From, To] given to list requests. A zero bound is left open.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// LastDays is the range of the last days up to now
+func LastDays(days int) TimeRange {
+	now := time.Now()
+	return TimeRange{From: now.AddDate(0, 0, -days), To: now}
+}
+
+// Validate checks that the range is not reversed
+func (r TimeRange) Validate() error {
+	if !r.From.IsZero() && !r.To.IsZero() && r.To.Before(r.From) {
+		return fmt.Errorf("time range ends (%s) before it starts (%s)", r.To.Format(time.RFC3339), r.From.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Contains reports whether t lies within the range, bounds included
+func (r TimeRange) Contains(t time.Time) bool {
+	return (r.From.IsZero() || !t.Before(r.From)) && (r.To.IsZero() || !t.After(r.To))
+}
+
+// relocator is a decoded value whose meaning depends on the platform timezone
+type relocator interface {
+	// relocate moves the value from the platform timezone it was read or is to be written in to another
+	relocate(from, to *time.Location)
+}
+
+var relocatorType = reflect.TypeFor[relocator]()
+
+// relocate keeps the wall clock: "08:00" read in from is "08:00" in to
+func (d *DateTime) relocate(from, to *time.Location) {
+	if d.IsZero() {
+		return
+	}
+	t := d.In(from)
+	d.Time = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), to)
+}
+
+// relocate keeps the instant and presents it in to
+func (m *Millis) relocate(_, to *time.Location) {
+	if !m.IsZero() {
+		m.Time = m.In(to)
+	}
+}
+
+// relocateValue moves every relocator reachable from v, which must be settable, between platform
+// timezones. Pointers, slices, maps and interfaces on the way are copied rather than written
+// through, so values shared with the caller are left alone.
+func relocateValue(v reflect.Value, from, to *time.Location) {
+	if !mayRelocate(v.Type()) {
+		return
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(relocatorType) {
+		v.Addr().Interface().(relocator).relocate(from, to)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(v.Elem())
+		relocateValue(copied.Elem(), from, to)
+		v.Set(copied)
+	case reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.New(v.Elem().Type()).Elem()
+		copied.Set(v.Elem())
+		relocateValue(copied, from, to)
+		v.Set(copied)
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if field := v.Field(i); field.CanSet() {
+				relocateValue(field, from, to)
+			}
+		}
+	case reflect.Array:
+		for i := range v.Len() {
+			relocateValue(v.Index(i), from, to)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(copied, v)
+		for i := range copied.Len() {
+			relocateValue(copied.Index(i), from, to)
+		}
+		v.Set(copied)
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for entries := v.MapRange(); entries.Next(); {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(entries.Value())
+			relocateValue(value, from, to)
+			copied.SetMapIndex(entries.Key(), value)
+		}
+		v.Set(copied)
+	}
+}
+
+// relocatable caches mayRelocate per type
+var relocatable sync.Map
+
+// mayRelocate reports whether values of t can hold a relocator
+func mayRelocate(t reflect.Type) bool {
+	if cached, ok := relocatable.Load(t); ok {
+		return cached.(bool)
+	}
+	// A type that refers to itself is assumed to while it is being looked at
+	relocatable.Store(t, true)
+	found := reflect.PointerTo(t).Implements(relocatorType)
+	switch t.Kind() {
+	case reflect.Interface:
+		found = true
+	case reflect.Pointer, reflect.Array, reflect.Slice, reflect.Map:
+		found = found || mayRelocate(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField() && !found; i++ {
+			found = t.Field(i).IsExported() && mayRelocate(t.Field(i).Type)
+		}
+	}
+	relocatable.Store(t, found)
+	return found
+}
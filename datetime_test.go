@@ -0,0 +1,126 @@
+package aifinitsdk
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"resty.dev/v3"
+)
+
+func TestMillis_JSON(t *testing.T) {
+	var order DoorOpenCloseShoppingResult
+	assert.NoError(t, json.Unmarshal([]byte(`{"openDoorTime":1714521600000,"closeDoorTime":"1714521660000"}`), &order))
+	assert.True(t, order.OpenDoorTime.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, PlatformLocation, order.OpenDoorTime.Location())
+	assert.Equal(t, int64(1714521660000), order.CloseDoorTime.Milliseconds())
+
+	// Heartbeats arrive as floats and keep their fraction of a millisecond
+	var device Device
+	assert.NoError(t, json.Unmarshal([]byte(`{"deviceUpdateTimestamp":1714521600000.5}`), &device))
+	assert.Equal(t, "1714521600000.5", device.DeviceUpdateTimestamp.String())
+	data, err := json.Marshal(struct {
+		At Millis `json:"at"`
+	}{At: device.DeviceUpdateTimestamp})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"at":1714521600000.5}`, string(data))
+
+	// Zero is the zero time and is left out where the field is optional
+	var alarm OperationalExceptionNotificationCallbackRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"sendTime":0,"videoSendTime":null}`), &alarm))
+	assert.True(t, alarm.SendTime.IsZero())
+	data, err = json.Marshal(alarm)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"sendTime":0`)
+	assert.NotContains(t, string(data), "videoSendTime")
+
+	assert.Error(t, json.Unmarshal([]byte(`{"sendTime":"yesterday"}`), &alarm))
+}
+
+func TestConfig_Timezone(t *testing.T) {
+	var body []byte
+	var updatedTime string
+	platform := func() Client {
+		restyClient := resty.New()
+		restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Body != nil {
+				body, _ = io.ReadAll(req.Body)
+			}
+			updatedTime = req.URL.Query().Get("updatedTime")
+			switch req.URL.Path {
+			case Post_VendingMachinePeopleFlow:
+				return jsonResponse(`{"status":200,"result":[{"code":"VM1","visitorCount":3,"aggregateTime":"2024-05-01 08"}]}`), nil
+			case Get_ProductList:
+				return jsonResponse(`{"status":200,"data":{"total":0}}`), nil
+			}
+			return jsonResponse(`{"status":200,"data":{"updateTime":"2024-05-01 08:00:00"}}`), nil
+		}))
+		return New(Crendetials{MerchantCode: "M1", SecretKey: "4UafmbIJroNY2lXX"}, restyClient, "")
+	}
+	ulaanbaatar := PlatformLocation
+	utc := platform()
+	utc.SetConfig(Config{Timezone: time.UTC})
+	assert.Equal(t, time.UTC, utc.Location())
+	defaults := platform()
+	assert.Equal(t, ulaanbaatar, defaults.Location())
+
+	// Each client reads date strings in its own zone
+	info, err := NewDeviceClient(utc).DeviceInfo("VM1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), info.Data.UpdateTime.Time)
+	info, err = NewDeviceClient(defaults).DeviceInfo("VM1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, ulaanbaatar), info.Data.UpdateTime.Time)
+	assert.Equal(t, ulaanbaatar, PlatformLocation)
+
+	flow, err := NewDeviceClient(utc).PeopleFlow(&DevicePeopleFlowRequest{}, "VM1")
+	require.NoError(t, err)
+	at, err := flow.Result[0].Time()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), at)
+
+	// and writes them in it, without touching the request
+	created := time.Date(2024, 5, 1, 16, 0, 0, 0, ulaanbaatar)
+	request := &SourceMaterialApplyRequest{SourceMaterialList: []SourceMaterial{{Name: "ad", CreateTime: DateTime{Time: created}}}}
+	_, err = NewAdvertisementManageClient(utc).MaterialApply(request)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"createTime":"2024-05-01 08:00:00"`)
+	assert.Equal(t, created, request.SourceMaterialList[0].CreateTime.Time)
+	_, err = NewProductClient(utc).ProductListWithFilter(&ProductListPage{UpdatedTime: created})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-05-01 08:00:00", updatedTime)
+
+	// Values decoded outside a client use PlatformLocation
+	var data DeviceInfoData
+	require.NoError(t, json.Unmarshal([]byte(`{"updateTime":"2024-05-01 08:00:00"}`), &data))
+	assert.Equal(t, time.Date(2024, 5, 1, 8, 0, 0, 0, ulaanbaatar), data.UpdateTime.Time)
+	encoded, err := json.Marshal(DeviceInfoData{UpdateTime: DateTime{Time: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}})
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"updateTime":"2024-05-01 08:00:00"`)
+}
+
+func TestListOrders_TimeRange(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "1714521600000", req.URL.Query().Get("beginTime"))
+		assert.Equal(t, "1714608000000", req.URL.Query().Get("endTime"))
+		return jsonResponse(`{"status":200,"data":{"total":0,"rows":[]}}`), nil
+	}))
+	operations := NewOperationClientImpl(&MockClient{RestyClient: restyClient})
+
+	request := (&ListOrderRequest{Page: 1}).SetRange(TimeRange{From: from, To: from.Add(24 * time.Hour)})
+	_, err := operations.ListOrders(request, "VM1")
+	assert.NoError(t, err)
+
+	_, err = operations.ListOrders((&ListOrderRequest{}).SetRange(TimeRange{From: from, To: from.Add(-time.Hour)}), "VM1")
+	assert.ErrorContains(t, err, "before it starts")
+
+	r := TimeRange{From: from}
+	assert.True(t, r.Contains(from))
+	assert.False(t, r.Contains(from.Add(-time.Second)))
+}
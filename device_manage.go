@@ -3,9 +3,9 @@ package aifinitsdk
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-playground/validator"
 	"github.com/sirupsen/logrus"
 	"resty.dev/v3"
 )
@@ -19,6 +19,11 @@ func (e *AinfinitError) Error() string {
 	return fmt.Sprintf("[ainfinit] %v", e.Err)
 }
 
+// Unwrap returns the underlying error so typed errors can be matched with errors.As
+func (e *AinfinitError) Unwrap() error {
+	return e.Err
+}
+
 // NewAinfinitError creates a new AinfinitError
 func NewAinfinitError(err error) error {
 	return &AinfinitError{Err: err}
@@ -63,8 +68,7 @@ func (c *vendingMachineManageClient) Update(request *DeviceUpdateRequest, machin
 		}).Debug("Updating vending machine")
 	}
 
-	validate := validator.New()
-	if err := validate.Struct(request); err != nil {
+	if err := validateRequest(request); err != nil {
 		return nil, NewAinfinitError(err)
 	}
 
@@ -179,6 +183,13 @@ func (c *vendingMachineManageClient) PeopleFlow(request *DevicePeopleFlowRequest
 		return nil, NewAinfinitError(err)
 	}
 
+	if err := (TimeRange{From: request.StartTimeStamp.Time, To: request.EndTimeStamp.Time}).Validate(); err != nil {
+		return nil, NewAinfinitError(err)
+	}
+	if err := request.Field.Validate(); err != nil {
+		return nil, NewAinfinitError(err)
+	}
+
 	var result DevicePeopleFlowResponse
 	resp, err := c.Resty.R().SetHeader("Authorization", signature).SetBody(request).SetResult(&result).
 		Post(Post_VendingMachinePeopleFlow)
@@ -249,6 +260,10 @@ func (c *vendingMachineManageClient) Control(request *DeviceControlRequest, mach
 		}).Debug("Controlling vending machine")
 	}
 
+	if err := validateRequest(request); err != nil {
+		return nil, NewAinfinitError(err)
+	}
+
 	signature, err := c.Client.GetSignature(time.Now().UnixMilli())
 	if err != nil {
 		return nil, NewAinfinitError(err)
@@ -342,6 +357,10 @@ func (c *vendingMachineManageClient) RefrigerationControl(request RefrigerationC
 		logrus.WithField("request", request).Debug("RefrigerationControl requested")
 	}
 
+	if err := validateRequest(request); err != nil {
+		return nil, NewAinfinitError(err)
+	}
+
 	signature, err := c.Client.GetSignature(time.Now().UnixMilli())
 	if err != nil {
 		return nil, NewAinfinitError(err)
@@ -370,11 +389,10 @@ func (c *vendingMachineManageClient) RefrigerationControl(request RefrigerationC
 }
 
 type RefrigerationControlRequest struct {
-	VmCode      string `json:"replVideoUploadFlag"` // Restocking video upload, 0 = No, 1 = Yes
-	ComprEnable int    `json:"comprEnable"`         // thermostat switch: 1 on, 0 off
-	Temp        int    `json:"temp"`                // refrigeration:(-28~-18), heating (30-50)
-	TempMode    int    `json:"tempMode"`            // 0: normal temp, 10: refrigeration, 11: refrigeration energy saving, 20: heating mode, 21: heating energy saving
-
+	VmCode      string `json:"vmCode"`                                  // Vending machine code
+	ComprEnable int    `json:"comprEnable" validate:"oneof=0 1"`        // thermostat switch: 1 on, 0 off
+	Temp        int    `json:"temp"`                                    // refrigeration:(-28~-18), heating (30-50), checked against TempMode
+	TempMode    int    `json:"tempMode" validate:"oneof=0 10 11 20 21"` // 0: normal temp, 10: refrigeration, 11: refrigeration energy saving, 20: heating mode, 21: heating energy saving
 }
 
 type RefrigerationControlResponse struct {
@@ -455,7 +473,7 @@ type Device struct {
 	// PowerStatus represents the power source (1: mains power, 2: UPS)
 	PowerStatus int `json:"powerStatus"`
 	// DeviceUpdateTimestamp represents the last heartbeat timestamp
-	DeviceUpdateTimestamp float64 `json:"deviceUpdateTimestamp"`
+	DeviceUpdateTimestamp Millis `json:"deviceUpdateTimestamp"`
 	// OnlineStatus represents the network status (1: online, 0: offline, calculated based on heartbeat timestamp)
 	OnlineStatus float64 `json:"onlineStatus"`
 	// Temperature represents the current temperature
@@ -469,17 +487,85 @@ type Device struct {
 }
 
 type VendingMachine struct {
-	DeviceSn   string `json:"deviceSn"`
-	ScanCode   string `json:"scanCode"`
-	Name       string `json:"name"`
-	Location   string `json:"location"`
-	UpdateTime string `json:"updateTime"`
+	DeviceSn   string   `json:"deviceSn"`
+	ScanCode   string   `json:"scanCode"`
+	Name       string   `json:"name"`
+	Location   string   `json:"location"`
+	UpdateTime DateTime `json:"updateTime"`
+}
+
+// PeopleFlowField is the granularity the platform aggregates visitor counts by
+type PeopleFlowField string
+
+const (
+	PeopleFlowByHour  PeopleFlowField = "hour"
+	PeopleFlowByDay   PeopleFlowField = "day"
+	PeopleFlowByMonth PeopleFlowField = "month"
+)
+
+// Truncate returns the start of the bucket t falls in, in t's location
+func (f PeopleFlowField) Truncate(t time.Time) time.Time {
+	switch f {
+	case PeopleFlowByHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case PeopleFlowByMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// Next returns the start of the bucket after the one starting at start
+func (f PeopleFlowField) Next(start time.Time) time.Time {
+	switch f {
+	case PeopleFlowByHour:
+		return start.Add(time.Hour)
+	case PeopleFlowByMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+func (f PeopleFlowField) Validate() error {
+	switch f {
+	case "", PeopleFlowByHour, PeopleFlowByDay, PeopleFlowByMonth:
+		return nil
+	}
+	return fmt.Errorf("unknown people flow field %q", string(f))
 }
 
 type PeopleFlow struct {
 	Code          string `json:"code"`
 	VisitorCount  int    `json:"visitorCount"`
 	AggregateTime string `json:"aggregateTime"`
+
+	location *time.Location // platform timezone of the client that decoded it
+}
+
+func (p *PeopleFlow) relocate(_, to *time.Location) {
+	p.location = to
+}
+
+// peopleFlowLayouts are the aggregate time formats seen per granularity, longest first
+var peopleFlowLayouts = []string{DateTimeLayout, "2006-01-02 15:04", "2006-01-02 15", time.DateOnly, "2006-01"}
+
+// Time parses AggregateTime, a platform date of the bucket start or unix milliseconds
+func (p PeopleFlow) Time() (time.Time, error) {
+	location := p.location
+	if location == nil {
+		location = PlatformLocation
+	}
+	value := strings.TrimSpace(p.AggregateTime)
+	for _, layout := range peopleFlowLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return FromUnixMilli(ms).In(location), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid people flow aggregate time %q", p.AggregateTime)
 }
 
 type ListMachineRequest struct {
@@ -489,10 +575,17 @@ type ListMachineRequest struct {
 }
 
 type DevicePeopleFlowRequest struct {
-	Field          string   `json:"field,omitempty"`
-	StartTimeStamp int64    `json:"startTimestamp,omitempty"`
-	EndTimeStamp   int64    `json:"endTimestamp,omitempty"`
-	Codes          []string `json:"codes,omitempty"`
+	Field          PeopleFlowField `json:"field,omitempty"`
+	StartTimeStamp Millis          `json:"startTimestamp,omitzero"`
+	EndTimeStamp   Millis          `json:"endTimestamp,omitzero"`
+	Codes          []string        `json:"codes,omitempty"`
+}
+
+// SetRange sets StartTimeStamp and EndTimeStamp from a time range
+func (r *DevicePeopleFlowRequest) SetRange(tr TimeRange) *DevicePeopleFlowRequest {
+	r.StartTimeStamp = MillisOf(tr.From)
+	r.EndTimeStamp = MillisOf(tr.To)
+	return r
 }
 
 type DeviceUpdateRequest struct {
@@ -501,17 +594,19 @@ type DeviceUpdateRequest struct {
 	ScanCode      string `json:"scanCode,omitempty"`
 	ContactNumber string `json:"contactNumber,omitempty"`
 	Location      string `json:"location,omitempty"`
-	Volume        int    `json:"volume,omitempty"`
-	AdVolume      int    `json:"adVolume,omitempty"`
-	Temp          int    `json:"temp,omitempty"`
-	EngineOn      int    `json:"engineOn,omitempty"`
+	Volume        *int   `json:"volume,omitempty" validate:"omitempty,min=0,max=100"`
+	AdVolume      *int   `json:"adVolume,omitempty" validate:"omitempty,min=0,max=100"`
+	Temp          *int   `json:"temp,omitempty" validate:"omitempty,min=-30,max=20"`
+	EngineOn      *int   `json:"engineOn,omitempty" validate:"omitempty,oneof=0 1"`
 }
 
+// DeviceControlRequest fields are pointers so that an explicit zero (mute, compressor off)
+// is sent to the machine while unset fields are left out. Use Int to fill them.
 type DeviceControlRequest struct {
-	Volume   int `json:"volume,omitempty"`   // 0 ~ 100
-	AdVolume int `json:"adVolume,omitempty"` // 0 ~ 100
-	Temp     int `json:"temp,omitempty"`     // -30 ~ 20
-	EngineOn int `json:"engineOn,omitempty"` // 0 | 1
+	Volume   *int `json:"volume,omitempty" validate:"omitempty,min=0,max=100"`   // 0 ~ 100
+	AdVolume *int `json:"adVolume,omitempty" validate:"omitempty,min=0,max=100"` // 0 ~ 100
+	Temp     *int `json:"temp,omitempty" validate:"omitempty,min=-30,max=20"`    // -30 ~ 20
+	EngineOn *int `json:"engineOn,omitempty" validate:"omitempty,oneof=0 1"`     // 0 | 1
 }
 type MachineDetailResponse struct {
 	Status  int    `json:"status"`
@@ -542,13 +637,13 @@ type DeviceInfoResponse struct {
 }
 
 type DeviceInfoData struct {
-	Code          string `json:"code"`
-	Name          string `json:"name"`
-	ScanCode      string `json:"scanCode"`
-	DeviceSn      string `json:"deviceSn"`
-	ContactNumber string `json:"contactNumber"`
-	Location      string `json:"location"`
-	UpdateTime    string `json:"updateTime"`
+	Code          string   `json:"code"`
+	Name          string   `json:"name"`
+	ScanCode      string   `json:"scanCode"`
+	DeviceSn      string   `json:"deviceSn"`
+	ContactNumber string   `json:"contactNumber"`
+	Location      string   `json:"location"`
+	UpdateTime    DateTime `json:"updateTime"`
 }
 
 type DeviceUpdateResponse struct {
@@ -0,0 +1,65 @@
+package aifinitsdk
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"resty.dev/v3"
+)
+
+func TestPeopleFlowField(t *testing.T) {
+	at := time.Date(2024, 5, 17, 14, 35, 0, 0, PlatformLocation)
+
+	assert.Equal(t, time.Date(2024, 5, 17, 14, 0, 0, 0, PlatformLocation), PeopleFlowByHour.Truncate(at))
+	assert.Equal(t, time.Date(2024, 5, 17, 0, 0, 0, 0, PlatformLocation), PeopleFlowByDay.Truncate(at))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, PlatformLocation), PeopleFlowByMonth.Truncate(at))
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, PlatformLocation), PeopleFlowByMonth.Next(PeopleFlowByMonth.Truncate(at)))
+	assert.NoError(t, PeopleFlowField("").Validate())
+	assert.Error(t, PeopleFlowField("week").Validate())
+}
+
+func TestPeopleFlow_Time(t *testing.T) {
+	hour := time.Date(2024, 5, 17, 14, 0, 0, 0, PlatformLocation)
+	for _, value := range []string{"2024-05-17 14:00:00", "2024-05-17 14:00", "2024-05-17 14", "1715925600000"} {
+		parsed, err := PeopleFlow{AggregateTime: value}.Time()
+		require.NoError(t, err, value)
+		assert.True(t, hour.Equal(parsed), value)
+	}
+
+	parsed, err := PeopleFlow{AggregateTime: "2024-05"}.Time()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, PlatformLocation), parsed)
+
+	_, err = PeopleFlow{AggregateTime: "yesterday"}.Time()
+	assert.Error(t, err)
+}
+
+func TestPeopleFlow_Request(t *testing.T) {
+	var body map[string]any
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		data, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(data, &body))
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"status":200,"result":[{"code":"VM1","visitorCount":3,"aggregateTime":"2024-05-17 14"}]}`)),
+		}, nil
+	}))
+	client := NewDeviceClient(&MockClient{RestyClient: restyClient})
+
+	request := &DevicePeopleFlowRequest{Field: PeopleFlowByHour, Codes: []string{"VM1"}}
+	response, err := client.PeopleFlow(request, "VM1")
+	require.NoError(t, err)
+	assert.Equal(t, "hour", body["field"])
+	assert.Equal(t, 3, response.Result[0].VisitorCount)
+
+	_, err = client.PeopleFlow(&DevicePeopleFlowRequest{Field: "week"}, "VM1")
+	assert.ErrorContains(t, err, "week")
+}
@@ -0,0 +1,342 @@
+package aifinitsdk
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceProfile is a set of refrigeration and volume settings applied to a machine at a schedule transition.
+// Nil sections are left untouched.
+type DeviceProfile struct {
+	Name string
+	// Refrigeration is sent through RefrigerationControl; VmCode is filled in per machine
+	Refrigeration *RefrigerationControlRequest
+	// Control is sent through Control (volume, ad volume)
+	Control *DeviceControlRequest
+}
+
+// ProfileTransition switches machines to Profile at the given local time of day
+type ProfileTransition struct {
+	// Days the transition fires on; empty means every day
+	Days []time.Weekday
+	// At is the local time of day in "15:04" format
+	At      string
+	Profile DeviceProfile
+}
+
+// DeviceSchedule applies profile transitions to a machine or a group of machines
+type DeviceSchedule struct {
+	Name     string
+	Machines []string
+	// Location is the timezone transitions are evaluated in; defaults to UTC.
+	// DeviceScheduler.TimezoneFor takes precedence for individual machines.
+	Location    *time.Location
+	Transitions []ProfileTransition
+}
+
+// ScheduleResultStatus is the outcome of applying a profile to a machine
+type ScheduleResultStatus string
+
+const (
+	ScheduleResultApplied  ScheduleResultStatus = "applied"  // Commands sent, waiting for verification
+	ScheduleResultVerified ScheduleResultStatus = "verified" // MachineDetail confirms the profile
+	ScheduleResultOffline  ScheduleResultStatus = "offline"  // Machine offline, will be retried
+	ScheduleResultFailed   ScheduleResultStatus = "failed"   // Command or verification failed, will be retried
+)
+
+// ScheduleResult is reported for every attempt the scheduler makes
+type ScheduleResult struct {
+	Schedule string
+	VmCode   string
+	Profile  string
+	Status   ScheduleResultStatus
+	Err      error
+	At       time.Time
+}
+
+type machineScheduleState struct {
+	occurrence  time.Time
+	profile     string
+	status      ScheduleResultStatus
+	nextAttempt time.Time
+	attempts    int
+}
+
+// DeviceScheduler applies time-of-day and day-of-week profiles to machines.
+// Each machine belongs to a single schedule; AddSchedule rejects a machine that is already scheduled.
+type DeviceScheduler struct {
+	Devices VendingMachineManageClient
+	// Interval between ticks in Run; defaults to one minute
+	Interval time.Duration
+	// RetryInterval is the delay before retrying an offline or failed machine; defaults to five minutes
+	RetryInterval time.Duration
+	// VerifyDelay is how long to wait after sending commands before checking MachineDetail
+	VerifyDelay time.Duration
+	// TimezoneFor optionally returns the local timezone of a machine
+	TimezoneFor func(vmCode string) *time.Location
+	// OnResult is called for every apply, verify, offline or failure outcome
+	OnResult func(ScheduleResult)
+
+	mu        sync.Mutex
+	schedules []DeviceSchedule
+	state     map[string]*machineScheduleState
+	now       func() time.Time
+}
+
+// NewDeviceScheduler creates a scheduler for the given device client
+func NewDeviceScheduler(devices VendingMachineManageClient) *DeviceScheduler {
+	return &DeviceScheduler{
+		Devices:       devices,
+		Interval:      time.Minute,
+		RetryInterval: 5 * time.Minute,
+		VerifyDelay:   30 * time.Second,
+		state:         make(map[string]*machineScheduleState),
+		now:           time.Now,
+	}
+}
+
+// AddSchedule validates and registers a schedule
+func (s *DeviceScheduler) AddSchedule(schedule DeviceSchedule) error {
+	if len(schedule.Machines) == 0 {
+		return NewAinfinitError(fmt.Errorf("schedule %q has no machines", schedule.Name))
+	}
+	if len(schedule.Transitions) == 0 {
+		return NewAinfinitError(fmt.Errorf("schedule %q has no transitions", schedule.Name))
+	}
+	for _, transition := range schedule.Transitions {
+		if _, _, err := parseClock(transition.At); err != nil {
+			return NewAinfinitError(fmt.Errorf("schedule %q: %w", schedule.Name, err))
+		}
+		if transition.Profile.Refrigeration != nil {
+			if err := validateRequest(*transition.Profile.Refrigeration); err != nil {
+				return NewAinfinitError(fmt.Errorf("schedule %q profile %q: %w", schedule.Name, transition.Profile.Name, err))
+			}
+		}
+		if transition.Profile.Control != nil {
+			if err := validateRequest(transition.Profile.Control); err != nil {
+				return NewAinfinitError(fmt.Errorf("schedule %q profile %q: %w", schedule.Name, transition.Profile.Name, err))
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Progress is tracked per machine, so two schedules would keep resetting each other
+	scheduled := make(map[string]string)
+	for _, existing := range s.schedules {
+		for _, vmCode := range existing.Machines {
+			scheduled[vmCode] = existing.Name
+		}
+	}
+	for _, vmCode := range schedule.Machines {
+		if name, ok := scheduled[vmCode]; ok {
+			return NewAinfinitError(fmt.Errorf("schedule %q: machine %s is already in schedule %q", schedule.Name, vmCode, name))
+		}
+		scheduled[vmCode] = schedule.Name
+	}
+	s.schedules = append(s.schedules, schedule)
+	return nil
+}
+
+// Run ticks until the context is cancelled
+func (s *DeviceScheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	s.Tick(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			s.Tick(ctx)
+		}
+	}
+}
+
+// Tick evaluates every schedule once: applying due transitions, verifying applied profiles
+// and retrying machines that were offline or failed
+func (s *DeviceScheduler) Tick(ctx context.Context) {
+	s.mu.Lock()
+	schedules := append([]DeviceSchedule(nil), s.schedules...)
+	s.mu.Unlock()
+
+	now := s.now()
+	for _, schedule := range schedules {
+		for _, vmCode := range schedule.Machines {
+			if ctx.Err() != nil {
+				return
+			}
+			s.tickMachine(schedule, vmCode, now)
+		}
+	}
+}
+
+func (s *DeviceScheduler) tickMachine(schedule DeviceSchedule, vmCode string, now time.Time) {
+	location := schedule.Location
+	if s.TimezoneFor != nil {
+		if machineLocation := s.TimezoneFor(vmCode); machineLocation != nil {
+			location = machineLocation
+		}
+	}
+	if location == nil {
+		location = time.UTC
+	}
+
+	transition, occurrence, ok := activeTransition(schedule.Transitions, now.In(location))
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	state, exists := s.state[vmCode]
+	if !exists || !state.occurrence.Equal(occurrence) {
+		state = &machineScheduleState{occurrence: occurrence, profile: transition.Profile.Name}
+		s.state[vmCode] = state
+	}
+	status, nextAttempt := state.status, state.nextAttempt
+	s.mu.Unlock()
+
+	if status == ScheduleResultVerified || now.Before(nextAttempt) {
+		return
+	}
+
+	result := ScheduleResult{Schedule: schedule.Name, VmCode: vmCode, Profile: transition.Profile.Name, At: now}
+	if status == ScheduleResultApplied {
+		result.Status, result.Err = s.verify(vmCode, transition.Profile)
+	} else {
+		result.Status, result.Err = s.apply(vmCode, transition.Profile)
+	}
+
+	s.mu.Lock()
+	state.status = result.Status
+	state.attempts++
+	switch result.Status {
+	case ScheduleResultApplied:
+		state.nextAttempt = now.Add(s.VerifyDelay)
+	case ScheduleResultOffline, ScheduleResultFailed:
+		state.nextAttempt = now.Add(s.RetryInterval)
+	}
+	s.mu.Unlock()
+
+	if s.OnResult != nil {
+		s.OnResult(result)
+	}
+	if result.Err != nil {
+		logrus.WithError(result.Err).WithFields(logrus.Fields{
+			"device_code": vmCode,
+			"profile":     transition.Profile.Name,
+			"status":      result.Status,
+		}).Warn("Device schedule transition not completed")
+	}
+}
+
+func (s *DeviceScheduler) apply(vmCode string, profile DeviceProfile) (ScheduleResultStatus, error) {
+	detail, err := s.Devices.MachineDetail(vmCode)
+	if err != nil {
+		return ScheduleResultFailed, err
+	}
+	if detail.Data.OnlineStatus != 1 {
+		return ScheduleResultOffline, fmt.Errorf("machine %s is offline", vmCode)
+	}
+
+	if profile.Refrigeration != nil {
+		request := *profile.Refrigeration
+		request.VmCode = vmCode
+		if _, err := s.Devices.RefrigerationControl(request, vmCode); err != nil {
+			return ScheduleResultFailed, err
+		}
+	}
+
+	if profile.Control != nil {
+		request := *profile.Control
+		if _, err := s.Devices.Control(&request, vmCode); err != nil {
+			return ScheduleResultFailed, err
+		}
+	}
+
+	return ScheduleResultApplied, nil
+}
+
+func (s *DeviceScheduler) verify(vmCode string, profile DeviceProfile) (ScheduleResultStatus, error) {
+	detail, err := s.Devices.MachineDetail(vmCode)
+	if err != nil {
+		return ScheduleResultFailed, err
+	}
+	device := detail.Data
+	if device.OnlineStatus != 1 {
+		return ScheduleResultOffline, fmt.Errorf("machine %s went offline before verification", vmCode)
+	}
+
+	if profile.Refrigeration != nil && profile.Refrigeration.TempMode != 0 {
+		if math.Round(device.TargetTemp) != float64(profile.Refrigeration.Temp) {
+			return ScheduleResultFailed, fmt.Errorf("target temperature is %.0f, want %d", device.TargetTemp, profile.Refrigeration.Temp)
+		}
+	}
+
+	if profile.Control != nil {
+		if volume := profile.Control.Volume; volume != nil && math.Round(device.Volume) != float64(*volume) {
+			return ScheduleResultFailed, fmt.Errorf("volume is %.0f, want %d", device.Volume, *volume)
+		}
+		if engineOn := profile.Control.EngineOn; engineOn != nil && math.Round(device.EngineOn) != float64(*engineOn) {
+			return ScheduleResultFailed, fmt.Errorf("compressor state is %.0f, want %d", device.EngineOn, *engineOn)
+		}
+	}
+
+	return ScheduleResultVerified, nil
+}
+
+// activeTransition returns the transition whose most recent occurrence is closest to (and not after) now
+func activeTransition(transitions []ProfileTransition, now time.Time) (ProfileTransition, time.Time, bool) {
+	var (
+		active     ProfileTransition
+		occurrence time.Time
+		found      bool
+	)
+
+	for _, transition := range transitions {
+		hour, minute, err := parseClock(transition.At)
+		if err != nil {
+			continue
+		}
+		for back := 0; back <= 7; back++ {
+			day := now.AddDate(0, 0, -back)
+			// Built from the wall clock rather than midnight plus an offset, which is an hour off on DST change days
+			at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+			if at.After(now) || !firesOn(transition.Days, at.Weekday()) {
+				continue
+			}
+			if !found || at.After(occurrence) {
+				active, occurrence, found = transition, at, true
+			}
+			break
+		}
+	}
+
+	return active, occurrence, found
+}
+
+func firesOn(days []time.Weekday, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseClock(value string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
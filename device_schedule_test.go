@@ -0,0 +1,161 @@
+package aifinitsdk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDeviceClient records commands and reflects them in MachineDetail
+type fakeDeviceClient struct {
+	VendingMachineManageClient
+	devices        map[string]*Device
+	refrigerations []RefrigerationControlRequest
+	controls       []DeviceControlRequest
+}
+
+func newFakeDeviceClient(codes ...string) *fakeDeviceClient {
+	f := &fakeDeviceClient{devices: make(map[string]*Device)}
+	for _, code := range codes {
+		f.devices[code] = &Device{Code: code, OnlineStatus: 1}
+	}
+	return f
+}
+
+func (f *fakeDeviceClient) MachineDetail(machineCode string) (*MachineDetailResponse, error) {
+	return &MachineDetailResponse{Status: 200, Data: *f.devices[machineCode]}, nil
+}
+
+func (f *fakeDeviceClient) RefrigerationControl(request RefrigerationControlRequest, machineCode string) (*RefrigerationControlResponse, error) {
+	f.refrigerations = append(f.refrigerations, request)
+	f.devices[machineCode].TargetTemp = float64(request.Temp)
+	return &RefrigerationControlResponse{Status: 200, Ok: true}, nil
+}
+
+func (f *fakeDeviceClient) Control(request *DeviceControlRequest, machineCode string) (*DeviceControlResponse, error) {
+	f.controls = append(f.controls, *request)
+	if request.Volume != nil {
+		f.devices[machineCode].Volume = float64(*request.Volume)
+	}
+	if request.EngineOn != nil {
+		f.devices[machineCode].EngineOn = float64(*request.EngineOn)
+	}
+	return &DeviceControlResponse{Status: 200}, nil
+}
+
+func TestActiveTransition(t *testing.T) {
+	transitions := []ProfileTransition{
+		{At: "08:00", Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, Profile: DeviceProfile{Name: "day"}},
+		{At: "20:00", Profile: DeviceProfile{Name: "night"}},
+	}
+
+	// Saturday 10:00 - weekday morning transition does not fire, so Friday night is still active
+	saturday := time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC)
+	transition, occurrence, ok := activeTransition(transitions, saturday)
+	assert.True(t, ok)
+	assert.Equal(t, "night", transition.Profile.Name)
+	assert.Equal(t, time.Date(2024, 6, 7, 20, 0, 0, 0, time.UTC), occurrence)
+
+	monday := time.Date(2024, 6, 10, 8, 0, 0, 0, time.UTC)
+	transition, _, ok = activeTransition(transitions, monday)
+	assert.True(t, ok)
+	assert.Equal(t, "day", transition.Profile.Name)
+
+	// On DST change days transitions still fire at their wall clock time
+	newYork, err := time.LoadLocation("America/New_York")
+	if assert.NoError(t, err) {
+		springForward := time.Date(2024, 3, 10, 8, 30, 0, 0, newYork)
+		transition, occurrence, ok = activeTransition(transitions, springForward)
+		assert.True(t, ok)
+		assert.Equal(t, "night", transition.Profile.Name)
+		assert.Equal(t, time.Date(2024, 3, 9, 20, 0, 0, 0, newYork), occurrence)
+
+		transition, occurrence, ok = activeTransition(transitions, time.Date(2024, 3, 10, 20, 0, 0, 0, newYork))
+		assert.True(t, ok)
+		assert.Equal(t, "night", transition.Profile.Name)
+		assert.Equal(t, time.Date(2024, 3, 10, 20, 0, 0, 0, newYork), occurrence)
+
+		fallBack := time.Date(2024, 11, 3, 19, 30, 0, 0, newYork)
+		_, occurrence, ok = activeTransition(transitions, fallBack)
+		assert.True(t, ok)
+		assert.Equal(t, time.Date(2024, 11, 2, 20, 0, 0, 0, newYork), occurrence)
+	}
+}
+
+func TestDeviceScheduler_AppliesVerifiesAndRetriesOffline(t *testing.T) {
+	devices := newFakeDeviceClient("vm1", "vm2")
+	devices.devices["vm2"].OnlineStatus = 0
+
+	ulaanbaatar := time.FixedZone("UB", 8*60*60)
+	now := time.Date(2024, 6, 10, 14, 30, 0, 0, time.UTC) // 22:30 in UB
+
+	scheduler := NewDeviceScheduler(devices)
+	scheduler.now = func() time.Time { return now }
+	scheduler.VerifyDelay = time.Minute
+
+	var results []ScheduleResult
+	scheduler.OnResult = func(result ScheduleResult) { results = append(results, result) }
+
+	err := scheduler.AddSchedule(DeviceSchedule{
+		Name:     "office",
+		Machines: []string{"vm1", "vm2"},
+		Location: ulaanbaatar,
+		Transitions: []ProfileTransition{
+			{At: "07:00", Profile: DeviceProfile{Name: "day", Control: &DeviceControlRequest{Volume: Int(60)}}},
+			{At: "22:00", Profile: DeviceProfile{
+				Name:          "night",
+				Refrigeration: &RefrigerationControlRequest{ComprEnable: 1, Temp: -18, TempMode: 11},
+				Control:       &DeviceControlRequest{Volume: Int(0)},
+			}},
+		},
+	})
+	assert.NoError(t, err)
+
+	scheduler.Tick(context.Background())
+	if assert.Len(t, devices.refrigerations, 1) {
+		assert.Equal(t, "vm1", devices.refrigerations[0].VmCode)
+		assert.Equal(t, 11, devices.refrigerations[0].TempMode)
+	}
+	assert.Equal(t, ScheduleResultApplied, results[0].Status)
+	assert.Equal(t, ScheduleResultOffline, results[1].Status)
+
+	// Verification happens after the verify delay
+	now = now.Add(2 * time.Minute)
+	scheduler.Tick(context.Background())
+	assert.Equal(t, ScheduleResultVerified, results[2].Status)
+
+	// vm2 comes back online and is retried after the retry interval
+	devices.devices["vm2"].OnlineStatus = 1
+	now = now.Add(5 * time.Minute)
+	scheduler.Tick(context.Background())
+	assert.Equal(t, "vm2", results[3].VmCode)
+	assert.Equal(t, ScheduleResultApplied, results[3].Status)
+	assert.Len(t, devices.refrigerations, 2)
+
+	// Verified machines are left alone until the next transition
+	now = now.Add(2 * time.Minute)
+	scheduler.Tick(context.Background())
+	assert.Len(t, devices.refrigerations, 2)
+	assert.Equal(t, ScheduleResultVerified, results[len(results)-1].Status)
+}
+
+func TestDeviceScheduler_RejectsInvalidSchedule(t *testing.T) {
+	scheduler := NewDeviceScheduler(newFakeDeviceClient())
+	assert.Error(t, scheduler.AddSchedule(DeviceSchedule{Name: "empty"}))
+	assert.Error(t, scheduler.AddSchedule(DeviceSchedule{
+		Name:        "bad",
+		Machines:    []string{"vm1"},
+		Transitions: []ProfileTransition{{At: "25:99"}},
+	}))
+
+	// A machine follows a single schedule
+	office := DeviceSchedule{Name: "office", Machines: []string{"vm1", "vm2"}, Transitions: []ProfileTransition{{At: "07:00"}}}
+	assert.NoError(t, scheduler.AddSchedule(office))
+	lobby := DeviceSchedule{Name: "lobby", Machines: []string{"vm3", "vm2"}, Transitions: []ProfileTransition{{At: "08:00"}}}
+	assert.ErrorContains(t, scheduler.AddSchedule(lobby), `machine vm2 is already in schedule "office"`)
+	assert.Error(t, scheduler.AddSchedule(DeviceSchedule{Name: "twice", Machines: []string{"vm4", "vm4"}, Transitions: []ProfileTransition{{At: "08:00"}}}))
+	lobby.Machines = []string{"vm3"}
+	assert.NoError(t, scheduler.AddSchedule(lobby))
+}
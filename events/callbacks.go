@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Callbacks publishes the platform's webhook notifications as events. Its methods sit next to the
+// Handle methods of the SDK's other callback consumers in a webhook server. A notification the
+// platform retries is published again with the same event ID, so consumers see a redelivery.
+type Callbacks struct {
+	Publisher Publisher
+
+	now func() time.Time
+}
+
+// NewCallbacks creates a webhook adapter publishing to the given bus
+func NewCallbacks(publisher Publisher) *Callbacks {
+	return &Callbacks{Publisher: publisher, now: time.Now}
+}
+
+// HandleOrder publishes an order settlement notification as OrderSettled
+func (c *Callbacks) HandleOrder(ctx context.Context, order *aifinitsdk.OrderCallbackRequest) error {
+	return c.publish(ctx, OrderSettled{OrderCallbackRequest: *order})
+}
+
+// HandleDoorNotification publishes a door notification as DoorOpened or DoorClosed
+func (c *Callbacks) HandleDoorNotification(ctx context.Context, action aifinitsdk.DoorOpenCloseAction, request *aifinitsdk.DoorOpenCloseNotificationCallbackRequest) error {
+	switch action {
+	case aifinitsdk.DoorOpenCloseActionTradeOpen, aifinitsdk.DoorOpenCloseActionReplenishOpen:
+		return c.publish(ctx, DoorOpened{Action: action, DoorOpenCloseNotificationCallbackRequest: *request})
+	case aifinitsdk.DoorOpenCloseActionTradeClose, aifinitsdk.DoorOpenCloseActionReplenishClose:
+		return c.publish(ctx, DoorClosed{Action: action, DoorOpenCloseNotificationCallbackRequest: *request})
+	}
+	return aifinitsdk.NewAinfinitError(fmt.Errorf("unknown door action %q", action))
+}
+
+// HandleMaintenanceException publishes a maintenance exception as AlarmTriggered or AlarmRecovered
+func (c *Callbacks) HandleMaintenanceException(ctx context.Context, request *aifinitsdk.MaintenanceExceptionNotificationCallbackRequest) error {
+	switch request.Status {
+	case aifinitsdk.MaintenanceExceptionStatusTriggered:
+		maintenance := *request
+		return c.publish(ctx, AlarmTriggered{Action: aifinitsdk.AlarmActionClientWarning, Maintenance: &maintenance})
+	case aifinitsdk.MaintenanceExceptionStatusRecovered:
+		return c.publish(ctx, AlarmRecovered{MaintenanceExceptionNotificationCallbackRequest: *request})
+	}
+	return aifinitsdk.NewAinfinitError(fmt.Errorf("unknown maintenance exception status %d", request.Status))
+}
+
+// HandleOperationalException publishes an operational exception as AlarmTriggered. The follow-up
+// notification carrying the video is published too, with the same ExID.
+func (c *Callbacks) HandleOperationalException(ctx context.Context, request *aifinitsdk.OperationalExceptionNotificationCallbackRequest) error {
+	operational := *request
+	return c.publish(ctx, AlarmTriggered{Action: aifinitsdk.AlarmActionOperatingException, Operational: &operational})
+}
+
+// HandleProductChange publishes a product change notification as ProductChanged
+func (c *Callbacks) HandleProductChange(ctx context.Context, action aifinitsdk.ProductChangeAction, change *aifinitsdk.ProductChangeNotificationCallbackRequest) error {
+	return c.publish(ctx, ProductChanged{Action: action, ProductChangeNotificationCallbackRequest: *change})
+}
+
+// HandleAdvertisementOnline publishes an advertisement status notification as AdOnline or AdOffline
+func (c *Callbacks) HandleAdvertisementOnline(ctx context.Context, request *aifinitsdk.AdvertisementOnlineNotificationCallbackRequest) error {
+	switch request.Status {
+	case aifinitsdk.AdvertisementOnlineStatusOnline:
+		return c.publish(ctx, AdOnline{AdvertisementOnlineNotificationCallbackRequest: *request})
+	case aifinitsdk.AdvertisementOnlineStatusOffline:
+		return c.publish(ctx, AdOffline{AdvertisementOnlineNotificationCallbackRequest: *request})
+	}
+	return aifinitsdk.NewAinfinitError(fmt.Errorf("unknown advertisement status %d", request.Status))
+}
+
+func (c *Callbacks) publish(ctx context.Context, payload Payload) error {
+	event, err := New(payload, c.now())
+	if err != nil {
+		return err
+	}
+	return c.Publisher.Publish(ctx, event)
+}
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// publishedEvents is a Publisher keeping what it was given
+type publishedEvents struct {
+	events []Event
+	err    error
+}
+
+func (p *publishedEvents) Publish(ctx context.Context, event Event) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func TestCallbacks(t *testing.T) {
+	ctx := context.Background()
+	published := &publishedEvents{}
+	callbacks := NewCallbacks(published)
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	callbacks.now = func() time.Time { return now }
+
+	door := &aifinitsdk.DoorOpenCloseNotificationCallbackRequest{VmCode: "VM1", RequestID: "R1", OpenType: aifinitsdk.OpenTypeShopping}
+	require.NoError(t, callbacks.HandleDoorNotification(ctx, aifinitsdk.DoorOpenCloseActionTradeOpen, door))
+	require.NoError(t, callbacks.HandleDoorNotification(ctx, aifinitsdk.DoorOpenCloseActionReplenishClose, door))
+	assert.Error(t, callbacks.HandleDoorNotification(ctx, "ajar", door))
+	require.NoError(t, callbacks.HandleOrder(ctx, &aifinitsdk.OrderCallbackRequest{OrderCode: "O1", VmCode: "VM1"}))
+	maintenance := &aifinitsdk.MaintenanceExceptionNotificationCallbackRequest{VmCode: "VM2", ExCode: aifinitsdk.MaintenanceExceptionCodeOverheating}
+	require.NoError(t, callbacks.HandleMaintenanceException(ctx, maintenance))
+	maintenance.Status = aifinitsdk.MaintenanceExceptionStatusRecovered
+	require.NoError(t, callbacks.HandleMaintenanceException(ctx, maintenance))
+	require.NoError(t, callbacks.HandleOperationalException(ctx, &aifinitsdk.OperationalExceptionNotificationCallbackRequest{ExID: "E1", VmCode: "VM3"}))
+	require.NoError(t, callbacks.HandleProductChange(ctx, aifinitsdk.ProductChangeActionUpdate, &aifinitsdk.ProductChangeNotificationCallbackRequest{Code: "cola"}))
+	require.NoError(t, callbacks.HandleAdvertisementOnline(ctx, &aifinitsdk.AdvertisementOnlineNotificationCallbackRequest{ID: 7, Status: aifinitsdk.AdvertisementOnlineStatusOnline}))
+	require.NoError(t, callbacks.HandleAdvertisementOnline(ctx, &aifinitsdk.AdvertisementOnlineNotificationCallbackRequest{ID: 7, Status: aifinitsdk.AdvertisementOnlineStatusOffline}))
+	assert.Error(t, callbacks.HandleAdvertisementOnline(ctx, &aifinitsdk.AdvertisementOnlineNotificationCallbackRequest{ID: 7}))
+
+	var types []Type
+	var machines []string
+	for _, event := range published.events {
+		types = append(types, event.Type)
+		machines = append(machines, event.VmCode)
+		assert.Equal(t, now, event.Time)
+	}
+	assert.Equal(t, []Type{TypeDoorOpened, TypeDoorClosed, TypeOrderSettled, TypeAlarmTriggered, TypeAlarmRecovered, TypeAlarmTriggered, TypeProductChanged, TypeAdOnline, TypeAdOffline}, types)
+	assert.Equal(t, []string{"VM1", "VM1", "VM1", "VM2", "VM2", "VM3", "", "", ""}, machines)
+
+	closed, err := Decode[DoorClosed](published.events[1])
+	require.NoError(t, err)
+	assert.Equal(t, aifinitsdk.DoorOpenCloseActionReplenishClose, closed.Action)
+	assert.Equal(t, "R1", closed.RequestID)
+	raised, err := Decode[AlarmTriggered](published.events[3])
+	require.NoError(t, err)
+	assert.Equal(t, aifinitsdk.AlarmActionClientWarning, raised.Action)
+	require.NotNil(t, raised.Maintenance)
+	assert.Equal(t, aifinitsdk.MaintenanceExceptionCodeOverheating, raised.Maintenance.ExCode)
+	assert.Nil(t, raised.Operational)
+	operational, err := Decode[AlarmTriggered](published.events[5])
+	require.NoError(t, err)
+	assert.Equal(t, "E1", operational.Operational.ExID)
+	product, err := Decode[ProductChanged](published.events[6])
+	require.NoError(t, err)
+	assert.Equal(t, aifinitsdk.ProductChangeActionUpdate, product.Action)
+	assert.Equal(t, "cola", product.Code)
+}
@@ -0,0 +1,280 @@
+// Package events is a typed bus for the events the SDK's webhook handlers, monitors and reconcilers
+// produce. Delivery is at least once: a consumer acknowledges an event by returning nil from its
+// handler, and an event whose handler fails is delivered again, so handlers should be idempotent
+// on Event.ID. Memory is the in-process bus and RedisStream carries events through Redis; other
+// brokers plug in by implementing Publisher.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Type names the kind of an event
+type Type string
+
+const (
+	TypeOrderSettled   Type = "order.settled"
+	TypeDoorOpened     Type = "door.opened"
+	TypeDoorClosed     Type = "door.closed"
+	TypeAlarmTriggered Type = "alarm.triggered"
+	TypeAlarmRecovered Type = "alarm.recovered"
+	TypeProductChanged Type = "product.changed"
+	TypeAdOnline       Type = "ad.online"
+	TypeAdOffline      Type = "ad.offline"
+	TypeMachineOffline Type = "machine.offline"
+)
+
+// Payload is the typed body of an event
+type Payload interface {
+	EventType() Type
+	// Machine is the code of the machine the event concerns, empty when it concerns none
+	Machine() string
+}
+
+// OrderSettled is an order settlement notification, whatever its handle status
+type OrderSettled struct {
+	aifinitsdk.OrderCallbackRequest
+}
+
+func (OrderSettled) EventType() Type   { return TypeOrderSettled }
+func (e OrderSettled) Machine() string { return e.VmCode }
+
+// key tells settlements apart by order, and a platform re-review that changes the handle status
+// from the first notification
+func (e OrderSettled) key() []string {
+	if e.OrderCode == "" {
+		return nil
+	}
+	return []string{e.OrderCode, fmt.Sprint(e.HandleStatus)}
+}
+
+// DoorOpened is a shopping or restocking door open
+type DoorOpened struct {
+	Action aifinitsdk.DoorOpenCloseAction `json:"action"`
+	aifinitsdk.DoorOpenCloseNotificationCallbackRequest
+}
+
+func (DoorOpened) EventType() Type   { return TypeDoorOpened }
+func (e DoorOpened) Machine() string { return e.VmCode }
+func (e DoorOpened) key() []string {
+	return doorKey(e.Action, e.DoorOpenCloseNotificationCallbackRequest)
+}
+
+// DoorClosed is a shopping or restocking door close
+type DoorClosed struct {
+	Action aifinitsdk.DoorOpenCloseAction `json:"action"`
+	aifinitsdk.DoorOpenCloseNotificationCallbackRequest
+}
+
+func (DoorClosed) EventType() Type   { return TypeDoorClosed }
+func (e DoorClosed) Machine() string { return e.VmCode }
+func (e DoorClosed) key() []string {
+	return doorKey(e.Action, e.DoorOpenCloseNotificationCallbackRequest)
+}
+
+// doorKey identifies a door notification by its machine, action and door open request. The
+// notification carries no time of its own; the request ID stands for the door cycle.
+func doorKey(action aifinitsdk.DoorOpenCloseAction, request aifinitsdk.DoorOpenCloseNotificationCallbackRequest) []string {
+	if request.RequestID == "" {
+		return nil
+	}
+	return []string{request.VmCode, string(action), request.RequestID}
+}
+
+// AlarmTriggered is a maintenance exception being raised or an operational exception; exactly one
+// of Maintenance and Operational is set, as told by Action
+type AlarmTriggered struct {
+	Action      aifinitsdk.AlarmAction                                      `json:"action"`
+	Maintenance *aifinitsdk.MaintenanceExceptionNotificationCallbackRequest `json:"maintenance,omitempty"`
+	Operational *aifinitsdk.OperationalExceptionNotificationCallbackRequest `json:"operational,omitempty"`
+}
+
+func (AlarmTriggered) EventType() Type { return TypeAlarmTriggered }
+
+func (e AlarmTriggered) Machine() string {
+	if e.Maintenance != nil {
+		return e.Maintenance.VmCode
+	}
+	if e.Operational != nil {
+		return e.Operational.VmCode
+	}
+	return ""
+}
+
+// key identifies an operational exception by its ExID; the follow-up carrying the video shares it
+// and is told apart by the video upload time. Maintenance exceptions have no ID of their own.
+func (e AlarmTriggered) key() []string {
+	if e.Maintenance != nil {
+		return maintenanceKey(*e.Maintenance)
+	}
+	if e.Operational != nil && e.Operational.ExID != "" {
+		return []string{e.Operational.ExID, fmt.Sprint(e.Operational.VideoSendTime.Milliseconds())}
+	}
+	return nil
+}
+
+// AlarmRecovered is a maintenance exception recovering
+type AlarmRecovered struct {
+	aifinitsdk.MaintenanceExceptionNotificationCallbackRequest
+}
+
+func (AlarmRecovered) EventType() Type   { return TypeAlarmRecovered }
+func (e AlarmRecovered) Machine() string { return e.VmCode }
+func (e AlarmRecovered) key() []string {
+	return maintenanceKey(e.MaintenanceExceptionNotificationCallbackRequest)
+}
+
+func maintenanceKey(request aifinitsdk.MaintenanceExceptionNotificationCallbackRequest) []string {
+	if request.NotifyTime.IsZero() {
+		return nil
+	}
+	return []string{request.VmCode, fmt.Sprint(request.ExCode), fmt.Sprint(request.NotifyTime.Milliseconds())}
+}
+
+// ProductChanged is a product being added, updated or deleted
+type ProductChanged struct {
+	Action aifinitsdk.ProductChangeAction `json:"action"`
+	aifinitsdk.ProductChangeNotificationCallbackRequest
+}
+
+func (ProductChanged) EventType() Type { return TypeProductChanged }
+func (ProductChanged) Machine() string { return "" }
+
+// AdOnline is an advertisement going online
+type AdOnline struct {
+	aifinitsdk.AdvertisementOnlineNotificationCallbackRequest
+}
+
+func (AdOnline) EventType() Type { return TypeAdOnline }
+func (AdOnline) Machine() string { return "" }
+
+// AdOffline is an advertisement going offline
+type AdOffline struct {
+	aifinitsdk.AdvertisementOnlineNotificationCallbackRequest
+}
+
+func (AdOffline) EventType() Type { return TypeAdOffline }
+func (AdOffline) Machine() string { return "" }
+
+// MachineOffline is a machine that stopped sending heartbeats
+type MachineOffline struct {
+	VmCode        string            `json:"vmCode"`
+	LastHeartbeat aifinitsdk.Millis `json:"lastHeartbeat,omitzero"`
+}
+
+func (MachineOffline) EventType() Type   { return TypeMachineOffline }
+func (e MachineOffline) Machine() string { return e.VmCode }
+
+// keyed is a payload that identifies the platform notification it came from, so that the
+// platform's retries of a notification become events with the same ID
+type keyed interface {
+	// key returns the fields identifying the notification, nil when they are missing
+	key() []string
+}
+
+// Event is the envelope every bus carries
+type Event struct {
+	// ID is unique per published event and stays the same across redeliveries. Events of platform
+	// notifications that identify themselves (orders, doors and alarms) derive it from that
+	// identity, so a notification the platform sends again has the ID of the first.
+	ID      string          `json:"id"`
+	Type    Type            `json:"type"`
+	VmCode  string          `json:"vmCode,omitempty"`
+	Time    time.Time       `json:"time"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// New wraps a payload into an event. The ID is derived from the notification the payload came
+// from when it identifies one, and random otherwise.
+func New(payload Payload, at time.Time) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, aifinitsdk.NewAinfinitError(fmt.Errorf("encode %s event: %w", payload.EventType(), err))
+	}
+	id := make([]byte, 16)
+	if k, ok := payload.(keyed); ok && k.key() != nil {
+		sum := sha256.Sum256([]byte(strings.Join(append([]string{string(payload.EventType())}, k.key()...), "\x00")))
+		copy(id, sum[:])
+	} else if _, err := rand.Read(id); err != nil {
+		return Event{}, aifinitsdk.NewAinfinitError(err)
+	}
+	return Event{ID: hex.EncodeToString(id), Type: payload.EventType(), VmCode: payload.Machine(), Time: at, Payload: data}, nil
+}
+
+// Decode unmarshals the payload of an event of T's type
+func Decode[T Payload](event Event) (T, error) {
+	var payload T
+	if event.Type != payload.EventType() {
+		return payload, aifinitsdk.NewAinfinitError(fmt.Errorf("event %s is %s, not %s", event.ID, event.Type, payload.EventType()))
+	}
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return payload, aifinitsdk.NewAinfinitError(fmt.Errorf("decode %s event %s: %w", event.Type, event.ID, err))
+	}
+	return payload, nil
+}
+
+// Handler processes a delivered event. Returning nil acknowledges it; an error leaves it
+// unacknowledged, so it is delivered again.
+type Handler func(ctx context.Context, event Event) error
+
+// Publisher sends events to a bus. Implement it to forward events to another broker.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Subscriber delivers events to consumer groups. A group receives every event published after it
+// first consumed, and the consumers of one group share its events.
+type Subscriber interface {
+	// Consume runs the handler on the group's events until ctx is done. Only events of the given
+	// types are handled, all when none are given; the others are acknowledged unhandled.
+	Consume(ctx context.Context, group string, handler Handler, types ...Type) error
+}
+
+// Bus publishes and delivers events
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+// Publish wraps a payload into an event stamped now and publishes it
+func Publish(ctx context.Context, publisher Publisher, payload Payload) (Event, error) {
+	event, err := New(payload, time.Now())
+	if err != nil {
+		return Event{}, err
+	}
+	return event, publisher.Publish(ctx, event)
+}
+
+// On adapts a handler of one payload type. Pass the type to Consume as well, or events of other
+// types fail to decode and are never acknowledged.
+func On[T Payload](handler func(ctx context.Context, event Event, payload T) error) Handler {
+	return func(ctx context.Context, event Event) error {
+		payload, err := Decode[T](event)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, event, payload)
+	}
+}
+
+// handles reports whether a consumer of the given types handles an event type
+func handles(types []Type, t Type) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+func TestNewAndDecode(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	order := OrderSettled{OrderCallbackRequest: aifinitsdk.OrderCallbackRequest{
+		OrderCode: "O1", VmCode: "VM1", HandleStatus: 1,
+		OrderGoodsList: []aifinitsdk.OrderGoods{{ItemCode: "cola", ItemPrice: aifinitsdk.NewMoney(250, "MNT"), Count: 2}},
+	}}
+	event, err := New(order, at)
+	require.NoError(t, err)
+	assert.Len(t, event.ID, 32)
+	assert.Equal(t, TypeOrderSettled, event.Type)
+	assert.Equal(t, "VM1", event.VmCode)
+	assert.Equal(t, at, event.Time)
+
+	// A notification sent again is the same event, one with another handle status is not
+	other, err := New(order, at.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, event.ID, other.ID)
+	order.HandleStatus = 3
+	other, err = New(order, at)
+	require.NoError(t, err)
+	assert.NotEqual(t, event.ID, other.ID)
+	order.HandleStatus = 1
+
+	decoded, err := Decode[OrderSettled](event)
+	require.NoError(t, err)
+	assert.Equal(t, order, decoded)
+	_, err = Decode[DoorOpened](event)
+	assert.Error(t, err)
+
+	alarm, err := New(AlarmTriggered{Action: aifinitsdk.AlarmActionOperatingException, Operational: &aifinitsdk.OperationalExceptionNotificationCallbackRequest{ExID: "E1", VmCode: "VM2"}}, at)
+	require.NoError(t, err)
+	assert.Equal(t, "VM2", alarm.VmCode)
+	product, err := New(ProductChanged{Action: aifinitsdk.ProductChangeActionAdd}, at)
+	require.NoError(t, err)
+	assert.Empty(t, product.VmCode)
+	// Payloads without an identity get a new ID every time
+	other, err = New(ProductChanged{Action: aifinitsdk.ProductChangeActionAdd}, at)
+	require.NoError(t, err)
+	assert.NotEqual(t, product.ID, other.ID)
+	assert.Len(t, other.ID, 32)
+}
+
+func TestNew_CallbackIDs(t *testing.T) {
+	id := func(payload Payload) string {
+		event, err := New(payload, time.Now())
+		require.NoError(t, err)
+		return event.ID
+	}
+	door := aifinitsdk.DoorOpenCloseNotificationCallbackRequest{VmCode: "VM1", RequestID: "R1"}
+	opened := id(DoorOpened{Action: aifinitsdk.DoorOpenCloseActionTradeOpen, DoorOpenCloseNotificationCallbackRequest: door})
+	assert.Equal(t, opened, id(DoorOpened{Action: aifinitsdk.DoorOpenCloseActionTradeOpen, DoorOpenCloseNotificationCallbackRequest: door}))
+	assert.NotEqual(t, opened, id(DoorClosed{Action: aifinitsdk.DoorOpenCloseActionTradeClose, DoorOpenCloseNotificationCallbackRequest: door}))
+	assert.NotEqual(t, opened, id(DoorOpened{Action: aifinitsdk.DoorOpenCloseActionTradeOpen}))
+
+	alarm := aifinitsdk.OperationalExceptionNotificationCallbackRequest{ExID: "E1", VmCode: "VM1"}
+	raised := id(AlarmTriggered{Action: aifinitsdk.AlarmActionOperatingException, Operational: &alarm})
+	assert.Equal(t, raised, id(AlarmTriggered{Action: aifinitsdk.AlarmActionOperatingException, Operational: &alarm}))
+	// The follow-up with the video is an event of its own
+	withVideo := alarm
+	withVideo.VideoSendTime = aifinitsdk.FromUnixMilli(1714550400000)
+	assert.NotEqual(t, raised, id(AlarmTriggered{Action: aifinitsdk.AlarmActionOperatingException, Operational: &withVideo}))
+
+	maintenance := aifinitsdk.MaintenanceExceptionNotificationCallbackRequest{VmCode: "VM1", NotifyTime: aifinitsdk.FromUnixMilli(1714550400000)}
+	triggered := id(AlarmTriggered{Action: aifinitsdk.AlarmActionClientWarning, Maintenance: &maintenance})
+	assert.Equal(t, triggered, id(AlarmTriggered{Action: aifinitsdk.AlarmActionClientWarning, Maintenance: &maintenance}))
+	assert.NotEqual(t, triggered, id(AlarmRecovered{MaintenanceExceptionNotificationCallbackRequest: maintenance}))
+}
+
+func TestOn(t *testing.T) {
+	var got []string
+	handler := On(func(ctx context.Context, event Event, door DoorOpened) error {
+		got = append(got, door.RequestID)
+		return nil
+	})
+	event, err := New(DoorOpened{Action: aifinitsdk.DoorOpenCloseActionTradeOpen, DoorOpenCloseNotificationCallbackRequest: aifinitsdk.DoorOpenCloseNotificationCallbackRequest{RequestID: "R1"}}, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, handler(context.Background(), event))
+	assert.Equal(t, []string{"R1"}, got)
+
+	event, err = New(DoorClosed{}, time.Now())
+	require.NoError(t, err)
+	assert.Error(t, handler(context.Background(), event))
+}
+
+// recorder collects the events a handler was given
+type recorder struct {
+	mu     sync.Mutex
+	events chan Event
+	// fail makes the handler fail that many times before it acknowledges
+	fail int
+}
+
+func newRecorder() *recorder {
+	return &recorder{events: make(chan Event, 64)}
+}
+
+func (r *recorder) handle(ctx context.Context, event Event) error {
+	r.events <- event
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail > 0 {
+		r.fail--
+		return errors.New("not now")
+	}
+	return nil
+}
+
+func (r *recorder) receive(t *testing.T) Event {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+		return Event{}
+	}
+}
+
+// none checks that nothing more is delivered for a while
+func (r *recorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case event := <-r.events:
+		t.Fatalf("unexpected event %s %s", event.Type, event.ID)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// consume runs a consumer until the test ends
+func consume(t *testing.T, bus Bus, group string, handler Handler, types ...Type) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Consume(ctx, group, handler, types...)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// join makes a group exist, so that it receives the events published from now on
+func join(t *testing.T, bus Bus, group string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := bus.Consume(ctx, group, func(ctx context.Context, event Event) error {
+		return errors.New("only joining")
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// assertEvent compares events as they survive encoding
+func assertEvent(t *testing.T, want, got Event) {
+	t.Helper()
+	assert.Equal(t, want.ID, got.ID)
+	assert.Equal(t, want.Type, got.Type)
+	assert.Equal(t, want.VmCode, got.VmCode)
+	assert.True(t, want.Time.Equal(got.Time), "time %s, want %s", got.Time, want.Time)
+	assert.JSONEq(t, string(want.Payload), string(got.Payload))
+}
+
+func publish(t *testing.T, bus Bus, payload Payload) Event {
+	event, err := Publish(context.Background(), bus, payload)
+	require.NoError(t, err)
+	return event
+}
+
+// testBus runs the behavior every Bus shares
+func testBus(t *testing.T, newBus func(t *testing.T) Bus) {
+	door := DoorOpened{Action: aifinitsdk.DoorOpenCloseActionTradeOpen, DoorOpenCloseNotificationCallbackRequest: aifinitsdk.DoorOpenCloseNotificationCallbackRequest{VmCode: "VM1", RequestID: "R1"}}
+
+	t.Run("groups", func(t *testing.T) {
+		bus := newBus(t)
+		join(t, bus, "billing")
+		join(t, bus, "audit")
+		billing, audit := newRecorder(), newRecorder()
+		consume(t, bus, "billing", billing.handle)
+		consume(t, bus, "audit", audit.handle)
+
+		event := publish(t, bus, door)
+		// Every group gets the event once
+		received := billing.receive(t)
+		assertEvent(t, event, received)
+		decoded, err := Decode[DoorOpened](received)
+		require.NoError(t, err)
+		assert.Equal(t, door, decoded)
+		assert.Equal(t, event.ID, audit.receive(t).ID)
+		billing.none(t)
+		audit.none(t)
+	})
+
+	t.Run("shared group", func(t *testing.T) {
+		bus := newBus(t)
+		join(t, bus, "billing")
+		first, second := newRecorder(), newRecorder()
+		consume(t, bus, "billing", first.handle)
+		consume(t, bus, "billing", second.handle)
+
+		sent := map[string]bool{}
+		for i := range 6 {
+			door := door
+			door.RequestID = fmt.Sprintf("R%d", i)
+			sent[publish(t, bus, door).ID] = true
+		}
+		require.Len(t, sent, 6)
+		received := map[string]bool{}
+		for len(received) < len(sent) {
+			select {
+			case event := <-first.events:
+				assert.False(t, received[event.ID], "delivered twice")
+				received[event.ID] = true
+			case event := <-second.events:
+				assert.False(t, received[event.ID], "delivered twice")
+				received[event.ID] = true
+			case <-time.After(5 * time.Second):
+				t.Fatal("events missing")
+			}
+		}
+		assert.Equal(t, sent, received)
+	})
+
+	t.Run("redelivery", func(t *testing.T) {
+		bus := newBus(t)
+		join(t, bus, "billing")
+		billing := newRecorder()
+		billing.fail = 2
+		consume(t, bus, "billing", billing.handle)
+
+		event := publish(t, bus, door)
+		// Unacknowledged deliveries are retried until one is acknowledged, with the same ID
+		assertEvent(t, event, billing.receive(t))
+		assertEvent(t, event, billing.receive(t))
+		assertEvent(t, event, billing.receive(t))
+		billing.none(t)
+	})
+
+	t.Run("types", func(t *testing.T) {
+		bus := newBus(t)
+		join(t, bus, "doors")
+		doors := newRecorder()
+		consume(t, bus, "doors", doors.handle, TypeDoorOpened, TypeDoorClosed)
+
+		publish(t, bus, OrderSettled{})
+		closed := publish(t, bus, DoorClosed{Action: aifinitsdk.DoorOpenCloseActionTradeClose})
+		assertEvent(t, closed, doors.receive(t))
+		doors.none(t)
+	})
+
+	t.Run("late group", func(t *testing.T) {
+		bus := newBus(t)
+		publish(t, bus, door)
+		join(t, bus, "late")
+		late := newRecorder()
+		consume(t, bus, "late", late.handle)
+		// Only events published after the group joined are delivered
+		event := publish(t, bus, OrderSettled{})
+		assertEvent(t, event, late.receive(t))
+		late.none(t)
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		bus := newBus(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- bus.Consume(ctx, "billing", newRecorder().handle) }()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Consume did not return")
+		}
+		assert.Error(t, bus.Publish(context.Background(), Event{ID: "x"}))
+	})
+}
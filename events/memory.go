@@ -0,0 +1,159 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Memory is a Bus within one process. Events are not persisted, so those still queued when the
+// process exits are lost.
+type Memory struct {
+	// RetryDelay is how long an event whose handler failed waits before it is delivered again;
+	// defaults to one second
+	RetryDelay time.Duration
+
+	mu     sync.Mutex
+	groups map[string]*memoryGroup
+	now    func() time.Time
+}
+
+type memoryGroup struct {
+	queue []memoryDelivery
+	// wake is signalled when the queue grows
+	wake chan struct{}
+}
+
+type memoryDelivery struct {
+	event     Event
+	notBefore time.Time
+	attempts  int
+}
+
+// NewMemory creates an in-process bus
+func NewMemory() *Memory {
+	return &Memory{
+		RetryDelay: time.Second,
+		groups:     make(map[string]*memoryGroup),
+		now:        time.Now,
+	}
+}
+
+// Publish queues the event for every group
+func (m *Memory) Publish(ctx context.Context, event Event) error {
+	if event.Type == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("event %s has no type", event.ID))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, group := range m.groups {
+		group.queue = append(group.queue, memoryDelivery{event: event})
+		group.signal()
+	}
+	return nil
+}
+
+func (m *Memory) Consume(ctx context.Context, group string, handler Handler, types ...Type) error {
+	g := m.group(group)
+	for {
+		delivery, wait, ok := m.next(g)
+		if !ok {
+			if err := g.wait(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		if !handles(types, delivery.event.Type) {
+			continue
+		}
+
+		delivery.attempts++
+		if err := handler(ctx, delivery.event); err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"group": group, "event": delivery.event.ID, "type": delivery.event.Type, "attempts": delivery.attempts}).
+				Debug("Event handler failed, redelivering")
+			m.retry(g, delivery)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Pending returns the number of events queued for a group and not yet acknowledged, counting
+// none that are being handled
+func (m *Memory) Pending(group string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if g, ok := m.groups[group]; ok {
+		return len(g.queue)
+	}
+	return 0
+}
+
+func (m *Memory) group(name string) *memoryGroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.groups[name]
+	if !ok {
+		g = &memoryGroup{wake: make(chan struct{}, 1)}
+		m.groups[name] = g
+	}
+	return g
+}
+
+// next takes the first due delivery. When none is due, it returns how long until one is, or 0 when
+// the queue is empty.
+func (m *Memory) next(g *memoryGroup) (memoryDelivery, time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var wait time.Duration
+	for i, delivery := range g.queue {
+		if !delivery.notBefore.After(now) {
+			g.queue = slices.Delete(g.queue, i, i+1)
+			return delivery, 0, true
+		}
+		if until := delivery.notBefore.Sub(now); wait == 0 || until < wait {
+			wait = until
+		}
+	}
+	return memoryDelivery{}, wait, false
+}
+
+func (m *Memory) retry(g *memoryGroup, delivery memoryDelivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.notBefore = m.now().Add(m.RetryDelay)
+	g.queue = append(g.queue, delivery)
+	g.signal()
+}
+
+// wait blocks until the queue grows, a delay passes or ctx is done. A zero delay waits for the
+// queue only.
+func (g *memoryGroup) wait(ctx context.Context, delay time.Duration) error {
+	var timer <-chan time.Time
+	if delay > 0 {
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-g.wake:
+	case <-timer:
+	}
+	return nil
+}
+
+func (g *memoryGroup) signal() {
+	select {
+	case g.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory(t *testing.T) {
+	testBus(t, func(t *testing.T) Bus {
+		bus := NewMemory()
+		bus.RetryDelay = 10 * time.Millisecond
+		return bus
+	})
+}
+
+func TestMemory_Pending(t *testing.T) {
+	bus := NewMemory()
+	bus.RetryDelay = time.Hour
+	join(t, bus, "billing")
+	publish(t, bus, MachineOffline{VmCode: "VM1"})
+	publish(t, bus, MachineOffline{VmCode: "VM2"})
+	assert.Equal(t, 2, bus.Pending("billing"))
+	assert.Zero(t, bus.Pending("audit"))
+
+	// A failed event waits for its retry while the next one is handled
+	billing := newRecorder()
+	billing.fail = 1
+	consume(t, bus, "billing", billing.handle)
+	first, second := billing.receive(t), billing.receive(t)
+	assert.Equal(t, "VM1", first.VmCode)
+	assert.Equal(t, "VM2", second.VmCode)
+	billing.none(t)
+	assert.Equal(t, 1, bus.Pending("billing"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, bus.Consume(ctx, "billing", billing.handle), context.Canceled)
+}
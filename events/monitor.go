@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// OfflineMonitor polls machine details and publishes MachineOffline when a machine goes offline.
+// A machine is reported once per outage: again only after it was seen online in between.
+type OfflineMonitor struct {
+	Devices   aifinitsdk.VendingMachineManageClient
+	Publisher Publisher
+	Machines  []string
+	// Interval between checks in Run; defaults to one minute
+	Interval time.Duration
+
+	mu      sync.Mutex
+	offline map[string]bool
+	now     func() time.Time
+}
+
+// NewOfflineMonitor creates a monitor of the given machines
+func NewOfflineMonitor(devices aifinitsdk.VendingMachineManageClient, publisher Publisher, machines ...string) *OfflineMonitor {
+	return &OfflineMonitor{
+		Devices:   devices,
+		Publisher: publisher,
+		Machines:  machines,
+		Interval:  time.Minute,
+		offline:   make(map[string]bool),
+		now:       time.Now,
+	}
+}
+
+// Run checks until the context is cancelled
+func (m *OfflineMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Check(ctx); err != nil {
+			logrus.WithError(err).Debug("Machine offline check failed")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check polls every machine once. Machines that cannot be polled keep their state and are
+// reported together in the error.
+func (m *OfflineMonitor) Check(ctx context.Context) error {
+	var errs []error
+	for _, vmCode := range m.Machines {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		detail, err := m.Devices.MachineDetail(vmCode)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("machine %s: %w", vmCode, err))
+			continue
+		}
+		offline := detail.Data.OnlineStatus == 0
+
+		m.mu.Lock()
+		wasOffline := m.offline[vmCode]
+		m.mu.Unlock()
+		if offline && !wasOffline {
+			event, err := New(MachineOffline{VmCode: vmCode, LastHeartbeat: detail.Data.DeviceUpdateTimestamp}, m.now())
+			if err == nil {
+				err = m.Publisher.Publish(ctx, event)
+			}
+			if err != nil {
+				// Still online as far as the monitor knows, so the next check retries
+				errs = append(errs, fmt.Errorf("machine %s: %w", vmCode, err))
+				continue
+			}
+		}
+		m.mu.Lock()
+		m.offline[vmCode] = offline
+		m.mu.Unlock()
+	}
+	if len(errs) > 0 {
+		return aifinitsdk.NewAinfinitError(errors.Join(errs...))
+	}
+	return nil
+}
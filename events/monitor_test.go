@@ -0,0 +1,63 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// fakeDeviceClient answers MachineDetail from a fixed set of devices
+type fakeDeviceClient struct {
+	aifinitsdk.VendingMachineManageClient
+	devices map[string]*aifinitsdk.Device
+}
+
+func (f *fakeDeviceClient) MachineDetail(machineCode string) (*aifinitsdk.MachineDetailResponse, error) {
+	device, ok := f.devices[machineCode]
+	if !ok {
+		return nil, errors.New("unknown machine")
+	}
+	return &aifinitsdk.MachineDetailResponse{Status: 200, Data: *device}, nil
+}
+
+func TestOfflineMonitor(t *testing.T) {
+	ctx := context.Background()
+	heartbeat := aifinitsdk.FromUnixMilli(1714525200000)
+	devices := &fakeDeviceClient{devices: map[string]*aifinitsdk.Device{
+		"VM1": {Code: "VM1", OnlineStatus: 1},
+		"VM2": {Code: "VM2", OnlineStatus: 0, DeviceUpdateTimestamp: heartbeat},
+	}}
+	published := &publishedEvents{}
+	monitor := NewOfflineMonitor(devices, published, "VM1", "VM2")
+
+	require.NoError(t, monitor.Check(ctx))
+	require.Len(t, published.events, 1)
+	offline, err := Decode[MachineOffline](published.events[0])
+	require.NoError(t, err)
+	assert.Equal(t, MachineOffline{VmCode: "VM2", LastHeartbeat: heartbeat}, offline)
+
+	// An outage is reported once, and again after the machine came back
+	require.NoError(t, monitor.Check(ctx))
+	assert.Len(t, published.events, 1)
+	devices.devices["VM2"].OnlineStatus = 1
+	require.NoError(t, monitor.Check(ctx))
+	devices.devices["VM2"].OnlineStatus = 0
+	require.NoError(t, monitor.Check(ctx))
+	assert.Len(t, published.events, 2)
+
+	// A machine that cannot be polled or reported does not stop the others
+	monitor.Machines = []string{"VM9", "VM1"}
+	devices.devices["VM1"].OnlineStatus = 0
+	published.err = errors.New("broker down")
+	err = monitor.Check(ctx)
+	assert.ErrorContains(t, err, "VM9")
+	assert.ErrorContains(t, err, "broker down")
+	published.err = nil
+	require.Error(t, monitor.Check(ctx))
+	require.Len(t, published.events, 3)
+	assert.Equal(t, "VM1", published.events[2].VmCode)
+}
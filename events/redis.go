@@ -0,0 +1,204 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// RedisStream is a Bus on a Redis stream, with groups mapped to Redis consumer groups. A delivered
+// event stays pending in its group until a handler acknowledges it; events pending longer than
+// ClaimAfter, because their handler failed or their consumer went away, are claimed and delivered
+// again, up to MaxDeliveries times before they are moved to the DeadLetter stream.
+type RedisStream struct {
+	Client redis.UniversalClient
+	// Stream is the key of the stream; defaults to "aifinit:events"
+	Stream string
+	// Consumer names this process within its groups; defaults to the host name and process ID
+	Consumer string
+	// MaxLen approximately caps the stream length, 0 keeps every event
+	MaxLen int64
+	// ClaimAfter is how long an unacknowledged event waits before it is delivered again; defaults to
+	// thirty seconds
+	ClaimAfter time.Duration
+	// Block is how long a read waits for new events; defaults to five seconds
+	Block time.Duration
+	// Batch is the number of events read at a time; defaults to 16
+	Batch int64
+	// MaxDeliveries is how many times an event is delivered to a group before it is given up on;
+	// defaults to ten, 0 delivers it until it is acknowledged
+	MaxDeliveries int64
+	// DeadLetter is the key of the stream given up events are added to, with the group and
+	// delivery count; defaults to the stream's key followed by ":dead"
+	DeadLetter string
+}
+
+// NewRedisStream creates a bus on the default stream of a Redis client
+func NewRedisStream(client redis.UniversalClient) *RedisStream {
+	host, _ := os.Hostname()
+	return &RedisStream{
+		Client:        client,
+		Stream:        "aifinit:events",
+		Consumer:      fmt.Sprintf("%s-%d", host, os.Getpid()),
+		ClaimAfter:    30 * time.Second,
+		Block:         5 * time.Second,
+		Batch:         16,
+		MaxDeliveries: 10,
+	}
+}
+
+// Publish appends the event to the stream
+func (s *RedisStream) Publish(ctx context.Context, event Event) error {
+	if event.Type == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("event %s has no type", event.ID))
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(err)
+	}
+	err = s.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.Stream,
+		MaxLen: s.MaxLen,
+		Approx: s.MaxLen > 0,
+		Values: map[string]any{"type": string(event.Type), "event": data},
+	}).Err()
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("publish %s event %s: %w", event.Type, event.ID, err))
+	}
+	return nil
+}
+
+func (s *RedisStream) Consume(ctx context.Context, group string, handler Handler, types ...Type) error {
+	err := s.Client.XGroupCreateMkStream(ctx, s.Stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("create group %s on %s: %w", group, s.Stream, err))
+	}
+
+	// The claim scan resumes where the last one stopped, so that every pending event gets its turn
+	// rather than the head of a long pending list being claimed over and over
+	cursor := "0-0"
+	for {
+		// Reclaim first, so that events to redeliver do not wait behind a busy stream
+		claimed, next, err := s.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.Stream,
+			Group:    group,
+			Consumer: s.Consumer,
+			MinIdle:  s.ClaimAfter,
+			Start:    cursor,
+			Count:    s.Batch,
+		}).Result()
+		if err != nil {
+			return s.consumeError(ctx, group, err)
+		}
+		cursor = next
+		claimed, err = s.giveUp(ctx, group, claimed)
+		if err != nil {
+			return s.consumeError(ctx, group, err)
+		}
+		s.handle(ctx, group, handler, types, claimed)
+
+		streams, err := s.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: s.Consumer,
+			Streams:  []string{s.Stream, ">"},
+			Count:    s.Batch,
+			Block:    s.Block,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return s.consumeError(ctx, group, err)
+		}
+		for _, stream := range streams {
+			s.handle(ctx, group, handler, types, stream.Messages)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *RedisStream) consumeError(ctx context.Context, group string, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return aifinitsdk.NewAinfinitError(fmt.Errorf("consume %s as %s: %w", s.Stream, group, err))
+}
+
+// giveUp moves the claimed messages delivered more than MaxDeliveries times to the dead letter
+// stream and returns the others
+func (s *RedisStream) giveUp(ctx context.Context, group string, claimed []redis.XMessage) ([]redis.XMessage, error) {
+	if s.MaxDeliveries <= 0 || len(claimed) == 0 {
+		return claimed, nil
+	}
+	pending, err := s.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   s.Stream,
+		Group:    group,
+		Start:    claimed[0].ID,
+		End:      claimed[len(claimed)-1].ID,
+		Count:    int64(len(claimed)),
+		Consumer: s.Consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	deadLetter := s.DeadLetter
+	if deadLetter == "" {
+		deadLetter = s.Stream + ":dead"
+	}
+	var keep []redis.XMessage
+	for _, message := range claimed {
+		// The count includes the delivery the claim is about to make
+		if deliveries[message.ID] <= s.MaxDeliveries {
+			keep = append(keep, message)
+			continue
+		}
+		values := map[string]any{"group": group, "id": message.ID, "deliveries": deliveries[message.ID] - 1}
+		for key, value := range message.Values {
+			values[key] = value
+		}
+		if err := s.Client.XAdd(ctx, &redis.XAddArgs{Stream: deadLetter, Values: values}).Err(); err != nil {
+			return nil, fmt.Errorf("dead letter %s: %w", message.ID, err)
+		}
+		logrus.WithFields(logrus.Fields{"stream": s.Stream, "group": group, "message": message.ID, "deadLetter": deadLetter}).
+			Warn("Event not acknowledged after the maximum deliveries, dead lettered")
+		if err := s.Client.XAck(ctx, s.Stream, group, message.ID).Err(); err != nil {
+			// Claimed and dead lettered again later
+			logrus.WithError(err).WithField("message", message.ID).Debug("Acknowledging dead lettered event failed")
+		}
+	}
+	return keep, nil
+}
+
+// handle runs the handler on each message and acknowledges those it handled. Messages that are
+// not events can never be handled and are acknowledged as well.
+func (s *RedisStream) handle(ctx context.Context, group string, handler Handler, types []Type, messages []redis.XMessage) {
+	for _, message := range messages {
+		log := logrus.WithFields(logrus.Fields{"stream": s.Stream, "group": group, "message": message.ID})
+		var event Event
+		data, _ := message.Values["event"].(string)
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.WithError(err).Warn("Dropping stream message that is not an event")
+		} else if handles(types, event.Type) {
+			if err := handler(ctx, event); err != nil {
+				log.WithError(err).WithFields(logrus.Fields{"event": event.ID, "type": event.Type}).Debug("Event handler failed, redelivering")
+				continue
+			}
+		}
+		if err := s.Client.XAck(ctx, s.Stream, group, message.ID).Err(); err != nil {
+			// The event stays pending and is delivered again
+			log.WithError(err).Debug("Acknowledging event failed")
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// testRedisStream creates a bus with short timings on miniredis, or on the server at
+// AIFINIT_REDIS_ADDR when set, e.g. one started with `docker run --rm -d -p 6379:6379 redis:7`
+func testRedisStream(t *testing.T) *RedisStream {
+	addr := os.Getenv("AIFINIT_REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+
+	bus := NewRedisStream(client)
+	bus.Stream = "aifinit:test:" + t.Name()
+	bus.ClaimAfter = 100 * time.Millisecond
+	bus.Block = 20 * time.Millisecond
+	require.NoError(t, client.Del(context.Background(), bus.Stream, bus.Stream+":dead").Err())
+	return bus
+}
+
+func TestRedisStream(t *testing.T) {
+	testBus(t, func(t *testing.T) Bus { return testRedisStream(t) })
+}
+
+func TestRedisStream_ConsumerGone(t *testing.T) {
+	ctx := context.Background()
+	bus := testRedisStream(t)
+	join(t, bus, "billing")
+
+	// The first consumer reads the event and stops before acknowledging it
+	gone := *bus
+	gone.Consumer = "gone"
+	read := make(chan Event, 1)
+	stop, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gone.Consume(stop, "billing", func(ctx context.Context, event Event) error {
+			read <- event
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	event := publish(t, bus, OrderSettled{OrderCallbackRequest: aifinitsdk.OrderCallbackRequest{OrderCode: "O1", VmCode: "VM1"}})
+	assertEvent(t, event, <-read)
+	cancel()
+	<-done
+	pending, err := bus.Client.XPending(ctx, bus.Stream, "billing").Result()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, pending.Count)
+
+	// Another consumer claims it
+	next := *bus
+	next.Consumer = "next"
+	billing := newRecorder()
+	consume(t, &next, "billing", billing.handle)
+	assertEvent(t, event, billing.receive(t))
+	billing.none(t)
+	pending, err = bus.Client.XPending(ctx, bus.Stream, "billing").Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
+
+func TestRedisStream_Publish(t *testing.T) {
+	ctx := context.Background()
+	bus := testRedisStream(t)
+	bus.MaxLen = 2
+	for range 3 {
+		publish(t, bus, MachineOffline{VmCode: "VM1"})
+	}
+	messages, err := bus.Client.XRange(ctx, bus.Stream, "-", "+").Result()
+	require.NoError(t, err)
+	assert.NotEmpty(t, messages)
+	assert.Equal(t, string(TypeMachineOffline), messages[0].Values["type"])
+
+	// Messages that are not events are acknowledged and skipped
+	join(t, bus, "audit")
+	require.NoError(t, bus.Client.XAdd(ctx, &redis.XAddArgs{Stream: bus.Stream, Values: map[string]any{"event": "not json"}}).Err())
+	audit := newRecorder()
+	consume(t, bus, "audit", audit.handle)
+	event := publish(t, bus, MachineOffline{VmCode: "VM2"})
+	assertEvent(t, event, audit.receive(t))
+	audit.none(t)
+}
+
+func TestRedisStream_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	bus := testRedisStream(t)
+	bus.MaxDeliveries = 3
+	bus.Batch = 1
+	join(t, bus, "billing")
+
+	// A handler that always fails gets the event MaxDeliveries times, then it is dead lettered
+	billing := newRecorder()
+	billing.fail = 100
+	consume(t, bus, "billing", billing.handle)
+	poison := publish(t, bus, MachineOffline{VmCode: "VM1"})
+	for range 3 {
+		assertEvent(t, poison, billing.receive(t))
+	}
+	billing.none(t)
+
+	require.Eventually(t, func() bool {
+		pending, err := bus.Client.XPending(ctx, bus.Stream, "billing").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 20*time.Millisecond)
+	dead, err := bus.Client.XRange(ctx, bus.Stream+":dead", "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "billing", dead[0].Values["group"])
+	assert.Equal(t, "3", dead[0].Values["deliveries"])
+	assert.Equal(t, string(TypeMachineOffline), dead[0].Values["type"])
+}
+
+func TestRedisStream_ClaimCursor(t *testing.T) {
+	ctx := context.Background()
+	bus := testRedisStream(t)
+	bus.Batch = 1
+	// Failed events are due again by the next loop, so a scan from the start would only ever claim the first
+	bus.ClaimAfter = time.Millisecond
+	bus.MaxDeliveries = 0
+	join(t, bus, "billing")
+
+	// Two events are left pending by a consumer that went away
+	for range 2 {
+		publish(t, bus, MachineOffline{VmCode: "VM1"})
+	}
+	_, err := bus.Client.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "billing", Consumer: "gone", Streams: []string{bus.Stream, ">"}, Count: 2}).Result()
+	require.NoError(t, err)
+
+	// The first keeps failing, yet the claim scan moves on to the second
+	var mu sync.Mutex
+	seen := map[string]int{}
+	consume(t, bus, "billing", func(ctx context.Context, event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[event.ID]++
+		if len(seen) == 1 {
+			return errors.New("not now")
+		}
+		return nil
+	})
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,482 @@
+package aifinitsdk
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EvidenceArtefact is one file of an evidence bundle
+type EvidenceArtefact struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Source string `json:"source,omitempty"`
+}
+
+// EvidenceTimelineEntry is one step of an order as shown in the evidence summary
+type EvidenceTimelineEntry struct {
+	At     time.Time `json:"at"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// EvidenceManifest describes an evidence bundle; it is stored as manifest.json
+type EvidenceManifest struct {
+	OrderCode   string    `json:"orderCode"`
+	VmCode      string    `json:"vmCode"`
+	RequestID   string    `json:"requestId"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	// OrderSource is "callback" when the order callback was recorded, "order_list" when the order was
+	// found through ListOrders
+	OrderSource    string                `json:"orderSource"`
+	Order          *OrderCallbackRequest `json:"order"`
+	OpenDoorDetail *SearchOpenDoorData   `json:"openDoorDetail,omitempty"`
+	// Prices are the machine's current prices of the ordered and candidate goods
+	Prices      []Goods                 `json:"prices,omitempty"`
+	WeightDelta float64                 `json:"weightDelta"` // open door weight minus close door weight
+	Timeline    []EvidenceTimelineEntry `json:"timeline"`
+	// Artefacts lists every other file in the bundle with its SHA-256
+	Artefacts []EvidenceArtefact `json:"artefacts"`
+	// Warnings are sources that could not be reached; the bundle is built without them
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// EvidenceExporter assembles dispute evidence bundles. Order callbacks passed to HandleOrder are
+// kept for export; orders without a recorded callback are looked up with ListOrders on Machines.
+type EvidenceExporter struct {
+	Operations OperationClient
+	// Machines are searched for orders without a recorded callback
+	Machines []string
+	// LookBack bounds the ListOrders search; defaults to seven days
+	LookBack time.Duration
+	// Archiver, when set, provides already archived clips instead of downloading them again
+	Archiver *OrderVideoArchiver
+	// HTTPClient downloads the videos; defaults to http.DefaultClient
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	orders map[string]*OrderCallbackRequest
+	now    func() time.Time
+}
+
+// NewEvidenceExporter creates an exporter searching the given machines for unrecorded orders
+func NewEvidenceExporter(operations OperationClient, machines ...string) *EvidenceExporter {
+	return &EvidenceExporter{
+		Operations: operations,
+		Machines:   machines,
+		LookBack:   7 * 24 * time.Hour,
+		orders:     make(map[string]*OrderCallbackRequest),
+		now:        time.Now,
+	}
+}
+
+// HandleOrder records an order callback for later export
+func (e *EvidenceExporter) HandleOrder(order *OrderCallbackRequest) {
+	if order == nil || order.OrderCode == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.orders[order.OrderCode] = order
+}
+
+// evidenceBundle collects the files of a bundle before they are zipped
+type evidenceBundle struct {
+	manifest *EvidenceManifest
+	files    []evidenceFile
+}
+
+type evidenceFile struct {
+	name   string
+	source string
+	data   []byte
+	open   func() (io.ReadCloser, error)
+}
+
+// ExportEvidence writes a ZIP bundle for the order to w and returns its manifest. The bundle holds
+// manifest.json, the order, door result and price data as JSON, every video clip, summary.html
+// with the timeline and SHA256SUMS covering all files. Unreachable sources are noted in the
+// manifest warnings; only an unknown order fails the export.
+func (e *EvidenceExporter) ExportEvidence(ctx context.Context, orderCode string, w io.Writer) (*EvidenceManifest, error) {
+	order, source, err := e.findOrder(ctx, orderCode)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &EvidenceManifest{
+		OrderCode:   orderCode,
+		VmCode:      order.VmCode,
+		RequestID:   order.TradeRequestId,
+		GeneratedAt: e.now(),
+		OrderSource: source,
+		Order:       order,
+		WeightDelta: order.OpenDoorWeight - order.CloseDoorWeight,
+	}
+	bundle := &evidenceBundle{manifest: manifest}
+	bundle.addJSON("order.json", source, order)
+
+	if order.TradeRequestId != "" {
+		detail, err := e.Operations.OpenDoorReqDetail(&OpenDoorDetailRequest{Type: OpenDoorForShopping, RequestID: order.TradeRequestId}, order.VmCode)
+		if err != nil || detail == nil {
+			manifest.warn("open door detail: %v", err)
+		} else {
+			manifest.OpenDoorDetail = &detail.Data
+			bundle.addJSON("open_door_detail.json", "OpenDoorReqDetail", detail.Data)
+		}
+	}
+
+	if prices, err := e.prices(order); err != nil {
+		manifest.warn("goods prices: %v", err)
+	} else {
+		manifest.Prices = prices
+		bundle.addJSON("goods_prices.json", "ListGoods", prices)
+	}
+
+	e.addVideos(ctx, bundle, order)
+	manifest.Timeline = evidenceTimeline(order)
+
+	if err := bundle.write(w); err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("failed to write evidence bundle: %w", err))
+	}
+	return manifest, nil
+}
+
+func (e *EvidenceExporter) findOrder(ctx context.Context, orderCode string) (*OrderCallbackRequest, string, error) {
+	e.mu.Lock()
+	order, ok := e.orders[orderCode]
+	e.mu.Unlock()
+	if ok {
+		copied := *order
+		return &copied, "callback", nil
+	}
+
+	lookBack := e.LookBack
+	if lookBack <= 0 {
+		lookBack = 7 * 24 * time.Hour
+	}
+	end := e.now()
+	begin := end.Add(-lookBack)
+	for _, vmCode := range e.Machines {
+		for listed, err := range NewOrderIterator(e.Operations, vmCode, TimeRange{From: begin, To: end}).All(ctx) {
+			if err != nil {
+				return nil, "", err
+			}
+			if listed.OrderCode == orderCode {
+				return orderFromListing(listed), "order_list", nil
+			}
+		}
+	}
+	return nil, "", NewAinfinitError(fmt.Errorf("order %s not found", orderCode))
+}
+
+// orderFromListing converts a listed order to the callback shape used in bundles
+func orderFromListing(listed Order) *OrderCallbackRequest {
+	order := &OrderCallbackRequest{
+		TradeRequestId:  listed.TradeRequestId,
+		OrderCode:       listed.OrderCode,
+		UserCode:        listed.UserCode,
+		VmCode:          listed.VmCode,
+		HandleStatus:    HandleStatus(listed.HandleStatus),
+		OpenDoorTime:    listed.OpenDoorTime,
+		OpenDoorWeight:  listed.OpenDoorWeight,
+		CloseDoorTime:   listed.CloseDoorTime,
+		CloseDoorWeight: listed.CloseDoorWeight,
+		ShopMove:        ShopMove(listed.ShopMove),
+	}
+	for _, goods := range listed.OrderGoodsList {
+		order.OrderGoodsList = append(order.OrderGoodsList, OrderGoods{ItemCode: goods.ItemCode, ItemPrice: goods.ActualPrice, Count: goods.Count})
+	}
+	return order
+}
+
+// prices returns the machine's current goods for the ordered and candidate items
+func (e *EvidenceExporter) prices(order *OrderCallbackRequest) ([]Goods, error) {
+	wanted := make(map[string]bool)
+	for _, item := range append(append([]OrderGoods(nil), order.OrderGoodsList...), order.Candidates...) {
+		wanted[item.ItemCode] = true
+	}
+	if len(wanted) == 0 {
+		return nil, nil
+	}
+
+	response, err := e.Operations.ListGoods(order.VmCode)
+	if err != nil {
+		return nil, err
+	}
+	if response == nil {
+		return nil, NewAinfinitError(fmt.Errorf("empty goods list for machine %s", order.VmCode))
+	}
+	if !isSuccessStatus(int(response.Status)) {
+		return nil, NewAinfinitError(fmt.Errorf("status: %d, message: %s", response.Status, response.Message))
+	}
+	var prices []Goods
+	for _, goods := range response.Result {
+		if wanted[goods.ItemCode] {
+			prices = append(prices, goods)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].ItemCode < prices[j].ItemCode })
+	return prices, nil
+}
+
+// addVideos adds archived clips when available, otherwise downloads the order's videos
+func (e *EvidenceExporter) addVideos(ctx context.Context, bundle *evidenceBundle, order *OrderCallbackRequest) {
+	if e.Archiver != nil {
+		if archived := e.Archiver.ByOrder(order.OrderCode); len(archived) > 0 {
+			for _, clip := range archived {
+				key := clip.Key
+				bundle.files = append(bundle.files, evidenceFile{
+					name:   fmt.Sprintf("videos/%02d%s", clip.Clip, clipExtension(clip.SourceURL)),
+					source: clip.SourceURL,
+					open:   func() (io.ReadCloser, error) { return e.Archiver.Storage.Open(ctx, key) },
+				})
+			}
+			return
+		}
+	}
+
+	urls := orderVideoURLs(order.VideoUrl, order.VideoUrls)
+	if len(urls) == 0 && order.TradeRequestId != "" {
+		video, err := e.Operations.GetOrderVideo(&GetOrderVideoRequest{RequestID: order.TradeRequestId, Type: OpenDoorForShopping}, order.VmCode)
+		switch {
+		case err != nil:
+			bundle.manifest.warn("order video: %v", err)
+		case video.Data.VideoStatus != VideoStatusUploadComplete:
+			bundle.manifest.warn("order video: %s", video.Data.VideoStatus)
+		default:
+			urls = orderVideoURLs(video.Data.VideoUrl, video.Data.VideoURLs)
+		}
+	}
+
+	client := e.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	for i, url := range urls {
+		url := url
+		bundle.files = append(bundle.files, evidenceFile{
+			name:   fmt.Sprintf("videos/%02d%s", i+1, clipExtension(url)),
+			source: url,
+			open: func() (io.ReadCloser, error) {
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				if err != nil {
+					return nil, err
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					return nil, err
+				}
+				if resp.StatusCode != http.StatusOK {
+					resp.Body.Close()
+					return nil, fmt.Errorf("%s: %s", url, resp.Status)
+				}
+				return resp.Body, nil
+			},
+		})
+	}
+}
+
+func (b *evidenceBundle) addJSON(name, source string, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		b.manifest.warn("%s: %v", name, err)
+		return
+	}
+	b.files = append(b.files, evidenceFile{name: name, source: source, data: data})
+}
+
+// write zips the files, hashing each as it is written, then adds the summary, the manifest and
+// SHA256SUMS. Videos that cannot be fetched are left out and noted in the manifest.
+func (b *evidenceBundle) write(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, file := range b.files {
+		artefact, err := writeEvidenceFile(archive, file)
+		var download *evidenceDownloadError
+		if errors.As(err, &download) {
+			logrus.WithError(err).WithField("file", file.name).Warn("Could not add video to evidence bundle")
+			b.manifest.warn("%s: %v", file.name, download.err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		b.manifest.Artefacts = append(b.manifest.Artefacts, artefact)
+	}
+
+	// Rendered after the videos so that failed downloads show up in it
+	summary, err := renderEvidenceSummary(b.manifest)
+	if err != nil {
+		return err
+	}
+	artefact, err := writeEvidenceFile(archive, evidenceFile{name: "summary.html", source: "generated", data: summary})
+	if err != nil {
+		return err
+	}
+	b.manifest.Artefacts = append(b.manifest.Artefacts, artefact)
+
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestArtefact, err := writeEvidenceFile(archive, evidenceFile{name: "manifest.json", data: manifest})
+	if err != nil {
+		return err
+	}
+
+	var sums bytes.Buffer
+	for _, artefact := range append(b.manifest.Artefacts, manifestArtefact) {
+		fmt.Fprintf(&sums, "%s  %s\n", artefact.SHA256, artefact.Name)
+	}
+	if _, err := writeEvidenceFile(archive, evidenceFile{name: "SHA256SUMS", data: sums.Bytes()}); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// evidenceDownloadError is a file that could not be fetched; the bundle is written without it
+type evidenceDownloadError struct {
+	err error
+}
+
+func (e *evidenceDownloadError) Error() string { return e.err.Error() }
+func (e *evidenceDownloadError) Unwrap() error { return e.err }
+
+// writeEvidenceFile adds one file to the archive. Fetched files are downloaded to a temporary file
+// first, so that a failed download leaves no truncated entry behind.
+func writeEvidenceFile(archive *zip.Writer, file evidenceFile) (EvidenceArtefact, error) {
+	if file.open == nil {
+		return writeEvidenceEntry(archive, file, zip.Deflate, bytes.NewReader(file.data))
+	}
+
+	tmp, err := os.CreateTemp("", "evidence-*")
+	if err != nil {
+		return EvidenceArtefact{}, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	if err := downloadEvidenceFile(file, tmp); err != nil {
+		return EvidenceArtefact{}, &evidenceDownloadError{err: err}
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return EvidenceArtefact{}, err
+	}
+	// Store videos as is; they are already compressed
+	return writeEvidenceEntry(archive, file, zip.Store, tmp)
+}
+
+func downloadEvidenceFile(file evidenceFile, w io.Writer) error {
+	reader, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+func writeEvidenceEntry(archive *zip.Writer, file evidenceFile, method uint16, body io.Reader) (EvidenceArtefact, error) {
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: method})
+	if err != nil {
+		return EvidenceArtefact{}, err
+	}
+	digest := sha256.New()
+	size, err := io.Copy(io.MultiWriter(entry, digest), body)
+	if err != nil {
+		return EvidenceArtefact{}, err
+	}
+	return EvidenceArtefact{Name: file.name, Size: size, SHA256: hex.EncodeToString(digest.Sum(nil)), Source: file.source}, nil
+}
+
+func (m *EvidenceManifest) warn(format string, args ...interface{}) {
+	m.Warnings = append(m.Warnings, fmt.Sprintf(format, args...))
+}
+
+// evidenceTimeline lists the door, weight and recognition steps of an order in time order
+func evidenceTimeline(order *OrderCallbackRequest) []EvidenceTimelineEntry {
+	var timeline []EvidenceTimelineEntry
+	if !order.OpenDoorTime.IsZero() {
+		timeline = append(timeline, EvidenceTimelineEntry{
+			At:     order.OpenDoorTime.Time,
+			Event:  "Door opened",
+			Detail: fmt.Sprintf("weight %.1f g", order.OpenDoorWeight),
+		})
+	}
+	if !order.CloseDoorTime.IsZero() {
+		closed := order.CloseDoorTime.Time
+		timeline = append(timeline, EvidenceTimelineEntry{
+			At:     closed,
+			Event:  "Door closed",
+			Detail: fmt.Sprintf("weight %.1f g, delta %.1f g", order.CloseDoorWeight, order.OpenDoorWeight-order.CloseDoorWeight),
+		})
+		timeline = append(timeline, EvidenceTimelineEntry{At: closed, Event: "Recognition", Detail: order.HandleStatus.String()})
+		for _, reason := range order.AbnormalReasons {
+			timeline = append(timeline, EvidenceTimelineEntry{At: closed, Event: "Abnormal reason", Detail: fmt.Sprintf("%s (%s)", reason.String(), string(reason))})
+		}
+		for _, candidate := range order.Candidates {
+			timeline = append(timeline, EvidenceTimelineEntry{At: closed, Event: "Candidate", Detail: fmt.Sprintf("%s x%d at %s", candidate.ItemCode, candidate.Count, candidate.ItemPrice)})
+		}
+	}
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].At.Before(timeline[j].At) })
+	return timeline
+}
+
+var evidenceSummaryTemplate = template.Must(template.New("summary").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Order {{.OrderCode}}</title>
+<style>body{font-family:sans-serif}table{border-collapse:collapse}td,th{border:1px solid #ccc;padding:4px 8px;text-align:left}</style>
+</head>
+<body>
+<h1>Order {{.OrderCode}}</h1>
+<p>Machine {{.VmCode}}, request {{.RequestID}}, generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+<p>Recognition: {{.Order.HandleStatus}}. Weight delta: {{printf "%.1f" .WeightDelta}} g.</p>
+<h2>Timeline</h2>
+<table>
+<tr><th>Time</th><th>Event</th><th>Detail</th></tr>
+{{range .Timeline}}<tr><td>{{.At.Format "2006-01-02 15:04:05"}}</td><td>{{.Event}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+<h2>Goods</h2>
+<table>
+<tr><th>Item</th><th>Name</th><th>Price</th><th>Count</th></tr>
+{{range .Order.OrderGoodsList}}<tr><td>{{.ItemCode}}</td><td>{{.ItemName}}</td><td>{{.ItemPrice}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{if .Order.Candidates}}<h2>Candidates</h2>
+<table>
+<tr><th>Item</th><th>Name</th><th>Price</th><th>Count</th></tr>
+{{range .Order.Candidates}}<tr><td>{{.ItemCode}}</td><td>{{.ItemName}}</td><td>{{.ItemPrice}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Prices}}<h2>Current prices</h2>
+<table>
+<tr><th>Item</th><th>Actual</th><th>Original</th></tr>
+{{range .Prices}}<tr><td>{{.ItemCode}}</td><td>{{.ActualPrice}}</td><td>{{.OriginalPrice}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Warnings}}<h2>Missing evidence</h2>
+<ul>{{range .Warnings}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<p>File hashes are listed in manifest.json and SHA256SUMS.</p>
+</body>
+</html>
+`))
+
+func renderEvidenceSummary(manifest *EvidenceManifest) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := evidenceSummaryTemplate.Execute(&buf, manifest); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
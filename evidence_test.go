@@ -0,0 +1,215 @@
+package aifinitsdk
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEvidenceClient struct {
+	fakeGoodsClient
+	orders   []Order
+	videoURL string
+}
+
+func (f *fakeEvidenceClient) ListOrders(request *ListOrderRequest, machineCode string) (*ListOrderResponse, error) {
+	response := &ListOrderResponse{Status: 200}
+	if machineCode == "VM1" {
+		response.Data.Rows = f.orders
+		response.Data.Total = len(f.orders)
+	}
+	return response, nil
+}
+
+func (f *fakeEvidenceClient) OpenDoorReqDetail(request *OpenDoorDetailRequest, machineCode string) (*OpenDoorDetailResponse, error) {
+	return &OpenDoorDetailResponse{Status: 202, Data: SearchOpenDoorData{TradeRequestId: request.RequestID, VmCode: machineCode, TotalFee: mnt(5)}}, nil
+}
+
+func (f *fakeEvidenceClient) GetOrderVideo(request *GetOrderVideoRequest, machineCode string) (*GetOrderVideoResponse, error) {
+	response := &GetOrderVideoResponse{Status: 200}
+	response.Data.VideoStatus = VideoStatusUploadComplete
+	response.Data.VideoURLs = []string{f.videoURL}
+	return response, nil
+}
+
+func readEvidenceZip(t *testing.T, data []byte) map[string][]byte {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		r, err := file.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		r.Close()
+		files[file.Name] = content
+	}
+	return files
+}
+
+func TestEvidenceExporter_ExportFromOrderList(t *testing.T) {
+	videos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "video bytes")
+	}))
+	defer videos.Close()
+
+	opened := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	operations := &fakeEvidenceClient{
+		fakeGoodsClient: fakeGoodsClient{goods: []Goods{{ItemCode: "COLA", ActualPrice: mnt(2.5), Count: 4}, {ItemCode: "WATER", ActualPrice: mnt(1)}}},
+		orders: []Order{{
+			OrderCode: "O-1", TradeRequestId: "REQ-1", HandleStatus: int(HandleStatusCloudSuccess),
+			OpenDoorTime: MillisOf(opened), CloseDoorTime: MillisOf(opened.Add(time.Minute)),
+			OpenDoorWeight: 5000, CloseDoorWeight: 4330,
+			OrderGoodsList: []Goods{{ItemCode: "COLA", ActualPrice: mnt(2.5), Count: 2}},
+		}},
+		videoURL: videos.URL + "/clip.mp4",
+	}
+	exporter := NewEvidenceExporter(operations, "VM2", "VM1")
+	exporter.now = func() time.Time { return opened.Add(time.Hour) }
+
+	var out bytes.Buffer
+	manifest, err := exporter.ExportEvidence(context.Background(), "O-1", &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "order_list", manifest.OrderSource)
+	assert.Equal(t, "VM1", manifest.VmCode)
+	assert.Equal(t, 670.0, manifest.WeightDelta)
+	assert.Equal(t, []Goods{{ItemCode: "COLA", ActualPrice: mnt(2.5), Count: 4}}, manifest.Prices)
+	assert.Empty(t, manifest.Warnings)
+
+	files := readEvidenceZip(t, out.Bytes())
+	for _, name := range []string{"manifest.json", "order.json", "open_door_detail.json", "goods_prices.json", "videos/01.mp4", "summary.html", "SHA256SUMS"} {
+		assert.Contains(t, files, name)
+	}
+	assert.Equal(t, "video bytes", string(files["videos/01.mp4"]))
+	assert.Contains(t, string(files["summary.html"]), "Door closed")
+	assert.Contains(t, string(files["summary.html"]), "Cloud Success")
+
+	// Every file but the checksum list itself is listed with its hash
+	sums := strings.Split(strings.TrimSpace(string(files["SHA256SUMS"])), "\n")
+	assert.Len(t, sums, len(files)-1)
+	for _, line := range sums {
+		parts := strings.SplitN(line, "  ", 2)
+		sum := sha256.Sum256(files[parts[1]])
+		assert.Equal(t, hex.EncodeToString(sum[:]), parts[0], parts[1])
+	}
+
+	var stored EvidenceManifest
+	assert.NoError(t, json.Unmarshal(files["manifest.json"], &stored))
+	assert.Len(t, stored.Artefacts, len(files)-2)
+}
+
+func TestEvidenceExporter_RecordedCallback(t *testing.T) {
+	videos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer videos.Close()
+
+	exporter := NewEvidenceExporter(&fakeEvidenceClient{})
+	exporter.HandleOrder(&OrderCallbackRequest{
+		OrderCode: "O-2", VmCode: "VM1", TradeRequestId: "REQ-2", HandleStatus: HandleStatusCloudFailure,
+		CloseDoorTime:   MillisOf(time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)),
+		AbnormalReasons: []AbnormalReason{AbnormalReasonCameraEx},
+		Candidates:      []OrderGoods{{ItemCode: "CHIPS", ItemPrice: mnt(3), Count: 1}},
+		VideoUrl:        videos.URL + "/missing.mp4",
+	})
+
+	var out bytes.Buffer
+	manifest, err := exporter.ExportEvidence(context.Background(), "O-2", &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "callback", manifest.OrderSource)
+	if assert.Len(t, manifest.Warnings, 1) {
+		assert.Contains(t, manifest.Warnings[0], "videos/01.mp4")
+	}
+
+	files := readEvidenceZip(t, out.Bytes())
+	assert.NotContains(t, files, "videos/01.mp4")
+	summary := string(files["summary.html"])
+	assert.Contains(t, summary, "CAMERA_EX")
+	assert.Contains(t, summary, "CHIPS x1")
+	assert.Contains(t, summary, "Missing evidence")
+
+	_, err = exporter.ExportEvidence(context.Background(), "O-404", io.Discard)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestEvidenceExporter_TruncatedVideo(t *testing.T) {
+	videos := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/cut.mp4" {
+			// The connection drops after part of the announced body
+			w.Header().Set("Content-Length", "1000")
+			io.WriteString(w, "partial")
+			return
+		}
+		io.WriteString(w, "video bytes")
+	}))
+	defer videos.Close()
+
+	exporter := NewEvidenceExporter(&fakeEvidenceClient{})
+	exporter.HandleOrder(&OrderCallbackRequest{
+		OrderCode: "O-3", VmCode: "VM1", HandleStatus: HandleStatusCloudSuccess,
+		CloseDoorTime: MillisOf(time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)),
+		VideoUrl:      videos.URL + "/cut.mp4",
+		VideoUrls:     []string{videos.URL + "/whole.mp4"},
+	})
+
+	var out bytes.Buffer
+	manifest, err := exporter.ExportEvidence(context.Background(), "O-3", &out)
+	assert.NoError(t, err)
+	if assert.Len(t, manifest.Warnings, 1) {
+		assert.Contains(t, manifest.Warnings[0], "videos/01.mp4")
+	}
+
+	files := readEvidenceZip(t, out.Bytes())
+	assert.NotContains(t, files, "videos/01.mp4")
+	assert.Equal(t, "video bytes", string(files["videos/02.mp4"]))
+	for _, line := range strings.Split(strings.TrimSpace(string(files["SHA256SUMS"])), "\n") {
+		parts := strings.SplitN(line, "  ", 2)
+		sum := sha256.Sum256(files[parts[1]])
+		assert.Equal(t, hex.EncodeToString(sum[:]), parts[0], parts[1])
+	}
+}
+
+// failingGoodsClient answers ListGoods with a fixed response
+type failingGoodsClient struct {
+	fakeEvidenceClient
+	response *GetMachineGoodsResponse
+}
+
+func (f *failingGoodsClient) ListGoods(machineCode string) (*GetMachineGoodsResponse, error) {
+	return f.response, nil
+}
+
+func TestEvidenceExporter_GoodsListFailure(t *testing.T) {
+	for name, response := range map[string]*GetMachineGoodsResponse{
+		"empty body":   nil,
+		"error status": {Status: 500, Message: "internal error"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			exporter := NewEvidenceExporter(&failingGoodsClient{response: response})
+			exporter.HandleOrder(&OrderCallbackRequest{
+				OrderCode: "O-4", VmCode: "VM1", HandleStatus: HandleStatusCloudSuccess,
+				OrderGoodsList: []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 1}},
+			})
+
+			var out bytes.Buffer
+			manifest, err := exporter.ExportEvidence(context.Background(), "O-4", &out)
+			assert.NoError(t, err)
+			assert.Empty(t, manifest.Prices)
+			if assert.Len(t, manifest.Warnings, 1) {
+				assert.Contains(t, manifest.Warnings[0], "goods prices")
+			}
+			assert.NotContains(t, readEvidenceZip(t, out.Bytes()), "goods_prices.json")
+		})
+	}
+}
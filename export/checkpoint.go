@@ -0,0 +1,78 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint marks how far an incremental export got
+type Checkpoint struct {
+	// Until is the latest close door time exported
+	Until time.Time `json:"until"`
+	// Exported maps the orders exported within the overlap window behind Until to their close door
+	// time, so that the next run can read the window again and skip them
+	Exported map[string]time.Time `json:"exported"`
+}
+
+// CheckpointStore persists the checkpoint between runs
+type CheckpointStore interface {
+	// Load returns the stored checkpoint, or nil before the first export
+	Load() (*Checkpoint, error)
+	Save(checkpoint *Checkpoint) error
+}
+
+// MemoryCheckpointStore keeps the checkpoint in memory only
+type MemoryCheckpointStore struct {
+	mu         sync.Mutex
+	checkpoint *Checkpoint
+}
+
+func (s *MemoryCheckpointStore) Load() (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoint, nil
+}
+
+func (s *MemoryCheckpointStore) Save(checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoint = checkpoint
+	return nil
+}
+
+// FileCheckpointStore keeps the checkpoint as a JSON file
+type FileCheckpointStore struct {
+	Path string
+}
+
+func (s *FileCheckpointStore) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+func (s *FileCheckpointStore) Save(checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
@@ -0,0 +1,278 @@
+// Package export flattens orders into one row per order line, enriched with product and machine
+// metadata, and writes them as CSV, JSON Lines or Parquet. Exports are incremental: a checkpoint
+// remembers the last exported close door time so the next run picks up from there, reading a
+// window behind it again for orders reported late.
+package export
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Row is one order line. The column set and order are the stable export schema; times are unix
+// milliseconds and amounts are in minor units of Currency.
+type Row struct {
+	OrderCode       string `json:"order_code" parquet:"order_code"`
+	TradeRequestId  string `json:"trade_request_id" parquet:"trade_request_id"`
+	Source          string `json:"source" parquet:"source"`
+	VmCode          string `json:"vm_code" parquet:"vm_code"`
+	MachineName     string `json:"machine_name" parquet:"machine_name"`
+	MachineLocation string `json:"machine_location" parquet:"machine_location"`
+	OpenDoorTime    int64  `json:"open_door_time" parquet:"open_door_time,timestamp(millisecond)"`
+	CloseDoorTime   int64  `json:"close_door_time" parquet:"close_door_time,timestamp(millisecond)"`
+	HandleStatus    int32  `json:"handle_status" parquet:"handle_status"`
+	Line            int32  `json:"line" parquet:"line"` // 1-based position within the order
+	ItemCode        string `json:"item_code" parquet:"item_code"`
+	ItemName        string `json:"item_name" parquet:"item_name"`
+	Barcode         string `json:"barcode" parquet:"barcode"`
+	Quantity        int64  `json:"quantity" parquet:"quantity"`
+	UnitPrice       int64  `json:"unit_price" parquet:"unit_price"`
+	LineAmount      int64  `json:"line_amount" parquet:"line_amount"`
+	Currency        string `json:"currency" parquet:"currency"`
+}
+
+// Order is an order from any source, reduced to what the export needs
+type Order struct {
+	Source         string
+	OrderCode      string
+	TradeRequestId string
+	VmCode         string
+	HandleStatus   aifinitsdk.HandleStatus
+	OpenDoorTime   aifinitsdk.Millis
+	CloseDoorTime  aifinitsdk.Millis
+	Goods          []aifinitsdk.OrderGoods
+}
+
+// Sources an order can come from
+const (
+	SourceListOrders = "list_orders"
+	SourceCallback   = "callback"
+)
+
+// FromCallback converts an order settlement callback
+func FromCallback(order *aifinitsdk.OrderCallbackRequest) Order {
+	return Order{
+		Source:         SourceCallback,
+		OrderCode:      order.OrderCode,
+		TradeRequestId: order.TradeRequestId,
+		VmCode:         order.VmCode,
+		HandleStatus:   order.HandleStatus,
+		OpenDoorTime:   order.OpenDoorTime,
+		CloseDoorTime:  order.CloseDoorTime,
+		Goods:          order.OrderGoodsList,
+	}
+}
+
+// FromListed converts an order returned by ListOrders. Listed goods carry no names.
+func FromListed(order aifinitsdk.Order) Order {
+	goods := make([]aifinitsdk.OrderGoods, 0, len(order.OrderGoodsList))
+	for _, item := range order.OrderGoodsList {
+		goods = append(goods, aifinitsdk.OrderGoods{ItemCode: item.ItemCode, ItemPrice: item.ActualPrice, Count: item.Count})
+	}
+	return Order{
+		Source:         SourceListOrders,
+		OrderCode:      order.OrderCode,
+		TradeRequestId: order.TradeRequestId,
+		VmCode:         order.VmCode,
+		HandleStatus:   aifinitsdk.HandleStatus(order.HandleStatus),
+		OpenDoorTime:   order.OpenDoorTime,
+		CloseDoorTime:  order.CloseDoorTime,
+		Goods:          goods,
+	}
+}
+
+// ProductSource looks up product metadata; *aifinitsdk.Catalog implements it
+type ProductSource interface {
+	Product(itemCode string) (aifinitsdk.Product, bool)
+}
+
+// MachineSource looks up machine metadata; *MachineDirectory implements it
+type MachineSource interface {
+	Machine(vmCode string) (aifinitsdk.DeviceInfoData, bool)
+}
+
+// Result reports what an export wrote
+type Result struct {
+	Orders     int         `json:"orders"`
+	Rows       int         `json:"rows"`
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+}
+
+// Exporter streams orders from its sources into a writer
+type Exporter struct {
+	// Sources are read in order; an order found in several is exported from the first
+	Sources     []Source
+	Products    ProductSource // optional
+	Machines    MachineSource // optional
+	Checkpoints CheckpointStore
+	// Overlap is how far behind the checkpoint each run reads again, so that orders reported late,
+	// such as callbacks retried by the platform, are still exported. Orders already exported within
+	// it are skipped. Defaults to one day.
+	Overlap time.Duration
+
+	now func() time.Time
+}
+
+// NewExporter creates an exporter. A nil checkpoint store keeps the checkpoint in memory only.
+func NewExporter(checkpoints CheckpointStore, sources ...Source) *Exporter {
+	if checkpoints == nil {
+		checkpoints = &MemoryCheckpointStore{}
+	}
+	return &Exporter{Sources: sources, Checkpoints: checkpoints, Overlap: 24 * time.Hour, now: time.Now}
+}
+
+// Export writes the lines of the orders closed within the range and not yet exported, then
+// closes the writer and advances the checkpoint. An open end defaults to now. On error the
+// checkpoint is left unchanged so the next run covers the same orders again.
+func (e *Exporter) Export(ctx context.Context, w Writer, r aifinitsdk.TimeRange) (*Result, error) {
+	result, err := e.Write(ctx, w, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Commit(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Write is Export without advancing the checkpoint. Call Commit with its result once the output is
+// safely stored, such as after moving a file into place.
+func (e *Exporter) Write(ctx context.Context, w Writer, r aifinitsdk.TimeRange) (*Result, error) {
+	result, err := e.export(ctx, w, r)
+	if closeErr := w.Close(); err == nil && closeErr != nil {
+		err = aifinitsdk.NewAinfinitError(fmt.Errorf("close export: %w", closeErr))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Commit saves the checkpoint of a written export
+func (e *Exporter) Commit(result *Result) error {
+	if result.Checkpoint == nil {
+		return nil
+	}
+	if err := e.Checkpoints.Save(result.Checkpoint); err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("save export checkpoint: %w", err))
+	}
+	return nil
+}
+
+func (e *Exporter) export(ctx context.Context, w Writer, r aifinitsdk.TimeRange) (*Result, error) {
+	checkpoint, err := e.Checkpoints.Load()
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("load export checkpoint: %w", err))
+	}
+	if r.To.IsZero() {
+		r.To = e.now()
+	}
+	exported := make(map[string]bool)
+	if checkpoint != nil {
+		if from := checkpoint.Until.Add(-e.Overlap); from.After(r.From) {
+			r.From = from
+		}
+		for code := range checkpoint.Exported {
+			exported[code] = true
+		}
+	}
+	if err := r.Validate(); err != nil {
+		return nil, aifinitsdk.NewAinfinitError(err)
+	}
+
+	result := &Result{}
+	next := &Checkpoint{Exported: make(map[string]time.Time)}
+	if checkpoint != nil {
+		next.Until = checkpoint.Until
+		maps.Copy(next.Exported, checkpoint.Exported)
+	}
+	for _, source := range e.Sources {
+		for order, err := range source.Orders(ctx, r) {
+			if err != nil {
+				return nil, err
+			}
+			closed := order.CloseDoorTime.Time
+			if order.OrderCode == "" || exported[order.OrderCode] || !r.Contains(closed) {
+				continue
+			}
+			exported[order.OrderCode] = true
+
+			rows := e.rows(order)
+			if len(rows) == 0 {
+				continue
+			}
+			for _, row := range rows {
+				if err := w.Write(row); err != nil {
+					return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("write order %s: %w", order.OrderCode, err))
+				}
+			}
+			result.Orders++
+			result.Rows += len(rows)
+
+			closed = closed.Truncate(time.Millisecond)
+			next.Exported[order.OrderCode] = closed
+			if closed.After(next.Until) {
+				next.Until = closed
+			}
+		}
+	}
+
+	// Orders that fell out of the window are not read again
+	maps.DeleteFunc(next.Exported, func(code string, closed time.Time) bool {
+		return closed.Before(next.Until.Add(-e.Overlap))
+	})
+	logrus.WithFields(logrus.Fields{"orders": result.Orders, "rows": result.Rows}).Debug("Exported orders")
+	if result.Orders > 0 {
+		result.Checkpoint = next
+	}
+	return result, nil
+}
+
+// rows flattens an order into its lines
+func (e *Exporter) rows(order Order) []Row {
+	template := Row{
+		OrderCode:      order.OrderCode,
+		TradeRequestId: order.TradeRequestId,
+		Source:         order.Source,
+		VmCode:         order.VmCode,
+		OpenDoorTime:   order.OpenDoorTime.Milliseconds(),
+		CloseDoorTime:  order.CloseDoorTime.Milliseconds(),
+		HandleStatus:   int32(order.HandleStatus),
+	}
+	if e.Machines != nil {
+		if machine, ok := e.Machines.Machine(order.VmCode); ok {
+			template.MachineName = machine.Name
+			template.MachineLocation = machine.Location
+		}
+	}
+
+	rows := make([]Row, 0, len(order.Goods))
+	for i, item := range order.Goods {
+		row := template
+		row.Line = int32(i + 1)
+		row.ItemCode = item.ItemCode
+		row.ItemName = item.ItemName
+		row.Quantity = int64(item.Count)
+		row.UnitPrice = item.ItemPrice.Minor
+		row.LineAmount = item.ItemPrice.Minor * int64(item.Count)
+		row.Currency = item.ItemPrice.CurrencyCode()
+		if e.Products != nil {
+			if product, ok := e.Products.Product(item.ItemCode); ok {
+				if row.ItemName == "" {
+					row.ItemName = product.Name
+				}
+				// Only the first of several comma separated barcodes is exported
+				barcode, _, _ := strings.Cut(product.QrCodes, ",")
+				row.Barcode = strings.TrimSpace(barcode)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
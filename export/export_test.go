@@ -0,0 +1,175 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+var _ ProductSource = (*aifinitsdk.Catalog)(nil)
+
+func mnt(amount float64) aifinitsdk.Money {
+	return aifinitsdk.MoneyFromFloat(amount, aifinitsdk.DefaultCurrency)
+}
+
+func at(hour int) aifinitsdk.Millis {
+	return aifinitsdk.MillisOf(time.Date(2024, 5, 1, hour, 0, 0, 0, aifinitsdk.PlatformLocation))
+}
+
+type fakeOrderClient struct {
+	aifinitsdk.OperationClient
+	orders map[string][]aifinitsdk.Order
+}
+
+func (f *fakeOrderClient) ListOrders(request *aifinitsdk.ListOrderRequest, machineCode string) (*aifinitsdk.ListOrderResponse, error) {
+	response := &aifinitsdk.ListOrderResponse{Status: 200}
+	response.Data.Rows = f.orders[machineCode]
+	response.Data.Total = len(response.Data.Rows)
+	return response, nil
+}
+
+type fakeProducts map[string]aifinitsdk.Product
+
+func (p fakeProducts) Product(itemCode string) (aifinitsdk.Product, bool) {
+	product, ok := p[itemCode]
+	return product, ok
+}
+
+type fakeMachines map[string]aifinitsdk.DeviceInfoData
+
+func (m fakeMachines) Machine(vmCode string) (aifinitsdk.DeviceInfoData, bool) {
+	machine, ok := m[vmCode]
+	return machine, ok
+}
+
+func listed(code string, closed aifinitsdk.Millis, goods ...aifinitsdk.Goods) aifinitsdk.Order {
+	return aifinitsdk.Order{OrderCode: code, HandleStatus: int(aifinitsdk.HandleStatusCloudSuccess), OpenDoorTime: closed, CloseDoorTime: closed, OrderGoodsList: goods}
+}
+
+func decodeJSONL(t *testing.T, data []byte) []Row {
+	var rows []Row
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var row Row
+		require.NoError(t, decoder.Decode(&row))
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestExporter_Export(t *testing.T) {
+	log := NewCallbackLog(filepath.Join(t.TempDir(), "callbacks.jsonl"))
+	require.NoError(t, log.HandleOrder(&aifinitsdk.OrderCallbackRequest{
+		OrderCode: "O1", TradeRequestId: "T1", VmCode: "VM1", HandleStatus: aifinitsdk.HandleStatusCloudSuccess,
+		OpenDoorTime: at(9), CloseDoorTime: at(9),
+		OrderGoodsList: []aifinitsdk.OrderGoods{{ItemCode: "cola", ItemName: "Cola Zero", ItemPrice: mnt(2.5), Count: 2}},
+	}))
+	operations := &fakeOrderClient{orders: map[string][]aifinitsdk.Order{"VM1": {
+		listed("O1", at(9), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 2}),
+		listed("O2", at(10),
+			aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1},
+			aifinitsdk.Goods{ItemCode: "chips", ActualPrice: mnt(3), Count: 1},
+		),
+		listed("O3", at(11)),
+	}}}
+
+	exporter := NewExporter(nil, log, &ListedOrders{Operations: operations, Machines: []string{"VM1"}})
+	exporter.Products = fakeProducts{"cola": {Name: "Cola", QrCodes: "690001, 690002"}}
+	exporter.Machines = fakeMachines{"VM1": {Code: "VM1", Name: "Lobby", Location: "Floor 1"}}
+	exporter.now = func() time.Time { return at(12).Time }
+
+	var buf bytes.Buffer
+	result, err := exporter.Export(context.Background(), NewJSONLWriter(&buf), aifinitsdk.TimeRange{From: at(0).Time})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Orders)
+	assert.Equal(t, 3, result.Rows)
+	assert.Equal(t, &Checkpoint{Until: at(10).Time, Exported: map[string]time.Time{"O1": at(9).Time, "O2": at(10).Time}}, result.Checkpoint)
+
+	rows := decodeJSONL(t, buf.Bytes())
+	require.Len(t, rows, 3)
+	assert.Equal(t, Row{
+		OrderCode: "O1", TradeRequestId: "T1", Source: SourceCallback, VmCode: "VM1", MachineName: "Lobby", MachineLocation: "Floor 1",
+		OpenDoorTime: at(9).Milliseconds(), CloseDoorTime: at(9).Milliseconds(), HandleStatus: int32(aifinitsdk.HandleStatusCloudSuccess),
+		Line: 1, ItemCode: "cola", ItemName: "Cola Zero", Barcode: "690001", Quantity: 2, UnitPrice: 250, LineAmount: 500, Currency: "MNT",
+	}, rows[0])
+	assert.Equal(t, SourceListOrders, rows[1].Source)
+	assert.Equal(t, "Cola", rows[1].ItemName)
+	assert.Equal(t, int32(2), rows[2].Line)
+	assert.Empty(t, rows[2].ItemName)
+}
+
+func TestExporter_Incremental(t *testing.T) {
+	operations := &fakeOrderClient{orders: map[string][]aifinitsdk.Order{"VM1": {
+		listed("O1", at(9), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+		listed("O2", at(10), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+	}}}
+	store := &FileCheckpointStore{Path: filepath.Join(t.TempDir(), "checkpoint.json")}
+	source := &ListedOrders{Operations: operations, Machines: []string{"VM1"}}
+
+	var buf bytes.Buffer
+	result, err := NewExporter(store, source).Export(context.Background(), NewJSONLWriter(&buf), aifinitsdk.TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Orders)
+
+	// A late order closed in the same millisecond as the checkpoint is still picked up
+	operations.orders["VM1"] = append(operations.orders["VM1"],
+		listed("O3", at(10), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+		listed("O4", at(11), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+	)
+	buf.Reset()
+	result, err = NewExporter(store, source).Export(context.Background(), NewJSONLWriter(&buf), aifinitsdk.TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Orders)
+	var codes []string
+	for _, row := range decodeJSONL(t, buf.Bytes()) {
+		codes = append(codes, row.OrderCode)
+	}
+	assert.Equal(t, []string{"O3", "O4"}, codes)
+
+	buf.Reset()
+	result, err = NewExporter(store, source).Export(context.Background(), NewJSONLWriter(&buf), aifinitsdk.TimeRange{})
+	require.NoError(t, err)
+	assert.Zero(t, result.Orders)
+	assert.Empty(t, buf.String())
+
+	// A late order closed before the checkpoint is picked up within the overlap, once
+	operations.orders["VM1"] = append(operations.orders["VM1"],
+		listed("O5", at(8), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+		listed("O6", aifinitsdk.MillisOf(at(11).Add(-25*time.Hour)), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+	)
+	for _, want := range []int{1, 0} {
+		buf.Reset()
+		result, err = NewExporter(store, source).Export(context.Background(), NewJSONLWriter(&buf), aifinitsdk.TimeRange{})
+		require.NoError(t, err)
+		assert.Equal(t, want, result.Orders)
+	}
+
+	checkpoint, err := store.Load()
+	require.NoError(t, err)
+	assert.True(t, checkpoint.Until.Equal(at(11).Time))
+	assert.Len(t, checkpoint.Exported, 5)
+	assert.NotContains(t, checkpoint.Exported, "O6")
+
+	// Orders that fell out of the window are dropped from the checkpoint
+	exporter := NewExporter(store, source)
+	exporter.Overlap = time.Hour
+	operations.orders["VM1"] = append(operations.orders["VM1"],
+		listed("O7", at(12), aifinitsdk.Goods{ItemCode: "cola", ActualPrice: mnt(2.5), Count: 1}),
+	)
+	buf.Reset()
+	result, err = exporter.Export(context.Background(), NewJSONLWriter(&buf), aifinitsdk.TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Orders)
+	checkpoint, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"O4", "O7"}, slices.Sorted(maps.Keys(checkpoint.Exported)))
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Source yields the orders closed within a range. Sources may yield orders slightly outside the
+// range; the exporter filters them.
+type Source interface {
+	Orders(ctx context.Context, r aifinitsdk.TimeRange) iter.Seq2[Order, error]
+}
+
+// ListedOrders pages through the machines' orders with ListOrders
+type ListedOrders struct {
+	Operations aifinitsdk.OperationClient
+	Machines   []string
+}
+
+func (s *ListedOrders) Orders(ctx context.Context, r aifinitsdk.TimeRange) iter.Seq2[Order, error] {
+	return func(yield func(Order, error) bool) {
+		for _, machine := range s.Machines {
+			for order, err := range aifinitsdk.NewOrderIterator(s.Operations, machine, r).All(ctx) {
+				if err != nil {
+					yield(Order{}, err)
+					return
+				}
+				if !yield(FromListed(order), nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// CallbackLog stores order settlement callbacks as JSON Lines so they can be exported later.
+// Register HandleOrder with the order callback handler.
+type CallbackLog struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewCallbackLog creates a callback log appending to the file at path
+func NewCallbackLog(path string) *CallbackLog {
+	return &CallbackLog{Path: path}
+}
+
+// HandleOrder appends the callback to the log
+func (l *CallbackLog) HandleOrder(order *aifinitsdk.OrderCallbackRequest) error {
+	if order == nil {
+		return nil
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("encode callback %s: %w", order.OrderCode, err))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("open callback log: %w", err))
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("append callback %s: %w", order.OrderCode, err))
+	}
+	return file.Close()
+}
+
+// Orders streams the logged callbacks closed within the range
+func (l *CallbackLog) Orders(ctx context.Context, r aifinitsdk.TimeRange) iter.Seq2[Order, error] {
+	return func(yield func(Order, error) bool) {
+		file, err := os.Open(l.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			yield(Order{}, aifinitsdk.NewAinfinitError(fmt.Errorf("open callback log: %w", err)))
+			return
+		}
+		defer file.Close()
+
+		decoder := json.NewDecoder(file)
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(Order{}, err)
+				return
+			}
+			var callback aifinitsdk.OrderCallbackRequest
+			if err := decoder.Decode(&callback); err == io.EOF {
+				return
+			} else if err != nil {
+				yield(Order{}, aifinitsdk.NewAinfinitError(fmt.Errorf("read callback log: %w", err)))
+				return
+			}
+			if !r.Contains(callback.CloseDoorTime.Time) {
+				continue
+			}
+			if !yield(FromCallback(&callback), nil) {
+				return
+			}
+		}
+	}
+}
+
+// MachineDirectory looks machines up with DeviceInfo and remembers the answers, including
+// failures, for its lifetime
+type MachineDirectory struct {
+	Devices aifinitsdk.VendingMachineManageClient
+
+	mu       sync.Mutex
+	machines map[string]*aifinitsdk.DeviceInfoData
+}
+
+// NewMachineDirectory creates a machine directory
+func NewMachineDirectory(devices aifinitsdk.VendingMachineManageClient) *MachineDirectory {
+	return &MachineDirectory{Devices: devices, machines: make(map[string]*aifinitsdk.DeviceInfoData)}
+}
+
+func (d *MachineDirectory) Machine(vmCode string) (aifinitsdk.DeviceInfoData, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	machine, ok := d.machines[vmCode]
+	if !ok {
+		response, err := d.Devices.DeviceInfo(vmCode)
+		if err != nil {
+			logrus.WithError(err).WithField("vmCode", vmCode).Debug("Failed to look up machine for export")
+		} else {
+			machine = &response.Data
+		}
+		d.machines[vmCode] = machine
+	}
+	if machine == nil {
+		return aifinitsdk.DeviceInfoData{}, false
+	}
+	return *machine, true
+}
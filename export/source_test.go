@@ -0,0 +1,78 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+func TestCallbackLog(t *testing.T) {
+	log := NewCallbackLog(filepath.Join(t.TempDir(), "callbacks.jsonl"))
+	for _, order := range callbacksAt(map[string]int{"O1": 9, "O2": 10, "O3": 11}) {
+		require.NoError(t, log.HandleOrder(order))
+	}
+
+	var codes []string
+	for order, err := range log.Orders(context.Background(), aifinitsdk.TimeRange{From: at(10).Time}) {
+		require.NoError(t, err)
+		assert.Equal(t, SourceCallback, order.Source)
+		assert.Equal(t, mnt(1), order.Goods[0].ItemPrice)
+		codes = append(codes, order.OrderCode)
+	}
+	assert.ElementsMatch(t, []string{"O2", "O3"}, codes)
+
+	require.NoError(t, os.WriteFile(log.Path, []byte("{not json\n"), 0o644))
+	for _, err := range log.Orders(context.Background(), aifinitsdk.TimeRange{}) {
+		assert.ErrorContains(t, err, "read callback log")
+	}
+
+	missing := NewCallbackLog(filepath.Join(t.TempDir(), "missing.jsonl"))
+	for range missing.Orders(context.Background(), aifinitsdk.TimeRange{}) {
+		t.Fatal("a missing log has no orders")
+	}
+}
+
+func callbacksAt(hours map[string]int) []*aifinitsdk.OrderCallbackRequest {
+	var orders []*aifinitsdk.OrderCallbackRequest
+	for code, hour := range hours {
+		orders = append(orders, &aifinitsdk.OrderCallbackRequest{
+			OrderCode: code, VmCode: "VM1", CloseDoorTime: at(hour),
+			OrderGoodsList: []aifinitsdk.OrderGoods{{ItemCode: "water", ItemPrice: mnt(1), Count: 1}},
+		})
+	}
+	return orders
+}
+
+type fakeDeviceClient struct {
+	aifinitsdk.VendingMachineManageClient
+	calls int
+}
+
+func (f *fakeDeviceClient) DeviceInfo(machineCode string) (*aifinitsdk.DeviceInfoResponse, error) {
+	f.calls++
+	if machineCode == "GONE" {
+		return nil, errors.New("machine not found")
+	}
+	return &aifinitsdk.DeviceInfoResponse{Status: 200, Data: aifinitsdk.DeviceInfoData{Code: machineCode, Name: "Lobby"}}, nil
+}
+
+func TestMachineDirectory(t *testing.T) {
+	devices := &fakeDeviceClient{}
+	directory := NewMachineDirectory(devices)
+
+	machine, ok := directory.Machine("VM1")
+	assert.True(t, ok)
+	assert.Equal(t, "Lobby", machine.Name)
+	_, ok = directory.Machine("GONE")
+	assert.False(t, ok)
+
+	directory.Machine("VM1")
+	directory.Machine("GONE")
+	assert.Equal(t, 2, devices.calls)
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Format is an export file format
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSONL   Format = "jsonl"
+	FormatParquet Format = "parquet"
+)
+
+// Columns are the export columns in schema order, as named in every format
+var Columns = []string{
+	"order_code", "trade_request_id", "source", "vm_code", "machine_name", "machine_location",
+	"open_door_time", "close_door_time", "handle_status", "line", "item_code", "item_name", "barcode",
+	"quantity", "unit_price", "line_amount", "currency",
+}
+
+// Writer writes rows in one format. Close flushes the output but leaves the underlying writer open.
+type Writer interface {
+	Write(row Row) error
+	Close() error
+}
+
+// NewWriter creates a writer for the format
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVWriter(w)
+	case FormatJSONL:
+		return NewJSONLWriter(w), nil
+	case FormatParquet:
+		return NewParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", string(format))
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+// NewCSVWriter writes CSV with a header row, so an export without orders still carries the schema
+func NewCSVWriter(w io.Writer) (Writer, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{writer: writer}, nil
+}
+
+func (w *csvWriter) Write(row Row) error {
+	return w.writer.Write(row.record())
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (r Row) record() []string {
+	return []string{
+		r.OrderCode,
+		r.TradeRequestId,
+		r.Source,
+		r.VmCode,
+		r.MachineName,
+		r.MachineLocation,
+		strconv.FormatInt(r.OpenDoorTime, 10),
+		strconv.FormatInt(r.CloseDoorTime, 10),
+		strconv.Itoa(int(r.HandleStatus)),
+		strconv.Itoa(int(r.Line)),
+		r.ItemCode,
+		r.ItemName,
+		r.Barcode,
+		strconv.FormatInt(r.Quantity, 10),
+		strconv.FormatInt(r.UnitPrice, 10),
+		strconv.FormatInt(r.LineAmount, 10),
+		r.Currency,
+	}
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+// NewJSONLWriter writes one JSON object per line
+func NewJSONLWriter(w io.Writer) Writer {
+	return &jsonlWriter{encoder: json.NewEncoder(w)}
+}
+
+func (w *jsonlWriter) Write(row Row) error {
+	return w.encoder.Encode(row)
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	writer *parquet.GenericWriter[Row]
+}
+
+// NewParquetWriter writes a Parquet file; it is only complete once closed
+func NewParquetWriter(w io.Writer) Writer {
+	return &parquetWriter{writer: parquet.NewGenericWriter[Row](w)}
+}
+
+func (w *parquetWriter) Write(row Row) error {
+	_, err := w.writer.Write([]Row{row})
+	return err
+}
+
+func (w *parquetWriter) Close() error {
+	return w.writer.Close()
+}
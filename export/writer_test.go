@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRows = []Row{
+	{OrderCode: "O1", Source: SourceCallback, VmCode: "VM1", MachineName: "Lobby, east", CloseDoorTime: 1714525200000, Line: 1, ItemCode: "cola", Quantity: 2, UnitPrice: 250, LineAmount: 500, Currency: "MNT"},
+	{OrderCode: "O1", Source: SourceCallback, VmCode: "VM1", CloseDoorTime: 1714525200000, Line: 2, ItemCode: "chips", Quantity: 1, UnitPrice: 300, LineAmount: 300, Currency: "MNT"},
+}
+
+func writeRows(t *testing.T, format Format) []byte {
+	var buf bytes.Buffer
+	writer, err := NewWriter(&buf, format)
+	require.NoError(t, err)
+	for _, row := range testRows {
+		require.NoError(t, writer.Write(row))
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestCSVWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(string(writeRows(t, FormatCSV))), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, strings.Join(Columns, ","), lines[0])
+	assert.Equal(t, `O1,,callback,VM1,"Lobby, east",,0,1714525200000,0,1,cola,,,2,250,500,MNT`, lines[1])
+}
+
+func TestJSONLWriter(t *testing.T) {
+	assert.Equal(t, testRows, decodeJSONL(t, writeRows(t, FormatJSONL)))
+}
+
+func TestParquetWriter(t *testing.T) {
+	data := writeRows(t, FormatParquet)
+	rows, err := parquet.Read[Row](bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, testRows, rows)
+
+	// Every format names the same columns in the same order
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	var names []string
+	for _, field := range file.Schema().Fields() {
+		names = append(names, field.Name())
+	}
+	assert.Equal(t, Columns, names)
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, "xlsx")
+	assert.EqualError(t, err, `unknown export format "xlsx"`)
+}
@@ -0,0 +1,173 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+
+	"resty.dev/v3"
+)
+
+// FileSource is a file uploaded by streaming it into the multipart body instead of holding it in memory
+type FileSource struct {
+	// Name is the file name sent to the platform
+	Name string
+	// Size in bytes, 0 when unknown. It is only used for progress reporting.
+	Size int64
+
+	open func() (io.ReadCloser, error)
+}
+
+// FileFromReader uploads from r. The reader is consumed once; if it is an io.Closer it is closed after upload.
+func FileFromReader(name string, r io.Reader, size int64) FileSource {
+	return FileSource{
+		Name: name,
+		Size: size,
+		open: func() (io.ReadCloser, error) {
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return io.NopCloser(r), nil
+		},
+	}
+}
+
+// FileFromFS uploads the named file of fsys. The file is opened when the upload reaches it.
+func FileFromFS(fsys fs.FS, name string) FileSource {
+	source := FileSource{
+		Name: path.Base(name),
+		open: func() (io.ReadCloser, error) { return fsys.Open(name) },
+	}
+	if info, err := fs.Stat(fsys, name); err == nil {
+		source.Size = info.Size()
+	}
+	return source
+}
+
+// FileFromBytes uploads an in-memory file
+func FileFromBytes(name string, data []byte) FileSource {
+	return FileFromReader(name, bytes.NewReader(data), int64(len(data)))
+}
+
+// Open returns a reader over the file content
+func (f FileSource) Open() (io.ReadCloser, error) {
+	if f.open == nil {
+		return nil, fmt.Errorf("file source %q has no content", f.Name)
+	}
+	return f.open()
+}
+
+// UploadProgress reports how much of one multipart file has been written to the request body
+type UploadProgress struct {
+	Field    string // multipart field name: "file", "files" or "weightFile"
+	FileName string
+	Size     int64 // 0 when unknown
+	Written  int64
+}
+
+// UploadProgressFunc receives upload progress; it is called from the goroutine writing the request body
+type UploadProgressFunc func(UploadProgress)
+
+// uploadPart is one file of a multipart upload
+type uploadPart struct {
+	field  string
+	source FileSource
+}
+
+// byteParts turns the in-memory file fields into upload parts, skipping nil entries
+func byteParts(field string, files [][]byte, names []string) []uploadPart {
+	var parts []uploadPart
+	for i, file := range files {
+		if file != nil {
+			parts = append(parts, uploadPart{field: field, source: FileFromBytes(names[i], file)})
+		}
+	}
+	return parts
+}
+
+func sourceParts(field string, sources []FileSource) []uploadPart {
+	parts := make([]uploadPart, 0, len(sources))
+	for _, source := range sources {
+		parts = append(parts, uploadPart{field: field, source: source})
+	}
+	return parts
+}
+
+// setUploadParts adds the parts to a multipart request. Sources are opened lazily while resty writes
+// the body; the returned function closes any that are still open and must be called after the request.
+func setUploadParts(req *resty.Request, parts []uploadPart, progress UploadProgressFunc) func() {
+	readers := make([]*lazyReader, 0, len(parts))
+	for _, part := range parts {
+		reader := &lazyReader{source: part.source}
+		readers = append(readers, reader)
+
+		field := &resty.MultipartField{
+			Name:     part.field,
+			FileName: part.source.Name,
+			Reader:   reader,
+			FileSize: part.source.Size,
+		}
+		if progress != nil {
+			field.ProgressCallback = func(p resty.MultipartFieldProgress) {
+				progress(UploadProgress{Field: p.Name, FileName: p.FileName, Size: p.FileSize, Written: p.Written})
+			}
+		}
+		req.SetMultipartFields(field)
+	}
+
+	return func() {
+		for _, reader := range readers {
+			reader.Close()
+		}
+	}
+}
+
+// lazyReader opens its source on first read and closes it at EOF
+type lazyReader struct {
+	mu     sync.Mutex
+	source FileSource
+	rc     io.ReadCloser
+	done   bool
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return 0, io.EOF
+	}
+	if r.rc == nil {
+		rc, err := r.source.Open()
+		if err != nil {
+			r.done = true
+			return 0, err
+		}
+		r.rc = rc
+	}
+
+	n, err := r.rc.Read(p)
+	if err != nil {
+		r.close()
+	}
+	return n, err
+}
+
+func (r *lazyReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+func (r *lazyReader) close() error {
+	r.done = true
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package aifinitsdk
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"resty.dev/v3"
+)
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestUpdateProductApplication_StreamsFileSources(t *testing.T) {
+	type part struct{ field, name, content string }
+	var parts []part
+
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "PUT", req.Method)
+		_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		reader := multipart.NewReader(req.Body, params["boundary"])
+		for {
+			p, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			content, _ := io.ReadAll(p)
+			if p.FileName() != "" {
+				parts = append(parts, part{p.FormName(), p.FileName(), string(content)})
+			}
+		}
+		return jsonResponse(`{"status":200,"message":"OK"}`), nil
+	}))
+
+	fsys := fstest.MapFS{
+		"photos/side.jpg":   {Data: []byte("side photo")},
+		"photos/weight.jpg": {Data: []byte("weight photo")},
+	}
+	stream := &closeTracker{Reader: strings.NewReader("streamed barcode photo")}
+
+	var progress []UploadProgress
+	products := NewProductClient(&MockClient{RestyClient: restyClient})
+	_, err := products.UpdateProductApplication("", &UpdateProductApplicationRequest{
+		Item: &UpdateProductApplication{
+			Id:                 3,
+			ImgFiles:           [][]byte{[]byte("front photo")},
+			ImgFileNames:       []string{"front.jpg"},
+			PhysicalImgSources: []FileSource{FileFromFS(fsys, "photos/side.jpg"), FileFromReader("barcode.jpg", stream, 0)},
+			WeightSource:       &FileSource{},
+		},
+		OnProgress: func(p UploadProgress) { progress = append(progress, p) },
+	})
+	// A source without content fails the upload
+	assert.Error(t, err)
+
+	parts, progress = nil, nil
+	weight := FileFromFS(fsys, "photos/weight.jpg")
+	assert.Equal(t, int64(12), weight.Size)
+	stream = &closeTracker{Reader: strings.NewReader("streamed barcode photo")}
+	_, err = products.UpdateProductApplication("", &UpdateProductApplicationRequest{
+		Item: &UpdateProductApplication{
+			Id:                 3,
+			ImgFiles:           [][]byte{[]byte("front photo")},
+			ImgFileNames:       []string{"front.jpg"},
+			PhysicalImgSources: []FileSource{FileFromFS(fsys, "photos/side.jpg"), FileFromReader("barcode.jpg", stream, 0)},
+			WeightSource:       &weight,
+		},
+		OnProgress: func(p UploadProgress) { progress = append(progress, p) },
+	})
+	assert.NoError(t, err)
+	assert.True(t, stream.closed)
+
+	assert.Equal(t, []part{
+		{"file", "front.jpg", "front photo"},
+		{"files", "side.jpg", "side photo"},
+		{"files", "barcode.jpg", "streamed barcode photo"},
+		{"weightFile", "weight.jpg", "weight photo"},
+	}, parts)
+
+	finished := map[string]int64{}
+	for _, p := range progress {
+		finished[p.FileName] = p.Written
+	}
+	assert.Equal(t, int64(len("side photo")), finished["side.jpg"])
+	assert.Equal(t, int64(len("weight photo")), finished["weight.jpg"])
+}
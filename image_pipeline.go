@@ -0,0 +1,391 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // accept GIF input, it is re-encoded as JPEG
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+)
+
+// ImagePipeline prepares photos before upload: it applies the EXIF orientation, drops all
+// metadata by re-encoding, limits the largest dimension and the encoded size, and renders a thumbnail.
+// PNG input stays PNG, everything else is written as JPEG.
+type ImagePipeline struct {
+	// MaxDimension is the longest allowed side in pixels; 0 keeps the original size
+	MaxDimension int
+	// JPEGQuality is the starting JPEG quality (1-100)
+	JPEGQuality int
+	// MinJPEGQuality is the lowest quality tried when shrinking towards MaxBytes
+	MinJPEGQuality int
+	// MaxBytes is the target encoded size; 0 disables the target. The pipeline lowers the
+	// JPEG quality first and then the resolution, and returns its best effort if the target
+	// still cannot be met.
+	MaxBytes int
+	// ThumbnailSize is the longest side of the thumbnail; 0 disables thumbnails
+	ThumbnailSize int
+}
+
+// DefaultImagePipeline returns settings suited to product application photos
+func DefaultImagePipeline() *ImagePipeline {
+	return &ImagePipeline{
+		MaxDimension:   1600,
+		JPEGQuality:    85,
+		MinJPEGQuality: 50,
+		MaxBytes:       2 << 20,
+		ThumbnailSize:  240,
+	}
+}
+
+// ProcessedImage is the output of ImagePipeline.Process
+type ProcessedImage struct {
+	Data          []byte
+	Format        string // "jpeg" or "png"
+	Width         int
+	Height        int
+	Thumbnail     []byte // JPEG, nil when thumbnails are disabled
+	OriginalBytes int
+}
+
+// Extension returns the file extension matching Format, including the dot
+func (p *ProcessedImage) Extension() string {
+	if p.Format == "png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// Process runs the pipeline on one encoded image
+func (p *ImagePipeline) Process(data []byte) (*ProcessedImage, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("decode image: %w", err))
+	}
+	if format == "jpeg" {
+		src = applyOrientation(src, jpegOrientation(data))
+	}
+	if format != "png" {
+		format = "jpeg"
+	}
+
+	img := toNRGBA(src)
+	if p.MaxDimension > 0 {
+		img = fitWithin(img, p.MaxDimension)
+	}
+
+	encoded, err := p.encodeWithinLimit(img, format)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProcessedImage{
+		Data:          encoded.data,
+		Format:        format,
+		Width:         encoded.width,
+		Height:        encoded.height,
+		OriginalBytes: len(data),
+	}
+
+	if p.ThumbnailSize > 0 {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fitWithin(img, p.ThumbnailSize), &jpeg.Options{Quality: p.quality()}); err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("encode thumbnail: %w", err))
+		}
+		result.Thumbnail = buf.Bytes()
+	}
+
+	return result, nil
+}
+
+// PrepareProductApplication returns a copy of the application with every image run through the pipeline.
+// File names are given the extension of the re-encoded format; the original is not modified.
+func (p *ImagePipeline) PrepareProductApplication(application *NewProductApplication) (*NewProductApplication, error) {
+	prepared := *application
+
+	var err error
+	if prepared.ImgFiles, prepared.ImgFileNames, err = p.processFiles(application.ImgFiles, application.ImgFileNames); err != nil {
+		return nil, err
+	}
+	if prepared.PhysicalImgFiles, prepared.PhysicalImgFileNames, err = p.processFiles(application.PhysicalImgFiles, application.PhysicalImgFileNames); err != nil {
+		return nil, err
+	}
+	if prepared.WeightFile, prepared.WeightFileName, err = p.processFile(application.WeightFile, application.WeightFileName); err != nil {
+		return nil, err
+	}
+	return &prepared, nil
+}
+
+// PrepareProductApplicationUpdate is PrepareProductApplication for application updates
+func (p *ImagePipeline) PrepareProductApplicationUpdate(application *UpdateProductApplication) (*UpdateProductApplication, error) {
+	prepared := *application
+
+	var err error
+	if prepared.ImgFiles, prepared.ImgFileNames, err = p.processFiles(application.ImgFiles, application.ImgFileNames); err != nil {
+		return nil, err
+	}
+	if prepared.PhysicalImgFiles, prepared.PhysicalImgFileNames, err = p.processFiles(application.PhysicalImgFiles, application.PhysicalImgFileNames); err != nil {
+		return nil, err
+	}
+	if prepared.WeightFile, prepared.WeightFileName, err = p.processFile(application.WeightFile, application.WeightFileName); err != nil {
+		return nil, err
+	}
+	return &prepared, nil
+}
+
+// AdMaterialImagePipeline returns settings suited to image ad materials shown on the machine screen.
+// Materials are referenced by URL in MaterialApply, so process the image, host ProcessedImage.Data
+// and pass its URL with FileTypeImageResource.
+func AdMaterialImagePipeline() *ImagePipeline {
+	return &ImagePipeline{
+		MaxDimension:   1920,
+		JPEGQuality:    90,
+		MinJPEGQuality: 60,
+		MaxBytes:       5 << 20,
+		ThumbnailSize:  320,
+	}
+}
+
+func (p *ImagePipeline) processFiles(files [][]byte, names []string) ([][]byte, []string, error) {
+	if files == nil {
+		return nil, names, nil
+	}
+
+	processedFiles := make([][]byte, len(files))
+	processedNames := append([]string(nil), names...)
+	for i, file := range files {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		data, newName, err := p.processFile(file, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		processedFiles[i] = data
+		if i < len(processedNames) {
+			processedNames[i] = newName
+		}
+	}
+	return processedFiles, processedNames, nil
+}
+
+func (p *ImagePipeline) processFile(data []byte, name string) ([]byte, string, error) {
+	if data == nil {
+		return nil, name, nil
+	}
+
+	processed, err := p.Process(data)
+	if err != nil {
+		return nil, "", NewAinfinitError(fmt.Errorf("%s: %w", name, err))
+	}
+	if name != "" {
+		name = strings.TrimSuffix(name, path.Ext(name)) + processed.Extension()
+	}
+	return processed.Data, name, nil
+}
+
+type encodedImage struct {
+	data          []byte
+	width, height int
+}
+
+func (p *ImagePipeline) encodeWithinLimit(img *image.NRGBA, format string) (*encodedImage, error) {
+	const maxDownscales = 6
+
+	for attempt := 0; ; attempt++ {
+		qualities := []int{p.quality()}
+		if format == "jpeg" && p.MaxBytes > 0 {
+			for q := p.quality() - 10; q >= p.MinJPEGQuality; q -= 10 {
+				qualities = append(qualities, q)
+			}
+		}
+
+		var data []byte
+		for _, quality := range qualities {
+			var buf bytes.Buffer
+			var err error
+			if format == "png" {
+				err = png.Encode(&buf, img)
+			} else {
+				err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+			}
+			if err != nil {
+				return nil, NewAinfinitError(fmt.Errorf("encode image: %w", err))
+			}
+			data = buf.Bytes()
+			if p.MaxBytes <= 0 || len(data) <= p.MaxBytes {
+				break
+			}
+		}
+
+		bounds := img.Bounds()
+		if p.MaxBytes <= 0 || len(data) <= p.MaxBytes || attempt == maxDownscales || bounds.Dx() < 64 || bounds.Dy() < 64 {
+			return &encodedImage{data: data, width: bounds.Dx(), height: bounds.Dy()}, nil
+		}
+		img = resizeNRGBA(img, bounds.Dx()*4/5, bounds.Dy()*4/5)
+	}
+}
+
+func (p *ImagePipeline) quality() int {
+	if p.JPEGQuality <= 0 || p.JPEGQuality > 100 {
+		return jpeg.DefaultQuality
+	}
+	return p.JPEGQuality
+}
+
+func toNRGBA(src image.Image) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+	return dst
+}
+
+// fitWithin scales the image down so its longest side is at most maxSide
+func fitWithin(img *image.NRGBA, maxSide int) *image.NRGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		return resizeNRGBA(img, maxSide, max(1, h*maxSide/w))
+	}
+	return resizeNRGBA(img, max(1, w*maxSide/h), maxSide)
+}
+
+// resizeNRGBA downsamples with a box filter, averaging every source pixel that falls in a target pixel
+func resizeNRGBA(src *image.NRGBA, width, height int) *image.NRGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * sh / height
+		y1 := max(y0+1, (dy+1)*sh/height)
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * sw / width
+			x1 := max(x0+1, (dx+1)*sw/width)
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					px := row[x*4 : x*4+4]
+					r += int(px[0])
+					g += int(px[1])
+					b += int(px[2])
+					a += int(px[3])
+					n++
+				}
+			}
+
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// applyOrientation turns the image upright according to an EXIF orientation value (1-8)
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < w; sx++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-sx, sy
+			case 3: // rotated 180
+				dx, dy = w-1-sx, h-1-sy
+			case 4: // mirrored vertically
+				dx, dy = sx, h-1-sy
+			case 5: // transposed
+				dx, dy = sy, sx
+			case 6: // needs 90 clockwise
+				dx, dy = h-1-sy, sx
+			case 7: // transversed
+				dx, dy = h-1-sy, w-1-sx
+			case 8: // needs 90 counter-clockwise
+				dx, dy = sy, w-1-sx
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag from a JPEG file, returning 1 when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan or end of image
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
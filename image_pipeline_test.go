@@ -0,0 +1,140 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"resty.dev/v3"
+)
+
+// withOrientation inserts an EXIF APP1 segment carrying the orientation tag right after SOI
+func withOrientation(jpegData []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)      // one IFD entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112) // orientation
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)      // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, app1...)
+	return append(out, jpegData[2:]...)
+}
+
+func halfAndHalf(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImagePipeline_Orientation(t *testing.T) {
+	data := withOrientation(halfAndHalf(t, 80, 40), 6)
+	assert.Equal(t, 6, jpegOrientation(data))
+
+	pipeline := &ImagePipeline{JPEGQuality: 95, ThumbnailSize: 10}
+	processed, err := pipeline.Process(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, processed.Width)
+	assert.Equal(t, 80, processed.Height)
+	assert.NotEmpty(t, processed.Thumbnail)
+
+	// Re-encoding drops the EXIF segment
+	assert.Equal(t, 1, jpegOrientation(processed.Data))
+
+	// The left (red) half ends up on top after a clockwise turn
+	img, _, err := image.Decode(bytes.NewReader(processed.Data))
+	assert.NoError(t, err)
+	r, _, b, _ := img.At(20, 10).RGBA()
+	assert.Greater(t, r, b)
+	r, _, b, _ = img.At(20, 70).RGBA()
+	assert.Greater(t, b, r)
+}
+
+func TestImagePipeline_ResizeAndSizeLimit(t *testing.T) {
+	data := encodeTestImage(t, "png", 900, 300)
+
+	pipeline := &ImagePipeline{MaxDimension: 300, JPEGQuality: 80, MinJPEGQuality: 40, MaxBytes: 20000}
+	processed, err := pipeline.Process(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "png", processed.Format)
+	assert.Equal(t, ".png", processed.Extension())
+	assert.LessOrEqual(t, processed.Width, 300)
+	assert.LessOrEqual(t, len(processed.Data), 20000)
+	assert.Nil(t, processed.Thumbnail)
+
+	prepared, err := pipeline.PrepareProductApplication(&NewProductApplication{
+		ImgFiles:     [][]byte{encodeTestImage(t, "gif", 400, 400)},
+		ImgFileNames: []string{"front.gif"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"front.jpg"}, prepared.ImgFileNames)
+}
+
+func TestNewProductApplication_WithImagePipeline(t *testing.T) {
+	var uploaded, item []byte
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		reader := multipart.NewReader(req.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			switch part.FormName() {
+			case "file":
+				assert.Equal(t, "front.jpg", part.FileName())
+				uploaded, _ = io.ReadAll(part)
+			case "item":
+				item, _ = io.ReadAll(part)
+			}
+		}
+		return jsonResponse(`{"status":200,"message":"OK","data":7}`), nil
+	}))
+
+	products := NewProductClient(&MockClient{RestyClient: restyClient}, WithImagePipeline(&ImagePipeline{MaxDimension: 100, JPEGQuality: 80}))
+	original := encodeTestImage(t, "jpeg", 400, 200)
+	resp, err := products.NewProductApplication(&NewProductApplicationRequest{Product: &NewProductApplication{
+		Name:         "Cola",
+		Price:        mnt(2.5),
+		ImgFiles:     [][]byte{original},
+		ImgFileNames: []string{"front.jpeg"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, resp.Data)
+	// The application endpoint takes the price in major units, as a number
+	assert.Contains(t, string(item), `"price":2.5`)
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(uploaded))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, config.Width)
+	assert.Equal(t, 50, config.Height)
+}
@@ -0,0 +1,492 @@
+package aifinitsdk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SnapshotReason tells why an inventory snapshot was taken
+type SnapshotReason string
+
+const (
+	SnapshotReasonScheduled SnapshotReason = "scheduled"
+	SnapshotReasonOrder     SnapshotReason = "order"
+	SnapshotReasonRestock   SnapshotReason = "restock"
+	SnapshotReasonMutation  SnapshotReason = "mutation"
+	SnapshotReasonManual    SnapshotReason = "manual"
+)
+
+// InventorySnapshot is the ListGoods result of one machine at one point in time
+type InventorySnapshot struct {
+	VmCode  string         `json:"vmCode"`
+	TakenAt time.Time      `json:"takenAt"`
+	Reason  SnapshotReason `json:"reason"`
+	Goods   []Goods        `json:"goods"`
+}
+
+// InventoryEventKind is the kind of activity that changes a machine's stock
+type InventoryEventKind string
+
+const (
+	InventoryEventOrder    InventoryEventKind = "order"
+	InventoryEventRestock  InventoryEventKind = "restock"
+	InventoryEventMutation InventoryEventKind = "mutation" // AddGoods, UpdateGoods, DeleteGoods or UpdateGoodsPrice
+)
+
+// InventoryEvent is an activity that explains stock changes between snapshots
+type InventoryEvent struct {
+	VmCode    string             `json:"vmCode"`
+	Kind      InventoryEventKind `json:"kind"`
+	At        time.Time          `json:"at"`
+	Reference string             `json:"reference"` // order code, restock request id or API call name
+	// Deltas are relative count changes, such as -2 for two items sold
+	Deltas map[string]int `json:"deltas,omitempty"`
+	// Counts are absolute counts set through the API
+	Counts map[string]int `json:"counts,omitempty"`
+	// Prices are actual prices set through the API
+	Prices map[string]Money `json:"prices,omitempty"`
+}
+
+// InventoryStore persists snapshots and events
+type InventoryStore interface {
+	SaveSnapshot(snapshot InventorySnapshot) error
+	// Snapshots returns the machine's snapshots taken in [from, to], oldest first
+	Snapshots(vmCode string, from, to time.Time) ([]InventorySnapshot, error)
+	SaveEvent(event InventoryEvent) error
+	// Events returns the machine's events in (from, to], oldest first
+	Events(vmCode string, from, to time.Time) ([]InventoryEvent, error)
+}
+
+// MemoryInventoryStore keeps snapshots and events in memory only
+type MemoryInventoryStore struct {
+	mu        sync.Mutex
+	snapshots map[string][]InventorySnapshot
+	events    map[string][]InventoryEvent
+}
+
+func (s *MemoryInventoryStore) SaveSnapshot(snapshot InventorySnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshots == nil {
+		s.snapshots = make(map[string][]InventorySnapshot)
+	}
+	snapshots := append(s.snapshots[snapshot.VmCode], snapshot)
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].TakenAt.Before(snapshots[j].TakenAt) })
+	s.snapshots[snapshot.VmCode] = snapshots
+	return nil
+}
+
+func (s *MemoryInventoryStore) Snapshots(vmCode string, from, to time.Time) ([]InventorySnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var snapshots []InventorySnapshot
+	for _, snapshot := range s.snapshots[vmCode] {
+		if !snapshot.TakenAt.Before(from) && !snapshot.TakenAt.After(to) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func (s *MemoryInventoryStore) SaveEvent(event InventoryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.events == nil {
+		s.events = make(map[string][]InventoryEvent)
+	}
+	events := append(s.events[event.VmCode], event)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	s.events[event.VmCode] = events
+	return nil
+}
+
+func (s *MemoryInventoryStore) Events(vmCode string, from, to time.Time) ([]InventoryEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []InventoryEvent
+	for _, event := range s.events[vmCode] {
+		if event.At.After(from) && !event.At.After(to) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// ItemChange is the change of one item between two snapshots
+type ItemChange struct {
+	ItemCode    string `json:"itemCode"`
+	Added       bool   `json:"added,omitempty"`   // not listed in the earlier snapshot
+	Removed     bool   `json:"removed,omitempty"` // not listed in the later snapshot
+	CountBefore int    `json:"countBefore"`
+	CountAfter  int    `json:"countAfter"`
+	PriceBefore Money  `json:"priceBefore"`
+	PriceAfter  Money  `json:"priceAfter"`
+	// Explained is the part of the count change accounted for by events
+	Explained int `json:"explained"`
+	// Unexplained is the rest; a negative value is shrinkage
+	Unexplained int  `json:"unexplained"`
+	Shrinkage   bool `json:"shrinkage,omitempty"`
+	// PriceUnexplained is set when the price moved without an API price change
+	PriceUnexplained bool     `json:"priceUnexplained,omitempty"`
+	Causes           []string `json:"causes,omitempty"` // references of the events touching the item
+}
+
+// CountDelta is the count change between the snapshots
+func (c ItemChange) CountDelta() int {
+	return c.CountAfter - c.CountBefore
+}
+
+// PriceChanged reports whether the actual price changed
+func (c ItemChange) PriceChanged() bool {
+	return !c.PriceBefore.Equal(c.PriceAfter)
+}
+
+// InventoryDiff is the difference between two snapshots of one machine
+type InventoryDiff struct {
+	VmCode  string           `json:"vmCode"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Changes []ItemChange     `json:"changes"` // only items that changed, ordered by item code
+	Events  []InventoryEvent `json:"events"`
+}
+
+// Shrinkage returns the changes with unexplained losses
+func (d *InventoryDiff) Shrinkage() []ItemChange {
+	var changes []ItemChange
+	for _, change := range d.Changes {
+		if change.Shrinkage {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// DiffSnapshots compares two snapshots and attributes the changes to the events between them.
+//
+// Orders and mutations explain exactly the changes they describe: order deltas are applied, and an
+// absolute count set through the API replaces the running expectation. A restock explains any
+// remaining increase. Whatever is left is unexplained; unexplained decreases are flagged as shrinkage.
+func DiffSnapshots(from, to InventorySnapshot, events []InventoryEvent) *InventoryDiff {
+	diff := &InventoryDiff{VmCode: to.VmCode, From: from.TakenAt, To: to.TakenAt}
+
+	before := goodsByCode(from.Goods)
+	after := goodsByCode(to.Goods)
+
+	var relevant []InventoryEvent
+	for _, event := range events {
+		if event.At.After(from.TakenAt) && !event.At.After(to.TakenAt) {
+			relevant = append(relevant, event)
+		}
+	}
+	sort.SliceStable(relevant, func(i, j int) bool { return relevant[i].At.Before(relevant[j].At) })
+	diff.Events = relevant
+
+	codes := make(map[string]bool)
+	for code := range before {
+		codes[code] = true
+	}
+	for code := range after {
+		codes[code] = true
+	}
+
+	for code := range codes {
+		b, inBefore := before[code]
+		a, inAfter := after[code]
+		change := ItemChange{
+			ItemCode:    code,
+			Added:       !inBefore,
+			Removed:     !inAfter,
+			CountBefore: b.Count,
+			CountAfter:  a.Count,
+			PriceBefore: b.ActualPrice,
+			PriceAfter:  a.ActualPrice,
+		}
+
+		expected := b.Count
+		restocked := false
+		priceSet := false
+		for _, event := range relevant {
+			touched := false
+			if count, ok := event.Counts[code]; ok {
+				expected = count
+				touched = true
+			}
+			if delta, ok := event.Deltas[code]; ok {
+				expected += delta
+				touched = true
+			}
+			if price, ok := event.Prices[code]; ok {
+				priceSet = priceSet || price.Equal(a.ActualPrice)
+				touched = true
+			}
+			if event.Kind == InventoryEventRestock {
+				restocked = true
+				touched = touched || a.Count > expected
+			}
+			if touched {
+				change.Causes = append(change.Causes, event.Reference)
+			}
+		}
+
+		change.Explained = expected - b.Count
+		change.Unexplained = a.Count - expected
+		if restocked && change.Unexplained > 0 {
+			change.Explained += change.Unexplained
+			change.Unexplained = 0
+		}
+		change.Shrinkage = change.Unexplained < 0
+		change.PriceUnexplained = inBefore && inAfter && change.PriceChanged() && !priceSet
+
+		if change.Added || change.Removed || change.CountDelta() != 0 || change.PriceChanged() || change.Unexplained != 0 {
+			diff.Changes = append(diff.Changes, change)
+		}
+	}
+
+	sort.Slice(diff.Changes, func(i, j int) bool { return diff.Changes[i].ItemCode < diff.Changes[j].ItemCode })
+	return diff
+}
+
+func goodsByCode(goods []Goods) map[string]Goods {
+	byCode := make(map[string]Goods, len(goods))
+	for _, item := range goods {
+		byCode[item.ItemCode] = item
+	}
+	return byCode
+}
+
+// InventoryRecorder records ListGoods snapshots on a schedule and on every order, restock and API
+// mutation it is told about, and computes attributed diffs between them
+type InventoryRecorder struct {
+	Operations OperationClient
+	Store      InventoryStore
+	// Machines are snapshotted by Run
+	Machines []string
+	// Interval between scheduled snapshots; defaults to one hour
+	Interval time.Duration
+
+	now func() time.Time
+}
+
+// NewInventoryRecorder creates a recorder. A nil store keeps the history in memory only.
+func NewInventoryRecorder(operations OperationClient, store InventoryStore) *InventoryRecorder {
+	if store == nil {
+		store = &MemoryInventoryStore{}
+	}
+
+	return &InventoryRecorder{
+		Operations: operations,
+		Store:      store,
+		Interval:   time.Hour,
+		now:        time.Now,
+	}
+}
+
+// Snapshot records the machine's current goods
+func (r *InventoryRecorder) Snapshot(vmCode string, reason SnapshotReason) (*InventorySnapshot, error) {
+	goods, err := r.Operations.ListGoods(vmCode)
+	if err != nil {
+		return nil, err
+	}
+	if goods == nil {
+		return nil, NewAinfinitError(fmt.Errorf("empty goods list for machine %s", vmCode))
+	}
+	if !isSuccessStatus(int(goods.Status)) {
+		return nil, NewAinfinitError(fmt.Errorf("status: %d, message: %s", goods.Status, goods.Message))
+	}
+
+	snapshot := InventorySnapshot{VmCode: vmCode, TakenAt: r.now(), Reason: reason, Goods: goods.Result}
+	if err := r.Store.SaveSnapshot(snapshot); err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("save inventory snapshot: %w", err))
+	}
+	return &snapshot, nil
+}
+
+// HandleOrder records the goods taken in an order and snapshots the machine
+func (r *InventoryRecorder) HandleOrder(order *OrderCallbackRequest) error {
+	if order == nil || order.VmCode == "" {
+		return NewAinfinitError(fmt.Errorf("order without machine code"))
+	}
+
+	deltas := make(map[string]int, len(order.OrderGoodsList))
+	for _, item := range order.OrderGoodsList {
+		deltas[item.ItemCode] -= item.Count
+	}
+	at := r.now()
+	if !order.CloseDoorTime.IsZero() {
+		at = order.CloseDoorTime.Time
+	}
+
+	event := InventoryEvent{VmCode: order.VmCode, Kind: InventoryEventOrder, At: at, Reference: order.OrderCode, Deltas: deltas}
+	if err := r.record(event); err != nil {
+		return err
+	}
+	_, err := r.Snapshot(order.VmCode, SnapshotReasonOrder)
+	return err
+}
+
+// HandleDoorNotification records a restock when the restocking door closes and snapshots the machine.
+// Other door notifications are ignored.
+func (r *InventoryRecorder) HandleDoorNotification(action DoorOpenCloseAction, request *DoorOpenCloseNotificationCallbackRequest) error {
+	if action != DoorOpenCloseActionReplenishClose || request == nil {
+		return nil
+	}
+
+	event := InventoryEvent{VmCode: request.VmCode, Kind: InventoryEventRestock, At: r.now(), Reference: request.RequestID}
+	if err := r.record(event); err != nil {
+		return err
+	}
+	_, err := r.Snapshot(request.VmCode, SnapshotReasonRestock)
+	return err
+}
+
+// RecordMutation records a successful AddGoods, UpdateGoods, DeleteGoods or UpdateGoodsPrice call
+// and snapshots the affected machines. request is the request passed to that call.
+func (r *InventoryRecorder) RecordMutation(vmCode string, request interface{}) error {
+	event := InventoryEvent{VmCode: vmCode, Kind: InventoryEventMutation, At: r.now()}
+	machines := []string{vmCode}
+
+	switch req := request.(type) {
+	case *AddNewGoodsRequest:
+		event.Reference = "AddGoods"
+		event.Counts, event.Prices = goodsCountsAndPrices(req.Items)
+	case *UpdateGoodsRequest:
+		event.Reference = "UpdateGoods"
+		event.Counts, event.Prices = goodsCountsAndPrices(*req)
+		// The call replaces the machine's whole goods list, so the goods it leaves out are gone
+		tracked, err := r.trackedGoods(vmCode, event.At)
+		if err != nil {
+			return err
+		}
+		for code := range tracked {
+			if _, ok := event.Counts[code]; !ok {
+				event.Counts[code] = 0
+			}
+		}
+	case *DeleteGoodsRequest:
+		event.Reference = "DeleteGoods"
+		event.Counts = make(map[string]int, len(req.ItemCodes))
+		for _, code := range req.ItemCodes {
+			event.Counts[code] = 0
+		}
+	case *UpdateGoodsPriceRequest:
+		event.Reference = "UpdateGoodsPrice"
+		_, event.Prices = goodsCountsAndPrices(req.Items)
+		if len(req.VmCodes) > 0 {
+			machines = req.VmCodes
+		}
+	default:
+		return NewAinfinitError(fmt.Errorf("unsupported goods mutation %T", request))
+	}
+
+	for _, machine := range machines {
+		event.VmCode = machine
+		if err := r.record(event); err != nil {
+			return err
+		}
+		if _, err := r.Snapshot(machine, SnapshotReasonMutation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Diff compares the latest snapshots taken at or before from and to
+func (r *InventoryRecorder) Diff(vmCode string, from, to time.Time) (*InventoryDiff, error) {
+	snapshots, err := r.Store.Snapshots(vmCode, time.Time{}, to)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("load inventory snapshots: %w", err))
+	}
+
+	var first, last *InventorySnapshot
+	for i := range snapshots {
+		if !snapshots[i].TakenAt.After(from) {
+			first = &snapshots[i]
+		}
+		last = &snapshots[i]
+	}
+	if first == nil || last == nil {
+		return nil, NewAinfinitError(fmt.Errorf("no inventory snapshot of machine %s at %s", vmCode, from.Format(time.RFC3339)))
+	}
+
+	events, err := r.Store.Events(vmCode, first.TakenAt, last.TakenAt)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("load inventory events: %w", err))
+	}
+	return DiffSnapshots(*first, *last, events), nil
+}
+
+// Run takes a snapshot of every machine on each interval until the context is cancelled
+func (r *InventoryRecorder) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, vmCode := range r.Machines {
+			if _, err := r.Snapshot(vmCode, SnapshotReasonScheduled); err != nil {
+				logrus.WithError(err).WithField("vm_code", vmCode).Warn("Inventory snapshot failed")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackedGoods returns the item codes the machine is known to have at: those in its latest
+// snapshot and those orders or mutations have touched since
+func (r *InventoryRecorder) trackedGoods(vmCode string, at time.Time) (map[string]bool, error) {
+	snapshots, err := r.Store.Snapshots(vmCode, time.Time{}, at)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("load inventory snapshots: %w", err))
+	}
+	tracked := make(map[string]bool)
+	var since time.Time
+	if len(snapshots) > 0 {
+		latest := snapshots[len(snapshots)-1]
+		since = latest.TakenAt
+		for _, item := range latest.Goods {
+			tracked[item.ItemCode] = true
+		}
+	}
+
+	events, err := r.Store.Events(vmCode, since, at)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("load inventory events: %w", err))
+	}
+	for _, event := range events {
+		for code := range event.Counts {
+			tracked[code] = true
+		}
+		for code := range event.Deltas {
+			tracked[code] = true
+		}
+	}
+	return tracked, nil
+}
+
+func (r *InventoryRecorder) record(event InventoryEvent) error {
+	if err := r.Store.SaveEvent(event); err != nil {
+		return NewAinfinitError(fmt.Errorf("save inventory event: %w", err))
+	}
+	return nil
+}
+
+func goodsCountsAndPrices(goods []Goods) (map[string]int, map[string]Money) {
+	counts := make(map[string]int, len(goods))
+	prices := make(map[string]Money, len(goods))
+	for _, item := range goods {
+		counts[item.ItemCode] = item.Count
+		if !item.ActualPrice.IsZero() {
+			prices[item.ItemCode] = item.ActualPrice
+		}
+	}
+	return counts, prices
+}
@@ -0,0 +1,126 @@
+package aifinitsdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventoryRecorder_DiffAttribution(t *testing.T) {
+	operations := &fakeGoodsClient{goods: []Goods{
+		{ItemCode: "COLA", Count: 10, ActualPrice: mnt(2.5)},
+		{ItemCode: "CHIPS", Count: 5, ActualPrice: mnt(3)},
+		{ItemCode: "WATER", Count: 8, ActualPrice: mnt(1)},
+	}}
+	recorder := NewInventoryRecorder(operations, nil)
+
+	clock := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return clock }
+	start := clock
+
+	_, err := recorder.Snapshot("VM1", SnapshotReasonScheduled)
+	assert.NoError(t, err)
+
+	// An order takes 2 colas
+	clock = clock.Add(time.Hour)
+	operations.goods = []Goods{
+		{ItemCode: "COLA", Count: 8, ActualPrice: mnt(2.5)},
+		{ItemCode: "CHIPS", Count: 5, ActualPrice: mnt(3)},
+		{ItemCode: "WATER", Count: 8, ActualPrice: mnt(1)},
+	}
+	assert.NoError(t, recorder.HandleOrder(&OrderCallbackRequest{
+		VmCode: "VM1", OrderCode: "O-1", CloseDoorTime: MillisOf(clock.Add(-time.Minute)),
+		OrderGoodsList: []OrderGoods{{ItemCode: "COLA", Count: 2}},
+	}))
+
+	// Water is repriced and juice added through the API
+	clock = clock.Add(time.Hour)
+	operations.goods = []Goods{
+		{ItemCode: "COLA", Count: 8, ActualPrice: mnt(2.5)},
+		{ItemCode: "CHIPS", Count: 5, ActualPrice: mnt(3)},
+		{ItemCode: "WATER", Count: 8, ActualPrice: mnt(1.2)},
+		{ItemCode: "JUICE", Count: 6, ActualPrice: mnt(4)},
+	}
+	assert.NoError(t, recorder.RecordMutation("VM1", &UpdateGoodsPriceRequest{Items: []Goods{{ItemCode: "WATER", ActualPrice: mnt(1.2)}}}))
+	assert.NoError(t, recorder.RecordMutation("VM1", &AddNewGoodsRequest{Items: []Goods{{ItemCode: "JUICE", Count: 6, ActualPrice: mnt(4)}}}))
+
+	// A restock fills colas up; two chips disappear and cola price moves with no explanation
+	clock = clock.Add(time.Hour)
+	operations.goods = []Goods{
+		{ItemCode: "COLA", Count: 12, ActualPrice: mnt(2.8)},
+		{ItemCode: "CHIPS", Count: 3, ActualPrice: mnt(3)},
+		{ItemCode: "WATER", Count: 8, ActualPrice: mnt(1.2)},
+		{ItemCode: "JUICE", Count: 6, ActualPrice: mnt(4)},
+	}
+	assert.NoError(t, recorder.HandleDoorNotification(DoorOpenCloseActionReplenishClose, &DoorOpenCloseNotificationCallbackRequest{VmCode: "VM1", RequestID: "R-1"}))
+	assert.NoError(t, recorder.HandleDoorNotification(DoorOpenCloseActionTradeOpen, &DoorOpenCloseNotificationCallbackRequest{VmCode: "VM1"}))
+
+	diff, err := recorder.Diff("VM1", start, clock)
+	assert.NoError(t, err)
+	assert.Len(t, diff.Events, 4)
+
+	changes := map[string]ItemChange{}
+	for _, change := range diff.Changes {
+		changes[change.ItemCode] = change
+	}
+	assert.Len(t, changes, 4)
+
+	cola := changes["COLA"]
+	assert.Equal(t, 2, cola.CountDelta())
+	assert.Equal(t, 2, cola.Explained)
+	assert.Equal(t, 0, cola.Unexplained)
+	assert.Equal(t, []string{"O-1", "R-1"}, cola.Causes)
+	assert.True(t, cola.PriceUnexplained)
+
+	chips := changes["CHIPS"]
+	assert.Equal(t, -2, chips.Unexplained)
+	assert.True(t, chips.Shrinkage)
+
+	water := changes["WATER"]
+	assert.True(t, water.PriceChanged())
+	assert.False(t, water.PriceUnexplained)
+	assert.Equal(t, []string{"UpdateGoodsPrice"}, water.Causes)
+
+	juice := changes["JUICE"]
+	assert.True(t, juice.Added)
+	assert.Equal(t, 6, juice.Explained)
+	assert.False(t, juice.Shrinkage)
+
+	if assert.Len(t, diff.Shrinkage(), 1) {
+		assert.Equal(t, "CHIPS", diff.Shrinkage()[0].ItemCode)
+	}
+
+	// A diff over the first hour only sees the order
+	diff, err = recorder.Diff("VM1", start, start.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, diff.Changes, 1)
+	assert.Empty(t, diff.Shrinkage())
+}
+
+func TestInventoryRecorder_UpdateGoodsDropsItems(t *testing.T) {
+	operations := &fakeGoodsClient{goods: []Goods{
+		{ItemCode: "COLA", Count: 10, ActualPrice: mnt(2.5)},
+		{ItemCode: "CHIPS", Count: 5, ActualPrice: mnt(3)},
+	}}
+	recorder := NewInventoryRecorder(operations, nil)
+	clock := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return clock }
+	start := clock
+	_, err := recorder.Snapshot("VM1", SnapshotReasonScheduled)
+	assert.NoError(t, err)
+
+	// The new list has no chips: they are taken off the machine, not lost
+	clock = clock.Add(time.Hour)
+	operations.goods = []Goods{{ItemCode: "COLA", Count: 12, ActualPrice: mnt(2.5)}}
+	update := UpdateGoodsRequest{{ItemCode: "COLA", Count: 12, ActualPrice: mnt(2.5)}}
+	assert.NoError(t, recorder.RecordMutation("VM1", &update))
+
+	diff, err := recorder.Diff("VM1", start, clock)
+	assert.NoError(t, err)
+	assert.Empty(t, diff.Shrinkage())
+	for _, change := range diff.Changes {
+		assert.Zero(t, change.Unexplained, change.ItemCode)
+	}
+	assert.Equal(t, map[string]int{"COLA": 12, "CHIPS": 0}, diff.Events[0].Counts)
+}
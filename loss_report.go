@@ -0,0 +1,384 @@
+package aifinitsdk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LossSignalKind is the source of a loss signal
+type LossSignalKind string
+
+const (
+	LossSignalAlarm         LossSignalKind = "alarm"          // operational exception that can hide a loss
+	LossSignalAbnormalOrder LossSignalKind = "abnormal_order" // order with abnormal reasons or failed recognition
+	LossSignalShrinkage     LossSignalKind = "shrinkage"      // unexplained inventory decrease
+)
+
+// lossAlarmTypes are the operational exceptions treated as loss signals
+var lossAlarmTypes = map[OperationalExceptionType]bool{
+	OperationalExceptionTypeWeightAnomaly:     true,
+	OperationalExceptionTypeForeignIntrusion:  true,
+	OperationalExceptionTypeInventoryMismatch: true,
+	OperationalExceptionTypeUnauthorizedDoor:  true,
+}
+
+// LossSignal is one piece of evidence of a possible loss
+type LossSignal struct {
+	VmCode    string         `json:"vmCode"`
+	Kind      LossSignalKind `json:"kind"`
+	At        time.Time      `json:"at"`
+	Reference string         `json:"reference"` // exception id, order code or item code
+	RequestID string         `json:"requestId,omitempty"`
+
+	ExType          OperationalExceptionType `json:"exType,omitempty"`
+	AbnormalReasons []AbnormalReason         `json:"abnormalReasons,omitempty"`
+	HandleStatus    HandleStatus             `json:"handleStatus,omitempty"`
+
+	ItemCode       string `json:"itemCode,omitempty"`
+	Quantity       int    `json:"quantity,omitempty"`
+	EstimatedValue Money  `json:"estimatedValue"`
+
+	// Units are the quantities per item code valued for a failed-recognition order
+	Units map[string]int `json:"units,omitempty"`
+
+	VideoURLs []string `json:"videoUrls,omitempty"`
+	// Related are references of alarms on the same machine within the same period as a shrinkage
+	// signal, and of abnormal orders whose units were deducted from it
+	Related []string `json:"related,omitempty"`
+}
+
+// MachineLoss ranks one machine in a loss report
+type MachineLoss struct {
+	VmCode         string       `json:"vmCode"`
+	EstimatedLoss  Money        `json:"estimatedLoss"`
+	ShrinkageUnits int          `json:"shrinkageUnits"`
+	Alarms         int          `json:"alarms"`
+	AbnormalOrders int          `json:"abnormalOrders"`
+	Signals        []LossSignal `json:"signals"`
+}
+
+// ItemLoss ranks one item in a loss report
+type ItemLoss struct {
+	ItemCode      string   `json:"itemCode"`
+	Units         int      `json:"units"`
+	EstimatedLoss Money    `json:"estimatedLoss"`
+	Machines      []string `json:"machines"`
+}
+
+// LossReport correlates loss signals per machine over a period.
+// Machines and items are ranked by estimated loss, highest first.
+type LossReport struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	TotalLoss Money         `json:"totalLoss"`
+	Machines  []MachineLoss `json:"machines"`
+	Items     []ItemLoss    `json:"items"`
+}
+
+// LossAnalyzer collects loss signals from alarm and order callbacks and combines them with
+// inventory shrinkage into loss reports
+type LossAnalyzer struct {
+	// Operations, when set, is used to fetch videos of abnormal orders that arrived without one
+	Operations OperationClient
+	// Inventory, when set, contributes shrinkage found by inventory diffs
+	Inventory *InventoryRecorder
+
+	mu      sync.Mutex
+	signals []LossSignal
+	alarms  map[string]int // exception id to index in signals
+}
+
+// NewLossAnalyzer creates an analyzer; both arguments are optional
+func NewLossAnalyzer(operations OperationClient, inventory *InventoryRecorder) *LossAnalyzer {
+	return &LossAnalyzer{
+		Operations: operations,
+		Inventory:  inventory,
+		alarms:     make(map[string]int),
+	}
+}
+
+// HandleOperationalException records weight anomaly, foreign intrusion, inventory mismatch and
+// unauthorized door alarms. The second notification of an alarm (carrying its video) updates the first.
+func (a *LossAnalyzer) HandleOperationalException(request *OperationalExceptionNotificationCallbackRequest) {
+	if request == nil || !lossAlarmTypes[request.ExType] {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if i, ok := a.alarms[request.ExID]; ok && request.ExID != "" {
+		if request.VideoURL != "" && !containsString(a.signals[i].VideoURLs, request.VideoURL) {
+			a.signals[i].VideoURLs = append(a.signals[i].VideoURLs, request.VideoURL)
+		}
+		return
+	}
+
+	signal := LossSignal{
+		VmCode:    request.VmCode,
+		Kind:      LossSignalAlarm,
+		At:        request.SendTime.Time,
+		Reference: request.ExID,
+		RequestID: request.RequestID,
+		ExType:    request.ExType,
+	}
+	if request.VideoURL != "" {
+		signal.VideoURLs = []string{request.VideoURL}
+	}
+	a.alarms[request.ExID] = len(a.signals)
+	a.signals = append(a.signals, signal)
+}
+
+// HandleOrder records orders with abnormal reasons or failed recognition.
+// For failed recognition the candidate goods (or the order goods) are valued as a possible loss.
+func (a *LossAnalyzer) HandleOrder(order *OrderCallbackRequest) {
+	if order == nil || (len(order.AbnormalReasons) == 0 && !order.HandleStatus.IsFailure()) {
+		return
+	}
+
+	signal := LossSignal{
+		VmCode:          order.VmCode,
+		Kind:            LossSignalAbnormalOrder,
+		At:              order.CloseDoorTime.Time,
+		Reference:       order.OrderCode,
+		RequestID:       order.TradeRequestId,
+		AbnormalReasons: order.AbnormalReasons,
+		HandleStatus:    order.HandleStatus,
+		VideoURLs:       orderVideoURLs(order.VideoUrl, order.VideoUrls),
+	}
+	if order.HandleStatus.IsFailure() {
+		goods := order.Candidates
+		if len(goods) == 0 {
+			goods = order.OrderGoodsList
+		}
+		signal.Units = make(map[string]int, len(goods))
+		for _, item := range goods {
+			signal.Quantity += item.Count
+			signal.Units[item.ItemCode] += item.Count
+			value, err := item.ItemPrice.Mul(int64(item.Count))
+			if err == nil {
+				value, err = signal.EstimatedValue.Add(value)
+			}
+			if err != nil {
+				logrus.WithError(err).WithField("order_code", order.OrderCode).Warn("Could not value abnormal order")
+				continue
+			}
+			signal.EstimatedValue = value
+		}
+	}
+
+	a.mu.Lock()
+	a.signals = append(a.signals, signal)
+	a.mu.Unlock()
+}
+
+// Report builds a loss report for the machines over [from, to]. An empty machine list covers every
+// machine with recorded signals.
+func (a *LossAnalyzer) Report(machines []string, from, to time.Time) (*LossReport, error) {
+	a.mu.Lock()
+	var signals []LossSignal
+	for _, signal := range a.signals {
+		if !signal.At.Before(from) && !signal.At.After(to) {
+			signals = append(signals, signal)
+		}
+	}
+	a.mu.Unlock()
+
+	if len(machines) == 0 {
+		seen := make(map[string]bool)
+		for _, signal := range signals {
+			if !seen[signal.VmCode] {
+				seen[signal.VmCode] = true
+				machines = append(machines, signal.VmCode)
+			}
+		}
+	}
+	wanted := make(map[string]bool, len(machines))
+	for _, vmCode := range machines {
+		wanted[vmCode] = true
+	}
+
+	byMachine := make(map[string][]LossSignal)
+	for _, signal := range signals {
+		if wanted[signal.VmCode] {
+			byMachine[signal.VmCode] = append(byMachine[signal.VmCode], a.withVideo(signal))
+		}
+	}
+
+	if a.Inventory != nil {
+		for _, vmCode := range machines {
+			shrinkage, err := a.shrinkage(vmCode, from, to, byMachine[vmCode])
+			if err != nil {
+				return nil, err
+			}
+			byMachine[vmCode] = append(byMachine[vmCode], shrinkage...)
+		}
+	}
+
+	report := &LossReport{From: from, To: to}
+	items := make(map[string]*ItemLoss)
+	var err error
+	for _, vmCode := range machines {
+		machine := MachineLoss{VmCode: vmCode, Signals: byMachine[vmCode]}
+		sort.SliceStable(machine.Signals, func(i, j int) bool { return machine.Signals[i].At.Before(machine.Signals[j].At) })
+
+		for _, signal := range machine.Signals {
+			if machine.EstimatedLoss, err = machine.EstimatedLoss.Add(signal.EstimatedValue); err != nil {
+				return nil, NewAinfinitError(fmt.Errorf("loss of %s: %w", vmCode, err))
+			}
+			switch signal.Kind {
+			case LossSignalAlarm:
+				machine.Alarms++
+			case LossSignalAbnormalOrder:
+				machine.AbnormalOrders++
+			case LossSignalShrinkage:
+				machine.ShrinkageUnits += signal.Quantity
+				item, ok := items[signal.ItemCode]
+				if !ok {
+					item = &ItemLoss{ItemCode: signal.ItemCode}
+					items[signal.ItemCode] = item
+				}
+				item.Units += signal.Quantity
+				if item.EstimatedLoss, err = item.EstimatedLoss.Add(signal.EstimatedValue); err != nil {
+					return nil, NewAinfinitError(fmt.Errorf("loss of %s: %w", signal.ItemCode, err))
+				}
+				if !containsString(item.Machines, vmCode) {
+					item.Machines = append(item.Machines, vmCode)
+				}
+			}
+		}
+		if len(machine.Signals) == 0 {
+			continue
+		}
+		if report.TotalLoss, err = report.TotalLoss.Add(machine.EstimatedLoss); err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("total loss: %w", err))
+		}
+		report.Machines = append(report.Machines, machine)
+	}
+	for _, item := range items {
+		report.Items = append(report.Items, *item)
+	}
+
+	sort.SliceStable(report.Machines, func(i, j int) bool {
+		if report.Machines[i].EstimatedLoss.Minor != report.Machines[j].EstimatedLoss.Minor {
+			return report.Machines[i].EstimatedLoss.Minor > report.Machines[j].EstimatedLoss.Minor
+		}
+		return report.Machines[i].VmCode < report.Machines[j].VmCode
+	})
+	sort.Slice(report.Items, func(i, j int) bool {
+		if report.Items[i].EstimatedLoss.Minor != report.Items[j].EstimatedLoss.Minor {
+			return report.Items[i].EstimatedLoss.Minor > report.Items[j].EstimatedLoss.Minor
+		}
+		return report.Items[i].ItemCode < report.Items[j].ItemCode
+	})
+	return report, nil
+}
+
+// shrinkage turns the unexplained losses of the machine's inventory diff into signals valued at the
+// item price, linking the machine's alarms in the same period. Units already valued by abnormal
+// orders in the period are deducted, so that the same loss is not counted twice.
+func (a *LossAnalyzer) shrinkage(vmCode string, from, to time.Time, related []LossSignal) ([]LossSignal, error) {
+	diff, err := a.Inventory.Diff(vmCode, from, to)
+	if err != nil {
+		// Machines without snapshots in the period simply contribute no shrinkage
+		logrus.WithError(err).WithField("vm_code", vmCode).Debug("No inventory diff for loss report")
+		return nil, nil
+	}
+
+	var alarms, orders []LossSignal
+	for _, signal := range related {
+		switch signal.Kind {
+		case LossSignalAlarm:
+			alarms = append(alarms, signal)
+		case LossSignalAbnormalOrder:
+			if len(signal.Units) > 0 {
+				orders = append(orders, signal)
+			}
+		}
+	}
+	// covered counts the units of each abnormal order not yet deducted from a shrinkage
+	covered := make([]map[string]int, len(orders))
+	for i, order := range orders {
+		covered[i] = make(map[string]int, len(order.Units))
+		for itemCode, units := range order.Units {
+			covered[i][itemCode] = units
+		}
+	}
+
+	var signals []LossSignal
+	for _, change := range diff.Shrinkage() {
+		price := change.PriceBefore
+		if price.IsZero() {
+			price = change.PriceAfter
+		}
+		units := -change.Unexplained
+		var references []string
+		for _, alarm := range alarms {
+			references = append(references, alarm.Reference)
+		}
+		for i, order := range orders {
+			deducted := min(units, covered[i][change.ItemCode])
+			if deducted == 0 {
+				continue
+			}
+			units -= deducted
+			covered[i][change.ItemCode] -= deducted
+			references = append(references, order.Reference)
+		}
+		if units == 0 {
+			continue
+		}
+		value, err := price.Mul(int64(units))
+		if err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("shrinkage of %s on %s: %w", change.ItemCode, vmCode, err))
+		}
+		signals = append(signals, LossSignal{
+			VmCode:         vmCode,
+			Kind:           LossSignalShrinkage,
+			At:             diff.To,
+			Reference:      change.ItemCode,
+			ItemCode:       change.ItemCode,
+			Quantity:       units,
+			EstimatedValue: value,
+			Related:        references,
+		})
+	}
+	return signals, nil
+}
+
+// withVideo fetches the video of an abnormal order that arrived without one
+func (a *LossAnalyzer) withVideo(signal LossSignal) LossSignal {
+	if signal.Kind != LossSignalAbnormalOrder || len(signal.VideoURLs) > 0 || a.Operations == nil || signal.RequestID == "" {
+		return signal
+	}
+
+	video, err := a.Operations.GetOrderVideo(&GetOrderVideoRequest{RequestID: signal.RequestID, Type: OpenDoorForShopping}, signal.VmCode)
+	if err != nil || video == nil {
+		logrus.WithError(err).WithField("order_code", signal.Reference).Warn("Could not fetch order video for loss report")
+		return signal
+	}
+	signal.VideoURLs = orderVideoURLs(video.Data.VideoUrl, video.Data.VideoURLs)
+	return signal
+}
+
+func orderVideoURLs(url string, urls []string) []string {
+	var videos []string
+	if url != "" {
+		videos = append(videos, url)
+	}
+	for _, u := range urls {
+		if u != "" && !containsString(videos, u) {
+			videos = append(videos, u)
+		}
+	}
+	return videos
+}
+
+// String summarises the report in one line
+func (r *LossReport) String() string {
+	return fmt.Sprintf("loss report %s - %s: %s over %d machines", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), r.TotalLoss, len(r.Machines))
+}
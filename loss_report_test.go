@@ -0,0 +1,132 @@
+package aifinitsdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeVideoClient struct {
+	fakeGoodsClient
+	videoRequests []string
+}
+
+func (f *fakeVideoClient) GetOrderVideo(request *GetOrderVideoRequest, machineCode string) (*GetOrderVideoResponse, error) {
+	f.videoRequests = append(f.videoRequests, request.RequestID)
+	response := &GetOrderVideoResponse{Status: 200}
+	response.Data.VideoUrl = "https://video/" + request.RequestID + ".mp4"
+	return response, nil
+}
+
+func TestLossAnalyzer_Report(t *testing.T) {
+	operations := &fakeVideoClient{fakeGoodsClient: fakeGoodsClient{goods: []Goods{
+		{ItemCode: "COLA", Count: 10, ActualPrice: mnt(2.5)},
+		{ItemCode: "CHIPS", Count: 5, ActualPrice: mnt(3)},
+	}}}
+	inventory := NewInventoryRecorder(operations, nil)
+	start := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	clock := start
+	inventory.now = func() time.Time { return clock }
+	_, err := inventory.Snapshot("VM1", SnapshotReasonScheduled)
+	assert.NoError(t, err)
+
+	analyzer := NewLossAnalyzer(operations, inventory)
+
+	// Weight anomaly arrives twice, the second time with its video
+	alarm := &OperationalExceptionNotificationCallbackRequest{VmCode: "VM1", ExID: "EX-1", ExType: OperationalExceptionTypeWeightAnomaly, SendTime: MillisOf(start.Add(time.Hour))}
+	analyzer.HandleOperationalException(alarm)
+	withVideo := *alarm
+	withVideo.VideoURL = "https://video/ex-1.mp4"
+	analyzer.HandleOperationalException(&withVideo)
+	// Not a loss signal
+	analyzer.HandleOperationalException(&OperationalExceptionNotificationCallbackRequest{VmCode: "VM1", ExID: "EX-2", ExType: OperationalExceptionTypeUPSPower, SendTime: MillisOf(start.Add(time.Hour))})
+
+	// Failed recognition on another machine, without a video in the callback
+	analyzer.HandleOrder(&OrderCallbackRequest{
+		VmCode: "VM2", OrderCode: "O-9", TradeRequestId: "REQ-9", HandleStatus: HandleStatusCloudFailure,
+		CloseDoorTime: MillisOf(start.Add(2 * time.Hour)),
+		Candidates:    []OrderGoods{{ItemCode: "JUICE", ItemPrice: mnt(4), Count: 1}},
+	})
+	// Normal order is ignored
+	analyzer.HandleOrder(&OrderCallbackRequest{VmCode: "VM1", OrderCode: "O-1", HandleStatus: HandleStatusLocalSuccess, CloseDoorTime: MillisOf(start.Add(time.Hour))})
+
+	// Three chips disappear without an order
+	clock = start.Add(3 * time.Hour)
+	operations.goods = []Goods{{ItemCode: "COLA", Count: 10, ActualPrice: mnt(2.5)}, {ItemCode: "CHIPS", Count: 2, ActualPrice: mnt(3)}}
+	_, err = inventory.Snapshot("VM1", SnapshotReasonScheduled)
+	assert.NoError(t, err)
+
+	report, err := analyzer.Report(nil, start, clock)
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(13.0), report.TotalLoss)
+
+	if assert.Len(t, report.Machines, 2) {
+		vm1 := report.Machines[0]
+		assert.Equal(t, "VM1", vm1.VmCode)
+		assert.Equal(t, mnt(9.0), vm1.EstimatedLoss)
+		assert.Equal(t, 3, vm1.ShrinkageUnits)
+		assert.Equal(t, 1, vm1.Alarms)
+		if assert.Len(t, vm1.Signals, 2) {
+			assert.Equal(t, []string{"https://video/ex-1.mp4"}, vm1.Signals[0].VideoURLs)
+			assert.Equal(t, []string{"EX-1"}, vm1.Signals[1].Related)
+		}
+
+		vm2 := report.Machines[1]
+		assert.Equal(t, mnt(4.0), vm2.EstimatedLoss)
+		assert.Equal(t, 1, vm2.AbnormalOrders)
+		assert.Equal(t, []string{"https://video/REQ-9.mp4"}, vm2.Signals[0].VideoURLs)
+	}
+
+	if assert.Len(t, report.Items, 1) {
+		assert.Equal(t, ItemLoss{ItemCode: "CHIPS", Units: 3, EstimatedLoss: mnt(9), Machines: []string{"VM1"}}, report.Items[0])
+	}
+}
+
+func TestLossAnalyzer_ReportDeductsAbnormalOrders(t *testing.T) {
+	operations := &fakeVideoClient{fakeGoodsClient: fakeGoodsClient{goods: []Goods{{ItemCode: "CHIPS", Count: 5, ActualPrice: mnt(3)}}}}
+	inventory := NewInventoryRecorder(operations, nil)
+	start := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	clock := start
+	inventory.now = func() time.Time { return clock }
+	_, err := inventory.Snapshot("VM1", SnapshotReasonScheduled)
+	assert.NoError(t, err)
+
+	analyzer := NewLossAnalyzer(operations, inventory)
+	// Recognition failed for two of the three chips that leave the machine
+	analyzer.HandleOrder(&OrderCallbackRequest{
+		VmCode: "VM1", OrderCode: "O-1", HandleStatus: HandleStatusCloudFailure, VideoUrl: "https://video/o-1.mp4",
+		CloseDoorTime: MillisOf(start.Add(time.Hour)),
+		Candidates:    []OrderGoods{{ItemCode: "CHIPS", ItemPrice: mnt(3), Count: 2}},
+	})
+	clock = start.Add(2 * time.Hour)
+	operations.goods = []Goods{{ItemCode: "CHIPS", Count: 2, ActualPrice: mnt(3)}}
+	_, err = inventory.Snapshot("VM1", SnapshotReasonScheduled)
+	assert.NoError(t, err)
+
+	report, err := analyzer.Report(nil, start, clock)
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(9.0), report.TotalLoss)
+	if assert.Len(t, report.Machines, 1) {
+		vm1 := report.Machines[0]
+		assert.Equal(t, 1, vm1.AbnormalOrders)
+		assert.Equal(t, 1, vm1.ShrinkageUnits)
+		if assert.Len(t, vm1.Signals, 2) {
+			assert.Equal(t, map[string]int{"CHIPS": 2}, vm1.Signals[0].Units)
+			assert.Equal(t, mnt(3.0), vm1.Signals[1].EstimatedValue)
+			assert.Equal(t, []string{"O-1"}, vm1.Signals[1].Related)
+		}
+	}
+
+	// When the order covers the whole drop, no shrinkage is left
+	analyzer.HandleOrder(&OrderCallbackRequest{
+		VmCode: "VM1", OrderCode: "O-2", HandleStatus: HandleStatusCloudFailure, VideoUrl: "https://video/o-2.mp4",
+		CloseDoorTime: MillisOf(start.Add(90 * time.Minute)),
+		Candidates:    []OrderGoods{{ItemCode: "CHIPS", ItemPrice: mnt(3), Count: 1}},
+	})
+	report, err = analyzer.Report(nil, start, clock)
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(9.0), report.TotalLoss)
+	assert.Zero(t, report.Machines[0].ShrinkageUnits)
+	assert.Empty(t, report.Items)
+}
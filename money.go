@@ -0,0 +1,360 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is given to amounts decoded from the platform, which sends no currency
+var DefaultCurrency = "MNT"
+
+// currencyDecimals lists currencies whose minor unit is not a hundredth
+var currencyDecimals = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"KWD": 3,
+	"BHD": 3,
+}
+
+// CurrencyDecimals returns the number of minor unit digits of a currency; 2 unless listed otherwise
+func CurrencyDecimals(currency string) int {
+	if decimals, ok := currencyDecimals[strings.ToUpper(currency)]; ok {
+		return decimals
+	}
+	return 2
+}
+
+var (
+	// ErrCurrencyMismatch is returned when amounts in different currencies are combined
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrMoneyOverflow is returned when a result does not fit in int64 minor units
+	ErrMoneyOverflow = errors.New("money overflow")
+)
+
+// Money is an amount in minor units (e.g. cents) of a currency. On the wire it is a decimal number
+// in major units, as used by Goods, OrderGoods and TotalFee; see MinorMoney for endpoints sending
+// minor units. An empty currency stands for DefaultCurrency.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// NewMoney creates an amount from minor units
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// MoneyFromFloat converts a major unit amount, rounding half away from zero to the currency's
+// minor unit
+func MoneyFromFloat(amount float64, currency string) Money {
+	scale := math.Pow10(CurrencyDecimals(currencyOrDefault(currency)))
+	return Money{Minor: int64(math.Round(amount * scale)), Currency: currency}
+}
+
+// ParseMoney parses a decimal major unit amount such as "12.50" exactly. Digits beyond the
+// currency's minor unit are rounded half away from zero.
+func ParseMoney(value, currency string) (Money, error) {
+	value = strings.TrimSpace(value)
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok || strings.ContainsAny(value, "/") {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(CurrencyDecimals(currencyOrDefault(currency)))), nil))
+	rat.Mul(rat, scale)
+
+	// Round half away from zero
+	num, den := rat.Num(), rat.Denom()
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(num.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return Money{}, fmt.Errorf("amount %q: %w", value, ErrMoneyOverflow)
+	}
+	return Money{Minor: quotient.Int64(), Currency: currency}, nil
+}
+
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// CurrencyCode returns the currency, DefaultCurrency when empty
+func (m Money) CurrencyCode() string {
+	return currencyOrDefault(m.Currency)
+}
+
+// Float returns the amount in major units, for display and ratios only
+func (m Money) Float() float64 {
+	return float64(m.Minor) / math.Pow10(CurrencyDecimals(m.CurrencyCode()))
+}
+
+// IsZero reports whether the amount is zero; it also makes `omitzero` skip zero amounts
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// IsPositive reports whether the amount is above zero
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+// Equal reports whether both amounts are the same in the same currency
+func (m Money) Equal(other Money) bool {
+	return m.Minor == other.Minor && (m.Minor == 0 || m.CurrencyCode() == other.CurrencyCode())
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or +1
+func (m Money) Cmp(other Money) (int, error) {
+	if _, err := m.currency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Minor < other.Minor:
+		return -1, nil
+	case m.Minor > other.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Add returns m + other
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := m.currency(other)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.Minor + other.Minor
+	if (other.Minor > 0 && sum < m.Minor) || (other.Minor < 0 && sum > m.Minor) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Minor: sum, Currency: currency}, nil
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) (Money, error) {
+	if other.Minor == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Minor: -other.Minor, Currency: other.Currency})
+}
+
+// Mul returns m multiplied by a quantity
+func (m Money) Mul(quantity int64) (Money, error) {
+	if m.Minor == 0 || quantity == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Minor * quantity
+	if product/quantity != m.Minor || (m.Minor == -1 && quantity == math.MinInt64) || (quantity == -1 && m.Minor == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Minor: product, Currency: m.Currency}, nil
+}
+
+// MulRate returns m multiplied by a rate such as a tax rate, rounded half away from zero to the
+// minor unit
+func (m Money) MulRate(rate float64) (Money, error) {
+	result := math.Round(float64(m.Minor) * rate)
+	if result >= math.MaxInt64 || result <= math.MinInt64 || math.IsNaN(result) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Minor: int64(result), Currency: m.Currency}, nil
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// SumMoney adds amounts of one currency; the sum of nothing is zero
+func SumMoney(amounts ...Money) (Money, error) {
+	var total Money
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// currency returns the common currency of two amounts. Zero amounts without currency adopt the
+// other's, so that sums can start from Money{}.
+func (m Money) currency(other Money) (string, error) {
+	switch {
+	case m.Currency == other.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Minor == 0:
+		return other.Currency, nil
+	case other.Currency == "" && other.Minor == 0:
+		return m.Currency, nil
+	case m.CurrencyCode() == other.CurrencyCode():
+		return m.CurrencyCode(), nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.CurrencyCode(), other.CurrencyCode())
+}
+
+// Decimal returns the amount in major units without trailing zeros, e.g. "12.5"
+func (m Money) Decimal() string {
+	return decimalString(m.Minor, CurrencyDecimals(m.CurrencyCode()), true)
+}
+
+// String returns the amount with its currency, e.g. "12.50 MNT"
+func (m Money) String() string {
+	return decimalString(m.Minor, CurrencyDecimals(m.CurrencyCode()), false) + " " + m.CurrencyCode()
+}
+
+// MarshalJSON writes the amount as a major unit number
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON reads a major unit number (or numeric string) in DefaultCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(bytes.Trim(data, `"`))
+	if value == "null" || value == "" {
+		*m = Money{}
+		return nil
+	}
+	parsed, err := ParseMoney(value, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// MinorMoney is Money sent as an integer number of minor units, as Product.Price and the product
+// change callback do
+type MinorMoney struct {
+	Money
+}
+
+// Cents wraps minor units of DefaultCurrency as MinorMoney
+func Cents(minor int64) MinorMoney {
+	return MinorMoney{Money{Minor: minor, Currency: DefaultCurrency}}
+}
+
+// MarshalJSON writes the amount as an integer of minor units
+func (m MinorMoney) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Minor, 10)), nil
+}
+
+// UnmarshalJSON reads an integer of minor units (a fraction is rounded) in DefaultCurrency
+func (m *MinorMoney) UnmarshalJSON(data []byte) error {
+	value := string(bytes.Trim(data, `"`))
+	if value == "null" || value == "" {
+		*m = MinorMoney{}
+		return nil
+	}
+	minor, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		number, floatErr := strconv.ParseFloat(value, 64)
+		if floatErr != nil || math.Abs(number) >= math.MaxInt64 {
+			return fmt.Errorf("invalid minor unit amount %s", value)
+		}
+		minor = int64(math.Round(number))
+	}
+	*m = MinorMoney{Money{Minor: minor, Currency: DefaultCurrency}}
+	return nil
+}
+
+func decimalString(minor int64, decimals int, trim bool) string {
+	sign := ""
+	magnitude := new(big.Int).SetInt64(minor)
+	if minor < 0 {
+		sign = "-"
+		magnitude.Neg(magnitude)
+	}
+	digits := magnitude.String()
+	if decimals == 0 {
+		return sign + digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-decimals], digits[len(digits)-decimals:]
+	if trim {
+		fraction = strings.TrimRight(fraction, "0")
+		if fraction == "" {
+			return sign + whole
+		}
+	}
+	return sign + whole + "." + fraction
+}
+
+// CurrencyFormat controls how amounts are printed for customers
+type CurrencyFormat struct {
+	Code        string `json:"code"`   // ISO code
+	Symbol      string `json:"symbol"` // printed before the amount, or after it when SymbolAfter is set
+	SymbolAfter bool   `json:"symbolAfter,omitempty"`
+	Decimals    int    `json:"decimals"`
+	Thousands   string `json:"thousands,omitempty"`
+	Decimal     string `json:"decimal"`
+}
+
+// DefaultCurrencyFormat prints Mongolian tögrög, e.g. "12,500.00₮"
+func DefaultCurrencyFormat() CurrencyFormat {
+	return CurrencyFormat{Code: "MNT", Symbol: "₮", SymbolAfter: true, Decimals: 2, Thousands: ",", Decimal: "."}
+}
+
+// Format prints an amount with grouping and symbol
+func (f CurrencyFormat) Format(amount Money) string {
+	// Rescale the minor units to the printed decimals, rounding half away from zero
+	minor := amount.Minor
+	shift := f.Decimals - CurrencyDecimals(amount.CurrencyCode())
+	for ; shift > 0; shift-- {
+		minor *= 10
+	}
+	for ; shift < 0; shift++ {
+		rounded := minor / 10
+		if remainder := minor % 10; remainder >= 5 {
+			rounded++
+		} else if remainder <= -5 {
+			rounded--
+		}
+		minor = rounded
+	}
+
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	digits := decimalString(minor, f.Decimals, false)
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(f.Thousands)
+		}
+		grouped.WriteRune(r)
+	}
+	number := grouped.String()
+	if f.Decimals > 0 {
+		decimal := f.Decimal
+		if decimal == "" {
+			decimal = "."
+		}
+		number += decimal + fraction
+	}
+
+	if f.SymbolAfter {
+		return sign + number + f.Symbol
+	}
+	return sign + f.Symbol + number
+}
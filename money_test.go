@@ -0,0 +1,117 @@
+package aifinitsdk
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mnt is a test shorthand for a major unit amount in the default currency
+func mnt(amount float64) Money {
+	return MoneyFromFloat(amount, DefaultCurrency)
+}
+
+func TestParseMoney(t *testing.T) {
+	money, err := ParseMoney("12.50", "MNT")
+	assert.NoError(t, err)
+	assert.Equal(t, NewMoney(1250, "MNT"), money)
+
+	money, err = ParseMoney("0.105", "MNT")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), money.Minor)
+	money, err = ParseMoney("-0.105", "MNT")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-11), money.Minor)
+
+	money, err = ParseMoney("1500", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), money.Minor)
+
+	_, err = ParseMoney("12,5", "MNT")
+	assert.Error(t, err)
+	_, err = ParseMoney("1/3", "MNT")
+	assert.Error(t, err)
+	_, err = ParseMoney("1e30", "MNT")
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+
+	// Floats that are not exact in binary still land on the right cent
+	assert.Equal(t, int64(1015), MoneyFromFloat(10.15, "MNT").Minor)
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	sum, err := SumMoney(mnt(2.5), mnt(3.1), Money{})
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(5.6), sum)
+
+	difference, err := mnt(2.5).Sub(mnt(3))
+	assert.NoError(t, err)
+	assert.True(t, difference.IsNegative())
+	assert.Equal(t, "-0.50 MNT", difference.String())
+
+	product, err := mnt(2.2).Mul(3)
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(6.6), product)
+
+	tax, err := mnt(55).MulRate(0.05)
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(2.75), tax)
+
+	cmp, err := mnt(2).Cmp(mnt(3))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, cmp)
+
+	_, err = mnt(1).Add(NewMoney(100, "USD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	_, err = NewMoney(math.MaxInt64, "MNT").Add(NewMoney(1, "MNT"))
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+	_, err = NewMoney(math.MaxInt64/2+1, "MNT").Mul(2)
+	assert.ErrorIs(t, err, ErrMoneyOverflow)
+
+	// An empty currency is the default one
+	assert.True(t, NewMoney(250, "").Equal(mnt(2.5)))
+	assert.False(t, NewMoney(250, "USD").Equal(mnt(2.5)))
+}
+
+func TestMoney_JSON(t *testing.T) {
+	// Goods, orders and fees carry major units
+	var goods Goods
+	assert.NoError(t, json.Unmarshal([]byte(`{"itemCode":"COLA","actualPrice":2.5,"originalPrice":"3.00","count":1}`), &goods))
+	assert.Equal(t, mnt(2.5), goods.ActualPrice)
+	assert.Equal(t, mnt(3), goods.OriginalPrice)
+
+	data, err := json.Marshal(Goods{ItemCode: "COLA", ActualPrice: mnt(2.5), Count: 1})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"itemCode":"COLA","actualPrice":2.5,"count":1}`, string(data))
+
+	var order DoorOpenCloseShoppingResult
+	assert.NoError(t, json.Unmarshal([]byte(`{"totalFee":8.1,"orderGoodsList":[{"itemCode":"COLA","itemPrice":2.5,"count":2}]}`), &order))
+	assert.Equal(t, mnt(8.1), order.TotalFee)
+	assert.Equal(t, mnt(2.5), order.OrderGoodsList[0].ItemPrice)
+
+	// Products carry cents
+	var product Product
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":"Cola","price":250}`), &product))
+	assert.Equal(t, Cents(250), product.Price)
+	assert.Equal(t, mnt(2.5), product.Price.Money)
+
+	data, err = json.Marshal(UpdateProductApplication{Id: 1, Price: Cents(250)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":1,"price":250,"weight":0,"qrCodes":""}`, string(data))
+
+	var change ProductChangeNotificationCallbackRequest
+	assert.NoError(t, json.Unmarshal([]byte(`{"code":"COLA","price":null}`), &change))
+	assert.True(t, change.Price.IsZero())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"actualPrice":"abc"}`), &goods))
+}
+
+func TestCurrencyFormat_Format(t *testing.T) {
+	assert.Equal(t, "12,500.00₮", DefaultCurrencyFormat().Format(mnt(12500)))
+	assert.Equal(t, "-1,234,567.89₮", DefaultCurrencyFormat().Format(mnt(-1234567.891)))
+	euro := CurrencyFormat{Code: "EUR", Symbol: "€", Decimals: 2, Thousands: ".", Decimal: ","}
+	assert.Equal(t, "€1.000,50", euro.Format(NewMoney(100050, "EUR")))
+	assert.Equal(t, "500₮", CurrencyFormat{Symbol: "₮", SymbolAfter: true}.Format(mnt(499.6)))
+	assert.Equal(t, "¥1,500.00", CurrencyFormat{Symbol: "¥", Decimals: 2, Thousands: ","}.Format(NewMoney(1500, "JPY")))
+}
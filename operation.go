@@ -42,19 +42,47 @@ type OperationClient interface {
 type OperationClientImpl struct {
 	Client Client
 	Resty  *resty.Client
+	// Guard is consulted before every OpenDoor call when set
+	Guard OpenDoorGuard
+	// Planogram, when set, refuses AddGoods and UpdateGoods calls that add mutually exclusive products
+	Planogram *PlanogramValidator
 }
 
-func NewOperationClientImpl(client Client) OperationClient {
+// OperationClientOption configures optional behaviour of the operation client
+type OperationClientOption func(*OperationClientImpl)
+
+// WithOpenDoorGuard installs a guard that can refuse OpenDoor requests before they reach the platform
+func WithOpenDoorGuard(guard OpenDoorGuard) OperationClientOption {
+	return func(c *OperationClientImpl) {
+		c.Guard = guard
+	}
+}
+
+// WithPlanogramGuard checks AddGoods items against each other and the machine's current goods, and
+// UpdateGoods items, which replace the current goods, against each other. Conflicting writes are
+// refused with a *PlanogramConflictError.
+func WithPlanogramGuard(validator *PlanogramValidator) OperationClientOption {
+	return func(c *OperationClientImpl) {
+		c.Planogram = validator
+	}
+}
+
+func NewOperationClientImpl(client Client, opts ...OperationClientOption) OperationClient {
 	restyClient := client.GetRestyClient()
 
 	if client.RestyDebug() {
 		restyClient.SetDebug(true)
 	}
 
-	return &OperationClientImpl{
+	c := &OperationClientImpl{
 		Client: client,
 		Resty:  restyClient,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
 }
 
 func (c *OperationClientImpl) OpenDoor(ctx context.Context, request *OpenDoorRequest, machineCode string) (*OpenDoorResponse, error) {
@@ -76,6 +104,12 @@ func (c *OperationClientImpl) OpenDoor(ctx context.Context, request *OpenDoorReq
 		return nil, NewAinfinitError(err)
 	}
 
+	if c.Guard != nil {
+		if err := c.Guard.CheckOpenDoor(ctx, request, machineCode); err != nil {
+			return nil, NewAinfinitError(err)
+		}
+	}
+
 	var openDoorResponse *OpenDoorResponse
 	req := c.Resty.R().SetContext(ctx).
 		SetHeader("Authorization", signature).
@@ -148,6 +182,13 @@ func (c *OperationClientImpl) UpdateGoods(request *UpdateGoodsRequest, machineCo
 		}).Debug("Updating sold goods")
 	}
 
+	if c.Planogram != nil && request != nil {
+		// The request replaces the whole goods list, so only its own items can conflict
+		if err := c.Planogram.guard(c, machineCode, *request, true); err != nil {
+			return nil, err
+		}
+	}
+
 	signature, err := c.Client.GetSignature(time.Now().UnixMilli())
 	if err != nil {
 		return nil, NewAinfinitError(err)
@@ -282,6 +323,12 @@ func (c *OperationClientImpl) AddGoods(request *AddNewGoodsRequest, machineCode
 		}).Debug("Adding new goods")
 	}
 
+	if c.Planogram != nil && request != nil {
+		if err := c.Planogram.guard(c, machineCode, request.Items, false); err != nil {
+			return nil, err
+		}
+	}
+
 	signature, err := c.Client.GetSignature(time.Now().UnixMilli())
 	if err != nil {
 		return nil, NewAinfinitError(err)
@@ -376,12 +423,16 @@ func (c *OperationClientImpl) ListOrders(request *ListOrderRequest, machineCode
 		// SetQueryParam("page", fmt.Sprintf("%d", request.Page)).
 		// SetQueryParam("limit", fmt.Sprintf("%d", request.Limit)).
 
-	if request.BeginTime != 0 {
-		query.SetQueryParam("beginTime", fmt.Sprintf("%d", request.BeginTime))
+	if err := (TimeRange{From: request.BeginTime.Time, To: request.EndTime.Time}).Validate(); err != nil {
+		return nil, NewAinfinitError(err)
+	}
+
+	if !request.BeginTime.IsZero() {
+		query.SetQueryParam("beginTime", request.BeginTime.String())
 	}
 
-	if request.EndTime != 0 {
-		query.SetQueryParam("endTime", fmt.Sprintf("%d", request.EndTime))
+	if !request.EndTime.IsZero() {
+		query.SetQueryParam("endTime", request.EndTime.String())
 	}
 
 	if request.Page != 0 {
@@ -415,10 +466,10 @@ func (c *OperationClientImpl) ListOrders(request *ListOrderRequest, machineCode
 }
 
 type OrderGoods struct {
-	ItemCode  string  `json:"itemCode"`  // Product code
-	ItemName  string  `json:"itemName"`  // Product name
-	ItemPrice float64 `json:"itemPrice"` // Commodity prices
-	Count     int     `json:"count"`     // Quantity of goods
+	ItemCode  string `json:"itemCode"`  // Product code
+	ItemName  string `json:"itemName"`  // Product name
+	ItemPrice Money  `json:"itemPrice"` // Commodity prices
+	Count     int    `json:"count"`     // Quantity of goods
 }
 
 type OrderCallbackResponse struct {
@@ -427,9 +478,9 @@ type OrderCallbackResponse struct {
 }
 
 type Goods struct {
-	ItemCode      string  `json:"itemCode,omitempty"`
-	ActualPrice   float64 `json:"actualPrice,omitempty"`
-	OriginalPrice float64 `json:"originalPrice,omitempty"`
+	ItemCode      string `json:"itemCode,omitempty"`
+	ActualPrice   Money  `json:"actualPrice,omitzero"`
+	OriginalPrice Money  `json:"originalPrice,omitzero"`
 	// Count is intentionally not omitempty: Ainfinit silently rejects
 	// AddGoods/UpdateGoods items when the field is missing from the JSON,
 	// which would otherwise drop every zero-stock item from sync.
@@ -444,9 +495,9 @@ type Order struct {
 	UserCode        string  `json:"userCode,omitempty"`
 	HandleStatus    int     `json:"handleStatus,omitempty"`
 	ShopMove        int     `json:"shopMove,omitempty"`
-	TotalFee        float64 `json:"totalFee,omitempty"`
-	OpenDoorTime    int64   `json:"openDoorTime,omitempty"`
-	CloseDoorTime   int64   `json:"closeDoorTime,omitempty"`
+	TotalFee        Money   `json:"totalFee,omitzero"`
+	OpenDoorTime    Millis  `json:"openDoorTime,omitzero"`
+	CloseDoorTime   Millis  `json:"closeDoorTime,omitzero"`
 	OpenDoorWeight  float64 `json:"openDoorWeight,omitempty"`
 	CloseDoorWeight float64 `json:"closeDoorWeight,omitempty"`
 	OrderGoodsList  []Goods `json:"orderGoodsList,omitempty"`
@@ -484,10 +535,17 @@ type OpenDoorDetailRequest struct {
 }
 
 type ListOrderRequest struct {
-	BeginTime int64 `json:"beginTime,omitempty"`
-	EndTime   int64 `json:"endTime,omitempty"`
-	Page      int   `json:"page,omitempty"`  //default 1
-	Limit     int   `json:"limit,omitempty"` //default 10 max 50
+	BeginTime Millis `json:"beginTime,omitzero"`
+	EndTime   Millis `json:"endTime,omitzero"`
+	Page      int    `json:"page,omitempty"`  //default 1
+	Limit     int    `json:"limit,omitempty"` //default 10 max 50
+}
+
+// SetRange sets BeginTime and EndTime from a time range
+func (r *ListOrderRequest) SetRange(tr TimeRange) *ListOrderRequest {
+	r.BeginTime = MillisOf(tr.From)
+	r.EndTime = MillisOf(tr.To)
+	return r
 }
 
 type GetOrderVideoRequest struct {
@@ -589,9 +647,9 @@ type SearchOpenDoorData struct {
 	VmCode          string  `json:"vmCode"`
 	MachineId       int     `json:"machineId"`
 	HandleStatus    int     `json:"handleStatus"`
-	TotalFee        float64 `json:"totalFee"`
-	OpenDoorTime    int64   `json:"openDoorTime"`
-	CloseDoorTime   int64   `json:"closeDoorTime"`
+	TotalFee        Money   `json:"totalFee"`
+	OpenDoorTime    Millis  `json:"openDoorTime"`
+	CloseDoorTime   Millis  `json:"closeDoorTime"`
 	OpenDoorWeight  float64 `json:"openDoorWeight"`
 	CloseDoorWeight float64 `json:"closeDoorWeight"`
 	OrderGoodsList  []Goods `json:"orderGoodsList"`
@@ -747,3 +805,18 @@ const (
 	DoorOpenCloseStatusTooManyOrders   DoorOpenCloseStatus = 40526 // Too many shopping orders in progress
 	DoorOpenCloseStatusNoPermission    DoorOpenCloseStatus = 42403 // No permission to query
 )
+
+// NotOpened reports whether the status says for certain that the door did not open: the device
+// reported a failure to open, or the platform never received the request
+func (s DoorOpenCloseStatus) NotOpened() bool {
+	switch s {
+	case DoorOpenCloseStatusShoppingNotFinished, DoorOpenCloseStatusRestockingNotFinished,
+		DoorOpenCloseStatusPowerOff, DoorOpenCloseStatusMaintenanceMode, DoorOpenCloseStatusBackgroundProcess,
+		DoorOpenCloseStatusTimeout, DoorOpenCloseStatusNoResult, DoorOpenCloseStatusUnknownError, DoorOpenCloseStatusCalibration,
+		DoorOpenCloseStatusProductVerification, DoorOpenCloseStatusSerialPortFault, DoorOpenCloseStatusWeightSensorFault,
+		DoorOpenCloseStatusCamerasOffline, DoorOpenCloseStatusAlgorithmError, DoorOpenCloseStatusDoorLockError,
+		DoorOpenCloseStatusPowerStatusError, DoorOpenCloseStatusRequestNotFound:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package aifinitsdk
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// maxOrderPageSize is the largest page ListOrders serves
+const maxOrderPageSize = 50
+
+// OrderIterator pages through the orders of one machine within a time range
+type OrderIterator struct {
+	Operations  OperationClient
+	MachineCode string
+	Range       TimeRange
+	// PageSize defaults to, and is capped at, 50
+	PageSize int
+}
+
+// NewOrderIterator creates an iterator over the machine's orders within the range
+func NewOrderIterator(operations OperationClient, machineCode string, r TimeRange) *OrderIterator {
+	return &OrderIterator{Operations: operations, MachineCode: machineCode, Range: r, PageSize: maxOrderPageSize}
+}
+
+// All yields every order, fetching pages as it goes. Orders listed without a machine code get the
+// iterator's. Iteration stops at the first error, which is yielded with a zero order.
+func (it *OrderIterator) All(ctx context.Context) iter.Seq2[Order, error] {
+	return func(yield func(Order, error) bool) {
+		if err := it.Range.Validate(); err != nil {
+			yield(Order{}, NewAinfinitError(err))
+			return
+		}
+		pageSize := it.PageSize
+		if pageSize <= 0 || pageSize > maxOrderPageSize {
+			pageSize = maxOrderPageSize
+		}
+
+		seen := 0
+		for page := 1; ; page++ {
+			if err := ctx.Err(); err != nil {
+				yield(Order{}, err)
+				return
+			}
+			request := (&ListOrderRequest{Page: page, Limit: pageSize}).SetRange(it.Range)
+			response, err := it.Operations.ListOrders(request, it.MachineCode)
+			if err != nil {
+				yield(Order{}, err)
+				return
+			}
+			if response == nil {
+				yield(Order{}, NewAinfinitError(fmt.Errorf("no order listing for %s page %d", it.MachineCode, page)))
+				return
+			}
+
+			for _, order := range response.Data.Rows {
+				if order.VmCode == "" {
+					order.VmCode = it.MachineCode
+				}
+				if !yield(order, nil) {
+					return
+				}
+			}
+			seen += len(response.Data.Rows)
+			if len(response.Data.Rows) < pageSize || seen >= response.Data.Total {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package aifinitsdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOrderPages struct {
+	fakeGoodsClient
+	orders   []Order
+	requests []ListOrderRequest
+	err      error
+}
+
+func (f *fakeOrderPages) ListOrders(request *ListOrderRequest, machineCode string) (*ListOrderResponse, error) {
+	f.requests = append(f.requests, *request)
+	if f.err != nil && request.Page > 1 {
+		return nil, f.err
+	}
+	response := &ListOrderResponse{Status: 200}
+	response.Data.Total = len(f.orders)
+	start := min((request.Page-1)*request.Limit, len(f.orders))
+	response.Data.Rows = f.orders[start:min(start+request.Limit, len(f.orders))]
+	return response, nil
+}
+
+func TestOrderIterator_All(t *testing.T) {
+	client := &fakeOrderPages{orders: make([]Order, 5)}
+	for i := range client.orders {
+		client.orders[i].OrderCode = string(rune('A' + i))
+	}
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	iterator := NewOrderIterator(client, "VM1", TimeRange{From: from})
+	iterator.PageSize = 2
+
+	var codes []string
+	for order, err := range iterator.All(context.Background()) {
+		require.NoError(t, err)
+		assert.Equal(t, "VM1", order.VmCode)
+		codes = append(codes, order.OrderCode)
+	}
+	assert.Equal(t, []string{"A", "B", "C", "D", "E"}, codes)
+	require.Len(t, client.requests, 3)
+	assert.Equal(t, from.UnixMilli(), client.requests[2].BeginTime.Milliseconds())
+}
+
+func TestOrderIterator_Error(t *testing.T) {
+	client := &fakeOrderPages{orders: make([]Order, 5), err: errors.New("platform unavailable")}
+	iterator := NewOrderIterator(client, "VM1", TimeRange{})
+	iterator.PageSize = 2
+
+	orders := 0
+	var lastErr error
+	for _, err := range iterator.All(context.Background()) {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		orders++
+	}
+	assert.Equal(t, 2, orders)
+	assert.EqualError(t, lastErr, "platform unavailable")
+
+	invalid := NewOrderIterator(client, "VM1", TimeRange{From: time.Now(), To: time.Now().Add(-time.Hour)})
+	for _, err := range invalid.All(context.Background()) {
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,163 @@
+package aifinitsdk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// String returns the string representation of VideoStatus
+func (s VideoStatus) String() string {
+	switch s {
+	case VideoStatusPendingUpload:
+		return "Pending upload"
+	case VideoStatusUploadComplete:
+		return "Upload complete"
+	case VideoStatusVideoDoesNotExist:
+		return "Video does not exist"
+	case VideoStatusNetworkError:
+		return "Network error"
+	case VideoStatusUploadInProgress:
+		return "Upload in progress"
+	default:
+		return fmt.Sprintf("VideoStatus(%d)", int(s))
+	}
+}
+
+// IsTerminal reports whether the video will not change status anymore
+func (s VideoStatus) IsTerminal() bool {
+	return s != VideoStatusPendingUpload && s != VideoStatusUploadInProgress
+}
+
+// OrderVideo is the outcome of waiting for the video of an order or replenishment
+type OrderVideo struct {
+	VmCode    string      `json:"vmCode"`
+	RequestID string      `json:"requestId"`
+	OrderCode string      `json:"orderCode"`
+	Status    VideoStatus `json:"status"`
+	URLs      []string    `json:"urls"`
+}
+
+// OrderVideoStatusError is returned when a video ends in a status without clips
+type OrderVideoStatusError struct {
+	RequestID string
+	Status    VideoStatus
+}
+
+func (e *OrderVideoStatusError) Error() string {
+	return fmt.Sprintf("order video %s: %s", e.RequestID, e.Status)
+}
+
+// OrderVideoPoller polls GetOrderVideo with exponential backoff until the video reaches a
+// terminal status
+type OrderVideoPoller struct {
+	Operations OperationClient
+	// Type of the door opening; defaults to shopping
+	Type OpenDoorType
+	// InitialInterval is the first wait between polls; defaults to five seconds
+	InitialInterval time.Duration
+	// MaxInterval caps the wait between polls; defaults to two minutes
+	MaxInterval time.Duration
+	// Multiplier grows the interval after every poll; defaults to 2
+	Multiplier float64
+	// NetworkRetries is how many NetworkError statuses are polled again before giving up,
+	// since the machine retries the upload itself; defaults to 3
+	NetworkRetries int
+
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewOrderVideoPoller creates a poller with the default backoff
+func NewOrderVideoPoller(operations OperationClient) *OrderVideoPoller {
+	return &OrderVideoPoller{
+		Operations:      operations,
+		Type:            OpenDoorForShopping,
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     2 * time.Minute,
+		Multiplier:      2,
+		NetworkRetries:  3,
+		sleep:           sleepContext,
+	}
+}
+
+// WaitForOrderVideo polls the video of a shopping order with the default backoff until it is
+// uploaded or can no longer be
+func WaitForOrderVideo(ctx context.Context, operations OperationClient, machineCode, requestID string) (*OrderVideo, error) {
+	return NewOrderVideoPoller(operations).Wait(ctx, machineCode, requestID)
+}
+
+// Wait polls until the video is uploaded and returns its clips. A video that does not exist, or
+// that keeps failing with network errors, returns an *OrderVideoStatusError wrapped in an
+// AinfinitError. Platform errors and context cancellation stop the wait immediately.
+func (p *OrderVideoPoller) Wait(ctx context.Context, machineCode, requestID string) (*OrderVideo, error) {
+	videoType := p.Type
+	if videoType == 0 {
+		videoType = OpenDoorForShopping
+	}
+	interval := p.InitialInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	networkErrors := 0
+	for {
+		response, err := p.Operations.GetOrderVideo(&GetOrderVideoRequest{RequestID: requestID, Type: videoType}, machineCode)
+		if err != nil {
+			return nil, err
+		}
+		if response.Status != ErrGetOrderVideoSuccess {
+			return nil, ConvertGetOrderVideoError(response.Status, response.Message)
+		}
+
+		status := response.Data.VideoStatus
+		logrus.WithFields(logrus.Fields{
+			"request_id":   requestID,
+			"device_code":  machineCode,
+			"video_status": status,
+		}).Debug("Polled order video")
+
+		switch {
+		case status == VideoStatusUploadComplete:
+			return &OrderVideo{
+				VmCode:    machineCode,
+				RequestID: requestID,
+				OrderCode: response.Data.OrderCode,
+				Status:    status,
+				URLs:      orderVideoURLs(response.Data.VideoUrl, response.Data.VideoURLs),
+			}, nil
+		case status == VideoStatusNetworkError && networkErrors < p.NetworkRetries:
+			networkErrors++
+		case status.IsTerminal():
+			return nil, NewAinfinitError(&OrderVideoStatusError{RequestID: requestID, Status: status})
+		}
+
+		if err := sleep(ctx, interval); err != nil {
+			return nil, NewAinfinitError(err)
+		}
+		interval = time.Duration(float64(interval) * multiplier)
+		if p.MaxInterval > 0 && interval > p.MaxInterval {
+			interval = p.MaxInterval
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,314 @@
+package aifinitsdk
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ArchivedVideo is one clip kept in video storage
+type ArchivedVideo struct {
+	VmCode     string    `json:"vmCode"`
+	OrderCode  string    `json:"orderCode"`
+	RequestID  string    `json:"requestId"`
+	Clip       int       `json:"clip"`
+	SourceURL  string    `json:"sourceUrl"`
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// VideoIndex persists the archive index
+type VideoIndex interface {
+	Load() ([]ArchivedVideo, error)
+	Save([]ArchivedVideo) error
+}
+
+// MemoryVideoIndex keeps the archive index in memory only
+type MemoryVideoIndex struct {
+	mu     sync.Mutex
+	videos []ArchivedVideo
+}
+
+func (s *MemoryVideoIndex) Load() ([]ArchivedVideo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ArchivedVideo(nil), s.videos...), nil
+}
+
+func (s *MemoryVideoIndex) Save(videos []ArchivedVideo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.videos = append([]ArchivedVideo(nil), videos...)
+	return nil
+}
+
+// FileVideoIndex keeps the archive index as a JSON file
+type FileVideoIndex struct {
+	Path string
+}
+
+func (s *FileVideoIndex) Load() ([]ArchivedVideo, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var videos []ArchivedVideo
+	if err := json.Unmarshal(data, &videos); err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+func (s *FileVideoIndex) Save(videos []ArchivedVideo) error {
+	data, err := json.Marshal(videos)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// OrderVideoArchiver waits for order videos, downloads every clip to storage and indexes the clips
+// by order code and machine. Each download is checked against the advertised Content-Length and,
+// when the source sends one, its MD5 (Content-MD5 or a plain ETag); storage then verifies the SHA-256.
+type OrderVideoArchiver struct {
+	Poller  *OrderVideoPoller
+	Storage VideoStorage
+	Index   VideoIndex
+	// HTTPClient downloads the clips; defaults to http.DefaultClient
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	videos map[string]ArchivedVideo // by key
+	now    func() time.Time
+}
+
+// NewOrderVideoArchiver creates an archiver. A nil index keeps the index in memory only.
+func NewOrderVideoArchiver(operations OperationClient, storage VideoStorage, index VideoIndex) *OrderVideoArchiver {
+	if index == nil {
+		index = &MemoryVideoIndex{}
+	}
+
+	return &OrderVideoArchiver{
+		Poller:  NewOrderVideoPoller(operations),
+		Storage: storage,
+		Index:   index,
+		videos:  make(map[string]ArchivedVideo),
+		now:     time.Now,
+	}
+}
+
+// Load restores the index from the index store
+func (a *OrderVideoArchiver) Load() error {
+	videos, err := a.Index.Load()
+	if err != nil {
+		return NewAinfinitError(fmt.Errorf("failed to load video index: %w", err))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, video := range videos {
+		a.videos[video.Key] = video
+	}
+	return nil
+}
+
+// Archive waits for the video of the request and archives its clips
+func (a *OrderVideoArchiver) Archive(ctx context.Context, machineCode, requestID string) ([]ArchivedVideo, error) {
+	video, err := a.Poller.Wait(ctx, machineCode, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return a.ArchiveVideo(ctx, video)
+}
+
+// ArchiveVideo downloads the clips of an uploaded video. Clips already in the index are not
+// downloaded again.
+func (a *OrderVideoArchiver) ArchiveVideo(ctx context.Context, video *OrderVideo) ([]ArchivedVideo, error) {
+	reference := video.OrderCode
+	if reference == "" {
+		reference = video.RequestID
+	}
+
+	var archived []ArchivedVideo
+	for i, source := range video.URLs {
+		key := fmt.Sprintf("%s/%s/%02d%s", video.VmCode, reference, i+1, clipExtension(source))
+
+		a.mu.Lock()
+		existing, ok := a.videos[key]
+		a.mu.Unlock()
+		if ok && existing.SourceURL == source {
+			archived = append(archived, existing)
+			continue
+		}
+
+		entry, err := a.archiveClip(ctx, key, source)
+		if err != nil {
+			return archived, NewAinfinitError(err)
+		}
+		entry.VmCode = video.VmCode
+		entry.OrderCode = video.OrderCode
+		entry.RequestID = video.RequestID
+		entry.Clip = i + 1
+		archived = append(archived, entry)
+
+		if err := a.record(entry); err != nil {
+			return archived, err
+		}
+		logrus.WithFields(logrus.Fields{
+			"key":  key,
+			"size": entry.Size,
+		}).Debug("Archived order video clip")
+	}
+	return archived, nil
+}
+
+// archiveClip downloads one clip to a temporary file, verifies it and stores it
+func (a *OrderVideoArchiver) archiveClip(ctx context.Context, key, source string) (ArchivedVideo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return ArchivedVideo{}, err
+	}
+	client := a.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ArchivedVideo{}, fmt.Errorf("failed to download %s: %w", source, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ArchivedVideo{}, fmt.Errorf("failed to download %s: %s", source, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp("", "order-video-*")
+	if err != nil {
+		return ArchivedVideo{}, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	sha := sha256.New()
+	sum := md5.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sha, sum), resp.Body)
+	if err != nil {
+		return ArchivedVideo{}, fmt.Errorf("failed to download %s: %w", source, err)
+	}
+	if resp.ContentLength >= 0 && size != resp.ContentLength {
+		return ArchivedVideo{}, fmt.Errorf("download of %s truncated: got %d bytes, expected %d", source, size, resp.ContentLength)
+	}
+	if expected := sourceMD5(resp.Header); expected != "" {
+		if got := hex.EncodeToString(sum.Sum(nil)); got != expected {
+			return ArchivedVideo{}, fmt.Errorf("download of %s corrupted: md5 %s, expected %s", source, got, expected)
+		}
+	}
+	digest := hex.EncodeToString(sha.Sum(nil))
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return ArchivedVideo{}, err
+	}
+	if err := a.Storage.Put(ctx, key, tmp, size, digest); err != nil {
+		return ArchivedVideo{}, fmt.Errorf("failed to store %s: %w", key, err)
+	}
+
+	return ArchivedVideo{
+		SourceURL:  source,
+		Key:        key,
+		Size:       size,
+		SHA256:     digest,
+		ArchivedAt: a.now(),
+	}, nil
+}
+
+func (a *OrderVideoArchiver) record(entry ArchivedVideo) error {
+	a.mu.Lock()
+	a.videos[entry.Key] = entry
+	videos := a.sorted(func(ArchivedVideo) bool { return true })
+	a.mu.Unlock()
+
+	if err := a.Index.Save(videos); err != nil {
+		return NewAinfinitError(fmt.Errorf("failed to save video index: %w", err))
+	}
+	return nil
+}
+
+// ByOrder returns the archived clips of an order
+func (a *OrderVideoArchiver) ByOrder(orderCode string) []ArchivedVideo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sorted(func(video ArchivedVideo) bool { return video.OrderCode == orderCode })
+}
+
+// ByMachine returns the archived clips of a machine
+func (a *OrderVideoArchiver) ByMachine(vmCode string) []ArchivedVideo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sorted(func(video ArchivedVideo) bool { return video.VmCode == vmCode })
+}
+
+// sorted returns matching clips ordered by key; callers hold the lock
+func (a *OrderVideoArchiver) sorted(match func(ArchivedVideo) bool) []ArchivedVideo {
+	var videos []ArchivedVideo
+	for _, video := range a.videos {
+		if match(video) {
+			videos = append(videos, video)
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool { return videos[i].Key < videos[j].Key })
+	return videos
+}
+
+// sourceMD5 returns the hex MD5 advertised by the source, if any. Multipart upload ETags
+// ("<md5>-<parts>") are not content digests and are ignored.
+func sourceMD5(header http.Header) string {
+	if value := header.Get("Content-MD5"); value != "" {
+		if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == md5.Size {
+			return hex.EncodeToString(raw)
+		}
+	}
+	etag := strings.ToLower(strings.Trim(strings.TrimPrefix(header.Get("ETag"), "W/"), `"`))
+	if len(etag) == 2*md5.Size && !strings.HasPrefix(header.Get("ETag"), "W/") {
+		if _, err := hex.DecodeString(etag); err == nil {
+			return etag
+		}
+	}
+	return ""
+}
+
+func clipExtension(source string) string {
+	if u, err := url.Parse(source); err == nil {
+		if ext := path.Ext(u.Path); ext != "" && len(ext) <= 5 {
+			return strings.ToLower(ext)
+		}
+	}
+	return ".mp4"
+}
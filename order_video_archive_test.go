@@ -0,0 +1,117 @@
+package aifinitsdk
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderVideoArchiver_Archive(t *testing.T) {
+	clips := map[string]string{"/a.mp4": "first clip", "/b.mp4": "second clip"}
+	downloads := 0
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		body := clips[r.URL.Path]
+		sum := md5.Sum([]byte(body))
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		io.WriteString(w, body)
+	}))
+	defer source.Close()
+
+	dir := t.TempDir()
+	index := &FileVideoIndex{Path: filepath.Join(dir, "index.json")}
+	archiver := NewOrderVideoArchiver(nil, &FileVideoStorage{Dir: filepath.Join(dir, "videos")}, index)
+	archiver.now = func() time.Time { return time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC) }
+
+	video := &OrderVideo{VmCode: "VM1", RequestID: "REQ-1", OrderCode: "O-1", URLs: []string{source.URL + "/a.mp4", source.URL + "/b.mp4"}}
+	archived, err := archiver.ArchiveVideo(context.Background(), video)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 2) {
+		assert.Equal(t, "VM1/O-1/01.mp4", archived[0].Key)
+		assert.Equal(t, int64(len("first clip")), archived[0].Size)
+		sum := sha256.Sum256([]byte("second clip"))
+		assert.Equal(t, hex.EncodeToString(sum[:]), archived[1].SHA256)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "videos", "VM1", "O-1", "02.mp4"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second clip", string(data))
+
+	// Archiving again reuses the index
+	_, err = archiver.ArchiveVideo(context.Background(), video)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, downloads)
+
+	restored := NewOrderVideoArchiver(nil, archiver.Storage, index)
+	assert.NoError(t, restored.Load())
+	assert.Len(t, restored.ByOrder("O-1"), 2)
+	assert.Len(t, restored.ByMachine("VM1"), 2)
+	assert.Empty(t, restored.ByMachine("VM2"))
+}
+
+func TestOrderVideoArchiver_RejectsCorruptedDownload(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"00000000000000000000000000000000"`)
+		io.WriteString(w, "tampered")
+	}))
+	defer source.Close()
+
+	dir := t.TempDir()
+	archiver := NewOrderVideoArchiver(nil, &FileVideoStorage{Dir: dir}, nil)
+	_, err := archiver.ArchiveVideo(context.Background(), &OrderVideo{VmCode: "VM1", OrderCode: "O-1", URLs: []string{source.URL + "/a.mp4"}})
+	assert.ErrorContains(t, err, "corrupted")
+	assert.Empty(t, archiver.ByOrder("O-1"))
+	_, err = os.Stat(filepath.Join(dir, "VM1", "O-1", "01.mp4"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileVideoStorage_VerifiesContent(t *testing.T) {
+	storage := &FileVideoStorage{Dir: t.TempDir()}
+	err := storage.Put(context.Background(), "VM1/clip.mp4", strings.NewReader("abc"), 3, strings.Repeat("0", 64))
+	assert.ErrorContains(t, err, "sha256")
+	err = storage.Put(context.Background(), "../escape.mp4", strings.NewReader("abc"), 3, "")
+	assert.ErrorContains(t, err, "invalid video key")
+}
+
+func TestS3VideoStorage_Put(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20260501/eu-central-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=") {
+			http.Error(w, "bad authorization "+auth, http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		objects[r.URL.EscapedPath()] = string(body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	storage := &S3VideoStorage{Endpoint: server.URL, Region: "eu-central-1", Bucket: "evidence", AccessKeyID: "AKID", SecretAccessKey: "secret", Prefix: "orders/"}
+	storage.now = func() time.Time { return time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC) }
+
+	sum := sha256.Sum256([]byte("clip"))
+	assert.NoError(t, storage.Put(context.Background(), "VM 1/O-1/01.mp4", strings.NewReader("clip"), 4, hex.EncodeToString(sum[:])))
+	assert.Equal(t, map[string]string{"/evidence/orders/VM%201/O-1/01.mp4": "clip"}, objects)
+
+	err := storage.Put(context.Background(), "VM1/O-2/01.mp4", strings.NewReader("clip"), 4, strings.Repeat("0", 64))
+	assert.ErrorContains(t, err, "XAmzContentSHA256Mismatch")
+}
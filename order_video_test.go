@@ -0,0 +1,77 @@
+package aifinitsdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVideoStatusClient answers GetOrderVideo with a fixed sequence of statuses
+type fakeVideoStatusClient struct {
+	OperationClient
+	statuses []VideoStatus
+	calls    int
+}
+
+func (f *fakeVideoStatusClient) GetOrderVideo(request *GetOrderVideoRequest, machineCode string) (*GetOrderVideoResponse, error) {
+	status := f.statuses[min(f.calls, len(f.statuses)-1)]
+	f.calls++
+	response := &GetOrderVideoResponse{Status: 200}
+	response.Data.OrderCode = "O-" + request.RequestID
+	response.Data.VideoStatus = status
+	if status == VideoStatusUploadComplete {
+		response.Data.VideoUrl = "https://video/1.mp4"
+		response.Data.VideoURLs = []string{"https://video/1.mp4", "https://video/2.mp4"}
+	}
+	return response, nil
+}
+
+func TestOrderVideoPoller_Wait(t *testing.T) {
+	operations := &fakeVideoStatusClient{statuses: []VideoStatus{
+		VideoStatusPendingUpload, VideoStatusUploadInProgress, VideoStatusNetworkError, VideoStatusUploadInProgress, VideoStatusUploadComplete,
+	}}
+	poller := NewOrderVideoPoller(operations)
+	poller.MaxInterval = 15 * time.Second
+	var waits []time.Duration
+	poller.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	video, err := poller.Wait(context.Background(), "VM1", "REQ-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "O-REQ-1", video.OrderCode)
+	assert.Equal(t, []string{"https://video/1.mp4", "https://video/2.mp4"}, video.URLs)
+	assert.Equal(t, []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second, 15 * time.Second}, waits)
+}
+
+func TestOrderVideoPoller_TerminalFailures(t *testing.T) {
+	noSleep := func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+
+	poller := NewOrderVideoPoller(&fakeVideoStatusClient{statuses: []VideoStatus{VideoStatusPendingUpload, VideoStatusVideoDoesNotExist}})
+	poller.sleep = noSleep
+	_, err := poller.Wait(context.Background(), "VM1", "REQ-1")
+	var statusErr *OrderVideoStatusError
+	if assert.True(t, errors.As(err, &statusErr)) {
+		assert.Equal(t, VideoStatusVideoDoesNotExist, statusErr.Status)
+	}
+
+	operations := &fakeVideoStatusClient{statuses: []VideoStatus{VideoStatusNetworkError}}
+	poller = NewOrderVideoPoller(operations)
+	poller.sleep = noSleep
+	_, err = poller.Wait(context.Background(), "VM1", "REQ-2")
+	if assert.True(t, errors.As(err, &statusErr)) {
+		assert.Equal(t, VideoStatusNetworkError, statusErr.Status)
+	}
+	assert.Equal(t, 4, operations.calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	poller = NewOrderVideoPoller(&fakeVideoStatusClient{statuses: []VideoStatus{VideoStatusPendingUpload}})
+	poller.sleep = noSleep
+	_, err = poller.Wait(ctx, "VM1", "REQ-3")
+	assert.True(t, errors.Is(err, context.Canceled))
+}
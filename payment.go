@@ -0,0 +1,442 @@
+package aifinitsdk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PaymentAuthorizationRequest asks a payment provider to hold an amount
+type PaymentAuthorizationRequest struct {
+	Reference string // our payment reference, also used as the door opening request id
+	UserCode  string // customer, if known
+	Amount    Money  // amount to hold
+}
+
+// PaymentAuthorization is an amount held by a payment provider
+type PaymentAuthorization struct {
+	ID        string
+	Reference string
+	Amount    Money
+}
+
+// PaymentProvider pre-authorises, captures and voids payments
+type PaymentProvider interface {
+	Authorize(ctx context.Context, request *PaymentAuthorizationRequest) (*PaymentAuthorization, error)
+	// Capture charges an amount up to the authorised one and releases the rest
+	Capture(ctx context.Context, authorizationID string, amount Money) error
+	// Void releases the whole authorisation
+	Void(ctx context.Context, authorizationID string) error
+}
+
+// FakePaymentStatus is the state of an authorisation held by FakePaymentProvider
+type FakePaymentStatus string
+
+const (
+	FakePaymentAuthorized FakePaymentStatus = "authorized"
+	FakePaymentCaptured   FakePaymentStatus = "captured"
+	FakePaymentVoided     FakePaymentStatus = "voided"
+)
+
+// FakePayment is an authorisation held by FakePaymentProvider
+type FakePayment struct {
+	PaymentAuthorization
+	Status   FakePaymentStatus
+	Captured Money
+}
+
+// FakePaymentProvider is an in-memory PaymentProvider for tests and local development
+type FakePaymentProvider struct {
+	// DeclineAbove makes authorisations of larger amounts fail when positive
+	DeclineAbove Money
+
+	mu       sync.Mutex
+	payments map[string]*FakePayment
+	next     int
+}
+
+func (p *FakePaymentProvider) Authorize(ctx context.Context, request *PaymentAuthorizationRequest) (*PaymentAuthorization, error) {
+	if !request.Amount.IsPositive() {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if p.DeclineAbove.IsPositive() {
+		if cmp, err := request.Amount.Cmp(p.DeclineAbove); err != nil {
+			return nil, err
+		} else if cmp > 0 {
+			return nil, fmt.Errorf("payment of %s declined", request.Amount)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.payments == nil {
+		p.payments = make(map[string]*FakePayment)
+	}
+	p.next++
+	authorization := PaymentAuthorization{ID: "auth-" + strconv.Itoa(p.next), Reference: request.Reference, Amount: request.Amount}
+	p.payments[authorization.ID] = &FakePayment{PaymentAuthorization: authorization, Status: FakePaymentAuthorized}
+	return &authorization, nil
+}
+
+func (p *FakePaymentProvider) Capture(ctx context.Context, authorizationID string, amount Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[authorizationID]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown authorization %s", authorizationID)
+	case payment.Status != FakePaymentAuthorized:
+		return fmt.Errorf("authorization %s is %s", authorizationID, payment.Status)
+	}
+	if cmp, err := amount.Cmp(payment.Amount); err != nil {
+		return err
+	} else if cmp > 0 {
+		return fmt.Errorf("capture of %s exceeds authorized %s", amount, payment.Amount)
+	}
+	payment.Status = FakePaymentCaptured
+	payment.Captured = amount
+	return nil
+}
+
+func (p *FakePaymentProvider) Void(ctx context.Context, authorizationID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[authorizationID]
+	switch {
+	case !ok:
+		return fmt.Errorf("unknown authorization %s", authorizationID)
+	case payment.Status != FakePaymentAuthorized:
+		return fmt.Errorf("authorization %s is %s", authorizationID, payment.Status)
+	}
+	payment.Status = FakePaymentVoided
+	return nil
+}
+
+// Payment returns an authorisation by id
+func (p *FakePaymentProvider) Payment(authorizationID string) (FakePayment, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[authorizationID]
+	if !ok {
+		return FakePayment{}, false
+	}
+	return *payment, true
+}
+
+// PaymentSessionStatus is the payment state of a shopping session
+type PaymentSessionStatus string
+
+const (
+	PaymentSessionAuthorized PaymentSessionStatus = "authorized" // amount held, door opening
+	PaymentSessionSettling   PaymentSessionStatus = "settling"   // order received, capture or void in progress
+	PaymentSessionCaptured   PaymentSessionStatus = "captured"
+	PaymentSessionVoided     PaymentSessionStatus = "voided"
+	PaymentSessionHeld       PaymentSessionStatus = "held" // waiting for manual review, see CaptureHeld and VoidHeld
+	PaymentSessionFailed     PaymentSessionStatus = "failed"
+)
+
+// PaymentSession follows the payment of one shopping session
+type PaymentSession struct {
+	Reference       string               `json:"reference"` // also the door opening request id
+	VmCode          string               `json:"vmCode"`
+	UserCode        string               `json:"userCode"`
+	AuthorizationID string               `json:"authorizationId"`
+	Authorized      Money                `json:"authorized"`
+	Captured        Money                `json:"captured"`
+	OrderCode       string               `json:"orderCode,omitempty"`
+	Status          PaymentSessionStatus `json:"status"`
+	Reason          string               `json:"reason,omitempty"` // why the session was voided, held or failed
+	UpdatedAt       time.Time            `json:"updatedAt"`
+}
+
+// PaymentSessions wraps shopping sessions with payment hooks: an amount is pre-authorised before
+// OpenDoor, the exact basket is captured when the order callback settles, empty or unopened
+// sessions are voided, and failed recognition holds the payment until manual review resolves it
+// (HandleCorrectedOrder). A basket above the authorisation is held too; CaptureHeld charges what
+// the authorisation covers and VoidHeld releases it.
+type PaymentSessions struct {
+	Operations OperationClient
+	Payments   PaymentProvider
+	// PreAuthAmount is held before the door opens when Open is given no amount
+	PreAuthAmount Money
+	// OnSession is called after every session change, outside the lock
+	OnSession func(PaymentSession)
+
+	mu       sync.Mutex
+	sessions map[string]*PaymentSession
+	now      func() time.Time
+}
+
+// NewPaymentSessions creates a session manager holding preAuthAmount per session by default
+func NewPaymentSessions(operations OperationClient, payments PaymentProvider, preAuthAmount Money) *PaymentSessions {
+	return &PaymentSessions{
+		Operations:    operations,
+		Payments:      payments,
+		PreAuthAmount: preAuthAmount,
+		sessions:      make(map[string]*PaymentSession),
+		now:           time.Now,
+	}
+}
+
+// Open pre-authorises amount (PreAuthAmount when zero) and opens the door for shopping, passing
+// the reference as RequestID and, without a user code, as UserCode. When the platform refuses the
+// door the authorisation is voided. When OpenDoor fails otherwise, e.g. on a timeout, the request is
+// looked up with OpenDoorReqDetail, and unless that confirms the door did not open the session stays
+// authorised for its order callback.
+func (s *PaymentSessions) Open(ctx context.Context, machineCode, reference, userCode string, amount Money) (*PaymentSession, error) {
+	if reference == "" {
+		return nil, NewAinfinitError(fmt.Errorf("payment reference is required"))
+	}
+	if amount.IsZero() {
+		amount = s.PreAuthAmount
+	}
+	if userCode == "" {
+		userCode = reference
+	}
+
+	s.mu.Lock()
+	if _, ok := s.sessions[reference]; ok {
+		s.mu.Unlock()
+		return nil, NewAinfinitError(fmt.Errorf("payment reference %s already used", reference))
+	}
+	session := &PaymentSession{Reference: reference, VmCode: machineCode, UserCode: userCode}
+	s.sessions[reference] = session
+	s.mu.Unlock()
+
+	authorization, err := s.Payments.Authorize(ctx, &PaymentAuthorizationRequest{Reference: reference, UserCode: userCode, Amount: amount})
+	if err != nil {
+		s.update(session, PaymentSessionFailed, fmt.Sprintf("authorization failed: %v", err), nil)
+		return nil, NewAinfinitError(fmt.Errorf("pre-authorization failed: %w", err))
+	}
+	s.update(session, PaymentSessionAuthorized, "", func(session *PaymentSession) {
+		session.AuthorizationID = authorization.ID
+		session.Authorized = authorization.Amount
+	})
+
+	response, err := s.Operations.OpenDoor(ctx, &OpenDoorRequest{Type: OpenDoorForShopping, RequestID: reference, UserCode: userCode}, machineCode)
+	if err == nil && response.Status != OpenDoorStatusSuccess {
+		err = NewAinfinitError(fmt.Errorf("open door failed: %d %s", response.Status, response.Message))
+	} else if err != nil && !s.doorNotOpened(machineCode, reference) {
+		// The door may have opened, so the order callback must still find the session authorized
+		s.update(session, PaymentSessionAuthorized, fmt.Sprintf("door outcome unknown: %v", err), nil)
+		return nil, NewAinfinitError(fmt.Errorf("door outcome of %s unknown, authorization kept: %w", reference, err))
+	}
+	if err != nil {
+		if voidErr := s.Payments.Void(ctx, authorization.ID); voidErr != nil {
+			s.update(session, PaymentSessionFailed, fmt.Sprintf("door did not open and void failed: %v", voidErr), nil)
+			return nil, err
+		}
+		s.update(session, PaymentSessionVoided, "door did not open", nil)
+		return nil, err
+	}
+
+	result, _ := s.Session(reference)
+	return &result, nil
+}
+
+// doorNotOpened confirms with the platform that a shopping door request did not open the door
+func (s *PaymentSessions) doorNotOpened(machineCode, reference string) bool {
+	detail, err := s.Operations.OpenDoorReqDetail(&OpenDoorDetailRequest{Type: OpenDoorForShopping, RequestID: reference}, machineCode)
+	if err != nil || detail == nil {
+		logrus.WithError(err).WithField("reference", reference).Warn("Could not confirm door outcome")
+		return false
+	}
+	return detail.Status.NotOpened()
+}
+
+// HandleOrder settles the session of an order callback, matched by TradeRequestId. Unknown orders
+// are ignored.
+func (s *PaymentSessions) HandleOrder(ctx context.Context, order *OrderCallbackRequest) error {
+	if order == nil {
+		return nil
+	}
+	// Claiming the session under the lock makes a redelivered callback a no-op
+	session, ok := s.claim(order.TradeRequestId, PaymentSessionAuthorized, func(session *PaymentSession) {
+		session.OrderCode = order.OrderCode
+	})
+	if !ok {
+		return nil
+	}
+
+	switch {
+	case order.ShopMove == ShopMoveDoorNotOpen:
+		return s.void(ctx, session, "door not opened")
+	case order.HandleStatus.IsFailure():
+		s.update(session, PaymentSessionHeld, fmt.Sprintf("recognition %s", order.HandleStatus), nil)
+		return nil
+	case len(order.OrderGoodsList) == 0:
+		return s.void(ctx, session, "empty basket")
+	}
+	total, err := orderGoodsTotal(order.OrderGoodsList)
+	if err != nil {
+		s.update(session, PaymentSessionHeld, fmt.Sprintf("basket total: %v", err), nil)
+		return NewAinfinitError(fmt.Errorf("basket of %s: %w", session.Reference, err))
+	}
+	return s.capture(ctx, session, total)
+}
+
+// HandleCorrectedOrder settles a held session once manual review confirmed the goods; wire it to
+// ReviewQueue.OnCorrected
+func (s *PaymentSessions) HandleCorrectedOrder(ctx context.Context, event CorrectedOrderEvent) error {
+	session, ok := s.claim(event.RequestID, PaymentSessionHeld, nil)
+	if !ok {
+		return nil
+	}
+
+	if event.CorrectedTotal.IsZero() {
+		return s.void(ctx, session, "empty basket after review")
+	}
+	return s.capture(ctx, session, event.CorrectedTotal)
+}
+
+// CaptureHeld settles a held session by hand, charging amount up to the authorised one. What a
+// basket exceeds the authorisation by is not collected and is noted in the session's Reason; a
+// zero amount voids the session.
+func (s *PaymentSessions) CaptureHeld(ctx context.Context, reference string, amount Money) (*PaymentSession, error) {
+	if amount.IsNegative() {
+		return nil, NewAinfinitError(fmt.Errorf("amount cannot be negative"))
+	}
+	session, ok := s.claim(reference, PaymentSessionHeld, nil)
+	if !ok {
+		return nil, NewAinfinitError(fmt.Errorf("payment session %s is not held", reference))
+	}
+	if amount.IsZero() {
+		return s.settled(reference, s.void(ctx, session, "empty basket after review"))
+	}
+
+	s.mu.Lock()
+	authorized := session.Authorized
+	s.mu.Unlock()
+	cmp, err := amount.Cmp(authorized)
+	if err != nil {
+		s.update(session, PaymentSessionHeld, fmt.Sprintf("basket %s: %v", amount, err), nil)
+		return nil, NewAinfinitError(fmt.Errorf("basket of %s: %w", reference, err))
+	}
+	reason := ""
+	if cmp > 0 {
+		reason = fmt.Sprintf("basket %s exceeds authorized %s, remainder not collected", amount, authorized)
+		amount = authorized
+	}
+	return s.settled(reference, s.charge(ctx, session, amount, reason))
+}
+
+// VoidHeld releases the authorisation of a held session without charging the customer
+func (s *PaymentSessions) VoidHeld(ctx context.Context, reference, reason string) (*PaymentSession, error) {
+	session, ok := s.claim(reference, PaymentSessionHeld, nil)
+	if !ok {
+		return nil, NewAinfinitError(fmt.Errorf("payment session %s is not held", reference))
+	}
+	return s.settled(reference, s.void(ctx, session, reason))
+}
+
+// settled returns the session after a manual settlement, or the settlement's error
+func (s *PaymentSessions) settled(reference string, err error) (*PaymentSession, error) {
+	if err != nil {
+		return nil, err
+	}
+	session, _ := s.Session(reference)
+	return &session, nil
+}
+
+// claim moves a session in the given status to settling, reporting false when there is no such
+// session or another settlement already claimed it
+func (s *PaymentSessions) claim(reference string, status PaymentSessionStatus, change func(*PaymentSession)) (*PaymentSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[reference]
+	if !ok || session.Status != status {
+		return nil, false
+	}
+	session.Status = PaymentSessionSettling
+	if change != nil {
+		change(session)
+	}
+	session.UpdatedAt = s.now()
+	return session, true
+}
+
+// Session returns a session by reference
+func (s *PaymentSessions) Session(reference string) (PaymentSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[reference]
+	if !ok {
+		return PaymentSession{}, false
+	}
+	return *session, true
+}
+
+// Sessions returns every session in the given status, or all sessions for an empty status
+func (s *PaymentSessions) Sessions(status PaymentSessionStatus) []PaymentSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []PaymentSession
+	for _, session := range s.sessions {
+		if status == "" || session.Status == status {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Reference < sessions[j].Reference })
+	return sessions
+}
+
+// capture charges the exact amount; an amount above the authorisation is held for review
+func (s *PaymentSessions) capture(ctx context.Context, session *PaymentSession, amount Money) error {
+	s.mu.Lock()
+	authorized := session.Authorized
+	s.mu.Unlock()
+	if cmp, err := amount.Cmp(authorized); err != nil || cmp > 0 {
+		reason := fmt.Sprintf("basket %s exceeds authorized %s", amount, authorized)
+		if err != nil {
+			reason = fmt.Sprintf("basket %s: %v", amount, err)
+		}
+		s.update(session, PaymentSessionHeld, reason, nil)
+		return nil
+	}
+	return s.charge(ctx, session, amount, "")
+}
+
+// charge captures an amount within the authorisation
+func (s *PaymentSessions) charge(ctx context.Context, session *PaymentSession, amount Money, reason string) error {
+	if err := s.Payments.Capture(ctx, session.AuthorizationID, amount); err != nil {
+		s.update(session, PaymentSessionFailed, fmt.Sprintf("capture failed: %v", err), nil)
+		return NewAinfinitError(fmt.Errorf("capture of %s failed: %w", session.Reference, err))
+	}
+	s.update(session, PaymentSessionCaptured, reason, func(session *PaymentSession) { session.Captured = amount })
+	return nil
+}
+
+func (s *PaymentSessions) void(ctx context.Context, session *PaymentSession, reason string) error {
+	if err := s.Payments.Void(ctx, session.AuthorizationID); err != nil {
+		s.update(session, PaymentSessionFailed, fmt.Sprintf("void failed: %v", err), nil)
+		return NewAinfinitError(fmt.Errorf("void of %s failed: %w", session.Reference, err))
+	}
+	s.update(session, PaymentSessionVoided, reason, nil)
+	return nil
+}
+
+func (s *PaymentSessions) update(session *PaymentSession, status PaymentSessionStatus, reason string, change func(*PaymentSession)) {
+	s.mu.Lock()
+	session.Status = status
+	session.Reason = reason
+	if change != nil {
+		change(session)
+	}
+	session.UpdatedAt = s.now()
+	snapshot := *session
+	s.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"reference": snapshot.Reference,
+		"status":    snapshot.Status,
+		"reason":    snapshot.Reason,
+	}).Debug("Payment session updated")
+	if s.OnSession != nil {
+		s.OnSession(snapshot)
+	}
+}
@@ -0,0 +1,250 @@
+package aifinitsdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDoorClient struct {
+	OperationClient
+	status   OpenDoorStatus
+	err      error
+	requests []OpenDoorRequest
+	// detail answers OpenDoorReqDetail, which fails when nil
+	detail *OpenDoorDetailResponse
+}
+
+func (f *fakeDoorClient) OpenDoor(ctx context.Context, request *OpenDoorRequest, machineCode string) (*OpenDoorResponse, error) {
+	f.requests = append(f.requests, *request)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &OpenDoorResponse{Status: f.status}, nil
+}
+
+func (f *fakeDoorClient) OpenDoorReqDetail(request *OpenDoorDetailRequest, machineCode string) (*OpenDoorDetailResponse, error) {
+	if f.detail == nil {
+		return nil, errors.New("platform unreachable")
+	}
+	return f.detail, nil
+}
+
+func TestPaymentSessions_Settlement(t *testing.T) {
+	ctx := context.Background()
+	operations := &fakeDoorClient{status: OpenDoorStatusSuccess}
+	payments := &FakePaymentProvider{}
+	sessions := NewPaymentSessions(operations, payments, mnt(20))
+
+	// Exact basket is captured
+	session, err := sessions.Open(ctx, "VM1", "PAY-1", "", Money{})
+	assert.NoError(t, err)
+	assert.Equal(t, PaymentSessionAuthorized, session.Status)
+	assert.Equal(t, OpenDoorRequest{Type: OpenDoorForShopping, RequestID: "PAY-1", UserCode: "PAY-1"}, operations.requests[0])
+	assert.NoError(t, sessions.HandleOrder(ctx, &OrderCallbackRequest{
+		TradeRequestId: "PAY-1", OrderCode: "O-1", HandleStatus: HandleStatusLocalSuccess, ShopMove: ShopMoveDoorOpenWithMove,
+		OrderGoodsList: []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 2}, {ItemCode: "CHIPS", ItemPrice: mnt(3.1), Count: 1}},
+	}))
+	session1, _ := sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionCaptured, session1.Status)
+	assert.Equal(t, mnt(8.1), session1.Captured)
+	payment, _ := payments.Payment(session1.AuthorizationID)
+	assert.Equal(t, FakePaymentCaptured, payment.Status)
+
+	// Door never opened and empty basket are voided
+	_, err = sessions.Open(ctx, "VM1", "PAY-2", "user-7", Money{})
+	assert.NoError(t, err)
+	assert.NoError(t, sessions.HandleOrder(ctx, &OrderCallbackRequest{TradeRequestId: "PAY-2", HandleStatus: HandleStatusLocalSuccess, ShopMove: ShopMoveDoorNotOpen}))
+	_, err = sessions.Open(ctx, "VM1", "PAY-3", "", Money{})
+	assert.NoError(t, err)
+	assert.NoError(t, sessions.HandleOrder(ctx, &OrderCallbackRequest{TradeRequestId: "PAY-3", HandleStatus: HandleStatusCloudSuccess, ShopMove: ShopMoveDoorOpenNoMove}))
+	voided := sessions.Sessions(PaymentSessionVoided)
+	if assert.Len(t, voided, 2) {
+		assert.Equal(t, "door not opened", voided[0].Reason)
+		assert.Equal(t, "empty basket", voided[1].Reason)
+	}
+
+	// Failed recognition is held until review
+	_, err = sessions.Open(ctx, "VM1", "PAY-4", "", Money{})
+	assert.NoError(t, err)
+	assert.NoError(t, sessions.HandleOrder(ctx, &OrderCallbackRequest{
+		TradeRequestId: "PAY-4", HandleStatus: HandleStatusCloudFailure, ShopMove: ShopMoveDoorOpenWithMove,
+		OrderGoodsList: []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 1}},
+	}))
+	session4, _ := sessions.Session("PAY-4")
+	assert.Equal(t, PaymentSessionHeld, session4.Status)
+	payment, _ = payments.Payment(session4.AuthorizationID)
+	assert.Equal(t, FakePaymentAuthorized, payment.Status)
+
+	assert.NoError(t, sessions.HandleCorrectedOrder(ctx, CorrectedOrderEvent{RequestID: "PAY-4", CorrectedTotal: mnt(5.2)}))
+	session4, _ = sessions.Session("PAY-4")
+	assert.Equal(t, PaymentSessionCaptured, session4.Status)
+	assert.Equal(t, mnt(5.2), session4.Captured)
+}
+
+func TestPaymentSessions_DoorFailureVoids(t *testing.T) {
+	ctx := context.Background()
+	payments := &FakePaymentProvider{DeclineAbove: mnt(50)}
+	sessions := NewPaymentSessions(&fakeDoorClient{status: OpenDoorStatusDeviceOffline}, payments, mnt(20))
+
+	_, err := sessions.Open(ctx, "VM1", "PAY-1", "", Money{})
+	assert.Error(t, err)
+	session, _ := sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionVoided, session.Status)
+	payment, _ := payments.Payment(session.AuthorizationID)
+	assert.Equal(t, FakePaymentVoided, payment.Status)
+
+	_, err = sessions.Open(ctx, "VM1", "PAY-1", "", Money{})
+	assert.ErrorContains(t, err, "already used")
+
+	operations := &fakeDoorClient{status: OpenDoorStatusSuccess}
+	sessions.Operations = operations
+	_, err = sessions.Open(ctx, "VM1", "PAY-2", "", mnt(80))
+	assert.ErrorContains(t, err, "declined")
+	assert.Empty(t, operations.requests)
+}
+
+func TestPaymentSessions_DoorOutcomeUnknown(t *testing.T) {
+	ctx := context.Background()
+	payments := &FakePaymentProvider{}
+	operations := &fakeDoorClient{err: context.DeadlineExceeded}
+	sessions := NewPaymentSessions(operations, payments, mnt(20))
+
+	// Neither OpenDoor nor the lookup answer: the session stays authorized
+	_, err := sessions.Open(ctx, "VM1", "PAY-1", "", Money{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	session, _ := sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionAuthorized, session.Status)
+	assert.Contains(t, session.Reason, "door outcome unknown")
+	payment, _ := payments.Payment(session.AuthorizationID)
+	assert.Equal(t, FakePaymentAuthorized, payment.Status)
+
+	// The door did open, so the order callback is still captured
+	assert.NoError(t, sessions.HandleOrder(ctx, &OrderCallbackRequest{
+		TradeRequestId: "PAY-1", OrderCode: "O-1", HandleStatus: HandleStatusLocalSuccess, ShopMove: ShopMoveDoorOpenWithMove,
+		OrderGoodsList: []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 1}},
+	}))
+	session, _ = sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionCaptured, session.Status)
+
+	// The lookup confirms the door opened
+	operations.detail = &OpenDoorDetailResponse{Status: DoorOpenCloseStatusOpened}
+	_, err = sessions.Open(ctx, "VM1", "PAY-2", "", Money{})
+	assert.Error(t, err)
+	session, _ = sessions.Session("PAY-2")
+	assert.Equal(t, PaymentSessionAuthorized, session.Status)
+
+	// The lookup confirms the platform never got the request
+	operations.detail = &OpenDoorDetailResponse{Status: DoorOpenCloseStatusRequestNotFound}
+	_, err = sessions.Open(ctx, "VM1", "PAY-3", "", Money{})
+	assert.Error(t, err)
+	session, _ = sessions.Session("PAY-3")
+	assert.Equal(t, PaymentSessionVoided, session.Status)
+	payment, _ = payments.Payment(session.AuthorizationID)
+	assert.Equal(t, FakePaymentVoided, payment.Status)
+}
+
+// redeliveringProvider delivers the order callback again while the first capture is in progress
+type redeliveringProvider struct {
+	*FakePaymentProvider
+	redeliver func() error
+	captures  int
+}
+
+func (p *redeliveringProvider) Capture(ctx context.Context, authorizationID string, amount Money) error {
+	p.captures++
+	if p.redeliver != nil {
+		redeliver := p.redeliver
+		p.redeliver = nil
+		if err := redeliver(); err != nil {
+			return err
+		}
+	}
+	return p.FakePaymentProvider.Capture(ctx, authorizationID, amount)
+}
+
+func TestPaymentSessions_DuplicateOrderCallback(t *testing.T) {
+	ctx := context.Background()
+	payments := &redeliveringProvider{FakePaymentProvider: &FakePaymentProvider{}}
+	sessions := NewPaymentSessions(&fakeDoorClient{status: OpenDoorStatusSuccess}, payments, mnt(20))
+	_, err := sessions.Open(ctx, "VM1", "PAY-1", "", Money{})
+	assert.NoError(t, err)
+
+	order := &OrderCallbackRequest{
+		TradeRequestId: "PAY-1", OrderCode: "O-1", HandleStatus: HandleStatusLocalSuccess, ShopMove: ShopMoveDoorOpenWithMove,
+		OrderGoodsList: []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 2}},
+	}
+	var during PaymentSession
+	payments.redeliver = func() error {
+		during, _ = sessions.Session("PAY-1")
+		return sessions.HandleOrder(ctx, order)
+	}
+	assert.NoError(t, sessions.HandleOrder(ctx, order))
+	assert.Equal(t, PaymentSessionSettling, during.Status)
+	assert.Equal(t, 1, payments.captures)
+	session, _ := sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionCaptured, session.Status)
+
+	// A retry after settlement changes nothing either
+	assert.NoError(t, sessions.HandleOrder(ctx, order))
+	assert.Equal(t, 1, payments.captures)
+	session, _ = sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionCaptured, session.Status)
+}
+
+func TestPaymentSessions_ResolveHeld(t *testing.T) {
+	ctx := context.Background()
+	payments := &FakePaymentProvider{}
+	sessions := NewPaymentSessions(&fakeDoorClient{status: OpenDoorStatusSuccess}, payments, mnt(10))
+	overBasket := func(reference string) {
+		_, err := sessions.Open(ctx, "VM1", reference, "", Money{})
+		assert.NoError(t, err)
+		assert.NoError(t, sessions.HandleOrder(ctx, &OrderCallbackRequest{
+			TradeRequestId: reference, HandleStatus: HandleStatusLocalSuccess, ShopMove: ShopMoveDoorOpenWithMove,
+			OrderGoodsList: []OrderGoods{{ItemCode: "WINE", ItemPrice: mnt(12.5), Count: 1}},
+		}))
+		session, _ := sessions.Session(reference)
+		assert.Equal(t, PaymentSessionHeld, session.Status)
+		assert.Contains(t, session.Reason, "exceeds authorized")
+	}
+
+	// Review corrects the basket to the same amount: still held, the authorisation stays open
+	overBasket("PAY-1")
+	assert.NoError(t, sessions.HandleCorrectedOrder(ctx, CorrectedOrderEvent{RequestID: "PAY-1", CorrectedTotal: mnt(12.5)}))
+	held, _ := sessions.Session("PAY-1")
+	assert.Equal(t, PaymentSessionHeld, held.Status)
+
+	// Capturing charges what the authorisation covers
+	session, err := sessions.CaptureHeld(ctx, "PAY-1", mnt(12.5))
+	assert.NoError(t, err)
+	assert.Equal(t, PaymentSessionCaptured, session.Status)
+	assert.Equal(t, mnt(10), session.Captured)
+	assert.Contains(t, session.Reason, "remainder not collected")
+	payment, _ := payments.Payment(session.AuthorizationID)
+	assert.Equal(t, FakePaymentCaptured, payment.Status)
+	assert.Equal(t, mnt(10), payment.Captured)
+
+	_, err = sessions.CaptureHeld(ctx, "PAY-1", mnt(5))
+	assert.ErrorContains(t, err, "not held")
+
+	// or the authorisation is released
+	overBasket("PAY-2")
+	session, err = sessions.VoidHeld(ctx, "PAY-2", "goodwill")
+	assert.NoError(t, err)
+	assert.Equal(t, PaymentSessionVoided, session.Status)
+	assert.Equal(t, "goodwill", session.Reason)
+	payment, _ = payments.Payment(session.AuthorizationID)
+	assert.Equal(t, FakePaymentVoided, payment.Status)
+
+	// A smaller amount is charged as is
+	overBasket("PAY-3")
+	session, err = sessions.CaptureHeld(ctx, "PAY-3", mnt(7.5))
+	assert.NoError(t, err)
+	assert.Equal(t, mnt(7.5), session.Captured)
+	assert.Empty(t, session.Reason)
+
+	_, err = sessions.VoidHeld(ctx, "PAY-404", "")
+	assert.ErrorContains(t, err, "not held")
+}
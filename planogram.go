@@ -0,0 +1,248 @@
+package aifinitsdk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConflictPair is two products the vision recogniser cannot tell apart in the same cabinet.
+// Proposed is the item being added; Other is already stocked or also being added.
+type ConflictPair struct {
+	Proposed string `json:"proposed"`
+	Other    string `json:"other"`
+}
+
+// PlanogramReport is the result of checking proposed products against a machine's assortment
+type PlanogramReport struct {
+	VmCode    string         `json:"vmCode"`
+	Current   []string       `json:"current"`
+	Proposed  []string       `json:"proposed"`
+	Conflicts []ConflictPair `json:"conflicts"`
+}
+
+// HasConflicts reports whether any proposed product conflicts
+func (r *PlanogramReport) HasConflicts() bool {
+	return len(r.Conflicts) > 0
+}
+
+// PlanogramConflictError is returned by guarded AddGoods and UpdateGoods calls that would put
+// mutually exclusive products in one machine
+type PlanogramConflictError struct {
+	VmCode    string
+	Conflicts []ConflictPair
+}
+
+func (e *PlanogramConflictError) Error() string {
+	pairs := make([]string, 0, len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		pairs = append(pairs, conflict.Proposed+"/"+conflict.Other)
+	}
+	return fmt.Sprintf("machine %s: mutually exclusive products: %s", e.VmCode, strings.Join(pairs, ", "))
+}
+
+// PlanogramValidator checks planned assortments against the platform's mutual exclusion rules
+type PlanogramValidator struct {
+	Products ProductManageClient
+	// Operations is used by Validate to read the machine's current goods
+	Operations OperationClient
+	// BatchSize is the largest number of item codes sent in one MutualExclusion call; defaults to 50
+	BatchSize int
+}
+
+// NewPlanogramValidator creates a validator with the default batch size
+func NewPlanogramValidator(products ProductManageClient, operations OperationClient) *PlanogramValidator {
+	return &PlanogramValidator{
+		Products:   products,
+		Operations: operations,
+		BatchSize:  50,
+	}
+}
+
+// Validate checks proposed item codes against the goods currently listed on the machine
+func (v *PlanogramValidator) Validate(machineCode string, proposed []string) (*PlanogramReport, error) {
+	current, err := currentGoodsCodes(v.Operations, machineCode)
+	if err != nil {
+		return nil, err
+	}
+	return v.Check(machineCode, current, proposed)
+}
+
+// guard refuses proposed goods that conflict with each other or, unless they replace the machine's
+// goods, with the goods currently listed
+func (v *PlanogramValidator) guard(operations OperationClient, machineCode string, goods []Goods, replace bool) error {
+	var current []string
+	if !replace {
+		var err error
+		if current, err = currentGoodsCodes(operations, machineCode); err != nil {
+			return err
+		}
+	}
+	report, err := v.Check(machineCode, current, goodsCodes(goods))
+	if err != nil {
+		return err
+	}
+	if report.HasConflicts() {
+		return NewAinfinitError(&PlanogramConflictError{VmCode: machineCode, Conflicts: report.Conflicts})
+	}
+	return nil
+}
+
+// Check reports every pair of products that conflict, where at least one side is proposed.
+// Conflicts among current goods alone are not reported.
+//
+// MutualExclusion only says which of the given codes conflict with some other code, so the set is
+// first narrowed down in batches and the remaining candidates are then checked pair by pair.
+func (v *PlanogramValidator) Check(machineCode string, current, proposed []string) (*PlanogramReport, error) {
+	current = uniqueCodes(current)
+	proposed = uniqueCodes(proposed)
+	report := &PlanogramReport{VmCode: machineCode, Current: current, Proposed: proposed}
+
+	isProposed := make(map[string]bool, len(proposed))
+	for _, code := range proposed {
+		isProposed[code] = true
+	}
+	all := append([]string(nil), proposed...)
+	for _, code := range current {
+		if !isProposed[code] {
+			all = append(all, code)
+		}
+	}
+	if len(proposed) == 0 || len(all) < 2 {
+		return report, nil
+	}
+
+	candidates, err := v.conflicting(all, isProposed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range candidates {
+		for _, b := range candidates[i+1:] {
+			if !isProposed[a] && !isProposed[b] {
+				continue
+			}
+			codes, err := v.mutualExclusion([]string{a, b})
+			if err != nil {
+				return nil, err
+			}
+			if len(codes) < 2 {
+				continue
+			}
+			if isProposed[a] {
+				report.Conflicts = append(report.Conflicts, ConflictPair{Proposed: a, Other: b})
+			} else {
+				report.Conflicts = append(report.Conflicts, ConflictPair{Proposed: b, Other: a})
+			}
+		}
+	}
+
+	sort.Slice(report.Conflicts, func(i, j int) bool {
+		if report.Conflicts[i].Proposed != report.Conflicts[j].Proposed {
+			return report.Conflicts[i].Proposed < report.Conflicts[j].Proposed
+		}
+		return report.Conflicts[i].Other < report.Conflicts[j].Other
+	})
+	return report, nil
+}
+
+// conflicting returns the codes that conflict with some other code. When the codes do not fit in one
+// batch, every pair of half-size chunks is checked so each pair of codes shares at least one call.
+func (v *PlanogramValidator) conflicting(codes []string, isProposed map[string]bool) ([]string, error) {
+	batchSize := v.BatchSize
+	if batchSize < 2 {
+		batchSize = 50
+	}
+
+	var batches [][]string
+	if len(codes) <= batchSize {
+		batches = [][]string{codes}
+	} else {
+		var chunks [][]string
+		for half := batchSize / 2; len(codes) > 0; {
+			n := min(half, len(codes))
+			chunks = append(chunks, codes[:n])
+			codes = codes[n:]
+		}
+		for i := range chunks {
+			for j := i + 1; j < len(chunks); j++ {
+				if !anyProposed(chunks[i], isProposed) && !anyProposed(chunks[j], isProposed) {
+					continue
+				}
+				batch := append(append([]string(nil), chunks[i]...), chunks[j]...)
+				batches = append(batches, batch)
+			}
+		}
+	}
+
+	found := make(map[string]bool)
+	var conflicting []string
+	for _, batch := range batches {
+		codes, err := v.mutualExclusion(batch)
+		if err != nil {
+			return nil, err
+		}
+		for _, code := range codes {
+			if !found[code] {
+				found[code] = true
+				conflicting = append(conflicting, code)
+			}
+		}
+	}
+	sort.Strings(conflicting)
+	return conflicting, nil
+}
+
+func (v *PlanogramValidator) mutualExclusion(codes []string) ([]string, error) {
+	resp, err := v.Products.MutualExclusion(&MutualExclusionRequest{ItemCodes: codes})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, nil
+	}
+	return resp.Data.Rows, nil
+}
+
+func anyProposed(codes []string, isProposed map[string]bool) bool {
+	for _, code := range codes {
+		if isProposed[code] {
+			return true
+		}
+	}
+	return false
+}
+
+func currentGoodsCodes(operations OperationClient, machineCode string) ([]string, error) {
+	goods, err := operations.ListGoods(machineCode)
+	if err != nil {
+		return nil, err
+	}
+	if goods == nil {
+		return nil, NewAinfinitError(fmt.Errorf("empty goods list for machine %s", machineCode))
+	}
+	if !isSuccessStatus(int(goods.Status)) {
+		return nil, NewAinfinitError(fmt.Errorf("status: %d, message: %s", goods.Status, goods.Message))
+	}
+	return goodsCodes(goods.Result), nil
+}
+
+func goodsCodes(goods []Goods) []string {
+	codes := make([]string, 0, len(goods))
+	for _, item := range goods {
+		codes = append(codes, item.ItemCode)
+	}
+	return codes
+}
+
+func uniqueCodes(codes []string) []string {
+	seen := make(map[string]bool, len(codes))
+	var unique []string
+	for _, code := range codes {
+		if code != "" && !seen[code] {
+			seen[code] = true
+			unique = append(unique, code)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,129 @@
+package aifinitsdk
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"resty.dev/v3"
+)
+
+// fakeExclusionClient answers MutualExclusion from fixed groups of look-alike products
+type fakeExclusionClient struct {
+	ProductManageClient
+	groups [][]string
+	calls  int
+}
+
+func (f *fakeExclusionClient) MutualExclusion(request *MutualExclusionRequest) (*MutualExclusionResponse, error) {
+	f.calls++
+	group := map[string]int{}
+	for i, members := range f.groups {
+		for _, code := range members {
+			group[code] = i + 1
+		}
+	}
+
+	count := map[int]int{}
+	for _, code := range request.ItemCodes {
+		count[group[code]]++
+	}
+	response := &MutualExclusionResponse{Status: 200}
+	for _, code := range request.ItemCodes {
+		if g := group[code]; g != 0 && count[g] > 1 {
+			response.Data.Rows = append(response.Data.Rows, code)
+		}
+	}
+	return response, nil
+}
+
+type fakeGoodsClient struct {
+	OperationClient
+	goods []Goods
+}
+
+func (f *fakeGoodsClient) ListGoods(machineCode string) (*GetMachineGoodsResponse, error) {
+	return &GetMachineGoodsResponse{Status: 200, Result: f.goods}, nil
+}
+
+func TestPlanogramValidator_Validate(t *testing.T) {
+	products := &fakeExclusionClient{groups: [][]string{{"COLA", "COLA-ZERO"}, {"CHIPS", "CHIPS-XL", "CHIPS-BBQ"}, {"OLD-A", "OLD-B"}}}
+	operations := &fakeGoodsClient{goods: []Goods{{ItemCode: "COLA"}, {ItemCode: "CHIPS"}, {ItemCode: "OLD-A"}, {ItemCode: "OLD-B"}, {ItemCode: "WATER"}}}
+
+	validator := NewPlanogramValidator(products, operations)
+	validator.BatchSize = 4
+
+	report, err := validator.Validate("VM1", []string{"COLA-ZERO", "CHIPS-XL", "CHIPS-BBQ", "JUICE", "COLA-ZERO"})
+	assert.NoError(t, err)
+	assert.True(t, report.HasConflicts())
+	assert.Equal(t, []ConflictPair{
+		{Proposed: "CHIPS-BBQ", Other: "CHIPS"},
+		{Proposed: "CHIPS-BBQ", Other: "CHIPS-XL"},
+		{Proposed: "CHIPS-XL", Other: "CHIPS"},
+		{Proposed: "COLA-ZERO", Other: "COLA"},
+	}, report.Conflicts)
+
+	report, err = validator.Validate("VM1", []string{"JUICE"})
+	assert.NoError(t, err)
+	assert.False(t, report.HasConflicts())
+}
+
+func TestAddGoods_PlanogramGuard(t *testing.T) {
+	var added bool
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "GET" {
+			return jsonResponse(`{"status":200,"message":"OK","result":[{"itemCode":"COLA","count":3}],"count":1}`), nil
+		}
+		added = true
+		return jsonResponse(`{"status":200,"message":"OK"}`), nil
+	}))
+
+	products := &fakeExclusionClient{groups: [][]string{{"COLA", "COLA-ZERO"}}}
+	operations := NewOperationClientImpl(&MockClient{RestyClient: restyClient}, WithPlanogramGuard(NewPlanogramValidator(products, nil)))
+
+	_, err := operations.AddGoods(&AddNewGoodsRequest{Items: []Goods{{ItemCode: "COLA-ZERO", Count: 1}}}, "VM1")
+	var conflict *PlanogramConflictError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, []ConflictPair{{Proposed: "COLA-ZERO", Other: "COLA"}}, conflict.Conflicts)
+	}
+	assert.False(t, added)
+
+	_, err = operations.AddGoods(&AddNewGoodsRequest{Items: []Goods{{ItemCode: "WATER", Count: 1}}}, "VM1")
+	assert.NoError(t, err)
+	assert.True(t, added)
+}
+
+func TestUpdateGoods_PlanogramGuard(t *testing.T) {
+	var listed, updated bool
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "GET" {
+			listed = true
+			return jsonResponse(`{"status":200,"message":"OK","result":[{"itemCode":"COLA","count":3}],"count":1}`), nil
+		}
+		updated = true
+		return jsonResponse(`{"status":200,"message":"OK"}`), nil
+	}))
+
+	products := &fakeExclusionClient{groups: [][]string{{"COLA", "COLA-ZERO"}}}
+	operations := NewOperationClientImpl(&MockClient{RestyClient: restyClient}, WithPlanogramGuard(NewPlanogramValidator(products, nil)))
+
+	// Swapping COLA for COLA-ZERO replaces the conflicting item, so it is allowed
+	request := UpdateGoodsRequest{{ItemCode: "COLA-ZERO", Count: 1}, {ItemCode: "WATER", Count: 2}}
+	_, err := operations.UpdateGoods(&request, "VM1")
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	assert.False(t, listed)
+
+	// Both in the new list still conflict
+	updated = false
+	request = UpdateGoodsRequest{{ItemCode: "COLA", Count: 1}, {ItemCode: "COLA-ZERO", Count: 1}}
+	_, err = operations.UpdateGoods(&request, "VM1")
+	var conflict *PlanogramConflictError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, []ConflictPair{{Proposed: "COLA", Other: "COLA-ZERO"}}, conflict.Conflicts)
+	}
+	assert.False(t, updated)
+}
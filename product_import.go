@@ -0,0 +1,411 @@
+package aifinitsdk
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ImportRow is one product of a bulk import manifest.
+// Manifests have a header row with the columns name, price, weight, barcode, images,
+// physical_images and weight_image; image columns hold paths relative to the image directory,
+// separated by ";" or "|".
+type ImportRow struct {
+	Line           int // manifest line, counting the header as line 1
+	Name           string
+	Price          Money // in major units in the manifest, e.g. 12.50
+	Weight         float64
+	Barcode        string
+	Images         []string
+	PhysicalImages []string
+	WeightImage    string
+	// ParseError is set when a cell could not be read; the row is reported as invalid
+	ParseError string
+}
+
+// ImportStatus is the outcome of one manifest row
+type ImportStatus string
+
+const (
+	ImportStatusSubmitted ImportStatus = "submitted"
+	ImportStatusSkipped   ImportStatus = "skipped" // barcode already has a pending or approved application, or an earlier manifest row
+	ImportStatusInvalid   ImportStatus = "invalid" // failed local validation, not submitted
+	ImportStatusFailed    ImportStatus = "failed"  // the platform call failed
+)
+
+// ImportResult is the outcome of one manifest row
+type ImportResult struct {
+	Line          int
+	Name          string
+	Barcode       string
+	Status        ImportStatus
+	ApplicationId int
+	Error         string
+}
+
+// ReadImportManifest reads a .csv or .xlsx manifest file
+func ReadImportManifest(name string) ([]ImportRow, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, NewAinfinitError(err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return ReadImportManifestCSV(file)
+	case ".xlsx":
+		info, err := file.Stat()
+		if err != nil {
+			return nil, NewAinfinitError(err)
+		}
+		return ReadImportManifestXLSX(file, info.Size())
+	default:
+		return nil, NewAinfinitError(fmt.Errorf("unsupported manifest type %q, use .csv or .xlsx", filepath.Ext(name)))
+	}
+}
+
+// ReadImportManifestCSV reads a CSV manifest
+func ReadImportManifestCSV(r io.Reader) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("read manifest: %w", err))
+	}
+	return parseImportRecords(records)
+}
+
+// ReadImportManifestXLSX reads the first worksheet of an XLSX manifest
+func ReadImportManifestXLSX(r io.ReaderAt, size int64) ([]ImportRow, error) {
+	records, err := readXLSXRows(r, size)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("read manifest: %w", err))
+	}
+	return parseImportRecords(records)
+}
+
+func parseImportRecords(records [][]string) ([]ImportRow, error) {
+	if len(records) == 0 {
+		return nil, NewAinfinitError(fmt.Errorf("manifest is empty"))
+	}
+
+	columns := make(map[string]int)
+	for i, header := range records[0] {
+		key := strings.ToLower(strings.TrimSpace(header))
+		key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+		columns[key] = i
+	}
+	for _, required := range []string{"name", "price", "barcode"} {
+		if _, ok := columns[required]; !ok {
+			return nil, NewAinfinitError(fmt.Errorf("manifest is missing the %q column", required))
+		}
+	}
+
+	var rows []ImportRow
+	for i, record := range records[1:] {
+		cell := func(column string) string {
+			index, ok := columns[column]
+			if !ok || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+
+		row := ImportRow{
+			Line:           i + 2,
+			Name:           cell("name"),
+			Barcode:        cell("barcode"),
+			Images:         splitPaths(cell("images")),
+			PhysicalImages: splitPaths(cell("physical_images")),
+			WeightImage:    cell("weight_image"),
+		}
+		if row.Name == "" && row.Barcode == "" && cell("price") == "" {
+			continue // blank line
+		}
+
+		var problems []string
+		row.Price, problems = parseImportPrice(cell("price"), problems)
+		row.Weight, problems = parseImportNumber(cell("weight"), "weight", problems)
+		row.ParseError = strings.Join(problems, "; ")
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseImportNumber(value, column string, problems []string) (float64, []string) {
+	if value == "" {
+		return 0, problems
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, append(problems, fmt.Sprintf("%s: %q is not a number", column, value))
+	}
+	return number, problems
+}
+
+func parseImportPrice(value string, problems []string) (Money, []string) {
+	if value == "" {
+		return Money{}, problems
+	}
+	price, err := ParseMoney(value, DefaultCurrency)
+	if err != nil {
+		return Money{}, append(problems, fmt.Sprintf("price: %q is not a number", value))
+	}
+	return price, problems
+}
+
+func splitPaths(value string) []string {
+	var paths []string
+	for _, p := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '|' }) {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// ProductImporter submits product applications for every row of a manifest.
+// All rows are validated before anything is submitted, rows whose barcode already has a pending or
+// approved application are skipped, so a failed import can simply be run again. Rows repeating the
+// barcode of an earlier row are skipped too.
+type ProductImporter struct {
+	Products ProductManageClient
+	// Images holds the files referenced by the manifest
+	Images fs.FS
+	Rules  ProductApplicationRules
+	// Concurrency is the number of applications submitted at once; defaults to 4
+	Concurrency int
+	// Tracker, when set, submits through the tracker so the applications are followed after import
+	Tracker *ApplicationTracker
+	// OnResult, when set, is called as each row finishes; it may be called from several goroutines
+	OnResult func(ImportResult)
+}
+
+// NewProductImporter creates an importer with the default validation rules
+func NewProductImporter(products ProductManageClient, images fs.FS) *ProductImporter {
+	return &ProductImporter{
+		Products:    products,
+		Images:      images,
+		Rules:       DefaultProductApplicationRules(),
+		Concurrency: 4,
+	}
+}
+
+// Import validates and submits the rows. The results follow the manifest order.
+// The error is only set when the import could not run; per row failures are in the results.
+func (p *ProductImporter) Import(ctx context.Context, rows []ImportRow) ([]ImportResult, error) {
+	results := make([]ImportResult, len(rows))
+	var pending []int
+
+	// Validate every row before submitting any
+	for i, row := range rows {
+		results[i] = ImportResult{Line: row.Line, Name: row.Name, Barcode: row.Barcode}
+		if row.ParseError != "" {
+			results[i].Status = ImportStatusInvalid
+			results[i].Error = row.ParseError
+			continue
+		}
+
+		application, err := p.application(row)
+		if err == nil {
+			err = ValidateProductApplication(application, p.Rules)
+		}
+		if err != nil {
+			results[i].Status = ImportStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	// Rows submitted at once cannot see each other's applications, so only the first row of a
+	// barcode is submitted
+	first := make(map[string]int)
+	pending = slices.DeleteFunc(pending, func(i int) bool {
+		for _, barcode := range splitBarcodes(rows[i].Barcode) {
+			if line, ok := first[barcode]; ok {
+				results[i].Status = ImportStatusSkipped
+				results[i].Error = fmt.Sprintf("barcode %s is already on line %d", barcode, line)
+				return true
+			}
+		}
+		for _, barcode := range splitBarcodes(rows[i].Barcode) {
+			first[barcode] = rows[i].Line
+		}
+		return false
+	})
+	for i := range results {
+		if results[i].Status == ImportStatusInvalid || results[i].Status == ImportStatusSkipped {
+			p.report(results[i])
+		}
+	}
+
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for _, i := range pending {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return results, ctx.Err()
+		case slots <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			p.submit(rows[i], &results[i])
+			p.report(results[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+func (p *ProductImporter) submit(row ImportRow, result *ImportResult) {
+	existing, err := p.existingApplication(row.Barcode)
+	if err != nil {
+		result.Status = ImportStatusFailed
+		result.Error = err.Error()
+		return
+	}
+	if existing != nil {
+		result.Status = ImportStatusSkipped
+		result.ApplicationId = existing.Id
+		return
+	}
+
+	// Images are read again here so only the rows being submitted are held in memory
+	application, err := p.application(row)
+	if err != nil {
+		result.Status = ImportStatusFailed
+		result.Error = err.Error()
+		return
+	}
+
+	var id int
+	if p.Tracker != nil {
+		var tracked *TrackedApplication
+		tracked, err = p.Tracker.Submit(application)
+		if tracked != nil {
+			id = tracked.Id
+		}
+	} else {
+		var resp *NewProductApplicationResponse
+		resp, err = p.Products.NewProductApplication(&NewProductApplicationRequest{Product: application})
+		if resp != nil {
+			id = resp.Data
+		}
+	}
+	if err != nil && id == 0 {
+		result.Status = ImportStatusFailed
+		result.Error = err.Error()
+		return
+	}
+
+	result.Status = ImportStatusSubmitted
+	result.ApplicationId = id
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// existingApplication returns a pending or approved application carrying one of the row's barcodes
+func (p *ProductImporter) existingApplication(barcodes string) (*Product, error) {
+	for _, barcode := range splitBarcodes(barcodes) {
+		for _, status := range []int{ApplyStatusUnderReview, ApplyStatusApproved} {
+			applications, err := listApplications(p.Products, status, barcode)
+			if err != nil {
+				return nil, err
+			}
+			for _, application := range applications {
+				if application.ApplyStatus == status && hasBarcode(application, barcode) {
+					return &application, nil
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (p *ProductImporter) application(row ImportRow) (*NewProductApplication, error) {
+	application := &NewProductApplication{
+		Name:    row.Name,
+		Price:   row.Price,
+		Weight:  row.Weight,
+		QrCodes: row.Barcode,
+	}
+
+	var err error
+	if application.ImgFiles, application.ImgFileNames, err = p.readImages(row.Images); err != nil {
+		return nil, err
+	}
+	if application.PhysicalImgFiles, application.PhysicalImgFileNames, err = p.readImages(row.PhysicalImages); err != nil {
+		return nil, err
+	}
+	if row.WeightImage != "" {
+		if application.WeightFile, err = fs.ReadFile(p.Images, row.WeightImage); err != nil {
+			return nil, fmt.Errorf("weight image: %w", err)
+		}
+		application.WeightFileName = path.Base(row.WeightImage)
+	}
+	return application, nil
+}
+
+func (p *ProductImporter) readImages(paths []string) ([][]byte, []string, error) {
+	var files [][]byte
+	var names []string
+	for _, name := range paths {
+		data, err := fs.ReadFile(p.Images, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("image: %w", err)
+		}
+		files = append(files, data)
+		names = append(names, path.Base(name))
+	}
+	return files, names, nil
+}
+
+func (p *ProductImporter) report(result ImportResult) {
+	if p.OnResult != nil {
+		p.OnResult(result)
+	}
+}
+
+// WriteImportResults writes the results as CSV with a header row
+func WriteImportResults(w io.Writer, results []ImportResult) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"line", "name", "barcode", "status", "application_id", "error"}); err != nil {
+		return err
+	}
+	for _, result := range results {
+		id := ""
+		if result.ApplicationId != 0 {
+			id = strconv.Itoa(result.ApplicationId)
+		}
+		record := []string{strconv.Itoa(result.Line), result.Name, result.Barcode, string(result.Status), id, result.Error}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
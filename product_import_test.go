@@ -0,0 +1,177 @@
+package aifinitsdk
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeImportClient records submitted applications and lists them back by barcode
+type fakeImportClient struct {
+	ProductManageClient
+	mu           sync.Mutex
+	applications []Product
+}
+
+func (f *fakeImportClient) NewProductApplication(request *NewProductApplicationRequest) (*NewProductApplicationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := len(f.applications) + 100
+	f.applications = append(f.applications, Product{Id: id, QrCodes: request.Product.QrCodes, ApplyStatus: ApplyStatusUnderReview})
+	return &NewProductApplicationResponse{Status: 200, Data: id}, nil
+}
+
+func (f *fakeImportClient) ListProductApplication(params *ListProductApplicationParams) (*ListProductApplicationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matches []Product
+	for _, application := range f.applications {
+		if application.ApplyStatus == params.ApplyStatus && strings.Contains(application.QrCodes, params.QrCodes) {
+			matches = append(matches, application)
+		}
+	}
+	response := &ListProductApplicationResponse{Status: 200}
+	response.Data.Total = len(matches)
+	first := min((params.Page-1)*params.PageSize, len(matches))
+	response.Data.Rows = matches[first:min(first+params.PageSize, len(matches))]
+	return response, nil
+}
+
+func TestProductImporter_CSV(t *testing.T) {
+	images := fstest.MapFS{
+		"cola/front.jpg": {Data: encodeTestImage(t, "jpeg", 600, 600)},
+		"cola/side.jpg":  {Data: encodeTestImage(t, "jpeg", 600, 600)},
+		"cola/back.png":  {Data: encodeTestImage(t, "png", 600, 600)},
+	}
+	manifest := `name,price,weight,barcode,images,physical_images
+Cola,2.5,350,4006381333931,cola/front.jpg,cola/side.jpg;cola/back.png
+Water,cheap,500,96385074,cola/front.jpg,cola/side.jpg|cola/back.png
+Chips,3,120,036000291453,cola/front.jpg,cola/side.jpg;cola/back.png
+Juice,4,300,036000291452,cola/missing.jpg,cola/side.jpg;cola/back.png
+`
+	rows, err := ReadImportManifestCSV(strings.NewReader(manifest))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, []string{"cola/side.jpg", "cola/back.png"}, rows[1].PhysicalImages)
+
+	products := &fakeImportClient{}
+	importer := NewProductImporter(products, images)
+	results, err := importer.Import(context.Background(), rows)
+	assert.NoError(t, err)
+
+	statuses := []ImportStatus{}
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	assert.Equal(t, []ImportStatus{ImportStatusSubmitted, ImportStatusInvalid, ImportStatusInvalid, ImportStatusInvalid}, statuses)
+	assert.Equal(t, 100, results[0].ApplicationId)
+	assert.Contains(t, results[1].Error, "price")
+	assert.Contains(t, results[2].Error, "check digit")
+	assert.Contains(t, results[3].Error, "missing.jpg")
+
+	// Running again skips the barcode that already has a pending application
+	results, err = importer.Import(context.Background(), rows[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, ImportStatusSkipped, results[0].Status)
+	assert.Equal(t, 100, results[0].ApplicationId)
+	assert.Len(t, products.applications, 1)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteImportResults(&out, results))
+	assert.Equal(t, "line,name,barcode,status,application_id,error\n2,Cola,4006381333931,skipped,100,\n", out.String())
+}
+
+func TestProductImporter_DuplicateBarcodes(t *testing.T) {
+	images := fstest.MapFS{
+		"front.jpg": {Data: encodeTestImage(t, "jpeg", 600, 600)},
+		"side.jpg":  {Data: encodeTestImage(t, "jpeg", 600, 600)},
+		"back.png":  {Data: encodeTestImage(t, "png", 600, 600)},
+	}
+	manifest := `name,price,weight,barcode,images,physical_images
+Cola,cheap,350,4006381333931,front.jpg,side.jpg;back.png
+Cola,2.5,350,4006381333931,front.jpg,side.jpg;back.png
+Cola again,2.5,350,4006381333931,front.jpg,side.jpg;back.png
+Water,1.5,500,96385074,front.jpg,side.jpg;back.png
+`
+	rows, err := ReadImportManifestCSV(strings.NewReader(manifest))
+	assert.NoError(t, err)
+
+	products := &fakeImportClient{}
+	results, err := NewProductImporter(products, images).Import(context.Background(), rows)
+	assert.NoError(t, err)
+
+	statuses := []ImportStatus{}
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	// An invalid row does not claim its barcode; later repeats are skipped before anything is submitted
+	assert.Equal(t, []ImportStatus{ImportStatusInvalid, ImportStatusSubmitted, ImportStatusSkipped, ImportStatusSubmitted}, statuses)
+	assert.Contains(t, results[2].Error, "line 3")
+	assert.Len(t, products.applications, 2)
+}
+
+func TestProductImporter_ExistingApplications(t *testing.T) {
+	images := fstest.MapFS{
+		"front.jpg": {Data: encodeTestImage(t, "jpeg", 600, 600)},
+		"side.jpg":  {Data: encodeTestImage(t, "jpeg", 600, 600)},
+		"back.png":  {Data: encodeTestImage(t, "png", 600, 600)},
+	}
+	// The exact match comes after a page of partial ones, and carries the row's second barcode
+	products := &fakeImportClient{}
+	for i := range lookupPageSize {
+		products.applications = append(products.applications, Product{Id: i + 1, QrCodes: fmt.Sprintf("96385074%02d", i), ApplyStatus: ApplyStatusApproved})
+	}
+	products.applications = append(products.applications, Product{Id: 99, QrCodes: "96385074", ApplyStatus: ApplyStatusApproved})
+	manifest := `name,price,weight,barcode,images,physical_images
+Water,1.5,500,"4006381333931, 96385074",front.jpg,side.jpg;back.png
+`
+	rows, err := ReadImportManifestCSV(strings.NewReader(manifest))
+	assert.NoError(t, err)
+
+	results, err := NewProductImporter(products, images).Import(context.Background(), rows)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, ImportStatusSkipped, results[0].Status, results[0].Error)
+		assert.Equal(t, 99, results[0].ApplicationId)
+	}
+	assert.Len(t, products.applications, lookupPageSize+1)
+}
+
+func TestReadImportManifestXLSX(t *testing.T) {
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Products" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/products.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>name</t></si><si><t>price</t></si><si><t>barcode</t></si><si><r><t>Cola </t></r><r><t>330ml</t></r></si></sst>`,
+		"xl/worksheets/products.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="D1" t="s"><v>2</v></c></row>
+<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2"><v>2.5</v></c><c r="D2" t="inlineStr"><is><t>4006381333931</t></is></c></row>
+</sheetData></worksheet>`,
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(name)
+		assert.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	assert.NoError(t, archive.Close())
+
+	rows, err := ReadImportManifestXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "Cola 330ml", rows[0].Name)
+		assert.Equal(t, mnt(2.5), rows[0].Price)
+		assert.Equal(t, "4006381333931", rows[0].Barcode)
+	}
+}
@@ -0,0 +1,113 @@
+package aifinitsdk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Product application statuses used by ListProductApplicationParams.ApplyStatus and Product.ApplyStatus
+const (
+	ApplyStatusUnderReview = 1
+	ApplyStatusApproved    = 2
+	ApplyStatusRejected    = 3
+)
+
+// lookupPageSize is the page size FindByBarcode reads the platform lists with
+const lookupPageSize = 50
+
+// BarcodeLookup is the result of FindByBarcode
+type BarcodeLookup struct {
+	Barcode string
+	// Products are platform products that already carry the barcode
+	Products []Product
+	// PendingApplications are applications under review for the barcode that have not become products yet
+	PendingApplications []Product
+}
+
+// Available reports whether a new product application can be filed for the barcode
+func (l *BarcodeLookup) Available() bool {
+	return len(l.Products) == 0 && len(l.PendingApplications) == 0
+}
+
+// FindByBarcode looks a barcode up in the platform catalog and among pending product applications.
+// Applications that already turned into one of the found products are dropped, so each product
+// is reported once.
+func FindByBarcode(products ProductManageClient, barcode string) (*BarcodeLookup, error) {
+	barcode = strings.TrimSpace(barcode)
+	if barcode == "" {
+		return nil, NewAinfinitError(fmt.Errorf("barcode cannot be empty"))
+	}
+
+	lookup := &BarcodeLookup{Barcode: barcode}
+
+	// The filter matches partially, so a short barcode can match more than a page
+	var found []Product
+	for page := 1; ; page++ {
+		list, err := products.ProductListWithFilter(&ProductListPage{Page: page, Limit: lookupPageSize, QrCodes: barcode})
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, list.Data.Rows...)
+		if len(list.Data.Rows) < lookupPageSize || len(found) >= list.Data.Total {
+			break
+		}
+	}
+
+	known := make(map[string]bool)
+	for _, product := range found {
+		if hasBarcode(product, barcode) && !known[product.ItemCode] {
+			known[product.ItemCode] = true
+			lookup.Products = append(lookup.Products, product)
+		}
+	}
+
+	pending, err := listApplications(products, ApplyStatusUnderReview, barcode)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	for _, application := range pending {
+		if !hasBarcode(application, barcode) || seen[application.Id] {
+			continue
+		}
+		if application.ItemCode != "" && known[application.ItemCode] {
+			continue
+		}
+		seen[application.Id] = true
+		lookup.PendingApplications = append(lookup.PendingApplications, application)
+	}
+
+	return lookup, nil
+}
+
+// listApplications reads every page of the applications in a status whose barcodes match the
+// filter, which the platform matches partially
+func listApplications(products ProductManageClient, status int, barcode string) ([]Product, error) {
+	var applications []Product
+	for page := 1; ; page++ {
+		list, err := products.ListProductApplication(&ListProductApplicationParams{
+			Page:        page,
+			PageSize:    lookupPageSize,
+			ApplyStatus: status,
+			QrCodes:     barcode,
+		})
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, list.Data.Rows...)
+		if len(list.Data.Rows) < lookupPageSize || len(applications) >= list.Data.Total {
+			return applications, nil
+		}
+	}
+}
+
+// hasBarcode checks for an exact barcode match, since the platform filter may match partially
+func hasBarcode(product Product, barcode string) bool {
+	for _, code := range splitBarcodes(product.QrCodes) {
+		if code == barcode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package aifinitsdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"resty.dev/v3"
+)
+
+func TestProductListWithFilter_QueryParams(t *testing.T) {
+	restyClient := resty.New()
+	restyClient.SetTransport(RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		query := req.URL.Query()
+		assert.Equal(t, "2", query.Get("page"))
+		assert.Equal(t, "20", query.Get("limit"))
+		assert.Equal(t, "2024-03-01 08:30:00", query.Get("updatedTime"))
+		assert.Equal(t, "6934024500113", query.Get("qrCodes"))
+		assert.False(t, query.Has("goodsName"))
+
+		return jsonResponse(`{"status":200,"message":"OK","data":{"total":1,"rows":[
+			{"itemCode":"A","name":"Cola","updateTime":"2024-03-02 10:00:00","createTime":""}]}}`), nil
+	}))
+
+	products := &ProductClient{Client: &MockClient{RestyClient: restyClient}, Resty: restyClient}
+	response, err := products.ProductListWithFilter(&ProductListPage{
+		Page:        2,
+		Limit:       20,
+		UpdatedTime: time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC),
+		QrCodes:     "6934024500113",
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, response.Data.Rows, 1) {
+		row := response.Data.Rows[0]
+		assert.True(t, row.UpdateTime.Equal(time.Date(2024, 3, 2, 2, 0, 0, 0, time.UTC)))
+		assert.True(t, row.CreateTime.IsZero())
+
+		body, _ := json.Marshal(row)
+		assert.Contains(t, string(body), `"updateTime":"2024-03-02 10:00:00"`)
+	}
+}
+
+func TestFindByBarcode(t *testing.T) {
+	products := &fakeProductClient{
+		products: []Product{
+			{ItemCode: "A", Name: "Cola", QrCodes: "6934024500113"},
+			{ItemCode: "B", Name: "Cola multipack", QrCodes: "69340245001130"},
+		},
+		applications: []Product{
+			{Id: 1, Name: "Cola", QrCodes: "6934024500113", ItemCode: "A", ApplyStatus: ApplyStatusUnderReview},
+			{Id: 2, Name: "Cola new label", QrCodes: "6934024500113", ApplyStatus: ApplyStatusUnderReview},
+			{Id: 3, Name: "Cola rejected", QrCodes: "6934024500113", ApplyStatus: ApplyStatusRejected},
+		},
+	}
+
+	lookup, err := FindByBarcode(products, " 6934024500113 ")
+	assert.NoError(t, err)
+	assert.False(t, lookup.Available())
+	if assert.Len(t, lookup.Products, 1) {
+		assert.Equal(t, "A", lookup.Products[0].ItemCode)
+	}
+	if assert.Len(t, lookup.PendingApplications, 1) {
+		assert.Equal(t, 2, lookup.PendingApplications[0].Id)
+	}
+
+	lookup, err = FindByBarcode(products, "4006381333931")
+	assert.NoError(t, err)
+	assert.True(t, lookup.Available())
+
+	_, err = FindByBarcode(products, "")
+	assert.Error(t, err)
+
+	// Exact matches behind a page of partial ones are still found
+	products = &fakeProductClient{}
+	for i := range lookupPageSize + 10 {
+		products.products = append(products.products, Product{ItemCode: fmt.Sprintf("P%d", i), QrCodes: fmt.Sprintf("1234%d", i)})
+		products.applications = append(products.applications, Product{Id: i, QrCodes: fmt.Sprintf("1234%d", i), ApplyStatus: ApplyStatusUnderReview})
+	}
+	products.products = append(products.products, Product{ItemCode: "X", QrCodes: "1234"})
+	products.applications = append(products.applications, Product{Id: 100, QrCodes: "1234", ApplyStatus: ApplyStatusUnderReview})
+	lookup, err = FindByBarcode(products, "1234")
+	assert.NoError(t, err)
+	if assert.Len(t, lookup.Products, 1) {
+		assert.Equal(t, "X", lookup.Products[0].ItemCode)
+	}
+	if assert.Len(t, lookup.PendingApplications, 1) {
+		assert.Equal(t, 100, lookup.PendingApplications[0].Id)
+	}
+}
+
+func jsonResponse(body string) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     header,
+	}
+}
@@ -1,7 +1,6 @@
 package aifinitsdk
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -14,6 +13,7 @@ import (
 type ProductManageClient interface {
 	LastInfo() (*LastInfoResponse, error)
 	ProductList(page, limit int) (*ProductListResponse, error)
+	ProductListWithFilter(filter *ProductListPage) (*ProductListResponse, error)
 	ProductDetail(itemCode string) (*ProductDetailResponse, error)
 	MutualExclusion(request *MutualExclusionRequest) (*MutualExclusionResponse, error)
 	NewProductApplication(request *NewProductApplicationRequest) (*NewProductApplicationResponse, error)
@@ -25,18 +25,34 @@ type ProductManageClient interface {
 type ProductClient struct {
 	Client Client
 	Resty  *resty.Client
+	// ImagePipeline, when set, processes product application images before upload
+	ImagePipeline *ImagePipeline
 }
 
-func NewProductClient(client Client) ProductManageClient {
+// ProductClientOption configures optional behaviour of the product client
+type ProductClientOption func(*ProductClient)
+
+// WithImagePipeline runs every product application image through the pipeline before upload
+func WithImagePipeline(pipeline *ImagePipeline) ProductClientOption {
+	return func(c *ProductClient) {
+		c.ImagePipeline = pipeline
+	}
+}
+
+func NewProductClient(client Client, opts ...ProductClientOption) ProductManageClient {
 	restyClient := client.GetRestyClient()
 	if client.RestyDebug() {
 		restyClient.SetDebug(true)
 	}
 
-	return &ProductClient{
+	c := &ProductClient{
 		Client: client,
 		Resty:  restyClient,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *ProductClient) LastInfo() (*LastInfoResponse, error) {
@@ -73,11 +89,12 @@ func (c *ProductClient) LastInfo() (*LastInfoResponse, error) {
 }
 
 func (c *ProductClient) ProductList(page, limit int) (*ProductListResponse, error) {
+	return c.ProductListWithFilter(&ProductListPage{Page: page, Limit: limit})
+}
+
+func (c *ProductClient) ProductListWithFilter(filter *ProductListPage) (*ProductListResponse, error) {
 	if c.Client.IsDebug() {
-		logrus.WithFields(logrus.Fields{
-			"page":  page,
-			"limit": limit,
-		}).Debug("Getting product list")
+		logrus.WithField("filter", filter).Debug("Getting product list")
 	}
 
 	signature, err := c.Client.GetSignature(time.Now().UnixMilli())
@@ -86,7 +103,29 @@ func (c *ProductClient) ProductList(page, limit int) (*ProductListResponse, erro
 	}
 
 	var products *ProductListResponse
-	resp, err := c.Resty.R().SetHeader("Authorization", signature).SetResult(&products).Get(Get_ProductList)
+	req := c.Resty.R().SetHeader("Authorization", signature)
+
+	if filter.Page != 0 {
+		req.SetQueryParam("page", fmt.Sprintf("%d", filter.Page))
+	}
+
+	if filter.Limit != 0 {
+		req.SetQueryParam("limit", fmt.Sprintf("%d", filter.Limit))
+	}
+
+	if !filter.UpdatedTime.IsZero() {
+		req.SetQueryParam("updatedTime", DateTime{Time: filter.UpdatedTime}.StringIn(c.Client.Location()))
+	}
+
+	if filter.GoodsName != "" {
+		req.SetQueryParam("goodsName", filter.GoodsName)
+	}
+
+	if filter.QrCodes != "" {
+		req.SetQueryParam("qrCodes", filter.QrCodes)
+	}
+
+	resp, err := req.SetResult(&products).Get(Get_ProductList)
 	if err != nil {
 		return nil, NewAinfinitError(err)
 	}
@@ -190,10 +229,18 @@ func (c *ProductClient) NewProductApplication(request *NewProductApplicationRequ
 		return nil, NewAinfinitError(fmt.Errorf("name cannot be empty"))
 	}
 
-	if request.Product.Price <= 0 {
+	if !request.Product.Price.IsPositive() {
 		return nil, NewAinfinitError(fmt.Errorf("price must be greater than 0"))
 	}
 
+	if c.ImagePipeline != nil {
+		product, err := c.ImagePipeline.PrepareProductApplication(request.Product)
+		if err != nil {
+			return nil, err
+		}
+		request = &NewProductApplicationRequest{Product: product, OnProgress: request.OnProgress}
+	}
+
 	if c.Client.IsDebug() {
 		logrus.WithField("request", request).Debug("Creating new product application")
 	}
@@ -215,25 +262,23 @@ func (c *ProductClient) NewProductApplication(request *NewProductApplicationRequ
 		return nil, NewAinfinitError(fmt.Errorf("image files and names must be the same length"))
 	}
 
-	for i, img := range request.Product.ImgFiles {
-		if img != nil {
-			req = req.SetFileReader("file", request.Product.ImgFileNames[i], bytes.NewReader(img))
-		}
-	}
-
 	if len(request.Product.PhysicalImgFiles) != len(request.Product.PhysicalImgFileNames) {
 		return nil, NewAinfinitError(fmt.Errorf("actual image files and names must be the same length"))
 	}
 
-	for i, img := range request.Product.PhysicalImgFiles {
-		if img != nil {
-			req = req.SetFileReader("files", request.Product.PhysicalImgFileNames[i], bytes.NewReader(img))
-		}
-	}
-
+	// Byte slices and streamed sources share one multipart body; sources are read while it is sent
+	var parts []uploadPart
+	parts = append(parts, byteParts("file", request.Product.ImgFiles, request.Product.ImgFileNames)...)
+	parts = append(parts, sourceParts("file", request.Product.ImgSources)...)
+	parts = append(parts, byteParts("files", request.Product.PhysicalImgFiles, request.Product.PhysicalImgFileNames)...)
+	parts = append(parts, sourceParts("files", request.Product.PhysicalImgSources)...)
 	if request.Product.WeightFile != nil {
-		req = req.SetFileReader("weightFile", request.Product.WeightFileName, bytes.NewReader(request.Product.WeightFile))
+		parts = append(parts, uploadPart{field: "weightFile", source: FileFromBytes(request.Product.WeightFileName, request.Product.WeightFile)})
+	} else if request.Product.WeightSource != nil {
+		parts = append(parts, uploadPart{field: "weightFile", source: *request.Product.WeightSource})
 	}
+	closeParts := setUploadParts(req, parts, request.OnProgress)
+	defer closeParts()
 
 	resp, err := req.SetResult(&newProductApplication).Post(Post_NewProductApplication)
 	if err != nil {
@@ -338,6 +383,14 @@ func (c *ProductClient) UpdateProductApplication(itemCode string, request *Updat
 		return nil, NewAinfinitError(fmt.Errorf("id cannot be 0"))
 	}
 
+	if c.ImagePipeline != nil {
+		item, err := c.ImagePipeline.PrepareProductApplicationUpdate(request.Item)
+		if err != nil {
+			return nil, err
+		}
+		request = &UpdateProductApplicationRequest{Item: item, OnProgress: request.OnProgress}
+	}
+
 	signature, err := c.Client.GetSignature(time.Now().UnixMilli())
 	if err != nil {
 		return nil, NewAinfinitError(err)
@@ -354,25 +407,23 @@ func (c *ProductClient) UpdateProductApplication(itemCode string, request *Updat
 		return nil, NewAinfinitError(fmt.Errorf("image files and names must be the same length"))
 	}
 
-	for i, img := range request.Item.ImgFiles {
-		if img != nil {
-			req = req.SetFileReader("file", request.Item.ImgFileNames[i], bytes.NewReader(img))
-		}
-	}
-
 	if len(request.Item.PhysicalImgFiles) != len(request.Item.PhysicalImgFileNames) {
 		return nil, NewAinfinitError(fmt.Errorf("actual image files and names must be the same length"))
 	}
 
-	for i, img := range request.Item.PhysicalImgFiles {
-		if img != nil {
-			req = req.SetFileReader("files", request.Item.PhysicalImgFileNames[i], bytes.NewReader(img))
-		}
-	}
-
+	// Byte slices and streamed sources share one multipart body; sources are read while it is sent
+	var parts []uploadPart
+	parts = append(parts, byteParts("file", request.Item.ImgFiles, request.Item.ImgFileNames)...)
+	parts = append(parts, sourceParts("file", request.Item.ImgSources)...)
+	parts = append(parts, byteParts("files", request.Item.PhysicalImgFiles, request.Item.PhysicalImgFileNames)...)
+	parts = append(parts, sourceParts("files", request.Item.PhysicalImgSources)...)
 	if request.Item.WeightFile != nil {
-		req = req.SetFileReader("weightFile", request.Item.WeightFileName, bytes.NewReader(request.Item.WeightFile))
+		parts = append(parts, uploadPart{field: "weightFile", source: FileFromBytes(request.Item.WeightFileName, request.Item.WeightFile)})
+	} else if request.Item.WeightSource != nil {
+		parts = append(parts, uploadPart{field: "weightFile", source: *request.Item.WeightSource})
 	}
+	closeParts := setUploadParts(req, parts, request.OnProgress)
+	defer closeParts()
 
 	var updateProductApplication *UpdateProductApplicationResponse
 	resp, err := req.SetResult(&updateProductApplication).Put(Put_UpdateProductAppication)
@@ -400,26 +451,26 @@ func (c *ProductClient) UpdateProductApplication(itemCode string, request *Updat
 // ENTITIES
 
 type Product struct {
-	Id             int      `json:"id"`             // Application ID
-	Name           string   `json:"name"`           // Product name
-	Price          int      `json:"price"`          // Suggested retail price in cents
-	Weight         int      `json:"weight"`         // Product weight in grams
-	WeightVariance int      `json:"weightVariance"` // Acceptable weight variance in grams
-	ImgUrl         string   `json:"imgUrl"`         // URL to the main product image
-	ItemCode       string   `json:"itemCode"`       // Unique product code (only available after approval)
-	CollType       int      `json:"collType"`       // Collection type: 1 - single item, 2 - collection/multiple items
-	UpdateTime     string   `json:"updateTime"`     // Last update time in "YYYY-MM-DD HH:MM:SS" format
-	CreateTime     string   `json:"createTime"`     // Creation time in "YYYY-MM-DD HH:MM:SS" format
-	Status         int      `json:"status"`         // Product status: 1 - available, 2 - unavailable
-	QrCodes        string   `json:"qrCodes"`        // Product barcode (e.g., "6934024500113")
-	ItemCodes      []string `json:"itemCodes"`      // List of item codes included in this product if it's a collection
-	ActualImgs     []string `json:"actualImgs"`     // List of URLs to actual/real product images
-	WeightFile     string   `json:"weightFile"`     // Path or URL to a file containing detailed weight data
-	ApplyStatus    int      `json:"applyStatus"`    // Application status: 1 - under review, 2 - approved, 3 - rejected
-	ApplyTime      string   `json:"applyTime"`      // Application submission time in "YYYY-MM-DD HH:MM:SS" format
-	RejectType     string   `json:"rejectType"`     // Rejection type: "1" - name non-compliant, "2" - barcode non-compliant, "3" - display image unclear, "4" - other
-	RejectReason   string   `json:"rejectReason"`   // Rejection reason
-	WeightImgUrl   string   `json:"weightImgUrl"`   // URL to the weight image
+	Id             int        `json:"id"`             // Application ID
+	Name           string     `json:"name"`           // Product name
+	Price          MinorMoney `json:"price"`          // Suggested retail price in cents
+	Weight         int        `json:"weight"`         // Product weight in grams
+	WeightVariance int        `json:"weightVariance"` // Acceptable weight variance in grams
+	ImgUrl         string     `json:"imgUrl"`         // URL to the main product image
+	ItemCode       string     `json:"itemCode"`       // Unique product code (only available after approval)
+	CollType       int        `json:"collType"`       // Collection type: 1 - single item, 2 - collection/multiple items
+	UpdateTime     DateTime   `json:"updateTime"`     // Last update time, "YYYY-MM-DD HH:MM:SS" on the wire
+	CreateTime     DateTime   `json:"createTime"`     // Creation time, "YYYY-MM-DD HH:MM:SS" on the wire
+	Status         int        `json:"status"`         // Product status: 1 - available, 2 - unavailable
+	QrCodes        string     `json:"qrCodes"`        // Product barcode (e.g., "6934024500113")
+	ItemCodes      []string   `json:"itemCodes"`      // List of item codes included in this product if it's a collection
+	ActualImgs     []string   `json:"actualImgs"`     // List of URLs to actual/real product images
+	WeightFile     string     `json:"weightFile"`     // Path or URL to a file containing detailed weight data
+	ApplyStatus    int        `json:"applyStatus"`    // Application status: 1 - under review, 2 - approved, 3 - rejected
+	ApplyTime      DateTime   `json:"applyTime"`      // Application submission time, "YYYY-MM-DD HH:MM:SS" on the wire
+	RejectType     string     `json:"rejectType"`     // Rejection type: "1" - name non-compliant, "2" - barcode non-compliant, "3" - display image unclear, "4" - other
+	RejectReason   string     `json:"rejectReason"`   // Rejection reason
+	WeightImgUrl   string     `json:"weightImgUrl"`   // URL to the weight image
 }
 
 func (p *Product) String() string {
@@ -431,10 +482,10 @@ func (p *Product) String() string {
 }
 
 type UpdateProductApplication struct {
-	Id      int    `json:"id"`
-	Price   int    `json:"price"`
-	Weight  int    `json:"weight"`
-	QrCodes string `json:"qrCodes"`
+	Id      int        `json:"id"`
+	Price   MinorMoney `json:"price"` // in cents, like Product.Price
+	Weight  int        `json:"weight"`
+	QrCodes string     `json:"qrCodes"`
 
 	ImgFiles     [][]byte `json:"-"` // product image files
 	ImgFileNames []string `json:"-"` // product image file names
@@ -443,6 +494,12 @@ type UpdateProductApplication struct {
 	PhysicalImgFileNames []string `json:"-"` // physical image file names IMPORTANT: at least 2 and bar code clearly visible
 	WeightFile           []byte   `json:"-"` // weight image file
 	WeightFileName       string   `json:"-"` // weight image file name
+
+	// Streamed alternatives to the byte slices above, uploaded after them without being loaded into memory.
+	// The image pipeline and the pre-submission validator only see the byte slices.
+	ImgSources         []FileSource `json:"-"` // product images
+	PhysicalImgSources []FileSource `json:"-"` // physical images, counted towards the minimum of 2
+	WeightSource       *FileSource  `json:"-"` // weight image, used when WeightFile is nil
 }
 
 func (u *UpdateProductApplication) String() string {
@@ -455,7 +512,7 @@ func (u *UpdateProductApplication) String() string {
 
 type NewProductApplication struct {
 	Name    string  `json:"name"`
-	Price   float64 `json:"price"`
+	Price   Money   `json:"price"` // in major units, e.g. 12.5
 	Weight  float64 `json:"weight"`
 	QrCodes string  `json:"qrCodes"`
 
@@ -466,6 +523,12 @@ type NewProductApplication struct {
 	PhysicalImgFileNames []string `json:"-"` // physical image file names IMPORTANT: at least 2 and bar code clearly visible
 	WeightFile           []byte   `json:"-"` // weight image file
 	WeightFileName       string   `json:"-"` // weight image file name
+
+	// Streamed alternatives to the byte slices above, uploaded after them without being loaded into memory.
+	// The image pipeline and the pre-submission validator only see the byte slices.
+	ImgSources         []FileSource `json:"-"` // product images
+	PhysicalImgSources []FileSource `json:"-"` // physical images, counted towards the minimum of 2
+	WeightSource       *FileSource  `json:"-"` // weight image, used when WeightFile is nil
 }
 
 func (n *NewProductApplication) String() string {
@@ -477,16 +540,18 @@ func (n *NewProductApplication) String() string {
 }
 
 type LastInfo struct {
-	Count          int   `json:"count"`
-	LastUpdateTime int64 `json:"lastUpdateTime"`
+	Count          int    `json:"count"`
+	LastUpdateTime Millis `json:"lastUpdateTime"`
 }
 
+// ProductListPage holds the query parameters supported by the product list endpoint.
+// Zero values are not sent.
 type ProductListPage struct {
-	Page        int    `json:"page,omitempty"`
-	Limit       int    `json:"limit,omitempty"`
-	UpdatedTime string `json:"updatedTime,omitempty"`
-	GoodsName   string `json:"goodsName,omitempty"`
-	QrCodes     string `json:"qrCodes,omitempty"`
+	Page        int       `json:"page,omitempty"`
+	Limit       int       `json:"limit,omitempty"`
+	UpdatedTime time.Time `json:"updatedTime,omitzero"` // only products updated since this time
+	GoodsName   string    `json:"goodsName,omitempty"`
+	QrCodes     string    `json:"qrCodes,omitempty"` // barcode
 }
 
 type MutualExclusionRequest struct {
@@ -495,6 +560,8 @@ type MutualExclusionRequest struct {
 
 type NewProductApplicationRequest struct {
 	Product *NewProductApplication `json:"item,omitempty"`
+	// OnProgress, when set, receives upload progress for every file
+	OnProgress UploadProgressFunc `json:"-"`
 }
 
 type ListProductApplicationParams struct {
@@ -507,6 +574,8 @@ type ListProductApplicationParams struct {
 
 type UpdateProductApplicationRequest struct {
 	Item *UpdateProductApplication `json:"item,omitempty"`
+	// OnProgress, when set, receives upload progress for every file
+	OnProgress UploadProgressFunc `json:"-"`
 }
 
 type ProductListResponse struct {
@@ -0,0 +1,258 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register JPEG decoder for image checks
+	_ "image/png"  // register PNG decoder for image checks
+	"strings"
+)
+
+// ProductApplicationRules are the local checks run before a product application is uploaded
+type ProductApplicationRules struct {
+	// MinImageWidth and MinImageHeight are the smallest accepted image dimensions in pixels
+	MinImageWidth  int
+	MinImageHeight int
+	// MaxImageBytes is the largest accepted image file size
+	MaxImageBytes int
+	// MinAspectRatio and MaxAspectRatio bound width/height
+	MinAspectRatio float64
+	MaxAspectRatio float64
+	// AllowedFormats are the accepted image formats as reported by image.DecodeConfig
+	AllowedFormats []string
+	// MinPhysicalImages is the number of physical photos required (the platform asks for at least 2)
+	MinPhysicalImages int
+	// MinWeight and MaxWeight bound the product weight in grams
+	MinWeight float64
+	MaxWeight float64
+}
+
+// DefaultProductApplicationRules returns rules matching the platform review guidelines
+func DefaultProductApplicationRules() ProductApplicationRules {
+	return ProductApplicationRules{
+		MinImageWidth:     500,
+		MinImageHeight:    500,
+		MaxImageBytes:     5 << 20,
+		MinAspectRatio:    0.5,
+		MaxAspectRatio:    2,
+		AllowedFormats:    []string{"jpeg", "png"},
+		MinPhysicalImages: 2,
+		MinWeight:         1,
+		MaxWeight:         30000,
+	}
+}
+
+// ValidationProblem is a single issue found by a pre-flight check
+type ValidationProblem struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ProductApplicationValidationError lists every problem found in a product application
+type ProductApplicationValidationError struct {
+	Problems []ValidationProblem
+}
+
+func (e *ProductApplicationValidationError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		messages = append(messages, fmt.Sprintf("%s: %s", problem.Field, problem.Message))
+	}
+	return fmt.Sprintf("product application has %d problem(s): %s", len(e.Problems), strings.Join(messages, "; "))
+}
+
+type applicationValidator struct {
+	rules    ProductApplicationRules
+	problems []ValidationProblem
+}
+
+func (v *applicationValidator) add(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, ValidationProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *applicationValidator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ProductApplicationValidationError{Problems: v.problems}
+}
+
+// ValidateProductApplication checks a new product application locally and returns every problem at once.
+// The error is a *ProductApplicationValidationError.
+func ValidateProductApplication(application *NewProductApplication, rules ProductApplicationRules) error {
+	v := &applicationValidator{rules: rules}
+	if application == nil {
+		v.add("item", "product cannot be nil")
+		return v.err()
+	}
+
+	if strings.TrimSpace(application.Name) == "" {
+		v.add("name", "cannot be empty")
+	}
+	if !application.Price.IsPositive() {
+		v.add("price", "must be greater than 0")
+	}
+	v.checkWeight(application.Weight)
+	v.checkBarcodes(application.QrCodes)
+
+	if len(application.ImgFiles)+len(application.ImgSources) == 0 {
+		v.add("file", "at least one product image is required")
+	}
+	v.checkImages("file", application.ImgFiles, application.ImgFileNames)
+	v.checkPhysicalImages(application.PhysicalImgFiles, application.PhysicalImgFileNames, len(application.PhysicalImgSources))
+	v.checkWeightFile(application.WeightFile, application.WeightFileName)
+
+	return v.err()
+}
+
+// ValidateProductApplicationUpdate checks a product application update locally.
+// Images are optional on update, but the ones given must pass the same checks.
+func ValidateProductApplicationUpdate(application *UpdateProductApplication, rules ProductApplicationRules) error {
+	v := &applicationValidator{rules: rules}
+	if application == nil {
+		v.add("item", "product cannot be nil")
+		return v.err()
+	}
+
+	if application.Id == 0 {
+		v.add("id", "cannot be 0")
+	}
+	if application.Price.IsNegative() {
+		v.add("price", "cannot be negative")
+	}
+	if application.Weight != 0 {
+		v.checkWeight(float64(application.Weight))
+	}
+	v.checkBarcodes(application.QrCodes)
+
+	v.checkImages("file", application.ImgFiles, application.ImgFileNames)
+	if len(application.PhysicalImgFiles)+len(application.PhysicalImgSources) > 0 {
+		v.checkPhysicalImages(application.PhysicalImgFiles, application.PhysicalImgFileNames, len(application.PhysicalImgSources))
+	}
+	v.checkWeightFile(application.WeightFile, application.WeightFileName)
+
+	return v.err()
+}
+
+func (v *applicationValidator) checkWeight(weight float64) {
+	if weight < v.rules.MinWeight || (v.rules.MaxWeight > 0 && weight > v.rules.MaxWeight) {
+		v.add("weight", "%.0fg is outside the plausible range %.0f-%.0fg", weight, v.rules.MinWeight, v.rules.MaxWeight)
+	}
+}
+
+func (v *applicationValidator) checkBarcodes(qrCodes string) {
+	barcodes := splitBarcodes(qrCodes)
+	if len(barcodes) == 0 {
+		v.add("qrCodes", "barcode is required")
+	}
+	for _, barcode := range barcodes {
+		if err := ValidateBarcode(barcode); err != nil {
+			v.add("qrCodes", "%v", err)
+		}
+	}
+}
+
+// checkPhysicalImages decodes the in-memory images; streamed ones only count towards the minimum
+func (v *applicationValidator) checkPhysicalImages(files [][]byte, names []string, streamed int) {
+	if count := len(files) + streamed; count < v.rules.MinPhysicalImages {
+		v.add("files", "at least %d physical images with the barcode visible are required, got %d", v.rules.MinPhysicalImages, count)
+	}
+	v.checkImages("files", files, names)
+}
+
+func (v *applicationValidator) checkWeightFile(file []byte, name string) {
+	if file == nil {
+		return
+	}
+	if name == "" {
+		v.add("weightFile", "file name is required")
+	}
+	v.checkImage("weightFile", name, file)
+}
+
+func (v *applicationValidator) checkImages(field string, files [][]byte, names []string) {
+	if len(files) != len(names) {
+		v.add(field, "%d files but %d file names", len(files), len(names))
+	}
+	for i, file := range files {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		v.checkImage(fmt.Sprintf("%s[%d]", field, i), name, file)
+	}
+}
+
+func (v *applicationValidator) checkImage(field, name string, data []byte) {
+	if name != "" {
+		field = fmt.Sprintf("%s (%s)", field, name)
+	}
+	if len(data) == 0 {
+		v.add(field, "image is empty")
+		return
+	}
+	if v.rules.MaxImageBytes > 0 && len(data) > v.rules.MaxImageBytes {
+		v.add(field, "image is %d bytes, limit is %d", len(data), v.rules.MaxImageBytes)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		v.add(field, "cannot decode image: %v", err)
+		return
+	}
+
+	if len(v.rules.AllowedFormats) > 0 && !containsString(v.rules.AllowedFormats, format) {
+		v.add(field, "format %s is not accepted, use %s", format, strings.Join(v.rules.AllowedFormats, " or "))
+	}
+	if config.Width < v.rules.MinImageWidth || config.Height < v.rules.MinImageHeight {
+		v.add(field, "resolution %dx%d is below the minimum %dx%d", config.Width, config.Height, v.rules.MinImageWidth, v.rules.MinImageHeight)
+	}
+	if config.Height > 0 && v.rules.MaxAspectRatio > 0 {
+		ratio := float64(config.Width) / float64(config.Height)
+		if ratio < v.rules.MinAspectRatio || ratio > v.rules.MaxAspectRatio {
+			v.add(field, "aspect ratio %.2f is outside %.2f-%.2f", ratio, v.rules.MinAspectRatio, v.rules.MaxAspectRatio)
+		}
+	}
+}
+
+// ValidateBarcode checks the length and check digit of an EAN-8, UPC-A or EAN-13 barcode
+func ValidateBarcode(barcode string) error {
+	for _, r := range barcode {
+		if r < '0' || r > '9' {
+			return fmt.Errorf("barcode %q must contain digits only", barcode)
+		}
+	}
+
+	switch len(barcode) {
+	case 8, 12, 13:
+	default:
+		return fmt.Errorf("barcode %q has %d digits, expected 8 (EAN-8), 12 (UPC-A) or 13 (EAN-13)", barcode, len(barcode))
+	}
+
+	// Weights alternate 3,1 starting from the digit next to the check digit
+	sum := 0
+	body := barcode[:len(barcode)-1]
+	for i := len(body) - 1; i >= 0; i-- {
+		digit := int(body[i] - '0')
+		if (len(body)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	check := (10 - sum%10) % 10
+
+	if got := int(barcode[len(barcode)-1] - '0'); got != check {
+		return fmt.Errorf("barcode %q has check digit %d, expected %d", barcode, got, check)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
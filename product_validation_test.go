@@ -0,0 +1,106 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateBarcode(t *testing.T) {
+	valid := []string{"4006381333931", "96385074", "036000291452", "6934024500113"}
+	for _, barcode := range valid {
+		assert.NoError(t, ValidateBarcode(barcode), barcode)
+	}
+
+	invalid := []string{"4006381333932", "96385075", "036000291453", "12345", "69340245OO113", ""}
+	for _, barcode := range invalid {
+		assert.Error(t, ValidateBarcode(barcode), barcode)
+	}
+}
+
+func TestValidateProductApplication_Valid(t *testing.T) {
+	application := &NewProductApplication{
+		Name:                 "Cola 330ml",
+		Price:                mnt(2.5),
+		Weight:               350,
+		QrCodes:              "4006381333931",
+		ImgFiles:             [][]byte{encodeTestImage(t, "jpeg", 600, 600)},
+		ImgFileNames:         []string{"front.jpg"},
+		PhysicalImgFiles:     [][]byte{encodeTestImage(t, "jpeg", 800, 600), encodeTestImage(t, "png", 600, 800)},
+		PhysicalImgFileNames: []string{"side.jpg", "barcode.png"},
+	}
+
+	assert.NoError(t, ValidateProductApplication(application, DefaultProductApplicationRules()))
+}
+
+func TestValidateProductApplication_ReportsAllProblems(t *testing.T) {
+	application := &NewProductApplication{
+		Name:                 "",
+		Price:                mnt(0),
+		Weight:               90000,
+		QrCodes:              "4006381333932",
+		ImgFiles:             [][]byte{encodeTestImage(t, "gif", 600, 600)},
+		ImgFileNames:         []string{"front.gif", "extra.jpg"},
+		PhysicalImgFiles:     [][]byte{encodeTestImage(t, "jpeg", 1200, 300)},
+		PhysicalImgFileNames: []string{"blurry.jpg"},
+		WeightFile:           []byte("not an image"),
+		WeightFileName:       "weight.jpg",
+	}
+
+	err := ValidateProductApplication(application, DefaultProductApplicationRules())
+	var validationErr *ProductApplicationValidationError
+	if !assert.True(t, errors.As(err, &validationErr)) {
+		return
+	}
+
+	fields := map[string]bool{}
+	for _, problem := range validationErr.Problems {
+		fields[problem.Field] = true
+	}
+	for _, field := range []string{
+		"name", "price", "weight", "qrCodes", "file",
+		"file[0] (front.gif)", "files", "files[0] (blurry.jpg)", "weightFile (weight.jpg)",
+	} {
+		assert.True(t, fields[field], "expected a problem for %s in %v", field, validationErr.Problems)
+	}
+}
+
+func TestValidateProductApplicationUpdate(t *testing.T) {
+	update := &UpdateProductApplication{Id: 12, QrCodes: "96385074"}
+	assert.NoError(t, ValidateProductApplicationUpdate(update, DefaultProductApplicationRules()))
+
+	update.PhysicalImgFiles = [][]byte{encodeTestImage(t, "jpeg", 100, 100)}
+	update.PhysicalImgFileNames = []string{"small.jpg"}
+	assert.Error(t, ValidateProductApplicationUpdate(update, DefaultProductApplicationRules()))
+}
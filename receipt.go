@@ -0,0 +1,415 @@
+package aifinitsdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MerchantHeader is printed at the top of every receipt
+type MerchantHeader struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	TaxID   string `json:"taxId,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+	Footer  string `json:"footer,omitempty"` // printed at the bottom, e.g. a thank-you note
+}
+
+// TaxRule is one tax applied to receipt lines. A rule without item codes applies to every line not
+// claimed by another rule; several rules may apply to the same line.
+type TaxRule struct {
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"` // e.g. 0.1 for 10%
+	// Inclusive rules are already part of the item prices; exclusive rules are added to the total
+	Inclusive bool     `json:"inclusive"`
+	ItemCodes []string `json:"itemCodes,omitempty"`
+}
+
+// ReceiptLine is one item on a receipt
+type ReceiptLine struct {
+	ItemCode  string   `json:"itemCode"`
+	Name      string   `json:"name"`
+	Count     int      `json:"count"`
+	UnitPrice Money    `json:"unitPrice"`
+	Amount    Money    `json:"amount"`
+	Taxes     []string `json:"taxes,omitempty"` // names of the rules applied
+}
+
+// ReceiptTax is the total of one tax rule on a receipt
+type ReceiptTax struct {
+	Name      string  `json:"name"`
+	Rate      float64 `json:"rate"`
+	Inclusive bool    `json:"inclusive"`
+	Base      Money   `json:"base"`   // taxable amount, excluding the tax
+	Amount    Money   `json:"amount"` // tax
+}
+
+// FiscalRecord is the tax authority's registration of a receipt
+type FiscalRecord struct {
+	ID          string    `json:"id"`
+	QRData      string    `json:"qrData,omitempty"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// FiscalSubmitter registers receipts with the tax authority
+type FiscalSubmitter interface {
+	Submit(ctx context.Context, receipt *Receipt) (*FiscalRecord, error)
+}
+
+// LocalFiscalSubmitter stands in for the tax authority API: it numbers receipts sequentially and
+// keeps them in memory
+type LocalFiscalSubmitter struct {
+	Prefix string // defaults to "LOCAL"
+
+	mu       sync.Mutex
+	receipts []Receipt
+	now      func() time.Time
+}
+
+func (s *LocalFiscalSubmitter) Submit(ctx context.Context, receipt *Receipt) (*FiscalRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "LOCAL"
+	}
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	s.receipts = append(s.receipts, *receipt)
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", receipt.OrderCode, receipt.VmCode, receipt.Total)))
+	return &FiscalRecord{
+		ID:          fmt.Sprintf("%s-%06d", prefix, len(s.receipts)),
+		QRData:      hex.EncodeToString(digest[:16]),
+		SubmittedAt: now(),
+	}, nil
+}
+
+// Receipts returns the submitted receipts in order
+func (s *LocalFiscalSubmitter) Receipts() []Receipt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Receipt(nil), s.receipts...)
+}
+
+// Receipt is a customer receipt for a settled order
+type Receipt struct {
+	OrderCode   string         `json:"orderCode"`
+	VmCode      string         `json:"vmCode"`
+	MachineName string         `json:"machineName,omitempty"`
+	Location    string         `json:"location,omitempty"`
+	IssuedAt    time.Time      `json:"issuedAt"` // close door time
+	Merchant    MerchantHeader `json:"merchant"`
+	Lines       []ReceiptLine  `json:"lines"`
+	Subtotal    Money          `json:"subtotal"` // sum of the lines
+	Taxes       []ReceiptTax   `json:"taxes,omitempty"`
+	Total       Money          `json:"total"` // subtotal plus exclusive taxes
+	Currency    CurrencyFormat `json:"currency"`
+	Fiscal      *FiscalRecord  `json:"fiscal,omitempty"`
+}
+
+// ReceiptBuilder turns settled orders into receipts. Machine names and locations come from
+// DeviceInfo and are cached per machine.
+type ReceiptBuilder struct {
+	// Devices, when set, supplies machine names and locations
+	Devices  VendingMachineManageClient
+	Merchant MerchantHeader
+	TaxRules []TaxRule
+	Currency CurrencyFormat
+	// Fiscal, when set, registers every built receipt
+	Fiscal FiscalSubmitter
+	// Location is the time zone receipts are printed in; defaults to the local zone
+	Location *time.Location
+
+	mu       sync.Mutex
+	machines map[string]DeviceInfoData
+}
+
+// NewReceiptBuilder creates a builder with the default currency format and no taxes
+func NewReceiptBuilder(devices VendingMachineManageClient, merchant MerchantHeader) *ReceiptBuilder {
+	return &ReceiptBuilder{
+		Devices:  devices,
+		Merchant: merchant,
+		Currency: DefaultCurrencyFormat(),
+		machines: make(map[string]DeviceInfoData),
+	}
+}
+
+// FromOrderCallback builds a receipt from an order settlement callback
+func (b *ReceiptBuilder) FromOrderCallback(ctx context.Context, order *OrderCallbackRequest) (*Receipt, error) {
+	if order == nil {
+		return nil, NewAinfinitError(fmt.Errorf("order cannot be nil"))
+	}
+	return b.build(ctx, order.OrderCode, order.VmCode, order.CloseDoorTime, order.OrderGoodsList)
+}
+
+// FromOrder builds a receipt from an order returned by ListOrders. Listed goods carry no names,
+// so lines are named by item code.
+func (b *ReceiptBuilder) FromOrder(ctx context.Context, order *Order) (*Receipt, error) {
+	if order == nil {
+		return nil, NewAinfinitError(fmt.Errorf("order cannot be nil"))
+	}
+	goods := make([]OrderGoods, 0, len(order.OrderGoodsList))
+	for _, item := range order.OrderGoodsList {
+		goods = append(goods, OrderGoods{ItemCode: item.ItemCode, ItemPrice: item.ActualPrice, Count: item.Count})
+	}
+	return b.build(ctx, order.OrderCode, order.VmCode, order.CloseDoorTime, goods)
+}
+
+func (b *ReceiptBuilder) build(ctx context.Context, orderCode, vmCode string, closeDoorTime Millis, goods []OrderGoods) (*Receipt, error) {
+	location := b.Location
+	if location == nil {
+		location = time.Local
+	}
+	receipt := &Receipt{
+		OrderCode: orderCode,
+		VmCode:    vmCode,
+		IssuedAt:  closeDoorTime.In(location),
+		Merchant:  b.Merchant,
+		Currency:  b.Currency,
+	}
+	if machine, ok := b.machine(vmCode); ok {
+		receipt.MachineName = machine.Name
+		receipt.Location = machine.Location
+	}
+
+	// Taxes are computed once per rule on the gross amount of its lines, so that rounding does not
+	// accumulate across lines
+	taxes := make(map[string]*ReceiptTax)
+	gross := make(map[string]Money)
+	for _, item := range goods {
+		if item.Count <= 0 {
+			continue
+		}
+		name := item.ItemName
+		if name == "" {
+			name = item.ItemCode
+		}
+		amount, err := item.ItemPrice.Mul(int64(item.Count))
+		if err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("order %s line %s: %w", orderCode, item.ItemCode, err))
+		}
+		line := ReceiptLine{
+			ItemCode:  item.ItemCode,
+			Name:      name,
+			Count:     item.Count,
+			UnitPrice: item.ItemPrice,
+			Amount:    amount,
+		}
+		for _, rule := range b.rulesFor(item.ItemCode) {
+			line.Taxes = append(line.Taxes, rule.Name)
+			if _, ok := taxes[rule.Name]; !ok {
+				taxes[rule.Name] = &ReceiptTax{Name: rule.Name, Rate: rule.Rate, Inclusive: rule.Inclusive}
+			}
+			if gross[rule.Name], err = gross[rule.Name].Add(line.Amount); err != nil {
+				return nil, NewAinfinitError(fmt.Errorf("order %s: %w", orderCode, err))
+			}
+		}
+		receipt.Lines = append(receipt.Lines, line)
+		if receipt.Subtotal, err = receipt.Subtotal.Add(line.Amount); err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("order %s: %w", orderCode, err))
+		}
+	}
+	if len(receipt.Lines) == 0 {
+		return nil, NewAinfinitError(fmt.Errorf("order %s has no goods", orderCode))
+	}
+
+	// Keep taxes in rule order
+	receipt.Total = receipt.Subtotal
+	for _, rule := range b.TaxRules {
+		tax, ok := taxes[rule.Name]
+		if !ok {
+			continue
+		}
+		delete(taxes, rule.Name)
+		var err error
+		if tax.Inclusive {
+			if tax.Base, err = gross[tax.Name].MulRate(1 / (1 + tax.Rate)); err == nil {
+				tax.Amount, err = gross[tax.Name].Sub(tax.Base)
+			}
+		} else {
+			tax.Base = gross[tax.Name]
+			if tax.Amount, err = tax.Base.MulRate(tax.Rate); err == nil {
+				receipt.Total, err = receipt.Total.Add(tax.Amount)
+			}
+		}
+		if err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("order %s tax %s: %w", orderCode, tax.Name, err))
+		}
+		receipt.Taxes = append(receipt.Taxes, *tax)
+	}
+
+	if b.Fiscal != nil {
+		record, err := b.Fiscal.Submit(ctx, receipt)
+		if err != nil {
+			return nil, NewAinfinitError(fmt.Errorf("fiscal submission of %s failed: %w", orderCode, err))
+		}
+		receipt.Fiscal = record
+	}
+	return receipt, nil
+}
+
+// rulesFor returns the rules listing the item, or the default rules when none does
+func (b *ReceiptBuilder) rulesFor(itemCode string) []TaxRule {
+	var specific, defaults []TaxRule
+	for _, rule := range b.TaxRules {
+		if len(rule.ItemCodes) == 0 {
+			defaults = append(defaults, rule)
+		} else if containsString(rule.ItemCodes, itemCode) {
+			specific = append(specific, rule)
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	return defaults
+}
+
+func (b *ReceiptBuilder) machine(vmCode string) (DeviceInfoData, bool) {
+	if b.Devices == nil || vmCode == "" {
+		return DeviceInfoData{}, false
+	}
+
+	b.mu.Lock()
+	machine, ok := b.machines[vmCode]
+	b.mu.Unlock()
+	if ok {
+		return machine, true
+	}
+
+	info, err := b.Devices.DeviceInfo(vmCode)
+	if err != nil {
+		// A receipt without the machine name is better than no receipt
+		logrus.WithError(err).WithField("vm_code", vmCode).Warn("Could not get machine info for receipt")
+		return DeviceInfoData{}, false
+	}
+
+	b.mu.Lock()
+	if b.machines == nil {
+		b.machines = make(map[string]DeviceInfoData)
+	}
+	b.machines[vmCode] = info.Data
+	b.mu.Unlock()
+	return info.Data, true
+}
+
+const receiptWidth = 40
+
+// Text renders the receipt as fixed width plain text
+func (r *Receipt) Text() string {
+	var b strings.Builder
+	center := func(s string) {
+		if s == "" {
+			return
+		}
+		pad := (receiptWidth - utf8.RuneCountInString(s)) / 2
+		b.WriteString(strings.Repeat(" ", max(pad, 0)) + s + "\n")
+	}
+	columns := func(left, right string) {
+		pad := receiptWidth - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+		b.WriteString(left + strings.Repeat(" ", max(pad, 1)) + right + "\n")
+	}
+	rule := strings.Repeat("-", receiptWidth) + "\n"
+	money := r.Currency.Format
+
+	center(r.Merchant.Name)
+	center(r.Merchant.Address)
+	if r.Merchant.TaxID != "" {
+		center("Tax ID: " + r.Merchant.TaxID)
+	}
+	if r.Merchant.Phone != "" {
+		center("Tel: " + r.Merchant.Phone)
+	}
+	b.WriteString(rule)
+	columns("Order", r.OrderCode)
+	machine := r.VmCode
+	if r.MachineName != "" {
+		machine = r.MachineName + " (" + r.VmCode + ")"
+	}
+	columns("Machine", machine)
+	if r.Location != "" {
+		columns("Location", r.Location)
+	}
+	columns("Date", r.IssuedAt.Format("2006-01-02 15:04"))
+	b.WriteString(rule)
+	for _, line := range r.Lines {
+		b.WriteString(line.Name + "\n")
+		columns(fmt.Sprintf("  %d x %s", line.Count, money(line.UnitPrice)), money(line.Amount))
+	}
+	b.WriteString(rule)
+	columns("Subtotal", money(r.Subtotal))
+	for _, tax := range r.Taxes {
+		label := fmt.Sprintf("%s %g%%", tax.Name, tax.Rate*100)
+		if tax.Inclusive {
+			label += " (incl.)"
+		}
+		columns(label, money(tax.Amount))
+	}
+	columns("TOTAL", money(r.Total))
+	if r.Fiscal != nil {
+		b.WriteString(rule)
+		columns("Fiscal ID", r.Fiscal.ID)
+		if r.Fiscal.QRData != "" {
+			b.WriteString(r.Fiscal.QRData + "\n")
+		}
+	}
+	if r.Merchant.Footer != "" {
+		b.WriteString(rule)
+		center(r.Merchant.Footer)
+	}
+	return b.String()
+}
+
+var receiptTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"percent": func(rate float64) string { return fmt.Sprintf("%g%%", rate*100) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Receipt {{.R.OrderCode}}</title>
+<style>body{font-family:sans-serif;max-width:24em;margin:auto}table{width:100%;border-collapse:collapse}td.amount{text-align:right}header,footer{text-align:center}</style>
+</head>
+<body>
+<header>
+<h1>{{.R.Merchant.Name}}</h1>
+{{with .R.Merchant.Address}}<div>{{.}}</div>{{end}}
+{{with .R.Merchant.TaxID}}<div>Tax ID: {{.}}</div>{{end}}
+{{with .R.Merchant.Phone}}<div>Tel: {{.}}</div>{{end}}
+</header>
+<p>Order {{.R.OrderCode}}<br>
+Machine {{if .R.MachineName}}{{.R.MachineName}} ({{.R.VmCode}}){{else}}{{.R.VmCode}}{{end}}<br>
+{{with .R.Location}}{{.}}<br>{{end}}
+{{.R.IssuedAt.Format "2006-01-02 15:04"}}</p>
+<table>
+{{range .R.Lines}}<tr><td>{{.Name}}<br><small>{{.Count}} x {{call $.Money .UnitPrice}}</small></td><td class="amount">{{call $.Money .Amount}}</td></tr>
+{{end}}<tr><td>Subtotal</td><td class="amount">{{call .Money .R.Subtotal}}</td></tr>
+{{range .R.Taxes}}<tr><td>{{.Name}} {{percent .Rate}}{{if .Inclusive}} (incl.){{end}}</td><td class="amount">{{call $.Money .Amount}}</td></tr>
+{{end}}<tr><th>Total</th><th class="amount">{{call .Money .R.Total}}</th></tr>
+</table>
+{{with .R.Fiscal}}<p>Fiscal ID {{.ID}}{{with .QRData}}<br><code>{{.}}</code>{{end}}</p>{{end}}
+{{with .R.Merchant.Footer}}<footer>{{.}}</footer>{{end}}
+</body>
+</html>
+`))
+
+// HTML renders the receipt as a standalone HTML page
+func (r *Receipt) HTML() ([]byte, error) {
+	var buf bytes.Buffer
+	err := receiptTemplate.Execute(&buf, struct {
+		R     *Receipt
+		Money func(Money) string
+	}{R: r, Money: r.Currency.Format})
+	if err != nil {
+		return nil, NewAinfinitError(err)
+	}
+	return buf.Bytes(), nil
+}
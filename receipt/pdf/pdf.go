@@ -0,0 +1,237 @@
+// Package pdf renders receipts as single page PDFs for 80 mm printers. The font is embedded with
+// only the glyphs the receipt uses, so a short receipt stays a few kilobytes. Render uses DejaVu
+// Sans Mono, which covers Cyrillic and symbols such as ₮ and adds about 340 KB to binaries that
+// import the package; NewRenderer takes another TrueType font instead.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/techpartners-asia/aifinitsdk"
+	xfont "golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+//go:embed fonts/DejaVuSansMono.ttf
+var dejaVuSansMono []byte
+
+// defaultRenderer parses the embedded font once
+var defaultRenderer = sync.OnceValues(func() (*Renderer, error) {
+	return NewRenderer(dejaVuSansMono)
+})
+
+// Render renders the text receipt in DejaVu Sans Mono. Text the font has no glyph for, e.g.
+// Chinese item names, is an error.
+func Render(receipt *aifinitsdk.Receipt) ([]byte, error) {
+	renderer, err := defaultRenderer()
+	if err != nil {
+		return nil, err
+	}
+	return renderer.Render(receipt)
+}
+
+// Renderer renders receipts in a TrueType font. The receipt columns line up only in a monospaced
+// font.
+type Renderer struct {
+	data []byte
+	font *sfnt.Font
+	name string
+}
+
+// NewRenderer parses a TrueType font to render receipts in. Fonts with CFF outlines are not
+// supported.
+func NewRenderer(ttf []byte) (*Renderer, error) {
+	font, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("receipt font: %w", err))
+	}
+	tables, err := readTables(ttf)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("receipt font: %w", err))
+	}
+	if tables["glyf"] == nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("receipt font has no TrueType outlines"))
+	}
+
+	// PDF names cannot hold spaces or delimiters
+	name, _ := font.Name(nil, sfnt.NameIDPostScript)
+	name = strings.Map(func(char rune) rune {
+		if char <= ' ' || char > '~' || strings.ContainsRune("()<>[]{}/%#", char) {
+			return -1
+		}
+		return char
+	}, name)
+	if name == "" {
+		name = "Receipt"
+	}
+	return &Renderer{data: ttf, font: font, name: name}, nil
+}
+
+// Render renders the text receipt on a single 80 mm wide page. Text the font has no glyph for is
+// an error rather than placeholder boxes.
+func (r *Renderer) Render(receipt *aifinitsdk.Receipt) ([]byte, error) {
+	lines := strings.Split(strings.TrimRight(receipt.Text(), "\n"), "\n")
+
+	const (
+		width    = 227 // 80 mm
+		margin   = 14
+		fontSize = 7.8
+		leading  = 10
+	)
+	height := 2*margin + leading*len(lines)
+
+	// The text is shown by glyph ID, the ToUnicode map keeps it searchable and copyable
+	var buf sfnt.Buffer
+	used := make(map[sfnt.GlyphIndex]rune)
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "BT /F1 %g Tf %d TL %d %d Td\n", fontSize, leading, margin, height-margin-leading+2)
+	for _, line := range lines {
+		content.WriteString("<")
+		for _, char := range line {
+			if char < 0x20 {
+				char = ' '
+			}
+			glyph, err := r.font.GlyphIndex(&buf, char)
+			if err != nil {
+				return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("receipt font: %w", err))
+			}
+			if glyph == 0 {
+				return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("receipt PDF font has no glyph for %q", char))
+			}
+			used[glyph] = char
+			fmt.Fprintf(&content, "%04X", uint16(glyph))
+		}
+		content.WriteString("> Tj T*\n")
+	}
+	content.WriteString("ET\n")
+
+	fontObjects, err := r.fontObjects(used)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("receipt font: %w", err))
+	}
+	objects := append([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>", width, height),
+		stream("", content.Bytes()),
+	}, fontObjects...)
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes(), nil
+}
+
+// fontObjects returns objects 5 onwards: the Type0 font showing the used glyphs, its CID font,
+// descriptor, compressed font subset and ToUnicode map
+func (r *Renderer) fontObjects(used map[sfnt.GlyphIndex]rune) ([]string, error) {
+	var buf sfnt.Buffer
+	// Metrics in thousandths of the font size, as PDF expects
+	ppem := fixed.I(1000)
+	metrics, err := r.font.Metrics(&buf, ppem, xfont.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+	bounds, err := r.font.Bounds(&buf, ppem, xfont.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Measured downwards, like the bounds, when the font's OS/2 table has no cap height
+	capHeight := metrics.CapHeight.Round()
+	if capHeight < 0 {
+		capHeight = -capHeight
+	}
+
+	glyphs := slices.Sorted(maps.Keys(used))
+	var widths, toUnicode strings.Builder
+	for _, glyph := range glyphs {
+		advance, err := r.font.GlyphAdvance(&buf, glyph, ppem, xfont.HintingNone)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&widths, "%d [%d] ", glyph, advance.Round())
+	}
+	toUnicode.WriteString("/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def /CMapType 2 def\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n")
+	// A bfchar block holds at most 100 entries
+	for chunk := range slices.Chunk(glyphs, 100) {
+		fmt.Fprintf(&toUnicode, "%d beginbfchar\n", len(chunk))
+		for _, glyph := range chunk {
+			fmt.Fprintf(&toUnicode, "<%04X> <", uint16(glyph))
+			for _, unit := range utf16.Encode([]rune{used[glyph]}) {
+				fmt.Fprintf(&toUnicode, "%04X", unit)
+			}
+			toUnicode.WriteString(">\n")
+		}
+		toUnicode.WriteString("endbfchar\n")
+	}
+	toUnicode.WriteString("endcmap CMapName currentdict /CMap defineresource pop end end\n")
+
+	data, err := subset(r.data, glyphs)
+	if err != nil {
+		return nil, err
+	}
+	var file bytes.Buffer
+	compress := zlib.NewWriter(&file)
+	if _, err := compress.Write(data); err != nil {
+		return nil, err
+	}
+	if err := compress.Close(); err != nil {
+		return nil, err
+	}
+
+	name := "/" + subsetTag(glyphs) + "+" + r.name
+	return []string{
+		"<< /Type /Font /Subtype /Type0 /BaseFont " + name + " /Encoding /Identity-H /DescendantFonts [6 0 R] /ToUnicode 9 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont " + name + " /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> " +
+			"/FontDescriptor 7 0 R /CIDToGIDMap /Identity /W [" + strings.TrimSpace(widths.String()) + "] >>",
+		fmt.Sprintf("<< /Type /FontDescriptor /FontName %s /Flags 33 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 8 0 R >>",
+			name, bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round(),
+			metrics.Ascent.Round(), -metrics.Descent.Round(), capHeight),
+		stream(fmt.Sprintf("/Filter /FlateDecode /Length1 %d ", len(data)), file.Bytes()),
+		stream("", []byte(toUnicode.String())),
+	}, nil
+}
+
+// subsetTag is the six capital letters PDF puts in front of the name of a font subset, derived
+// from the glyphs so that the same subset gets the same tag
+func subsetTag(glyphs []sfnt.GlyphIndex) string {
+	hash := sha256.New()
+	for _, glyph := range glyphs {
+		hash.Write([]byte{byte(glyph >> 8), byte(glyph)})
+	}
+	sum := hash.Sum(nil)
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+	return string(tag)
+}
+
+// stream returns a stream object with the given extra dictionary entries
+func stream(entries string, data []byte) string {
+	return fmt.Sprintf("<< %s/Length %d >>\nstream\n%s\nendstream", entries, len(data), data)
+}
@@ -0,0 +1,127 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/techpartners-asia/aifinitsdk"
+	xfont "golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+func mongolianReceipt() *aifinitsdk.Receipt {
+	total := aifinitsdk.MoneyFromFloat(1500, aifinitsdk.DefaultCurrency)
+	return &aifinitsdk.Receipt{
+		Merchant:  aifinitsdk.MerchantHeader{Name: "Сүү Өргөө ХХК"},
+		OrderCode: "O-1", VmCode: "VM1",
+		Currency: aifinitsdk.DefaultCurrencyFormat(),
+		Lines:    []aifinitsdk.ReceiptLine{{Name: "Ус 0.5л", Count: 1, UnitPrice: total, Amount: total}},
+		Subtotal: total, Total: total,
+	}
+}
+
+func TestRender(t *testing.T) {
+	receipt := mongolianReceipt()
+	pdf, err := Render(receipt)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Equal(t, strings.TrimRight(receipt.Text(), "\n"), pdfText(t, pdf))
+	assert.Regexp(t, `/BaseFont /[A-Z]{6}\+DejaVuSansMono `, string(pdf))
+
+	// Only the glyphs the receipt uses are embedded, not the whole 340 KB font
+	assert.Less(t, len(pdf), 20_000)
+	font, err := sfnt.Parse(embeddedFont(t, pdf))
+	require.NoError(t, err)
+	var buf sfnt.Buffer
+	for char, kept := range map[rune]bool{'Ө': true, '₮': true, '5': true, 'Ж': false, 'Z': false} {
+		glyph, err := font.GlyphIndex(&buf, char)
+		require.NoError(t, err)
+		segments, err := font.LoadGlyph(&buf, glyph, fixed.I(12), nil)
+		require.NoError(t, err)
+		assert.Equal(t, kept, len(segments) > 0, "%q", char)
+		advance, err := font.GlyphAdvance(&buf, glyph, fixed.I(1000), xfont.HintingNone)
+		require.NoError(t, err)
+		assert.Equal(t, 602, advance.Round(), "%q keeps its metrics", char)
+	}
+
+	// Text the font cannot show is not printed as placeholders
+	receipt.Lines[0].Name = "可口可乐"
+	_, err = Render(receipt)
+	assert.ErrorContains(t, err, `no glyph for '可'`)
+}
+
+func TestNewRenderer(t *testing.T) {
+	renderer, err := NewRenderer(gomono.TTF)
+	require.NoError(t, err)
+	receipt := mongolianReceipt()
+	receipt.Merchant.Name = "Кофе ХХК"
+	receipt.Lines[0].Name = "Вода 0.5л"
+	receipt.Currency.Symbol = "MNT"
+	pdf, err := renderer.Render(receipt)
+	require.NoError(t, err)
+	assert.Equal(t, strings.TrimRight(receipt.Text(), "\n"), pdfText(t, pdf))
+	assert.Regexp(t, `/BaseFont /[A-Z]{6}\+GoMono `, string(pdf))
+	_, err = sfnt.Parse(embeddedFont(t, pdf))
+	assert.NoError(t, err)
+
+	// Go Mono has Cyrillic but not the Mongolian letters
+	receipt.Lines[0].Name = "Өрөм"
+	_, err = renderer.Render(receipt)
+	assert.ErrorContains(t, err, `no glyph for 'Ө'`)
+
+	_, err = NewRenderer([]byte("not a font"))
+	assert.Error(t, err)
+}
+
+var (
+	pdfTextLine = regexp.MustCompile(`(?m)^<([0-9A-F]*)> Tj T\*$`)
+	pdfCMapChar = regexp.MustCompile(`(?m)^<([0-9A-F]{4})> <([0-9A-F]+)>$`)
+	pdfFontFile = regexp.MustCompile(`(?s)/FlateDecode /Length1 \d+ /Length (\d+) >>\nstream\n`)
+)
+
+// pdfText reads the receipt lines back through the PDF's ToUnicode map
+func pdfText(t *testing.T, pdf []byte) string {
+	chars := make(map[string]string)
+	for _, match := range pdfCMapChar.FindAllSubmatch(pdf, -1) {
+		units, err := hex.DecodeString(string(match[2]))
+		require.NoError(t, err)
+		var utf []uint16
+		for i := 0; i < len(units); i += 2 {
+			utf = append(utf, uint16(units[i])<<8|uint16(units[i+1]))
+		}
+		chars[string(match[1])] = string(utf16.Decode(utf))
+	}
+	var lines []string
+	for _, match := range pdfTextLine.FindAllSubmatch(pdf, -1) {
+		var line strings.Builder
+		for i := 0; i < len(match[1]); i += 4 {
+			char, ok := chars[string(match[1][i:i+4])]
+			require.True(t, ok, "glyph %s is not in the ToUnicode map", match[1][i:i+4])
+			line.WriteString(char)
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// embeddedFont decompresses the PDF's font file
+func embeddedFont(t *testing.T, pdf []byte) []byte {
+	match := pdfFontFile.FindSubmatchIndex(pdf)
+	require.NotNil(t, match)
+	reader, err := zlib.NewReader(bytes.NewReader(pdf[match[1]:]))
+	require.NoError(t, err)
+	font, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return font
+}
@@ -0,0 +1,221 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math/bits"
+	"slices"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// subsetTables are the tables kept from a TrueType font besides glyf and loca, and whether they
+// are required. A PDF reader only needs the metrics; cmap, OS/2 and post, cut down to its header,
+// keep the subset a valid font of its own and the rest carry hinting.
+var subsetTables = map[string]bool{
+	"head": true, "hhea": true, "hmtx": true, "maxp": true, "cmap": true, "post": true,
+	"OS/2": false, "cvt ": false, "fpgm": false, "prep": false,
+}
+
+// subset returns a copy of a TrueType font with the outlines of all but the given glyphs, glyph 0
+// and the components they are built from emptied out. Glyph IDs are kept, so text shown by glyph
+// ID needs no remapping.
+func subset(font []byte, glyphs []sfnt.GlyphIndex) ([]byte, error) {
+	tables, err := readTables(font)
+	if err != nil {
+		return nil, err
+	}
+	head, maxp, loca, glyf, post := tables["head"], tables["maxp"], tables["loca"], tables["glyf"], tables["post"]
+	if len(head) < 54 || len(maxp) < 6 || len(post) < 32 || loca == nil || glyf == nil {
+		return nil, errors.New("not a TrueType font")
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	offsets := make([]int, numGlyphs+1)
+	long := binary.BigEndian.Uint16(head[50:]) == 1
+	for i := range offsets {
+		switch {
+		case long && len(loca) >= 4*i+4:
+			offsets[i] = int(binary.BigEndian.Uint32(loca[4*i:]))
+		case !long && len(loca) >= 2*i+2:
+			offsets[i] = 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		default:
+			return nil, errors.New("loca table is truncated")
+		}
+	}
+	outline := func(glyph int) ([]byte, error) {
+		start, end := offsets[glyph], offsets[glyph+1]
+		if start > end || end > len(glyf) {
+			return nil, fmt.Errorf("glyph %d is out of bounds", glyph)
+		}
+		return glyf[start:end], nil
+	}
+
+	keep := make(map[int]bool)
+	pending := []int{0}
+	for _, glyph := range glyphs {
+		pending = append(pending, int(glyph))
+	}
+	for len(pending) > 0 {
+		glyph := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if keep[glyph] {
+			continue
+		}
+		if glyph >= numGlyphs {
+			return nil, fmt.Errorf("glyph %d is out of range", glyph)
+		}
+		keep[glyph] = true
+		data, err := outline(glyph)
+		if err != nil {
+			return nil, err
+		}
+		components, err := glyphComponents(data)
+		if err != nil {
+			return nil, fmt.Errorf("glyph %d: %w", glyph, err)
+		}
+		pending = append(pending, components...)
+	}
+
+	// The new loca is always in the long format, so head says so
+	var newGlyf []byte
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for glyph := range numGlyphs {
+		binary.BigEndian.PutUint32(newLoca[4*glyph:], uint32(len(newGlyf)))
+		if keep[glyph] {
+			data, _ := outline(glyph)
+			newGlyf = append(newGlyf, data...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(len(newGlyf)))
+	newHead := slices.Clone(head)
+	binary.BigEndian.PutUint16(newHead[50:], 1)
+	// Version 3 has no glyph names
+	newPost := slices.Clone(post[:32])
+	binary.BigEndian.PutUint32(newPost, 0x00030000)
+
+	subset := map[string][]byte{"head": newHead, "loca": newLoca, "glyf": newGlyf, "post": newPost}
+	for tag, required := range subsetTables {
+		data, ok := tables[tag]
+		if !ok && required {
+			return nil, fmt.Errorf("font has no %s table", tag)
+		}
+		if ok && subset[tag] == nil {
+			subset[tag] = data
+		}
+	}
+	return writeTables(subset), nil
+}
+
+// glyphComponents returns the glyphs a composite glyph is built from
+func glyphComponents(data []byte) ([]int, error) {
+	if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+		return nil, nil
+	}
+	const (
+		argsAreWords   = 0x0001
+		haveScale      = 0x0008
+		moreComponents = 0x0020
+		haveXYScale    = 0x0040
+		haveTwoByTwo   = 0x0080
+	)
+	var components []int
+	for pos := 10; ; {
+		if len(data) < pos+4 {
+			return nil, errors.New("composite glyph is truncated")
+		}
+		flags := binary.BigEndian.Uint16(data[pos:])
+		components = append(components, int(binary.BigEndian.Uint16(data[pos+2:])))
+		pos += 4
+		if flags&argsAreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			pos += 2
+		case flags&haveXYScale != 0:
+			pos += 4
+		case flags&haveTwoByTwo != 0:
+			pos += 8
+		}
+		if flags&moreComponents == 0 {
+			return components, nil
+		}
+	}
+}
+
+// readTables returns the tables of a TrueType font by tag
+func readTables(font []byte) (map[string][]byte, error) {
+	if len(font) < 12 {
+		return nil, errors.New("font is truncated")
+	}
+	count := int(binary.BigEndian.Uint16(font[4:]))
+	if len(font) < 12+16*count {
+		return nil, errors.New("font table directory is truncated")
+	}
+	tables := make(map[string][]byte, count)
+	for i := range count {
+		record := font[12+16*i:]
+		offset, length := uint64(binary.BigEndian.Uint32(record[8:])), uint64(binary.BigEndian.Uint32(record[12:]))
+		if offset+length > uint64(len(font)) {
+			return nil, fmt.Errorf("font table %q is out of bounds", record[:4])
+		}
+		tables[string(record[:4])] = font[offset : offset+length]
+	}
+	return tables, nil
+}
+
+// writeTables lays the tables out as a TrueType font, with checksums
+func writeTables(tables map[string][]byte) []byte {
+	tags := slices.Sorted(maps.Keys(tables))
+	selector := bits.Len(uint(len(tags))) - 1
+	searchRange := 16 << selector
+
+	var font bytes.Buffer
+	header := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(tags)))
+	header = binary.BigEndian.AppendUint16(header, uint16(searchRange))
+	header = binary.BigEndian.AppendUint16(header, uint16(selector))
+	header = binary.BigEndian.AppendUint16(header, uint16(16*len(tags)-searchRange))
+	font.Write(header)
+
+	offset, headOffset := 12+16*len(tags), 0
+	for _, tag := range tags {
+		data := tables[tag]
+		if tag == "head" {
+			// The adjustment is left out of the head checksum and filled in below
+			binary.BigEndian.PutUint32(data[8:], 0)
+			headOffset = offset
+		}
+		font.WriteString(tag)
+		binary.Write(&font, binary.BigEndian, []uint32{checksum(data), uint32(offset), uint32(len(data))})
+		offset += (len(data) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		font.Write(tables[tag])
+		font.Write(make([]byte, (4-len(tables[tag])%4)%4))
+	}
+
+	data := font.Bytes()
+	binary.BigEndian.PutUint32(data[headOffset+8:], 0xB1B0AFBA-checksum(data))
+	return data
+}
+
+// checksum sums a table as big endian 32-bit words, zero padded
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,78 @@
+package aifinitsdk
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDeviceInfoClient struct {
+	VendingMachineManageClient
+	calls int
+}
+
+func (f *fakeDeviceInfoClient) DeviceInfo(machineCode string) (*DeviceInfoResponse, error) {
+	f.calls++
+	return &DeviceInfoResponse{Status: 200, Data: DeviceInfoData{Code: machineCode, Name: "Lobby fridge", Location: "Central Tower, 1st floor"}}, nil
+}
+
+func TestReceiptBuilder_Build(t *testing.T) {
+	devices := &fakeDeviceInfoClient{}
+	fiscal := &LocalFiscalSubmitter{}
+	builder := NewReceiptBuilder(devices, MerchantHeader{Name: "Smart Shelf LLC", TaxID: "1234567", Footer: "Thank you!"})
+	builder.Location = time.UTC
+	builder.Fiscal = fiscal
+	builder.TaxRules = []TaxRule{
+		{Name: "VAT", Rate: 0.1, Inclusive: true},
+		{Name: "Excise", Rate: 0.05, ItemCodes: []string{"BEER"}},
+		{Name: "VAT", Rate: 0.1, Inclusive: true, ItemCodes: []string{"BEER"}},
+	}
+
+	order := &OrderCallbackRequest{
+		OrderCode: "O-1", VmCode: "VM1",
+		CloseDoorTime: MillisOf(time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)),
+		OrderGoodsList: []OrderGoods{
+			{ItemCode: "COLA", ItemName: "Cola 330ml", ItemPrice: mnt(2200), Count: 2},
+			{ItemCode: "BEER", ItemName: "Beer (can)", ItemPrice: mnt(5500), Count: 1},
+		},
+	}
+	receipt, err := builder.FromOrderCallback(context.Background(), order)
+	assert.NoError(t, err)
+	assert.Equal(t, "Lobby fridge", receipt.MachineName)
+	assert.Equal(t, mnt(9900.0), receipt.Subtotal)
+	assert.Equal(t, []ReceiptTax{
+		{Name: "VAT", Rate: 0.1, Inclusive: true, Base: mnt(9000), Amount: mnt(900)},
+		{Name: "Excise", Rate: 0.05, Base: mnt(5500), Amount: mnt(275)},
+	}, receipt.Taxes)
+	assert.Equal(t, mnt(10175.0), receipt.Total)
+	assert.Equal(t, []string{"Excise", "VAT"}, receipt.Lines[1].Taxes)
+	if assert.NotNil(t, receipt.Fiscal) {
+		assert.Equal(t, "LOCAL-000001", receipt.Fiscal.ID)
+	}
+	assert.Len(t, fiscal.Receipts(), 1)
+
+	text := receipt.Text()
+	assert.Contains(t, text, "Lobby fridge (VM1)")
+	assert.Contains(t, text, "2026-05-01 08:30")
+	assert.Contains(t, text, "  2 x 2,200.00₮")
+	assert.Contains(t, text, "10,175.00₮")
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		assert.LessOrEqual(t, len([]rune(line)), receiptWidth, line)
+	}
+
+	html, err := receipt.HTML()
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "Beer (can)")
+	assert.Contains(t, string(html), "Excise 5%")
+
+	// Listed orders reuse the cached machine info
+	_, err = builder.FromOrder(context.Background(), &Order{OrderCode: "O-2", VmCode: "VM1", OrderGoodsList: []Goods{{ItemCode: "COLA", ActualPrice: mnt(2200), Count: 1}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, devices.calls)
+
+	_, err = builder.FromOrder(context.Background(), &Order{OrderCode: "O-3", VmCode: "VM1"})
+	assert.ErrorContains(t, err, "no goods")
+}
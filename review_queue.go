@@ -0,0 +1,542 @@
+package aifinitsdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReviewStatus is the state of an order in the review queue
+type ReviewStatus string
+
+const (
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusClaimed  ReviewStatus = "claimed"
+	ReviewStatusResolved ReviewStatus = "resolved"
+)
+
+// ReviewAuditAction is the kind of an audit trail entry
+type ReviewAuditAction string
+
+const (
+	ReviewAuditEnqueued ReviewAuditAction = "enqueued"
+	ReviewAuditClaimed  ReviewAuditAction = "claimed"
+	ReviewAuditReleased ReviewAuditAction = "released"
+	ReviewAuditVideo    ReviewAuditAction = "video_attached"
+	ReviewAuditResolved ReviewAuditAction = "resolved"
+)
+
+// ReviewAuditEntry is one step in the audit trail of a review
+type ReviewAuditEntry struct {
+	At     time.Time         `json:"at"`
+	Actor  string            `json:"actor"` // reviewer, or "system"
+	Action ReviewAuditAction `json:"action"`
+	Detail string            `json:"detail,omitempty"`
+}
+
+// ReviewCandidate is a possible item of an order, enriched with catalog data
+type ReviewCandidate struct {
+	ItemCode string `json:"itemCode"`
+	Name     string `json:"name"`
+	Price    Money  `json:"price"` // price reported with the order
+	// CatalogPrice is the catalog's suggested retail price
+	CatalogPrice Money  `json:"catalogPrice,omitzero"`
+	ImgUrl       string `json:"imgUrl,omitempty"`
+	Count        int    `json:"count"`
+}
+
+// ReviewDecision is the final goods list confirmed by a reviewer
+type ReviewDecision struct {
+	Reviewer  string       `json:"reviewer"`
+	Goods     []OrderGoods `json:"goods"`
+	Note      string       `json:"note,omitempty"`
+	DecidedAt time.Time    `json:"decidedAt"`
+}
+
+// ReviewItem is an order waiting for, or resolved by, manual review
+type ReviewItem struct {
+	OrderCode    string           `json:"orderCode"`
+	VmCode       string           `json:"vmCode"`
+	RequestID    string           `json:"requestId"`
+	HandleStatus HandleStatus     `json:"handleStatus"`
+	Reasons      []AbnormalReason `json:"reasons,omitempty"`
+	// Recognized is the goods list the platform reported with the order
+	Recognized []OrderGoods       `json:"recognized,omitempty"`
+	Candidates []ReviewCandidate  `json:"candidates,omitempty"`
+	VideoURLs  []string           `json:"videoUrls,omitempty"`
+	Status     ReviewStatus       `json:"status"`
+	ClaimedBy  string             `json:"claimedBy,omitempty"`
+	EnqueuedAt time.Time          `json:"enqueuedAt"`
+	Decision   *ReviewDecision    `json:"decision,omitempty"`
+	Audit      []ReviewAuditEntry `json:"audit"`
+}
+
+// CorrectedOrderEvent is emitted when a reviewer confirms the goods of an order; billing charges
+// CorrectedTotal instead of OriginalTotal
+type CorrectedOrderEvent struct {
+	OrderCode      string       `json:"orderCode"`
+	VmCode         string       `json:"vmCode"`
+	RequestID      string       `json:"requestId"`
+	OriginalGoods  []OrderGoods `json:"originalGoods"`
+	CorrectedGoods []OrderGoods `json:"correctedGoods"`
+	OriginalTotal  Money        `json:"originalTotal"`
+	CorrectedTotal Money        `json:"correctedTotal"`
+	Changed        bool         `json:"changed"`
+	Reviewer       string       `json:"reviewer"`
+	Note           string       `json:"note,omitempty"`
+	DecidedAt      time.Time    `json:"decidedAt"`
+}
+
+// ReviewStore persists the review queue between restarts
+type ReviewStore interface {
+	Load() ([]ReviewItem, error)
+	Save(items []ReviewItem) error
+}
+
+// MemoryReviewStore keeps the review queue in memory only
+type MemoryReviewStore struct {
+	mu    sync.Mutex
+	items []ReviewItem
+}
+
+func (s *MemoryReviewStore) Load() ([]ReviewItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.items, nil
+}
+
+func (s *MemoryReviewStore) Save(items []ReviewItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = items
+	return nil
+}
+
+// FileReviewStore keeps the review queue as a JSON file
+type FileReviewStore struct {
+	Path string
+}
+
+func (s *FileReviewStore) Load() ([]ReviewItem, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ReviewItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *FileReviewStore) Save(items []ReviewItem) error {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// ReviewQueue collects orders that need human correction: failed recognition or abnormal reasons.
+// Reviewers claim an order, look at its candidates and video, and resolve it with the final goods
+// list; every step is kept in the item's audit trail and each resolution is reported through
+// OnCorrected for billing.
+type ReviewQueue struct {
+	// Catalog, when set, supplies candidate names, images and suggested prices
+	Catalog *Catalog
+	// Operations, when set, fetches order videos and machine prices missing from the callback
+	Operations OperationClient
+	Store      ReviewStore
+	// OnCorrected is called for every resolved order, outside the queue lock
+	OnCorrected func(CorrectedOrderEvent)
+
+	mu    sync.Mutex
+	items map[string]*ReviewItem
+	now   func() time.Time
+}
+
+// NewReviewQueue creates a queue. A nil store keeps the queue in memory only.
+func NewReviewQueue(catalog *Catalog, operations OperationClient, store ReviewStore) *ReviewQueue {
+	if store == nil {
+		store = &MemoryReviewStore{}
+	}
+
+	return &ReviewQueue{
+		Catalog:    catalog,
+		Operations: operations,
+		Store:      store,
+		items:      make(map[string]*ReviewItem),
+		now:        time.Now,
+	}
+}
+
+// NeedsReview reports whether an order has failed recognition or abnormal reasons
+func NeedsReview(order *OrderCallbackRequest) bool {
+	return order != nil && (order.HandleStatus.IsFailure() || len(order.AbnormalReasons) > 0)
+}
+
+// Load restores the queue from the store
+func (q *ReviewQueue) Load() error {
+	items, err := q.Store.Load()
+	if err != nil {
+		return NewAinfinitError(fmt.Errorf("load review queue: %w", err))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range items {
+		item := items[i]
+		q.items[item.OrderCode] = &item
+	}
+	return nil
+}
+
+// HandleOrder enqueues an order callback that needs review. It reports whether the order was
+// enqueued; orders already in the queue are left as they are.
+func (q *ReviewQueue) HandleOrder(order *OrderCallbackRequest) (bool, error) {
+	if !NeedsReview(order) || order.OrderCode == "" {
+		return false, nil
+	}
+
+	candidates := make([]ReviewCandidate, 0, len(order.Candidates))
+	for _, candidate := range order.Candidates {
+		candidates = append(candidates, q.candidate(candidate))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.items[order.OrderCode]; ok {
+		return false, nil
+	}
+
+	item := &ReviewItem{
+		OrderCode:    order.OrderCode,
+		VmCode:       order.VmCode,
+		RequestID:    order.TradeRequestId,
+		HandleStatus: order.HandleStatus,
+		Reasons:      order.AbnormalReasons,
+		Recognized:   order.OrderGoodsList,
+		Candidates:   candidates,
+		VideoURLs:    orderVideoURLs(order.VideoUrl, order.VideoUrls),
+		Status:       ReviewStatusPending,
+		EnqueuedAt:   q.now(),
+	}
+	q.audit(item, "system", ReviewAuditEnqueued, fmt.Sprintf("%s, reasons %v", order.HandleStatus, order.AbnormalReasons))
+	q.items[item.OrderCode] = item
+	return true, q.save()
+}
+
+// Pending returns the orders still waiting for a decision, oldest first
+func (q *ReviewQueue) Pending() []ReviewItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []ReviewItem
+	for _, item := range q.list() {
+		if item.Status != ReviewStatusResolved {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Item returns one order of the queue
+func (q *ReviewQueue) Item(orderCode string) (ReviewItem, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item, ok := q.items[orderCode]
+	if !ok {
+		return ReviewItem{}, false
+	}
+	return copyReviewItem(item), true
+}
+
+// Claim assigns an order to a reviewer and returns it ready for presentation. When the callback
+// carried no video, the order video is fetched with GetOrderVideo.
+func (q *ReviewQueue) Claim(orderCode, reviewer string) (ReviewItem, error) {
+	if reviewer == "" {
+		return ReviewItem{}, NewAinfinitError(fmt.Errorf("reviewer is required"))
+	}
+
+	q.mu.Lock()
+	item, ok := q.items[orderCode]
+	switch {
+	case !ok:
+		q.mu.Unlock()
+		return ReviewItem{}, NewAinfinitError(fmt.Errorf("order %s is not in the review queue", orderCode))
+	case item.Status == ReviewStatusResolved:
+		q.mu.Unlock()
+		return ReviewItem{}, NewAinfinitError(fmt.Errorf("order %s is already resolved", orderCode))
+	case item.Status == ReviewStatusClaimed && item.ClaimedBy != reviewer:
+		claimedBy := item.ClaimedBy
+		q.mu.Unlock()
+		return ReviewItem{}, NewAinfinitError(fmt.Errorf("order %s is claimed by %s", orderCode, claimedBy))
+	}
+	if item.Status != ReviewStatusClaimed {
+		item.Status = ReviewStatusClaimed
+		item.ClaimedBy = reviewer
+		q.audit(item, reviewer, ReviewAuditClaimed, "")
+	}
+	needsVideo := len(item.VideoURLs) == 0 && item.RequestID != "" && q.Operations != nil
+	vmCode, requestID := item.VmCode, item.RequestID
+	q.mu.Unlock()
+
+	var videos []string
+	if needsVideo {
+		response, err := q.Operations.GetOrderVideo(&GetOrderVideoRequest{RequestID: requestID, Type: OpenDoorForShopping}, vmCode)
+		if err == nil && response.Data.VideoStatus == VideoStatusUploadComplete {
+			videos = orderVideoURLs(response.Data.VideoUrl, response.Data.VideoURLs)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(videos) > 0 && len(item.VideoURLs) == 0 {
+		item.VideoURLs = videos
+		q.audit(item, "system", ReviewAuditVideo, fmt.Sprintf("%d clips", len(videos)))
+	}
+	return copyReviewItem(item), q.save()
+}
+
+// Release returns a claimed order to the pending list
+func (q *ReviewQueue) Release(orderCode, reviewer string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[orderCode]
+	if !ok || item.Status != ReviewStatusClaimed || item.ClaimedBy != reviewer {
+		return NewAinfinitError(fmt.Errorf("order %s is not claimed by %s", orderCode, reviewer))
+	}
+	item.Status = ReviewStatusPending
+	item.ClaimedBy = ""
+	q.audit(item, reviewer, ReviewAuditReleased, "")
+	return q.save()
+}
+
+// Resolve records the reviewer's final goods list and emits a CorrectedOrderEvent. Items without a
+// price take the price reported with the order, then the machine's current price. An empty goods
+// list confirms that nothing was taken.
+func (q *ReviewQueue) Resolve(orderCode, reviewer string, goods []OrderGoods, note string) (*CorrectedOrderEvent, error) {
+	if reviewer == "" {
+		return nil, NewAinfinitError(fmt.Errorf("reviewer is required"))
+	}
+
+	item, ok := q.Item(orderCode)
+	switch {
+	case !ok:
+		return nil, NewAinfinitError(fmt.Errorf("order %s is not in the review queue", orderCode))
+	case item.Status == ReviewStatusResolved:
+		return nil, NewAinfinitError(fmt.Errorf("order %s is already resolved", orderCode))
+	case item.Status == ReviewStatusClaimed && item.ClaimedBy != reviewer:
+		return nil, NewAinfinitError(fmt.Errorf("order %s is claimed by %s", orderCode, item.ClaimedBy))
+	}
+
+	corrected, err := q.priced(item, goods)
+	if err != nil {
+		return nil, err
+	}
+	originalTotal, err := orderGoodsTotal(item.Recognized)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("order %s: %w", orderCode, err))
+	}
+	correctedTotal, err := orderGoodsTotal(corrected)
+	if err != nil {
+		return nil, NewAinfinitError(fmt.Errorf("order %s: %w", orderCode, err))
+	}
+
+	// Another reviewer may have resolved or claimed the order while it was priced
+	q.mu.Lock()
+	stored := q.items[orderCode]
+	if stored.Status == ReviewStatusResolved {
+		q.mu.Unlock()
+		return nil, NewAinfinitError(fmt.Errorf("order %s is already resolved", orderCode))
+	}
+	if stored.Status == ReviewStatusClaimed && stored.ClaimedBy != reviewer {
+		claimedBy := stored.ClaimedBy
+		q.mu.Unlock()
+		return nil, NewAinfinitError(fmt.Errorf("order %s is claimed by %s", orderCode, claimedBy))
+	}
+	decision := &ReviewDecision{Reviewer: reviewer, Goods: corrected, Note: note, DecidedAt: q.now()}
+	stored.Decision = decision
+	stored.Status = ReviewStatusResolved
+	stored.ClaimedBy = reviewer
+	q.audit(stored, reviewer, ReviewAuditResolved, fmt.Sprintf("%d items, total %s", len(corrected), correctedTotal))
+	err = q.save()
+	q.mu.Unlock()
+
+	event := &CorrectedOrderEvent{
+		OrderCode:      item.OrderCode,
+		VmCode:         item.VmCode,
+		RequestID:      item.RequestID,
+		OriginalGoods:  item.Recognized,
+		CorrectedGoods: corrected,
+		OriginalTotal:  originalTotal,
+		CorrectedTotal: correctedTotal,
+		Changed:        !sameOrderGoods(item.Recognized, corrected),
+		Reviewer:       reviewer,
+		Note:           note,
+		DecidedAt:      decision.DecidedAt,
+	}
+	if q.OnCorrected != nil {
+		q.OnCorrected(*event)
+	}
+	return event, err
+}
+
+// priced validates the reviewer's goods and fills missing names and prices
+func (q *ReviewQueue) priced(item ReviewItem, goods []OrderGoods) ([]OrderGoods, error) {
+	known := make(map[string]OrderGoods)
+	for _, recognized := range item.Recognized {
+		known[recognized.ItemCode] = recognized
+	}
+	for _, candidate := range item.Candidates {
+		if _, ok := known[candidate.ItemCode]; !ok {
+			known[candidate.ItemCode] = OrderGoods{ItemCode: candidate.ItemCode, ItemName: candidate.Name, ItemPrice: candidate.Price}
+		}
+	}
+
+	var machine map[string]Goods
+	corrected := make([]OrderGoods, 0, len(goods))
+	for _, line := range goods {
+		if line.ItemCode == "" || line.Count <= 0 {
+			return nil, NewAinfinitError(fmt.Errorf("invalid goods line %+v", line))
+		}
+		if q.Catalog != nil {
+			if product, ok := q.Catalog.Product(line.ItemCode); !ok {
+				return nil, NewAinfinitError(fmt.Errorf("item %s is not in the catalog", line.ItemCode))
+			} else if line.ItemName == "" {
+				line.ItemName = product.Name
+			}
+		}
+		if reference, ok := known[line.ItemCode]; ok {
+			if line.ItemName == "" {
+				line.ItemName = reference.ItemName
+			}
+			if line.ItemPrice.IsZero() {
+				line.ItemPrice = reference.ItemPrice
+			}
+		}
+		if line.ItemPrice.IsZero() && q.Operations != nil {
+			if machine == nil {
+				machine = make(map[string]Goods)
+				response, err := q.Operations.ListGoods(item.VmCode)
+				if err != nil {
+					return nil, err
+				}
+				for _, g := range response.Result {
+					machine[g.ItemCode] = g
+				}
+			}
+			line.ItemPrice = machine[line.ItemCode].ActualPrice
+		}
+		if line.ItemPrice.IsZero() {
+			return nil, NewAinfinitError(fmt.Errorf("no price for item %s", line.ItemCode))
+		}
+		corrected = append(corrected, line)
+	}
+	return corrected, nil
+}
+
+func (q *ReviewQueue) candidate(goods OrderGoods) ReviewCandidate {
+	candidate := ReviewCandidate{ItemCode: goods.ItemCode, Name: goods.ItemName, Price: goods.ItemPrice, Count: goods.Count}
+	if q.Catalog != nil {
+		if product, ok := q.Catalog.Product(goods.ItemCode); ok {
+			candidate.Name = product.Name
+			candidate.CatalogPrice = product.Price.Money
+			candidate.ImgUrl = product.ImgUrl
+		}
+	}
+	return candidate
+}
+
+func (q *ReviewQueue) audit(item *ReviewItem, actor string, action ReviewAuditAction, detail string) {
+	item.Audit = append(item.Audit, ReviewAuditEntry{At: q.now(), Actor: actor, Action: action, Detail: detail})
+}
+
+func (q *ReviewQueue) list() []ReviewItem {
+	items := make([]ReviewItem, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, copyReviewItem(item))
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].EnqueuedAt.Equal(items[j].EnqueuedAt) {
+			return items[i].EnqueuedAt.Before(items[j].EnqueuedAt)
+		}
+		return items[i].OrderCode < items[j].OrderCode
+	})
+	return items
+}
+
+func (q *ReviewQueue) save() error {
+	if err := q.Store.Save(q.list()); err != nil {
+		return NewAinfinitError(fmt.Errorf("save review queue: %w", err))
+	}
+	return nil
+}
+
+func copyReviewItem(item *ReviewItem) ReviewItem {
+	copied := *item
+	copied.Audit = append([]ReviewAuditEntry(nil), item.Audit...)
+	copied.VideoURLs = append([]string(nil), item.VideoURLs...)
+	if item.Decision != nil {
+		decision := *item.Decision
+		copied.Decision = &decision
+	}
+	return copied
+}
+
+func orderGoodsTotal(goods []OrderGoods) (Money, error) {
+	var total Money
+	for _, line := range goods {
+		amount, err := line.ItemPrice.Mul(int64(line.Count))
+		if err != nil {
+			return Money{}, err
+		}
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// sameOrderGoods compares goods lists by item code, count and price, ignoring order
+func sameOrderGoods(a, b []OrderGoods) bool {
+	type line struct {
+		count int
+		price Money
+	}
+	lines := make(map[string]line)
+	for _, g := range a {
+		l := lines[g.ItemCode]
+		l.count += g.Count
+		l.price = g.ItemPrice
+		lines[g.ItemCode] = l
+	}
+	for _, g := range b {
+		l, ok := lines[g.ItemCode]
+		if !ok || !l.price.Equal(g.ItemPrice) {
+			return false
+		}
+		l.count -= g.Count
+		lines[g.ItemCode] = l
+	}
+	for _, l := range lines {
+		if l.count != 0 {
+			return false
+		}
+	}
+	return true
+}
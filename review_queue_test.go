@@ -0,0 +1,135 @@
+package aifinitsdk
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewQueue_ClaimAndResolve(t *testing.T) {
+	catalog := NewCatalog(nil, nil)
+	catalog.replace([]Product{
+		{ItemCode: "COLA", Name: "Cola 330ml", Price: Cents(250), ImgUrl: "https://img/cola.png"},
+		{ItemCode: "COLA-ZERO", Name: "Cola Zero 330ml", Price: Cents(260)},
+		{ItemCode: "WATER", Name: "Water 500ml", Price: Cents(100)},
+	})
+	operations := &fakeVideoClient{fakeGoodsClient: fakeGoodsClient{goods: []Goods{{ItemCode: "WATER", ActualPrice: mnt(1.2)}}}}
+
+	store := &FileReviewStore{Path: filepath.Join(t.TempDir(), "reviews.json")}
+	queue := NewReviewQueue(catalog, operations, store)
+	queue.now = func() time.Time { return time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC) }
+	var events []CorrectedOrderEvent
+	queue.OnCorrected = func(event CorrectedOrderEvent) { events = append(events, event) }
+
+	enqueued, err := queue.HandleOrder(&OrderCallbackRequest{VmCode: "VM1", OrderCode: "O-OK", HandleStatus: HandleStatusLocalSuccess})
+	assert.NoError(t, err)
+	assert.False(t, enqueued)
+
+	order := &OrderCallbackRequest{
+		VmCode: "VM1", OrderCode: "O-1", TradeRequestId: "REQ-1",
+		HandleStatus:    HandleStatusCloudFailure,
+		AbnormalReasons: []AbnormalReason{AbnormalReasonUnknownItem},
+		OrderGoodsList:  []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 1}},
+		Candidates:      []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 1}, {ItemCode: "COLA-ZERO", ItemPrice: mnt(2.6), Count: 1}},
+	}
+	enqueued, err = queue.HandleOrder(order)
+	assert.NoError(t, err)
+	assert.True(t, enqueued)
+	enqueued, _ = queue.HandleOrder(order)
+	assert.False(t, enqueued)
+
+	pending := queue.Pending()
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, ReviewCandidate{ItemCode: "COLA", Name: "Cola 330ml", Price: mnt(2.5), CatalogPrice: mnt(2.5), ImgUrl: "https://img/cola.png", Count: 1}, pending[0].Candidates[0])
+	}
+
+	item, err := queue.Claim("O-1", "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, ReviewStatusClaimed, item.Status)
+	assert.Equal(t, []string{"https://video/REQ-1.mp4"}, item.VideoURLs)
+
+	_, err = queue.Claim("O-1", "bob")
+	assert.ErrorContains(t, err, "claimed by alice")
+	_, err = queue.Resolve("O-1", "bob", nil, "")
+	assert.ErrorContains(t, err, "claimed by alice")
+	_, err = queue.Resolve("O-1", "alice", []OrderGoods{{ItemCode: "UNKNOWN", Count: 1}}, "")
+	assert.ErrorContains(t, err, "not in the catalog")
+
+	event, err := queue.Resolve("O-1", "alice", []OrderGoods{{ItemCode: "COLA-ZERO", Count: 1}, {ItemCode: "WATER", Count: 2}}, "zero on video, plus two waters")
+	assert.NoError(t, err)
+	assert.Equal(t, []OrderGoods{
+		{ItemCode: "COLA-ZERO", ItemName: "Cola Zero 330ml", ItemPrice: mnt(2.6), Count: 1},
+		{ItemCode: "WATER", ItemName: "Water 500ml", ItemPrice: mnt(1.2), Count: 2},
+	}, event.CorrectedGoods)
+	assert.Equal(t, mnt(2.5), event.OriginalTotal)
+	assert.Equal(t, mnt(5.0), event.CorrectedTotal)
+	assert.True(t, event.Changed)
+	assert.Len(t, events, 1)
+	assert.Empty(t, queue.Pending())
+
+	_, err = queue.Resolve("O-1", "alice", nil, "")
+	assert.ErrorContains(t, err, "already resolved")
+
+	// The queue and its audit trail survive a restart
+	restored := NewReviewQueue(catalog, operations, store)
+	assert.NoError(t, restored.Load())
+	item, ok := restored.Item("O-1")
+	if assert.True(t, ok) {
+		assert.Equal(t, ReviewStatusResolved, item.Status)
+		assert.Equal(t, "alice", item.Decision.Reviewer)
+		var actions []ReviewAuditAction
+		for _, entry := range item.Audit {
+			actions = append(actions, entry.Action)
+		}
+		assert.Equal(t, []ReviewAuditAction{ReviewAuditEnqueued, ReviewAuditClaimed, ReviewAuditVideo, ReviewAuditResolved}, actions)
+	}
+}
+
+func TestReviewQueue_ConfirmNothingTaken(t *testing.T) {
+	queue := NewReviewQueue(nil, nil, nil)
+	_, err := queue.HandleOrder(&OrderCallbackRequest{
+		VmCode: "VM1", OrderCode: "O-2", HandleStatus: HandleStatusCloudSuccess,
+		AbnormalReasons: []AbnormalReason{AbnormalReasonForeignInvasion},
+		OrderGoodsList:  []OrderGoods{{ItemCode: "CHIPS", ItemPrice: mnt(3), Count: 1}},
+	})
+	assert.NoError(t, err)
+
+	event, err := queue.Resolve("O-2", "bob", nil, "hand only, nothing taken")
+	assert.NoError(t, err)
+	assert.True(t, event.Changed)
+	assert.True(t, event.CorrectedTotal.IsZero())
+	assert.Equal(t, mnt(3.0), event.OriginalTotal)
+}
+
+// claimingGoodsClient lets another reviewer claim the order while Resolve looks up machine prices
+type claimingGoodsClient struct {
+	fakeGoodsClient
+	claim func()
+}
+
+func (f *claimingGoodsClient) ListGoods(machineCode string) (*GetMachineGoodsResponse, error) {
+	f.claim()
+	return f.fakeGoodsClient.ListGoods(machineCode)
+}
+
+func TestReviewQueue_ResolveClaimedMeanwhile(t *testing.T) {
+	operations := &claimingGoodsClient{fakeGoodsClient: fakeGoodsClient{goods: []Goods{{ItemCode: "WATER", ActualPrice: mnt(1.2)}}}}
+	queue := NewReviewQueue(nil, operations, nil)
+	operations.claim = func() {
+		_, err := queue.Claim("O-3", "bob")
+		assert.NoError(t, err)
+	}
+	_, err := queue.HandleOrder(&OrderCallbackRequest{
+		VmCode: "VM1", OrderCode: "O-3", HandleStatus: HandleStatusCloudFailure,
+		OrderGoodsList: []OrderGoods{{ItemCode: "COLA", ItemPrice: mnt(2.5), Count: 1}},
+	})
+	assert.NoError(t, err)
+
+	_, err = queue.Resolve("O-3", "alice", []OrderGoods{{ItemCode: "WATER", Count: 1}}, "")
+	assert.ErrorContains(t, err, "claimed by bob")
+	item, _ := queue.Item("O-3")
+	assert.Equal(t, ReviewStatusClaimed, item.Status)
+	assert.Nil(t, item.Decision)
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// Memory is a Store that keeps everything in memory, for tests and short-lived tools
+type Memory struct {
+	mu        sync.RWMutex
+	machines  map[string]aifinitsdk.DeviceInfoData
+	goods     map[string]map[string]GoodsSnapshot // by vm code, then item code
+	orders    map[string]aifinitsdk.Order
+	incidents map[string]aifinitsdk.OperationalExceptionNotificationCallbackRequest
+	events    []Event
+	eventKeys map[[2]string]bool
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		machines:  make(map[string]aifinitsdk.DeviceInfoData),
+		goods:     make(map[string]map[string]GoodsSnapshot),
+		orders:    make(map[string]aifinitsdk.Order),
+		incidents: make(map[string]aifinitsdk.OperationalExceptionNotificationCallbackRequest),
+		eventKeys: make(map[[2]string]bool),
+	}
+}
+
+func (m *Memory) UpsertMachine(ctx context.Context, machine aifinitsdk.DeviceInfoData) error {
+	if machine.Code == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("machine has no code"))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.machines[machine.Code] = machine
+	return nil
+}
+
+func (m *Memory) Machine(ctx context.Context, vmCode string) (aifinitsdk.DeviceInfoData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	machine, ok := m.machines[vmCode]
+	if !ok {
+		return aifinitsdk.DeviceInfoData{}, notFound("machine", vmCode)
+	}
+	return machine, nil
+}
+
+func (m *Memory) ListMachines(ctx context.Context) ([]aifinitsdk.DeviceInfoData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	machines := make([]aifinitsdk.DeviceInfoData, 0, len(m.machines))
+	for _, machine := range m.machines {
+		machines = append(machines, machine)
+	}
+	slices.SortFunc(machines, func(a, b aifinitsdk.DeviceInfoData) int { return cmp.Compare(a.Code, b.Code) })
+	return machines, nil
+}
+
+func (m *Memory) UpsertGoods(ctx context.Context, vmCode string, at time.Time, goods []aifinitsdk.Goods) error {
+	if err := validateGoods(vmCode, goods); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshots := m.goods[vmCode]
+	if snapshots == nil {
+		snapshots = make(map[string]GoodsSnapshot)
+		m.goods[vmCode] = snapshots
+	}
+	for _, item := range goods {
+		snapshots[item.ItemCode] = GoodsSnapshot{VmCode: vmCode, Goods: normalizeGoods(item), UpdatedAt: at.Truncate(time.Millisecond)}
+	}
+	return nil
+}
+
+func (m *Memory) ListGoods(ctx context.Context, vmCode string) ([]GoodsSnapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	goods := make([]GoodsSnapshot, 0, len(m.goods[vmCode]))
+	for _, snapshot := range m.goods[vmCode] {
+		goods = append(goods, snapshot)
+	}
+	slices.SortFunc(goods, func(a, b GoodsSnapshot) int { return cmp.Compare(a.ItemCode, b.ItemCode) })
+	return goods, nil
+}
+
+func (m *Memory) UpsertOrder(ctx context.Context, order aifinitsdk.Order) error {
+	if order.OrderCode == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("order has no order code"))
+	}
+	order, _, err := normalizeOrder(order)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.orders[order.OrderCode] = order
+	return nil
+}
+
+func (m *Memory) Order(ctx context.Context, orderCode string) (aifinitsdk.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	order, ok := m.orders[orderCode]
+	if !ok {
+		return aifinitsdk.Order{}, notFound("order", orderCode)
+	}
+	return order, nil
+}
+
+func (m *Memory) ListOrders(ctx context.Context, filter OrderFilter) ([]aifinitsdk.Order, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var orders []aifinitsdk.Order
+	for _, order := range m.orders {
+		if (filter.VmCode == "" || order.VmCode == filter.VmCode) && containsMillis(filter.Range, order.CloseDoorTime) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortFunc(orders, func(a, b aifinitsdk.Order) int {
+		return cmp.Or(cmp.Compare(a.CloseDoorTime.Milliseconds(), b.CloseDoorTime.Milliseconds()), cmp.Compare(a.OrderCode, b.OrderCode))
+	})
+	return orders, nil
+}
+
+func (m *Memory) UpsertIncident(ctx context.Context, incident aifinitsdk.OperationalExceptionNotificationCallbackRequest) error {
+	if incident.ExID == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("incident has no exception ID"))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.incidents[incident.ExID] = incident
+	return nil
+}
+
+func (m *Memory) Incident(ctx context.Context, exID string) (aifinitsdk.OperationalExceptionNotificationCallbackRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	incident, ok := m.incidents[exID]
+	if !ok {
+		return aifinitsdk.OperationalExceptionNotificationCallbackRequest{}, notFound("incident", exID)
+	}
+	return incident, nil
+}
+
+func (m *Memory) ListIncidents(ctx context.Context, filter IncidentFilter) ([]aifinitsdk.OperationalExceptionNotificationCallbackRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var incidents []aifinitsdk.OperationalExceptionNotificationCallbackRequest
+	for _, incident := range m.incidents {
+		if (filter.VmCode == "" || incident.VmCode == filter.VmCode) && containsMillis(filter.Range, incident.SendTime) {
+			incidents = append(incidents, incident)
+		}
+	}
+	slices.SortFunc(incidents, func(a, b aifinitsdk.OperationalExceptionNotificationCallbackRequest) int {
+		return cmp.Or(cmp.Compare(a.SendTime.Milliseconds(), b.SendTime.Milliseconds()), cmp.Compare(a.ExID, b.ExID))
+	})
+	return incidents, nil
+}
+
+func (m *Memory) RecordEvent(ctx context.Context, event *Event) (bool, error) {
+	if event.Kind == "" {
+		return false, aifinitsdk.NewAinfinitError(fmt.Errorf("event has no kind"))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := [2]string{event.Kind, event.Key}
+	if event.Key != "" {
+		if m.eventKeys[key] {
+			return false, nil
+		}
+		m.eventKeys[key] = true
+	}
+	event.ID = int64(len(m.events) + 1)
+	stored := *event
+	stored.ReceivedAt = stored.ReceivedAt.Truncate(time.Millisecond)
+	stored.Payload = slices.Clone(event.Payload)
+	m.events = append(m.events, stored)
+	return true, nil
+}
+
+func (m *Memory) ListEvents(ctx context.Context, filter EventFilter) ([]Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var events []Event
+	for _, event := range m.events {
+		if event.ID <= filter.AfterID || (filter.Kind != "" && event.Kind != filter.Kind) || (filter.VmCode != "" && event.VmCode != filter.VmCode) {
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func notFound(entity, key string) error {
+	return aifinitsdk.NewAinfinitError(fmt.Errorf("%s %s: %w", entity, key, ErrNotFound))
+}
+
+func validateGoods(vmCode string, goods []aifinitsdk.Goods) error {
+	if vmCode == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("goods have no machine code"))
+	}
+	for _, item := range goods {
+		if item.ItemCode == "" {
+			return aifinitsdk.NewAinfinitError(fmt.Errorf("goods of %s include an item without item code", vmCode))
+		}
+	}
+	return nil
+}
+
+// containsMillis matches a range against a timestamp at the millisecond precision the SQL stores keep
+func containsMillis(r aifinitsdk.TimeRange, m aifinitsdk.Millis) bool {
+	ms := m.Milliseconds()
+	return (r.From.IsZero() || ms >= r.From.UnixMilli()) && (r.To.IsZero() || ms <= r.To.UnixMilli())
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+var postgresDialect = dialect{
+	name: "postgres",
+	migrations: []string{
+		`CREATE TABLE machines (
+			vm_code TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			data JSONB NOT NULL
+		);
+		CREATE TABLE goods (
+			vm_code TEXT NOT NULL,
+			item_code TEXT NOT NULL,
+			count INTEGER NOT NULL,
+			actual_price BIGINT NOT NULL,
+			original_price BIGINT NOT NULL,
+			currency TEXT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			PRIMARY KEY (vm_code, item_code)
+		);
+		CREATE TABLE orders (
+			order_code TEXT PRIMARY KEY,
+			vm_code TEXT NOT NULL,
+			trade_request_id TEXT NOT NULL,
+			handle_status INTEGER NOT NULL,
+			total_fee BIGINT NOT NULL,
+			currency TEXT NOT NULL,
+			close_door_time BIGINT NOT NULL,
+			goods JSONB NOT NULL,
+			data JSONB NOT NULL
+		);
+		CREATE INDEX orders_vm_code_close_door_time ON orders (vm_code, close_door_time);
+		CREATE INDEX orders_close_door_time ON orders (close_door_time);
+		CREATE TABLE incidents (
+			ex_id TEXT PRIMARY KEY,
+			vm_code TEXT NOT NULL,
+			ex_type INTEGER NOT NULL,
+			send_time BIGINT NOT NULL,
+			data JSONB NOT NULL
+		);
+		CREATE INDEX incidents_vm_code_send_time ON incidents (vm_code, send_time);
+		CREATE TABLE events (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			kind TEXT NOT NULL,
+			event_key TEXT,
+			vm_code TEXT NOT NULL,
+			received_at BIGINT NOT NULL,
+			payload JSON NOT NULL
+		);
+		CREATE UNIQUE INDEX events_kind_event_key ON events (kind, event_key);
+		CREATE INDEX events_vm_code_id ON events (vm_code, id);`,
+	},
+}
+
+// OpenPostgres connects to and migrates a Postgres store. The DSN is a URL or key=value string as
+// accepted by pgx. Event payloads are kept as JSON, not JSONB, so that they read back verbatim.
+func OpenPostgres(ctx context.Context, dsn string) (*SQLStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("open postgres: %w", err))
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("open postgres: %w", err))
+	}
+	return newSQLStore(ctx, db, postgresDialect)
+}
@@ -0,0 +1,446 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// SQLStore is a Store on a SQL database. Both dialects share the queries, which stick to numbered
+// placeholders and ON CONFLICT upserts; only the schema differs.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+type dialect struct {
+	name string
+	// migrations are applied in order, each once; append new ones, never edit applied ones
+	migrations []string
+}
+
+// newSQLStore migrates the database and wraps it
+func newSQLStore(ctx context.Context, db *sql.DB, d dialect) (*SQLStore, error) {
+	s := &SQLStore{db: db, dialect: d}
+	if err := s.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// DB returns the underlying database, for queries the repositories do not cover
+func (s *SQLStore) DB() *sql.DB {
+	return s.db
+}
+
+// Migrate applies the schema migrations not applied yet. Opening a store migrates it already.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at BIGINT NOT NULL)`); err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("create schema_migrations: %w", err))
+	}
+	var applied int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&applied); err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("read schema version: %w", err))
+	}
+
+	for i := applied; i < len(s.dialect.migrations); i++ {
+		version := i + 1
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, s.dialect.migrations[i]); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, time.Now().UnixMilli())
+			return err
+		})
+		if err != nil {
+			return aifinitsdk.NewAinfinitError(fmt.Errorf("%s migration %d: %w", s.dialect.name, version, err))
+		}
+		logrus.WithFields(logrus.Fields{"dialect": s.dialect.name, "version": version}).Debug("Applied store migration")
+	}
+	return nil
+}
+
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) UpsertMachine(ctx context.Context, machine aifinitsdk.DeviceInfoData) error {
+	if machine.Code == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("machine has no code"))
+	}
+	data, err := json.Marshal(machine)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(err)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO machines (vm_code, name, data) VALUES ($1, $2, $3)
+		ON CONFLICT (vm_code) DO UPDATE SET name = excluded.name, data = excluded.data`,
+		machine.Code, machine.Name, string(data))
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("upsert machine %s: %w", machine.Code, err))
+	}
+	return nil
+}
+
+func (s *SQLStore) Machine(ctx context.Context, vmCode string) (aifinitsdk.DeviceInfoData, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM machines WHERE vm_code = $1`, vmCode).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return aifinitsdk.DeviceInfoData{}, notFound("machine", vmCode)
+	}
+	var machine aifinitsdk.DeviceInfoData
+	if err == nil {
+		err = json.Unmarshal([]byte(data), &machine)
+	}
+	if err != nil {
+		return aifinitsdk.DeviceInfoData{}, aifinitsdk.NewAinfinitError(fmt.Errorf("read machine %s: %w", vmCode, err))
+	}
+	return machine, nil
+}
+
+func (s *SQLStore) ListMachines(ctx context.Context) ([]aifinitsdk.DeviceInfoData, error) {
+	machines, err := queryJSON[aifinitsdk.DeviceInfoData](ctx, s.db, `SELECT data FROM machines ORDER BY vm_code`)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list machines: %w", err))
+	}
+	return machines, nil
+}
+
+func (s *SQLStore) UpsertGoods(ctx context.Context, vmCode string, at time.Time, goods []aifinitsdk.Goods) error {
+	if err := validateGoods(vmCode, goods); err != nil {
+		return err
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, item := range goods {
+			_, err := tx.ExecContext(ctx, `INSERT INTO goods (vm_code, item_code, count, actual_price, original_price, currency, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				ON CONFLICT (vm_code, item_code) DO UPDATE SET count = excluded.count, actual_price = excluded.actual_price,
+					original_price = excluded.original_price, currency = excluded.currency, updated_at = excluded.updated_at`,
+				vmCode, item.ItemCode, item.Count, item.ActualPrice.Minor, item.OriginalPrice.Minor, goodsCurrency(item), at.UnixMilli())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("upsert goods of %s: %w", vmCode, err))
+	}
+	return nil
+}
+
+func (s *SQLStore) ListGoods(ctx context.Context, vmCode string) ([]GoodsSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT item_code, count, actual_price, original_price, currency, updated_at
+		FROM goods WHERE vm_code = $1 ORDER BY item_code`, vmCode)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list goods of %s: %w", vmCode, err))
+	}
+	defer rows.Close()
+
+	var goods []GoodsSnapshot
+	for rows.Next() {
+		snapshot := GoodsSnapshot{VmCode: vmCode}
+		var actual, original, updatedAt int64
+		var currency string
+		if err := rows.Scan(&snapshot.ItemCode, &snapshot.Count, &actual, &original, &currency, &updatedAt); err != nil {
+			return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list goods of %s: %w", vmCode, err))
+		}
+		snapshot.ActualPrice = money(actual, currency)
+		snapshot.OriginalPrice = money(original, currency)
+		snapshot.UpdatedAt = time.UnixMilli(updatedAt)
+		goods = append(goods, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list goods of %s: %w", vmCode, err))
+	}
+	return goods, nil
+}
+
+// orderGoods is a stored order line. Prices are kept in minor units, which the wire format of
+// Money does not preserve for every currency.
+type orderGoods struct {
+	ItemCode      string `json:"itemCode"`
+	ActualPrice   int64  `json:"actualPrice"`
+	OriginalPrice int64  `json:"originalPrice,omitempty"`
+	Count         int    `json:"count"`
+}
+
+func (s *SQLStore) UpsertOrder(ctx context.Context, order aifinitsdk.Order) error {
+	if order.OrderCode == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("order has no order code"))
+	}
+	order, currency, err := normalizeOrder(order)
+	if err != nil {
+		return err
+	}
+	lines := make([]orderGoods, 0, len(order.OrderGoodsList))
+	for _, item := range order.OrderGoodsList {
+		lines = append(lines, orderGoods{ItemCode: item.ItemCode, ActualPrice: item.ActualPrice.Minor, OriginalPrice: item.OriginalPrice.Minor, Count: item.Count})
+	}
+	goods, err := json.Marshal(lines)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(err)
+	}
+	// The amounts live in their own columns
+	rest := order
+	rest.TotalFee = aifinitsdk.Money{}
+	rest.OrderGoodsList = nil
+	data, err := json.Marshal(rest)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `INSERT INTO orders (order_code, vm_code, trade_request_id, handle_status, total_fee, currency, close_door_time, goods, data)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (order_code) DO UPDATE SET vm_code = excluded.vm_code, trade_request_id = excluded.trade_request_id,
+			handle_status = excluded.handle_status, total_fee = excluded.total_fee, currency = excluded.currency,
+			close_door_time = excluded.close_door_time, goods = excluded.goods, data = excluded.data`,
+		order.OrderCode, order.VmCode, order.TradeRequestId, order.HandleStatus, order.TotalFee.Minor, currency,
+		order.CloseDoorTime.Milliseconds(), string(goods), string(data))
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("upsert order %s: %w", order.OrderCode, err))
+	}
+	return nil
+}
+
+func (s *SQLStore) Order(ctx context.Context, orderCode string) (aifinitsdk.Order, error) {
+	orders, err := s.queryOrders(ctx, `WHERE order_code = $1`, orderCode)
+	if err != nil {
+		return aifinitsdk.Order{}, aifinitsdk.NewAinfinitError(fmt.Errorf("read order %s: %w", orderCode, err))
+	}
+	if len(orders) == 0 {
+		return aifinitsdk.Order{}, notFound("order", orderCode)
+	}
+	return orders[0], nil
+}
+
+func (s *SQLStore) ListOrders(ctx context.Context, filter OrderFilter) ([]aifinitsdk.Order, error) {
+	var where conditions
+	if filter.VmCode != "" {
+		where.add("vm_code =", filter.VmCode)
+	}
+	where.addRange("close_door_time", filter.Range)
+	orders, err := s.queryOrders(ctx, where.String()+` ORDER BY close_door_time, order_code`, where.args...)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list orders: %w", err))
+	}
+	return orders, nil
+}
+
+func (s *SQLStore) queryOrders(ctx context.Context, clause string, args ...any) ([]aifinitsdk.Order, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT total_fee, currency, goods, data FROM orders `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []aifinitsdk.Order
+	for rows.Next() {
+		var totalFee int64
+		var currency, goods, data string
+		if err := rows.Scan(&totalFee, &currency, &goods, &data); err != nil {
+			return nil, err
+		}
+		var order aifinitsdk.Order
+		if err := json.Unmarshal([]byte(data), &order); err != nil {
+			return nil, err
+		}
+		var lines []orderGoods
+		if err := json.Unmarshal([]byte(goods), &lines); err != nil {
+			return nil, err
+		}
+		order.TotalFee = money(totalFee, currency)
+		for _, line := range lines {
+			order.OrderGoodsList = append(order.OrderGoodsList, aifinitsdk.Goods{
+				ItemCode:      line.ItemCode,
+				ActualPrice:   money(line.ActualPrice, currency),
+				OriginalPrice: money(line.OriginalPrice, currency),
+				Count:         line.Count,
+			})
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func (s *SQLStore) UpsertIncident(ctx context.Context, incident aifinitsdk.OperationalExceptionNotificationCallbackRequest) error {
+	if incident.ExID == "" {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("incident has no exception ID"))
+	}
+	data, err := json.Marshal(incident)
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(err)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO incidents (ex_id, vm_code, ex_type, send_time, data) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (ex_id) DO UPDATE SET vm_code = excluded.vm_code, ex_type = excluded.ex_type, send_time = excluded.send_time, data = excluded.data`,
+		incident.ExID, incident.VmCode, int(incident.ExType), incident.SendTime.Milliseconds(), string(data))
+	if err != nil {
+		return aifinitsdk.NewAinfinitError(fmt.Errorf("upsert incident %s: %w", incident.ExID, err))
+	}
+	return nil
+}
+
+func (s *SQLStore) Incident(ctx context.Context, exID string) (aifinitsdk.OperationalExceptionNotificationCallbackRequest, error) {
+	incidents, err := queryJSON[aifinitsdk.OperationalExceptionNotificationCallbackRequest](ctx, s.db, `SELECT data FROM incidents WHERE ex_id = $1`, exID)
+	if err != nil {
+		return aifinitsdk.OperationalExceptionNotificationCallbackRequest{}, aifinitsdk.NewAinfinitError(fmt.Errorf("read incident %s: %w", exID, err))
+	}
+	if len(incidents) == 0 {
+		return aifinitsdk.OperationalExceptionNotificationCallbackRequest{}, notFound("incident", exID)
+	}
+	return incidents[0], nil
+}
+
+func (s *SQLStore) ListIncidents(ctx context.Context, filter IncidentFilter) ([]aifinitsdk.OperationalExceptionNotificationCallbackRequest, error) {
+	var where conditions
+	if filter.VmCode != "" {
+		where.add("vm_code =", filter.VmCode)
+	}
+	where.addRange("send_time", filter.Range)
+	incidents, err := queryJSON[aifinitsdk.OperationalExceptionNotificationCallbackRequest](ctx, s.db,
+		`SELECT data FROM incidents `+where.String()+` ORDER BY send_time, ex_id`, where.args...)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list incidents: %w", err))
+	}
+	return incidents, nil
+}
+
+func (s *SQLStore) RecordEvent(ctx context.Context, event *Event) (bool, error) {
+	if event.Kind == "" {
+		return false, aifinitsdk.NewAinfinitError(fmt.Errorf("event has no kind"))
+	}
+	// A NULL key never conflicts, so keyless events are always appended
+	var key sql.NullString
+	if event.Key != "" {
+		key = sql.NullString{String: event.Key, Valid: true}
+	}
+	payload := string(event.Payload)
+	if payload == "" {
+		payload = "null"
+	}
+
+	var id int64
+	err := s.db.QueryRowContext(ctx, `INSERT INTO events (kind, event_key, vm_code, received_at, payload) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, event_key) DO NOTHING RETURNING id`,
+		event.Kind, key, event.VmCode, event.ReceivedAt.UnixMilli(), payload).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, aifinitsdk.NewAinfinitError(fmt.Errorf("record %s event: %w", event.Kind, err))
+	}
+	event.ID = id
+	return true, nil
+}
+
+func (s *SQLStore) ListEvents(ctx context.Context, filter EventFilter) ([]Event, error) {
+	var where conditions
+	where.add("id >", filter.AfterID)
+	if filter.Kind != "" {
+		where.add("kind =", filter.Kind)
+	}
+	if filter.VmCode != "" {
+		where.add("vm_code =", filter.VmCode)
+	}
+	query := `SELECT id, kind, event_key, vm_code, received_at, payload FROM events ` + where.String() + ` ORDER BY id`
+	if filter.Limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list events: %w", err))
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var key sql.NullString
+		var receivedAt int64
+		var payload string
+		if err := rows.Scan(&event.ID, &event.Kind, &key, &event.VmCode, &receivedAt, &payload); err != nil {
+			return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list events: %w", err))
+		}
+		event.Key = key.String
+		event.ReceivedAt = time.UnixMilli(receivedAt)
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("list events: %w", err))
+	}
+	return events, nil
+}
+
+// conditions builds a WHERE clause with numbered placeholders
+type conditions struct {
+	clauses []string
+	args    []any
+}
+
+// add appends a condition; the placeholder follows the column and operator
+func (c *conditions) add(columnOperator string, arg any) {
+	c.args = append(c.args, arg)
+	c.clauses = append(c.clauses, fmt.Sprintf("%s $%d", columnOperator, len(c.args)))
+}
+
+// addRange matches a unix millisecond column against a time range
+func (c *conditions) addRange(column string, r aifinitsdk.TimeRange) {
+	if !r.From.IsZero() {
+		c.add(column+" >=", r.From.UnixMilli())
+	}
+	if !r.To.IsZero() {
+		c.add(column+" <=", r.To.UnixMilli())
+	}
+}
+
+func (c *conditions) String() string {
+	if len(c.clauses) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(c.clauses, " AND ")
+}
+
+// queryJSON decodes a single JSON column from every row
+func queryJSON[T any](ctx context.Context, db *sql.DB, query string, args ...any) ([]T, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []T
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var value T
+		if err := json.Unmarshal([]byte(data), &value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
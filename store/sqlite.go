@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/techpartners-asia/aifinitsdk"
+	_ "modernc.org/sqlite"
+)
+
+var sqliteDialect = dialect{
+	name: "sqlite",
+	migrations: []string{
+		`CREATE TABLE machines (
+			vm_code TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			data TEXT NOT NULL
+		);
+		CREATE TABLE goods (
+			vm_code TEXT NOT NULL,
+			item_code TEXT NOT NULL,
+			count INTEGER NOT NULL,
+			actual_price INTEGER NOT NULL,
+			original_price INTEGER NOT NULL,
+			currency TEXT NOT NULL,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (vm_code, item_code)
+		);
+		CREATE TABLE orders (
+			order_code TEXT PRIMARY KEY,
+			vm_code TEXT NOT NULL,
+			trade_request_id TEXT NOT NULL,
+			handle_status INTEGER NOT NULL,
+			total_fee INTEGER NOT NULL,
+			currency TEXT NOT NULL,
+			close_door_time INTEGER NOT NULL,
+			goods TEXT NOT NULL,
+			data TEXT NOT NULL
+		);
+		CREATE INDEX orders_vm_code_close_door_time ON orders (vm_code, close_door_time);
+		CREATE INDEX orders_close_door_time ON orders (close_door_time);
+		CREATE TABLE incidents (
+			ex_id TEXT PRIMARY KEY,
+			vm_code TEXT NOT NULL,
+			ex_type INTEGER NOT NULL,
+			send_time INTEGER NOT NULL,
+			data TEXT NOT NULL
+		);
+		CREATE INDEX incidents_vm_code_send_time ON incidents (vm_code, send_time);
+		CREATE TABLE events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			event_key TEXT,
+			vm_code TEXT NOT NULL,
+			received_at INTEGER NOT NULL,
+			payload TEXT NOT NULL
+		);
+		CREATE UNIQUE INDEX events_kind_event_key ON events (kind, event_key);
+		CREATE INDEX events_vm_code_id ON events (vm_code, id);`,
+	},
+}
+
+// OpenSQLite opens, creating it if needed, and migrates a SQLite store in a file. The driver is
+// pure Go, so no cgo is needed.
+func OpenSQLite(ctx context.Context, path string) (*SQLStore, error) {
+	// Writers wait for each other instead of failing with SQLITE_BUSY
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("open sqlite %s: %w", path, err))
+	}
+	// SQLite has a single writer; one connection keeps transactions from tripping over each other
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, aifinitsdk.NewAinfinitError(fmt.Errorf("open sqlite %s: %w", path, err))
+	}
+	return newSQLStore(ctx, db, sqliteDialect)
+}
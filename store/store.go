@@ -0,0 +1,203 @@
+// Package store persists the SDK's entities: machines, goods snapshots, orders, incidents and
+// webhook events. Store is implemented in memory, on SQLite (pure Go, no cgo) and on Postgres.
+// Writes are upserts keyed by the platform's identifiers: VmCode for machines, VmCode and itemCode
+// for goods, OrderCode for orders and ExID for incidents.
+package store
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/techpartners-asia/aifinitsdk"
+)
+
+// ErrNotFound is returned when no entity has the requested key
+var ErrNotFound = errors.New("not found")
+
+// GoodsSnapshot is the last seen stock of one item in one machine
+type GoodsSnapshot struct {
+	VmCode string `json:"vmCode"`
+	aifinitsdk.Goods
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// OrderFilter selects orders; zero fields match everything
+type OrderFilter struct {
+	VmCode string
+	// Range is matched against the close door time
+	Range aifinitsdk.TimeRange
+}
+
+// IncidentFilter selects incidents; zero fields match everything
+type IncidentFilter struct {
+	VmCode string
+	// Range is matched against the send time
+	Range aifinitsdk.TimeRange
+}
+
+// Event is a received webhook, kept verbatim
+type Event struct {
+	ID int64 `json:"id"` // assigned when recorded, increasing
+	// Kind names the webhook, e.g. "order" or an AlarmAction
+	Kind string `json:"kind"`
+	// Key identifies the delivery, e.g. an order code or exception ID. A delivery with a kind and key
+	// already recorded is a duplicate; an empty key is never a duplicate.
+	Key        string          `json:"key,omitempty"`
+	VmCode     string          `json:"vmCode,omitempty"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// EventFilter selects events; zero fields match everything
+type EventFilter struct {
+	Kind   string
+	VmCode string
+	// AfterID returns only events recorded after this one, for paging and tailing
+	AfterID int64
+	// Limit caps the number of events, 0 means no limit
+	Limit int
+}
+
+// MachineRepository stores machines keyed by their code
+type MachineRepository interface {
+	UpsertMachine(ctx context.Context, machine aifinitsdk.DeviceInfoData) error
+	Machine(ctx context.Context, vmCode string) (aifinitsdk.DeviceInfoData, error)
+	// ListMachines returns every machine by code
+	ListMachines(ctx context.Context) ([]aifinitsdk.DeviceInfoData, error)
+}
+
+// GoodsRepository stores the latest stock per machine and item
+type GoodsRepository interface {
+	// UpsertGoods records the machine's stock of the given items as seen at a time. Items left out
+	// keep their previous snapshot.
+	UpsertGoods(ctx context.Context, vmCode string, at time.Time, goods []aifinitsdk.Goods) error
+	// ListGoods returns the machine's snapshots by item code
+	ListGoods(ctx context.Context, vmCode string) ([]GoodsSnapshot, error)
+}
+
+// OrderRepository stores orders keyed by order code
+type OrderRepository interface {
+	UpsertOrder(ctx context.Context, order aifinitsdk.Order) error
+	Order(ctx context.Context, orderCode string) (aifinitsdk.Order, error)
+	// ListOrders returns the matching orders by close door time, then order code
+	ListOrders(ctx context.Context, filter OrderFilter) ([]aifinitsdk.Order, error)
+}
+
+// IncidentRepository stores operational exceptions keyed by ExID. The follow-up notification of an
+// exception, which carries its video, replaces the first.
+type IncidentRepository interface {
+	UpsertIncident(ctx context.Context, incident aifinitsdk.OperationalExceptionNotificationCallbackRequest) error
+	Incident(ctx context.Context, exID string) (aifinitsdk.OperationalExceptionNotificationCallbackRequest, error)
+	// ListIncidents returns the matching incidents by send time, then ExID
+	ListIncidents(ctx context.Context, filter IncidentFilter) ([]aifinitsdk.OperationalExceptionNotificationCallbackRequest, error)
+}
+
+// EventRepository is an append-only log of webhook deliveries
+type EventRepository interface {
+	// RecordEvent appends the event and sets its ID. It reports false, leaving the log unchanged,
+	// when the delivery is a duplicate.
+	RecordEvent(ctx context.Context, event *Event) (bool, error)
+	// ListEvents returns the matching events by ID
+	ListEvents(ctx context.Context, filter EventFilter) ([]Event, error)
+}
+
+// Store holds every repository
+type Store interface {
+	MachineRepository
+	GoodsRepository
+	OrderRepository
+	IncidentRepository
+	EventRepository
+	Close() error
+}
+
+// OrderFromCallback converts an order settlement callback into the order stored for it, so that
+// webhook and ListOrders orders share one table
+func OrderFromCallback(callback *aifinitsdk.OrderCallbackRequest) (aifinitsdk.Order, error) {
+	order := aifinitsdk.Order{
+		TradeRequestId:  callback.TradeRequestId,
+		OrderCode:       callback.OrderCode,
+		VmCode:          callback.VmCode,
+		UserCode:        callback.UserCode,
+		HandleStatus:    int(callback.HandleStatus),
+		ShopMove:        int(callback.ShopMove),
+		OpenDoorTime:    callback.OpenDoorTime,
+		CloseDoorTime:   callback.CloseDoorTime,
+		OpenDoorWeight:  callback.OpenDoorWeight,
+		CloseDoorWeight: callback.CloseDoorWeight,
+	}
+	amounts := make([]aifinitsdk.Money, 0, len(callback.OrderGoodsList))
+	for _, item := range callback.OrderGoodsList {
+		order.OrderGoodsList = append(order.OrderGoodsList, aifinitsdk.Goods{ItemCode: item.ItemCode, ActualPrice: item.ItemPrice, Count: item.Count})
+		amount, err := item.ItemPrice.Mul(int64(item.Count))
+		if err != nil {
+			return aifinitsdk.Order{}, aifinitsdk.NewAinfinitError(err)
+		}
+		amounts = append(amounts, amount)
+	}
+	total, err := aifinitsdk.SumMoney(amounts...)
+	if err != nil {
+		return aifinitsdk.Order{}, aifinitsdk.NewAinfinitError(err)
+	}
+	order.TotalFee = total
+	return order, nil
+}
+
+// money rebuilds a stored amount. Every store returns amounts this way: zero without a currency and
+// others with an explicit one.
+func money(minor int64, currency string) aifinitsdk.Money {
+	if minor == 0 {
+		return aifinitsdk.Money{}
+	}
+	return aifinitsdk.NewMoney(minor, cmp.Or(currency, aifinitsdk.DefaultCurrency))
+}
+
+// goodsCurrency is the currency of an item's prices
+func goodsCurrency(item aifinitsdk.Goods) string {
+	if item.ActualPrice.IsZero() && !item.OriginalPrice.IsZero() {
+		return item.OriginalPrice.CurrencyCode()
+	}
+	return item.ActualPrice.CurrencyCode()
+}
+
+func normalizeGoods(item aifinitsdk.Goods) aifinitsdk.Goods {
+	currency := goodsCurrency(item)
+	item.ActualPrice = money(item.ActualPrice.Minor, currency)
+	item.OriginalPrice = money(item.OriginalPrice.Minor, currency)
+	return item
+}
+
+// normalizeOrder checks that an order's amounts share one currency, which it returns along with
+// the order as the stores return it
+func normalizeOrder(order aifinitsdk.Order) (aifinitsdk.Order, string, error) {
+	amounts := []aifinitsdk.Money{order.TotalFee}
+	for _, item := range order.OrderGoodsList {
+		amounts = append(amounts, item.ActualPrice, item.OriginalPrice)
+	}
+	currency := ""
+	for _, amount := range amounts {
+		if amount.IsZero() {
+			continue
+		}
+		if currency == "" {
+			currency = amount.CurrencyCode()
+		} else if amount.CurrencyCode() != currency {
+			return order, "", aifinitsdk.NewAinfinitError(fmt.Errorf("order %s: %w: %s and %s", order.OrderCode, aifinitsdk.ErrCurrencyMismatch, currency, amount.CurrencyCode()))
+		}
+	}
+	currency = cmp.Or(currency, aifinitsdk.DefaultCurrency)
+
+	goods := make([]aifinitsdk.Goods, 0, len(order.OrderGoodsList))
+	for _, item := range order.OrderGoodsList {
+		item.ActualPrice = money(item.ActualPrice.Minor, currency)
+		item.OriginalPrice = money(item.OriginalPrice.Minor, currency)
+		goods = append(goods, item)
+	}
+	order.TotalFee = money(order.TotalFee.Minor, currency)
+	order.OrderGoodsList = goods
+	return order, currency, nil
+}
@@ -0,0 +1,61 @@
+package aifinitsdk
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/go-playground/validator"
+)
+
+// Temperature ranges accepted by RefrigerationControl, depending on TempMode
+const (
+	RefrigerationTempMin = -28
+	RefrigerationTempMax = -18
+	HeatingTempMin       = 30
+	HeatingTempMax       = 50
+)
+
+// Temperature modes accepted by RefrigerationControl
+const (
+	TempModeNormal                    = 0
+	TempModeRefrigeration             = 10
+	TempModeRefrigerationEnergySaving = 11
+	TempModeHeating                   = 20
+	TempModeHeatingEnergySaving       = 21
+)
+
+var (
+	requestValidatorOnce sync.Once
+	requestValidator     *validator.Validate
+)
+
+// Int returns a pointer to v, for optional request fields where an explicit zero must reach the machine
+func Int(v int) *int {
+	return &v
+}
+
+// validateRequest runs tag validation plus the cross-field rules registered for device commands
+func validateRequest(request interface{}) error {
+	requestValidatorOnce.Do(func() {
+		requestValidator = validator.New()
+		requestValidator.RegisterStructValidation(validateRefrigerationControl, RefrigerationControlRequest{})
+	})
+
+	return requestValidator.Struct(request)
+}
+
+// validateRefrigerationControl enforces the temperature range that matches the selected TempMode
+func validateRefrigerationControl(sl validator.StructLevel) {
+	request := sl.Current().Interface().(RefrigerationControlRequest)
+
+	switch request.TempMode {
+	case TempModeRefrigeration, TempModeRefrigerationEnergySaving:
+		if request.Temp < RefrigerationTempMin || request.Temp > RefrigerationTempMax {
+			sl.ReportError(request.Temp, "temp", "Temp", "refrigeration_temp", fmt.Sprintf("%d~%d", RefrigerationTempMin, RefrigerationTempMax))
+		}
+	case TempModeHeating, TempModeHeatingEnergySaving:
+		if request.Temp < HeatingTempMin || request.Temp > HeatingTempMax {
+			sl.ReportError(request.Temp, "temp", "Temp", "heating_temp", fmt.Sprintf("%d~%d", HeatingTempMin, HeatingTempMax))
+		}
+	}
+}
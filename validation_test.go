@@ -0,0 +1,70 @@
+package aifinitsdk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDeviceControlRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request DeviceControlRequest
+		wantErr bool
+	}{
+		{name: "empty", request: DeviceControlRequest{}},
+		{name: "mute and compressor off", request: DeviceControlRequest{Volume: Int(0), AdVolume: Int(0), EngineOn: Int(0)}},
+		{name: "max values", request: DeviceControlRequest{Volume: Int(100), AdVolume: Int(100), Temp: Int(20), EngineOn: Int(1)}},
+		{name: "min temp", request: DeviceControlRequest{Temp: Int(-30)}},
+		{name: "volume too high", request: DeviceControlRequest{Volume: Int(101)}, wantErr: true},
+		{name: "negative ad volume", request: DeviceControlRequest{AdVolume: Int(-1)}, wantErr: true},
+		{name: "temp too low", request: DeviceControlRequest{Temp: Int(-31)}, wantErr: true},
+		{name: "engine on invalid", request: DeviceControlRequest{EngineOn: Int(2)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequest(&tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateRefrigerationControlRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request RefrigerationControlRequest
+		wantErr bool
+	}{
+		{name: "normal mode ignores temp", request: RefrigerationControlRequest{TempMode: TempModeNormal, Temp: 5}},
+		{name: "refrigeration in range", request: RefrigerationControlRequest{TempMode: TempModeRefrigeration, Temp: -20, ComprEnable: 1}},
+		{name: "energy saving upper bound", request: RefrigerationControlRequest{TempMode: TempModeRefrigerationEnergySaving, Temp: -18}},
+		{name: "refrigeration too warm", request: RefrigerationControlRequest{TempMode: TempModeRefrigeration, Temp: 4}, wantErr: true},
+		{name: "heating in range", request: RefrigerationControlRequest{TempMode: TempModeHeating, Temp: 45}},
+		{name: "heating energy saving too cold", request: RefrigerationControlRequest{TempMode: TempModeHeatingEnergySaving, Temp: -20}, wantErr: true},
+		{name: "unknown mode", request: RefrigerationControlRequest{TempMode: 12}, wantErr: true},
+		{name: "invalid compressor flag", request: RefrigerationControlRequest{ComprEnable: 3}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequest(tt.request)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeviceControlRequest_SendsExplicitZero(t *testing.T) {
+	body, err := json.Marshal(DeviceControlRequest{Volume: Int(0), EngineOn: Int(0)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"volume":0,"engineOn":0}`, string(body))
+}
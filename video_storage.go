@@ -0,0 +1,277 @@
+package aifinitsdk
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VideoStorage stores archived video clips under slash separated keys
+type VideoStorage interface {
+	// Put stores size bytes read from body. Implementations must reject content whose length or
+	// SHA-256 (hex encoded) does not match.
+	Put(ctx context.Context, key string, body io.Reader, size int64, sha256Hex string) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// FileVideoStorage keeps clips below a local directory
+type FileVideoStorage struct {
+	Dir string
+}
+
+func (s *FileVideoStorage) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid video key %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s *FileVideoStorage) Put(ctx context.Context, key string, body io.Reader, size int64, sha256Hex string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	digest := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, digest), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := verifyVideoContent(key, written, size, digest, sha256Hex); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileVideoStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *FileVideoStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// S3VideoStorage keeps clips in an S3 compatible bucket (AWS, MinIO, R2, ...), addressed path style
+// and signed with AWS Signature Version 4. The SHA-256 sent with every upload lets the server
+// reject corrupted content.
+type S3VideoStorage struct {
+	// Endpoint such as https://s3.eu-central-1.amazonaws.com or http://localhost:9000
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only needed for temporary credentials
+	SessionToken string
+	// Prefix is prepended to every key
+	Prefix     string
+	HTTPClient *http.Client
+
+	now func() time.Time
+}
+
+const emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3VideoStorage) Put(ctx context.Context, key string, body io.Reader, size int64, sha256Hex string) error {
+	req, err := s.request(ctx, http.MethodPut, key, io.NopCloser(body), sha256Hex)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3VideoStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil, emptyPayloadSHA256)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3VideoStorage) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil, emptyPayloadSHA256)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3VideoStorage) request(ctx context.Context, method, key string, body io.ReadCloser, payloadSHA256 string) (*http.Request, error) {
+	if s.Bucket == "" || key == "" {
+		return nil, fmt.Errorf("s3 bucket and key are required")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(s.Endpoint, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+		req.Header.Set("Content-Type", "video/mp4")
+	}
+	// Set the escaped path explicitly so the request line matches the signed canonical URI
+	objectPath := "/" + s3Escape(s.Bucket) + "/" + s3Escape(s.Prefix+key)
+	req.URL.Path = "/" + s.Bucket + "/" + s.Prefix + key
+	req.URL.RawPath = objectPath
+	s.sign(req, objectPath, payloadSHA256)
+	return req, nil
+}
+
+func (s *S3VideoStorage) do(req *http.Request) (*http.Response, error) {
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 authorization header
+func (s *S3VideoStorage) sign(req *http.Request, canonicalURI, payloadSHA256 string) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadSHA256)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		"", // no query string
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadSHA256,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestDigest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestDigest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything but unreserved characters and slashes
+func s3Escape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func verifyVideoContent(key string, written, size int64, digest hash.Hash, sha256Hex string) error {
+	if size >= 0 && written != size {
+		return fmt.Errorf("video %s: got %d bytes, expected %d", key, written, size)
+	}
+	if sum := hex.EncodeToString(digest.Sum(nil)); sha256Hex != "" && !strings.EqualFold(sum, sha256Hex) {
+		return fmt.Errorf("video %s: sha256 %s, expected %s", key, sum, sha256Hex)
+	}
+	return nil
+}